@@ -0,0 +1,98 @@
+// abort.go contains the abort conditions, which are evaluated while the run is in progress and stop it early,
+// instead of burning the whole request budget against a dead target or without any proxies.
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// consecutiveFailures counts the requests that failed in a row, over all threads
+var consecutiveFailures int64
+
+// abortReason holds why the run was aborted; it is empty if the run was not aborted
+var abortReason string
+
+// abortOnce ensures the run is aborted only once, with the first reason
+var abortOnce sync.Once
+
+// abortRun stops the run early for the given reason.
+func abortRun(format string, args ...interface{}) {
+	abortOnce.Do(func() {
+		abortReason = fmt.Sprintf(format, args...)
+		slog.Warn("Aborting the run", "component", componentMain, "reason", abortReason)
+		if dashboardEnabled {
+			noteError("ABORTING: %s", abortReason)
+		} else {
+			fmt.Printf("\nABORTING: %s\n", abortReason)
+		}
+		requestStop()
+	})
+}
+
+// countConsecutiveFailure counts the outcome of a request towards the consecutive failures,
+// and aborts the run once abortConsecutiveFailures requests failed in a row.
+func countConsecutiveFailure(failed bool) {
+	if abortConsecutiveFailures <= 0 {
+		return
+	}
+	if !failed {
+		// Only write when there is a streak to reset, so successes do not contend on the counter
+		if atomic.LoadInt64(&consecutiveFailures) != 0 {
+			atomic.StoreInt64(&consecutiveFailures, 0)
+		}
+		return
+	}
+	if atomic.AddInt64(&consecutiveFailures, 1) == abortConsecutiveFailures {
+		abortRun("%d requests failed in a row", abortConsecutiveFailures)
+	}
+}
+
+// startAbortMonitor evaluates the error rate over the last abortErrorWindow and the size of the proxy pool
+// every second for the lifetime of the run, and aborts the run when one of them crosses its limit.
+// It does nothing if neither condition is enabled.
+func startAbortMonitor(collector *StatsCollector) {
+	if abortErrorRate <= 0 && !(abortOnEmptyPool && useProxy) {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(1 * time.Second)
+		defer ticker.Stop()
+
+		// Snapshots of the last abortErrorWindow seconds, oldest first
+		var window []StatsSnapshot
+		var emptySince time.Time
+		started := time.Now()
+
+		for now := range ticker.C {
+			if abortErrorRate > 0 {
+				window = append(window, collector.Snapshot())
+				if len(window) > int(abortErrorWindow/time.Second)+1 {
+					window = window[1:]
+				}
+				oldest, newest := window[0], window[len(window)-1]
+				requests := newest.Requests - oldest.Requests
+				failures := newest.Failures - oldest.Failures
+				if requests >= abortMinRequests && float64(failures)/float64(requests) > abortErrorRate {
+					abortRun("error rate of %.1f%% over the last %s is above %.1f%%",
+						100*float64(failures)/float64(requests), abortErrorWindow, 100*abortErrorRate)
+				}
+			}
+
+			if abortOnEmptyPool && useProxy && now.Sub(started) >= poolAlertGrace {
+				if proxiesPool.Len() > 0 {
+					emptySince = time.Time{}
+				} else if emptySince.IsZero() {
+					emptySince = now
+				} else if now.Sub(emptySince) >= abortPoolEmptyFor {
+					abortRun("the proxy pool has been empty for %s", abortPoolEmptyFor)
+				}
+			}
+		}
+	}()
+}
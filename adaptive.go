@@ -0,0 +1,141 @@
+// adaptive.go contains the adaptive concurrency controller, which grows and shrinks the number of running threads
+// to hold the p95 latency at a target, additively increasing while under it and multiplicatively backing off above it,
+// so the run discovers the concurrency the target sustains.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// adaptiveHistory holds the intervals of the adaptive concurrency controller
+var adaptiveHistory = &AdaptiveHistory{}
+
+// AdaptiveStep is one interval of the adaptive concurrency controller.
+type AdaptiveStep struct {
+	Threads int           // Threads running during the interval
+	P95     time.Duration // p95 latency of the requests completed in the interval
+	Samples int64         // Requests completed in the interval
+}
+
+// AdaptiveHistory records the intervals of the adaptive concurrency controller.
+// It is safe for concurrent use.
+type AdaptiveHistory struct {
+	mu    sync.Mutex
+	steps []AdaptiveStep
+}
+
+// startAdaptiveConcurrency adjusts the thread count every adaptiveInterval to hold the p95 latency at adaptiveTargetP95,
+// for the lifetime of the run. It does nothing if no target is set.
+func startAdaptiveConcurrency() {
+	if adaptiveTargetP95 <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(adaptiveInterval)
+		defer ticker.Stop()
+
+		previous := latencies.Buckets()
+		for range ticker.C {
+			// Start from the current count, which the control API may also have changed
+			threads := runControl.State().Threads
+			current := latencies.Buckets()
+			p95, samples := intervalQuantile(previous, current, 0.95)
+			previous = current
+
+			// Too few requests to judge the interval; keep the thread count
+			if samples < adaptiveMinSamples {
+				continue
+			}
+			adaptiveHistory.add(AdaptiveStep{Threads: threads, P95: p95, Samples: samples})
+
+			if p95 > adaptiveTargetP95 {
+				threads = int(math.Floor(float64(threads) * adaptiveBackoff))
+			} else {
+				threads += adaptiveStep
+			}
+			if threads < adaptiveMinThreads {
+				threads = adaptiveMinThreads
+			}
+			runControl.SetThreads(threads)
+		}
+	}()
+}
+
+// intervalQuantile returns the duration at quantile q of the values recorded between two bucket snapshots
+// of the same histogram, and the number of those values.
+func intervalQuantile(previous, current []HistogramBucket, q float64) (time.Duration, int64) {
+	before := make(map[time.Duration]int64, len(previous))
+	for _, b := range previous {
+		before[b.UpperBound] = b.Count
+	}
+
+	deltas := make([]HistogramBucket, 0, len(current))
+	var total int64
+	for _, b := range current {
+		if delta := b.Count - before[b.UpperBound]; delta > 0 {
+			deltas = append(deltas, HistogramBucket{UpperBound: b.UpperBound, Count: delta})
+			total += delta
+		}
+	}
+	if total == 0 {
+		return 0, 0
+	}
+
+	target := int64(math.Ceil(q * float64(total)))
+	var cumulative int64
+	for _, b := range deltas {
+		cumulative += b.Count
+		if cumulative >= target {
+			return b.UpperBound, total
+		}
+	}
+	return deltas[len(deltas)-1].UpperBound, total
+}
+
+// add appends an interval to the history.
+func (h *AdaptiveHistory) add(step AdaptiveStep) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.steps = append(h.steps, step)
+}
+
+// Stable returns the mean thread count and p95 latency over the last adaptiveStableIntervals intervals,
+// which is where the controller settled. It returns false if there are no intervals.
+func (h *AdaptiveHistory) Stable() (threads float64, p95 time.Duration, ok bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	steps := h.steps
+	if len(steps) == 0 {
+		return 0, 0, false
+	}
+	if len(steps) > adaptiveStableIntervals {
+		steps = steps[len(steps)-adaptiveStableIntervals:]
+	}
+
+	var sumThreads float64
+	var sumP95 time.Duration
+	for _, s := range steps {
+		sumThreads += float64(s.Threads)
+		sumP95 += s.P95
+	}
+	return sumThreads / float64(len(steps)), sumP95 / time.Duration(len(steps)), true
+}
+
+// printAdaptiveSummary prints the concurrency the adaptive controller settled at.
+func printAdaptiveSummary() {
+	fmt.Printf("\n--- ADAPTIVE CONCURRENCY ---\n")
+	fmt.Printf("Target p95: %s\n", adaptiveTargetP95)
+	threads, p95, ok := adaptiveHistory.Stable()
+	if !ok {
+		fmt.Printf("Not enough requests to adjust the concurrency\n")
+	} else {
+		fmt.Printf("Stable concurrency: %.0f threads at p95 %s\n", threads, p95.Round(time.Millisecond))
+	}
+	fmt.Printf("----------------------------\n")
+}
@@ -0,0 +1,266 @@
+// aggregate.go contains the aggregate subcommand, which merges the NDJSON and CSV result files written by runs
+// on different machines into one combined summary, with percentiles and throughput computed over all requests.
+
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// aggregateSource is the contribution of one result file to the aggregate.
+type aggregateSource struct {
+	Path     string
+	Requests int64
+	First    time.Time // Start of the earliest request
+	Last     time.Time // End of the latest request
+}
+
+// resultsAggregate accumulates the requests read from result files.
+type resultsAggregate struct {
+	latencies  *Histogram
+	parameters *ParameterAggregator
+	stats      StatsSnapshot
+	sources    []aggregateSource
+}
+
+// runAggregate runs the aggregate subcommand with the given arguments and returns the exit code.
+func runAggregate(args []string) int {
+	flags := flag.NewFlagSet("aggregate", flag.ContinueOnError)
+	parametersCSV := flags.String("parameters-csv", "", "write the combined per-parameter table to this CSV file")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: jeet aggregate [-parameters-csv file] results.ndjson|results.csv...\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	agg := &resultsAggregate{
+		latencies:  newHistogram(latencyHighestTrackable, latencySignificantFigures),
+		parameters: newParameterAggregator(),
+		stats:      StatsSnapshot{StatusCodes: make(StatusCounts)},
+	}
+	for _, path := range flags.Args() {
+		if err := agg.addFile(path); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read %s: %s\n", path, err)
+			return 1
+		}
+	}
+
+	agg.print()
+
+	if *parametersCSV != "" {
+		if err := writeParameterSummaryCSV(*parametersCSV, agg.parameters.Summaries()); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write parameter summary: %s\n", err)
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// addFile adds the requests in the result file at path. Files ending in .csv are read as results files,
+// and everything else as NDJSON streams.
+func (agg *resultsAggregate) addFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		slog.Error("Error in addFile", "component", componentInput, "error", err)
+		return fmt.Errorf("Failed to open result file: %w", err)
+	}
+	defer file.Close()
+
+	source := aggregateSource{Path: path}
+	add := func(summary RequestSummary) {
+		agg.add(summary)
+		source.Requests++
+		if source.First.IsZero() || summary.Timestamp.Before(source.First) {
+			source.First = summary.Timestamp
+		}
+		if end := summary.Timestamp.Add(summary.Duration); end.After(source.Last) {
+			source.Last = end
+		}
+	}
+
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		err = readResultsCSV(file, add)
+	} else {
+		err = readResultsNDJSON(file, add)
+	}
+	if err != nil {
+		return err
+	}
+
+	agg.sources = append(agg.sources, source)
+	return nil
+}
+
+// add adds one request to the aggregate. Requests that received a response count towards the latency percentiles,
+// as they do during a run.
+func (agg *resultsAggregate) add(summary RequestSummary) {
+	agg.stats.Requests++
+	if summary.ErrorClass != ErrorClassNone {
+		agg.stats.Failures++
+		agg.stats.ErrorClasses[summary.ErrorClass]++
+	} else {
+		agg.stats.Successes++
+	}
+	if summary.StatusCode != 0 {
+		agg.stats.StatusCodes[summary.StatusCode]++
+		agg.latencies.Record(summary.Duration)
+	}
+	agg.stats.BytesIn += int64(summary.BytesIn)
+	agg.parameters.Record(summary)
+}
+
+// readResultsCSV reads the rows of a results file written by ResultsWriter.
+// Rows written before the request_id column was added are read as well.
+func readResultsCSV(r io.Reader, add func(RequestSummary)) error {
+	reader := csv.NewReader(bufio.NewReader(r))
+	reader.FieldsPerRecord = -1
+
+	line := 0
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			slog.Error("Error in readResultsCSV", "component", componentInput, "error", err)
+			return fmt.Errorf("Failed to read results row: %w", err)
+		}
+		line++
+		if len(row) != len(resultsHeader) && len(row) != len(resultsHeader)-1 {
+			return fmt.Errorf("row %d: %d fields, expected %d", line, len(row), len(resultsHeader))
+		}
+		if line == 1 && row[0] == resultsHeader[0] {
+			continue
+		}
+
+		summary, err := parseResultRecord(row[0], row[1], row[2], row[3], row[4], row[5], row[6])
+		if err != nil {
+			return fmt.Errorf("row %d: %w", line, err)
+		}
+		if len(row) == len(resultsHeader) {
+			summary.RequestID = row[7]
+		}
+		add(summary)
+	}
+}
+
+// readResultsNDJSON reads the lines of an NDJSON stream written by NDJSONWriter.
+func readResultsNDJSON(r io.Reader, add func(RequestSummary)) error {
+	dec := json.NewDecoder(bufio.NewReader(r))
+	for line := 1; ; line++ {
+		var record requestRecordJSON
+		if err := dec.Decode(&record); err == io.EOF {
+			return nil
+		} else if err != nil {
+			slog.Error("Error in readResultsNDJSON", "component", componentInput, "error", err)
+			return fmt.Errorf("Failed to decode record %d: %w", line, err)
+		}
+
+		summary := RequestSummary{
+			Timestamp:  record.Timestamp,
+			RequestID:  record.RequestID,
+			Parameter:  record.Parameter,
+			Proxy:      record.Proxy,
+			StatusCode: record.StatusCode,
+			Duration:   time.Duration(record.DurationMs * float64(time.Millisecond)),
+			BytesIn:    record.BytesIn,
+			ErrorClass: parseErrorClass(record.ErrorClass),
+		}
+		if summary.ErrorClass != ErrorClassNone {
+			summary.ErrorCount = 1
+		}
+		add(summary)
+	}
+}
+
+// parseResultRecord converts the columns of a results file row to a RequestSummary.
+func parseResultRecord(timestamp, parameter, proxy, status, durationMs, bytes, errorClass string) (RequestSummary, error) {
+	summary := RequestSummary{Parameter: parameter, Proxy: proxy, ErrorClass: parseErrorClass(errorClass)}
+
+	var err error
+	if summary.Timestamp, err = time.Parse(time.RFC3339Nano, timestamp); err != nil {
+		return summary, fmt.Errorf("invalid timestamp %q", timestamp)
+	}
+	if summary.StatusCode, err = strconv.Atoi(status); err != nil {
+		return summary, fmt.Errorf("invalid status %q", status)
+	}
+	millis, err := strconv.ParseFloat(durationMs, 64)
+	if err != nil {
+		return summary, fmt.Errorf("invalid duration %q", durationMs)
+	}
+	summary.Duration = time.Duration(millis * float64(time.Millisecond))
+	if summary.BytesIn, err = strconv.Atoi(bytes); err != nil {
+		return summary, fmt.Errorf("invalid byte count %q", bytes)
+	}
+	if summary.ErrorClass != ErrorClassNone {
+		summary.ErrorCount = 1
+	}
+
+	return summary, nil
+}
+
+// print prints the combined summary of all result files.
+// Throughput is computed over the span from the earliest request start to the latest request end across all files.
+func (agg *resultsAggregate) print() {
+	fmt.Printf("\n=== AGGREGATE SUMMARY ===\n")
+
+	var first, last time.Time
+	fmt.Printf("\n--- SOURCES ---\n")
+	fmt.Printf("%-40s %10s %12s %10s\n", "FILE", "REQUESTS", "SPAN", "REQ/S")
+	for _, s := range agg.sources {
+		span := s.Last.Sub(s.First)
+		fmt.Printf("%-40s %10d %12s %10.1f\n", s.Path, s.Requests, span.Round(time.Millisecond), perSecond(s.Requests, span))
+		if s.Requests == 0 {
+			continue
+		}
+		if first.IsZero() || s.First.Before(first) {
+			first = s.First
+		}
+		if s.Last.After(last) {
+			last = s.Last
+		}
+	}
+
+	span := last.Sub(first)
+	fmt.Printf("\n--- TOTALS ---\n")
+	if !first.IsZero() {
+		fmt.Printf("Started: %s\n", first.Format(time.RFC3339))
+	}
+	fmt.Printf("Span: %s\n", span.Round(time.Millisecond))
+	fmt.Printf("Total requests: %d\n", agg.stats.Requests)
+	fmt.Printf("Success count: %d\n", agg.stats.Successes)
+	fmt.Printf("Failure count: %d\n", agg.stats.Failures)
+	fmt.Printf("Throughput: %.1f requests/s\n", perSecond(agg.stats.Requests, span))
+	fmt.Printf("Bytes received: %d (%s)\n", agg.stats.BytesIn, formatBytes(agg.stats.BytesIn))
+
+	printLatencySummary(agg.latencies.Snapshot())
+	printStatusSummary(agg.stats.StatusCodes)
+	printErrorSummary(agg.stats.ErrorClasses)
+	printParameterSummary(agg.parameters.Summaries())
+}
+
+// perSecond returns the rate of count over d, or 0 if d is not positive.
+func perSecond(count int64, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return float64(count) / d.Seconds()
+}
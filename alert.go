@@ -0,0 +1,231 @@
+// alert.go contains the alerts of a run: the proxy pool floor alert, which warns when the number of healthy proxies
+// drops below a configured floor, since effective concurrency otherwise degrades silently, the error rate alert,
+// and the completion notification, so unattended runs can page someone.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// AlertEvent is a warning about the state of the run, printed and optionally posted to alertWebhookUrl.
+type AlertEvent struct {
+	Time           time.Time `json:"time"`
+	Event          string    `json:"event"`
+	Message        string    `json:"message"`
+	HealthyProxies int       `json:"healthy_proxies"`
+	Floor          int       `json:"floor"`
+	Threads        int       `json:"threads"`
+
+	// Set by the error rate alert and the completion notification
+	Requests  int64   `json:"requests,omitempty"`
+	Failures  int64   `json:"failures,omitempty"`
+	ErrorRate float64 `json:"error_rate,omitempty"`
+	Threshold float64 `json:"threshold,omitempty"`
+
+	// Set by the completion notification
+	DurationSeconds float64 `json:"duration_seconds,omitempty"`
+	Throughput      float64 `json:"throughput,omitempty"`
+	P50Ms           float64 `json:"p50_ms,omitempty"`
+	P95Ms           float64 `json:"p95_ms,omitempty"`
+	P99Ms           float64 `json:"p99_ms,omitempty"`
+}
+
+// poolFloorMonitor tracks whether the proxy pool is below its floor, so an alert is emitted
+// once when the pool drops below it and once when it recovers, rather than on every check.
+type poolFloorMonitor struct {
+	floor   int
+	armed   bool // Whether the pool has reached the floor or the startup grace period has passed
+	below   bool
+	started time.Time
+}
+
+// newPoolFloorMonitor creates a monitor for the given floor.
+func newPoolFloorMonitor(floor int) *poolFloorMonitor {
+	return &poolFloorMonitor{floor: floor, started: time.Now()}
+}
+
+// Check compares the number of healthy proxies to the floor and emits an alert when it crosses it.
+// Until the pool first reaches the floor, alerts are held back for poolAlertGrace so the initial fill does not alert.
+func (m *poolFloorMonitor) Check(healthy int, proxiesLogger *log.Logger) {
+	if m.floor <= 0 {
+		return
+	}
+	if !m.armed {
+		if healthy < m.floor && time.Since(m.started) < poolAlertGrace {
+			return
+		}
+		m.armed = true
+	}
+
+	switch {
+	case healthy < m.floor && !m.below:
+		m.below = true
+		emitAlert(AlertEvent{
+			Event:          "proxy_pool_below_floor",
+			Message:        fmt.Sprintf("Healthy proxies dropped to %d, below the floor of %d; effective concurrency is degraded", healthy, m.floor),
+			HealthyProxies: healthy,
+			Floor:          m.floor,
+			Threads:        numOfThreads,
+		}, proxiesLogger)
+	case healthy >= m.floor && m.below:
+		m.below = false
+		emitAlert(AlertEvent{
+			Event:          "proxy_pool_recovered",
+			Message:        fmt.Sprintf("Healthy proxies recovered to %d, at or above the floor of %d", healthy, m.floor),
+			HealthyProxies: healthy,
+			Floor:          m.floor,
+			Threads:        numOfThreads,
+		}, proxiesLogger)
+	}
+}
+
+// errorRateMonitor tracks whether the error rate is above the threshold, so an alert is emitted
+// once when it rises above it and once when it recovers.
+type errorRateMonitor struct {
+	threshold float64
+	above     bool
+	previous  StatsSnapshot
+}
+
+// startErrorRateMonitor checks the error rate of every errorRateCheckInterval against errorRateAlertThreshold
+// for the lifetime of the run. It does nothing if the threshold is not positive.
+func startErrorRateMonitor(collector *StatsCollector) {
+	if errorRateAlertThreshold <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(errorRateCheckInterval)
+		defer ticker.Stop()
+
+		monitor := &errorRateMonitor{threshold: errorRateAlertThreshold}
+		for range ticker.C {
+			monitor.Check(collector.Snapshot())
+		}
+	}()
+}
+
+// Check compares the error rate since the previous check to the threshold and emits an alert when it crosses it.
+// Intervals with fewer than errorRateMinRequests requests are skipped, so a handful of failures does not alert.
+func (m *errorRateMonitor) Check(current StatsSnapshot) {
+	requests := current.Requests - m.previous.Requests
+	failures := current.Failures - m.previous.Failures
+	if requests < errorRateMinRequests {
+		return
+	}
+	m.previous = current
+	rate := float64(failures) / float64(requests)
+
+	switch {
+	case rate > m.threshold && !m.above:
+		m.above = true
+		emitAlert(AlertEvent{
+			Event:     "error_rate_above_threshold",
+			Message:   fmt.Sprintf("Error rate rose to %.1f%% (%d of %d requests), above the threshold of %.1f%%", 100*rate, failures, requests, 100*m.threshold),
+			Threads:   numOfThreads,
+			Requests:  requests,
+			Failures:  failures,
+			ErrorRate: rate,
+			Threshold: m.threshold,
+		}, log.Default())
+	case rate <= m.threshold && m.above:
+		m.above = false
+		emitAlert(AlertEvent{
+			Event:     "error_rate_recovered",
+			Message:   fmt.Sprintf("Error rate recovered to %.1f%%, at or below the threshold of %.1f%%", 100*rate, 100*m.threshold),
+			Threads:   numOfThreads,
+			Requests:  requests,
+			Failures:  failures,
+			ErrorRate: rate,
+			Threshold: m.threshold,
+		}, log.Default())
+	}
+}
+
+// notifyRunCompleted posts the headline results of the run to alertWebhookUrl, if one is configured.
+// Unlike warnings it is posted synchronously, since the process exits right after.
+func notifyRunCompleted(report RunReport) {
+	if alertWebhookUrl == "" {
+		return
+	}
+
+	event := AlertEvent{
+		Time:            time.Now(),
+		Event:           "run_completed",
+		Message:         fmt.Sprintf("Run completed: %d requests, %d failures in %s", report.Stats.Requests, report.Stats.Failures, report.Duration.Round(time.Second)),
+		HealthyProxies:  report.HealthyProxies,
+		Threads:         report.Config.Threads,
+		Requests:        report.Stats.Requests,
+		Failures:        report.Stats.Failures,
+		DurationSeconds: report.Duration.Seconds(),
+		Throughput:      report.Throughput,
+		P50Ms:           durationMillis(report.Latency.P50),
+		P95Ms:           durationMillis(report.Latency.P95),
+		P99Ms:           durationMillis(report.Latency.P99),
+	}
+	if report.Stats.Requests > 0 {
+		event.ErrorRate = float64(report.Stats.Failures) / float64(report.Stats.Requests)
+	}
+	if err := postWebhook(alertWebhookUrl, event); err != nil {
+		slog.Error("Failed to post completion to webhook", "component", componentControl, "error", err)
+	}
+}
+
+// emitAlert prints an alert, writes it to the given log, and posts it to alertWebhookUrl if one is configured.
+func emitAlert(event AlertEvent, logger *log.Logger) {
+	event.Time = time.Now()
+	if dashboardEnabled {
+		noteError("WARNING: %s", event.Message)
+	} else {
+		fmt.Printf("\nWARNING: %s\n", event.Message)
+	}
+	logger.Printf("WARNING: %s\n", event.Message)
+
+	if alertWebhookUrl != "" {
+		go func() {
+			if err := postWebhook(alertWebhookUrl, event); err != nil {
+				slog.Error("Failed to post alert to webhook", "component", componentControl, "error", err)
+			}
+		}()
+	}
+}
+
+// postWebhook posts a payload as JSON to a webhook.
+func postWebhook(url string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		slog.Error("Error in postWebhook", "component", componentControl, "error", err)
+		return fmt.Errorf("Failed to encode webhook payload: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), clientTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		slog.Error("Error in postWebhook", "component", componentControl, "error", err)
+		return fmt.Errorf("Failed to create webhook request: %w", err)
+	}
+	req.Header.Add("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		slog.Error("Error in postWebhook", "component", componentControl, "error", err)
+		return fmt.Errorf("Failed to post to webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("Received non-2xx response code from webhook: %d", resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,118 @@
+// assert.go contains the response assertions, which define success beyond receiving a response:
+// the body must match a regular expression, a JSON field must have a given value, or the body size must be in a range.
+// Responses failing an assertion are counted as failures of the assertion error class.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// successStatusSet marks the status codes in successStatuses, indexed by code
+var successStatusSet, successStatusErr = parseStatusSet(successStatuses)
+
+// assertBodyPattern is the compiled assertBodyRegex, or nil if the body is not matched
+var assertBodyPattern *regexp.Regexp
+
+// assertJSONFieldPath is the split assertJSONPath, or nil if no JSON field is asserted
+var assertJSONFieldPath []string
+
+// setupAssertions compiles the configured assertions.
+// It returns an error if the regular expression is invalid, or if the body is asserted while bodies are discarded.
+func setupAssertions() error {
+	if successStatusErr != nil {
+		slog.Error("Error in setupAssertions", "component", componentMain, "error", successStatusErr)
+		return fmt.Errorf("Failed to parse success statuses: %w", successStatusErr)
+	}
+	if (assertBodyRegex != "" || assertJSONPath != "") && discardBodies {
+		return fmt.Errorf("Body assertions cannot be checked when bodies are discarded")
+	}
+
+	if assertBodyRegex != "" {
+		pattern, err := regexp.Compile(assertBodyRegex)
+		if err != nil {
+			slog.Error("Error in setupAssertions", "component", componentMain, "error", err)
+			return fmt.Errorf("Failed to compile body assertion: %w", err)
+		}
+		assertBodyPattern = pattern
+	}
+
+	if assertJSONPath != "" {
+		// Accept JSONPath's root prefix, so "$.data.status" and "data.status" are the same field
+		path := strings.TrimPrefix(strings.TrimPrefix(assertJSONPath, "$"), ".")
+		assertJSONFieldPath = strings.Split(path, ".")
+	}
+
+	return nil
+}
+
+// parseStatusSet parses a comma-separated list of status codes and inclusive ranges, such as "200-299,304".
+func parseStatusSet(spec string) ([statusCodeSlots]bool, error) {
+	var set [statusCodeSlots]bool
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		low, high, isRange := strings.Cut(part, "-")
+		if !isRange {
+			high = low
+		}
+		from, err := strconv.Atoi(strings.TrimSpace(low))
+		if err != nil {
+			return set, fmt.Errorf("invalid status code %q", part)
+		}
+		to, err := strconv.Atoi(strings.TrimSpace(high))
+		if err != nil {
+			return set, fmt.Errorf("invalid status code %q", part)
+		}
+		if from < 1 || to >= statusCodeSlots || from > to {
+			return set, fmt.Errorf("invalid status range %q", part)
+		}
+		for code := from; code <= to; code++ {
+			set[code] = true
+		}
+	}
+	return set, nil
+}
+
+// isSuccessStatus reports whether a status code is one of the success statuses.
+func isSuccessStatus(code int) bool {
+	return code > 0 && code < statusCodeSlots && successStatusSet[code]
+}
+
+// checkAssertions checks a response body of size bytes against the configured assertions.
+// It returns a description of the first failed assertion, or an empty string if all pass.
+func checkAssertions(body []byte, size int) string {
+	if assertMinSize > 0 && size < assertMinSize {
+		return fmt.Sprintf("body size %d is below %d", size, assertMinSize)
+	}
+	if assertMaxSize > 0 && size > assertMaxSize {
+		return fmt.Sprintf("body size %d is above %d", size, assertMaxSize)
+	}
+
+	if assertBodyPattern != nil && !assertBodyPattern.Match(body) {
+		return fmt.Sprintf("body does not match %q", assertBodyRegex)
+	}
+
+	if assertJSONFieldPath != nil {
+		var doc interface{}
+		if err := json.Unmarshal(body, &doc); err != nil {
+			return "body is not valid JSON"
+		}
+		values := lookupField(doc, assertJSONFieldPath)
+		if len(values) == 0 {
+			return fmt.Sprintf("body has no field %s", assertJSONPath)
+		}
+		for _, value := range values {
+			if formatFieldValue(value) == assertJSONValue {
+				return ""
+			}
+		}
+		return fmt.Sprintf("field %s is %s, not %s", assertJSONPath, formatFieldValue(values[0]), assertJSONValue)
+	}
+
+	return ""
+}
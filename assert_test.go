@@ -0,0 +1,47 @@
+package main
+
+import "testing"
+
+func TestParseStatusSet(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		want    []int // Codes in the set
+		notWant []int // Codes not in the set
+		wantErr bool
+	}{
+		{"single code", "200", []int{200}, []int{199, 201}, false},
+		{"range", "200-299", []int{200, 250, 299}, []int{199, 300}, false},
+		{"list", "200-299,304", []int{200, 299, 304}, []int{300, 303, 305}, false},
+		{"spaces", " 200 - 201 , 404 ", []int{200, 201, 404}, []int{202}, false},
+		{"single code range", "204-204", []int{204}, []int{203, 205}, false},
+		{"lowest and highest code", "1,599", []int{1, 599}, []int{2, 598}, false},
+		{"empty", "", nil, nil, true},
+		{"empty part", "200,", nil, nil, true},
+		{"not a number", "ok", nil, nil, true},
+		{"open range", "200-", nil, nil, true},
+		{"reversed range", "299-200", nil, nil, true},
+		{"zero", "0", nil, nil, true},
+		{"negative", "-1", nil, nil, true},
+		{"too high", "600", nil, nil, true},
+		{"range too high", "500-600", nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set, err := parseStatusSet(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseStatusSet(%q) error = %v, wantErr %t", tt.spec, err, tt.wantErr)
+			}
+			for _, code := range tt.want {
+				if !set[code] {
+					t.Errorf("parseStatusSet(%q) does not contain %d", tt.spec, code)
+				}
+			}
+			for _, code := range tt.notWant {
+				if set[code] {
+					t.Errorf("parseStatusSet(%q) contains %d", tt.spec, code)
+				}
+			}
+		})
+	}
+}
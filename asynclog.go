@@ -0,0 +1,112 @@
+// asynclog.go contains the asynchronous log writer, which takes the writes of log records off the request path.
+// Records are copied into a bounded queue and written by a single goroutine, batched into large writes,
+// and records that arrive while the queue is full are dropped and counted instead of blocking the threads.
+
+package main
+
+import (
+	"bufio"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// droppedLogRecords counts the log records dropped because a log queue was full
+var droppedLogRecords int64
+
+// AsyncWriter queues writes and writes them to an underlying writer in the background.
+// It is safe for concurrent use.
+type AsyncWriter struct {
+	mu     sync.RWMutex // Held for reading to queue, and for writing to close the queue
+	closed bool
+	queue  chan []byte
+	done   chan struct{}
+	w      io.WriteCloser
+	batch  bool
+}
+
+// newAsyncWriter starts writing the records queued on the returned writer to w.
+// With batch, records are gathered into large writes; otherwise every record is written on its own,
+// for writers such as syslog that treat every write as a message.
+func newAsyncWriter(w io.WriteCloser, batch bool) *AsyncWriter {
+	a := &AsyncWriter{
+		queue: make(chan []byte, logQueueSize),
+		done:  make(chan struct{}),
+		w:     w,
+		batch: batch,
+	}
+	go a.run()
+	return a
+}
+
+// Write queues a copy of p, or drops it and counts it if the queue is full. It never blocks on the underlying writer.
+// Writes after Close go to the underlying writer directly.
+func (a *AsyncWriter) Write(p []byte) (int, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if a.closed {
+		return a.w.Write(p)
+	}
+	record := make([]byte, len(p))
+	copy(record, p)
+	select {
+	case a.queue <- record:
+	default:
+		atomic.AddInt64(&droppedLogRecords, 1)
+	}
+	return len(p), nil
+}
+
+// run writes the queued records until the queue is closed. Batched records are flushed whenever the queue runs empty,
+// and at least every logFlushInterval.
+func (a *AsyncWriter) run() {
+	defer close(a.done)
+
+	var out io.Writer = a.w
+	var buf *bufio.Writer
+	if a.batch {
+		buf = bufio.NewWriterSize(a.w, logBatchSize)
+		out = buf
+	}
+	flush := func() {
+		if buf != nil && buf.Buffered() > 0 {
+			buf.Flush()
+		}
+	}
+
+	ticker := time.NewTicker(logFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case record, ok := <-a.queue:
+			if !ok {
+				flush()
+				return
+			}
+			out.Write(record)
+			if len(a.queue) == 0 {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// Close writes the queued records, then closes the underlying writer.
+func (a *AsyncWriter) Close() error {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return nil
+	}
+	a.closed = true
+	close(a.queue)
+	a.mu.Unlock()
+
+	<-a.done
+	return a.w.Close()
+}
@@ -0,0 +1,273 @@
+// balancer.go contains the proxy selection strategies used by the proxy pool.
+// A strategy decides which healthy proxy the next batch of requests is sent through.
+// Unless proxySharing is set, a thread has exclusive use of its proxy: a strategy only selects from the proxies
+// no batch is using, and the pool makes threads wait while every proxy is in use.
+
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// latencyEwmaWeight is the weight of the newest sample in the per-proxy latency moving average
+const latencyEwmaWeight = 0.2
+
+// ProxyBalancer selects proxies from the set of healthy proxies.
+// Implementations do not need to be safe for concurrent use; the ProxyPool serializes all calls.
+type ProxyBalancer interface {
+	// Add adds a healthy proxy to the set.
+	Add(proxy string)
+	// Remove removes a proxy from the set.
+	Remove(proxy string)
+	// Next selects the proxy for the next batch of requests and marks it as outstanding,
+	// drawing any randomness from rng, which belongs to the calling thread.
+	// It returns false if no proxy in the set is available.
+	Next(rng *rand.Rand) (string, bool)
+	// Observe records the outcome of a single request sent through a proxy.
+	Observe(proxy string, latency time.Duration, ok bool)
+	// Release marks a batch previously returned by Next as finished.
+	Release(proxy string)
+	// Len returns the number of proxies in the set.
+	Len() int
+}
+
+// newProxyBalancer creates the proxy balancer for the given strategy name.
+// If shared is false, a proxy is only selected while no batch is using it.
+// It returns an error if the strategy is unknown.
+func newProxyBalancer(strategy string, shared bool) (ProxyBalancer, error) {
+	set := proxySet{shared: shared}
+	switch strategy {
+	case "random":
+		return &randomBalancer{proxySet: set}, nil
+	case "round-robin":
+		return &roundRobinBalancer{proxySet: set}, nil
+	case "least-latency":
+		return &leastLatencyBalancer{proxySet: set}, nil
+	case "least-outstanding":
+		return &leastOutstandingBalancer{proxySet: set}, nil
+	case "weighted":
+		return &weightedBalancer{proxySet: set}, nil
+	default:
+		return nil, fmt.Errorf("unknown proxy balancing strategy: %s", strategy)
+	}
+}
+
+// proxyState holds the per-proxy bookkeeping shared by all strategies.
+type proxyState struct {
+	proxy       string
+	latency     time.Duration // Moving average of the request latency, only meaningful once measured
+	measured    bool          // Whether a successful request through the proxy was observed
+	outstanding int           // Number of batches currently using the proxy
+}
+
+// proxySet is an ordered set of proxies with their state, embedded by every strategy.
+type proxySet struct {
+	states []*proxyState
+	index  map[string]int
+	shared bool // Whether a proxy may be selected while batches are using it
+}
+
+// Add adds a proxy to the set if it is not already present.
+func (s *proxySet) Add(proxy string) {
+	if s.index == nil {
+		s.index = make(map[string]int)
+	}
+	if _, exists := s.index[proxy]; exists {
+		return
+	}
+	s.index[proxy] = len(s.states)
+	s.states = append(s.states, &proxyState{proxy: proxy})
+}
+
+// Remove removes a proxy from the set by swapping it with the last element.
+func (s *proxySet) Remove(proxy string) {
+	i, exists := s.index[proxy]
+	if !exists {
+		return
+	}
+	last := len(s.states) - 1
+	s.states[i] = s.states[last]
+	s.index[s.states[i].proxy] = i
+	s.states = s.states[:last]
+	delete(s.index, proxy)
+}
+
+// Observe updates the latency moving average of a proxy.
+func (s *proxySet) Observe(proxy string, latency time.Duration, ok bool) {
+	i, exists := s.index[proxy]
+	if !exists || !ok {
+		return
+	}
+	state := s.states[i]
+	if !state.measured {
+		state.latency = latency
+		state.measured = true
+		return
+	}
+	state.latency = time.Duration(latencyEwmaWeight*float64(latency) + (1-latencyEwmaWeight)*float64(state.latency))
+}
+
+// Release decrements the outstanding batch count of a proxy.
+func (s *proxySet) Release(proxy string) {
+	if i, exists := s.index[proxy]; exists && s.states[i].outstanding > 0 {
+		s.states[i].outstanding--
+	}
+}
+
+// Len returns the number of proxies in the set.
+func (s *proxySet) Len() int {
+	return len(s.states)
+}
+
+// available reports whether the proxy at index i may be selected.
+func (s *proxySet) available(i int) bool {
+	return s.shared || s.states[i].outstanding == 0
+}
+
+// take marks the proxy at index i as outstanding and returns it.
+func (s *proxySet) take(i int) (string, bool) {
+	s.states[i].outstanding++
+	return s.states[i].proxy, true
+}
+
+// randomBalancer selects a uniformly random proxy.
+type randomBalancer struct {
+	proxySet
+}
+
+// Next selects a uniformly random available proxy.
+func (b *randomBalancer) Next(rng *rand.Rand) (string, bool) {
+	count := 0
+	for i := range b.states {
+		if b.available(i) {
+			count++
+		}
+	}
+	if count == 0 {
+		return "", false
+	}
+	pick := rng.Intn(count)
+	for i := range b.states {
+		if !b.available(i) {
+			continue
+		}
+		if pick == 0 {
+			return b.take(i)
+		}
+		pick--
+	}
+	return "", false
+}
+
+// roundRobinBalancer cycles through the proxies in order.
+type roundRobinBalancer struct {
+	proxySet
+	next int
+}
+
+// Next selects the first available proxy after the previously selected one.
+func (b *roundRobinBalancer) Next(rng *rand.Rand) (string, bool) {
+	for n := 0; n < len(b.states); n++ {
+		i := (b.next + n) % len(b.states)
+		if b.available(i) {
+			b.next = i + 1
+			return b.take(i)
+		}
+	}
+	return "", false
+}
+
+// leastLatencyBalancer selects the proxy with the lowest latency moving average.
+// The latency of a proxy without samples is unknown rather than zero: unmeasured proxies are probed in turn,
+// one batch each until their first sample arrives, and are otherwise passed over for measured ones.
+type leastLatencyBalancer struct {
+	proxySet
+	nextProbe int
+}
+
+// Next selects an idle unmeasured proxy to probe if there is one, and the available measured proxy with the lowest
+// latency moving average otherwise. If no available proxy is measured, it selects the available proxy with the fewest batches in flight.
+func (b *leastLatencyBalancer) Next(rng *rand.Rand) (string, bool) {
+	// Probe the unmeasured proxies round-robin, so a new proxy does not draw every batch before its first sample
+	for n := 0; n < len(b.states); n++ {
+		i := (b.nextProbe + n) % len(b.states)
+		if state := b.states[i]; !state.measured && state.outstanding == 0 {
+			b.nextProbe = i + 1
+			return b.take(i)
+		}
+	}
+
+	best := -1
+	for i, state := range b.states {
+		if b.available(i) && state.measured && (best < 0 || state.latency < b.states[best].latency) {
+			best = i
+		}
+	}
+	if best < 0 {
+		for i, state := range b.states {
+			if b.available(i) && (best < 0 || state.outstanding < b.states[best].outstanding) {
+				best = i
+			}
+		}
+	}
+	if best < 0 {
+		return "", false
+	}
+	return b.take(best)
+}
+
+// leastOutstandingBalancer selects the proxy with the fewest batches in flight.
+type leastOutstandingBalancer struct {
+	proxySet
+}
+
+// Next selects the available proxy with the fewest batches in flight, breaking ties at random.
+func (b *leastOutstandingBalancer) Next(rng *rand.Rand) (string, bool) {
+	if len(b.states) == 0 {
+		return "", false
+	}
+	start := rng.Intn(len(b.states))
+	best := -1
+	for n := 0; n < len(b.states); n++ {
+		i := (start + n) % len(b.states)
+		if b.available(i) && (best < 0 || b.states[i].outstanding < b.states[best].outstanding) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return "", false
+	}
+	return b.take(best)
+}
+
+// weightedBalancer selects a random proxy with a probability proportional to its weight.
+// Weights are read from the proxies file, and proxies without a weight default to 1.
+type weightedBalancer struct {
+	proxySet
+}
+
+// Next selects a random available proxy weighted by its configured weight.
+func (b *weightedBalancer) Next(rng *rand.Rand) (string, bool) {
+	total := 0
+	for i, state := range b.states {
+		if b.available(i) {
+			total += proxyWeight(state.proxy)
+		}
+	}
+	if total == 0 {
+		return "", false
+	}
+	pick := rng.Intn(total)
+	for i, state := range b.states {
+		if !b.available(i) {
+			continue
+		}
+		pick -= proxyWeight(state.proxy)
+		if pick < 0 {
+			return b.take(i)
+		}
+	}
+	return "", false
+}
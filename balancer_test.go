@@ -0,0 +1,61 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestProxyBalancerExclusive(t *testing.T) {
+	strategies := []string{"random", "round-robin", "least-latency", "least-outstanding", "weighted"}
+	for _, strategy := range strategies {
+		t.Run(strategy, func(t *testing.T) {
+			balancer, err := newProxyBalancer(strategy, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, proxy := range []string{"a:1", "b:1", "c:1"} {
+				balancer.Add(proxy)
+			}
+			rng := rand.New(rand.NewSource(1))
+
+			taken := make(map[string]bool)
+			for i := 0; i < 3; i++ {
+				proxy, ok := balancer.Next(rng)
+				if !ok {
+					t.Fatalf("Next() #%d found no proxy, want one of the idle proxies", i)
+				}
+				if taken[proxy] {
+					t.Fatalf("Next() #%d = %s, which is in use", i, proxy)
+				}
+				taken[proxy] = true
+			}
+			if proxy, ok := balancer.Next(rng); ok {
+				t.Fatalf("Next() with every proxy in use = %s, want none", proxy)
+			}
+
+			balancer.Release("b:1")
+			if proxy, ok := balancer.Next(rng); !ok || proxy != "b:1" {
+				t.Fatalf("Next() after releasing b:1 = %s, %t, want b:1, true", proxy, ok)
+			}
+		})
+	}
+}
+
+func TestProxyBalancerShared(t *testing.T) {
+	strategies := []string{"random", "round-robin", "least-latency", "least-outstanding", "weighted"}
+	for _, strategy := range strategies {
+		t.Run(strategy, func(t *testing.T) {
+			balancer, err := newProxyBalancer(strategy, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			balancer.Add("a:1")
+			rng := rand.New(rand.NewSource(1))
+			for i := 0; i < 3; i++ {
+				if proxy, ok := balancer.Next(rng); !ok || proxy != "a:1" {
+					t.Fatalf("Next() #%d = %s, %t, want a:1, true", i, proxy, ok)
+				}
+			}
+		})
+	}
+}
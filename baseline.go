@@ -0,0 +1,163 @@
+// baseline.go contains the run baselines, which save the aggregate metrics of a run to a file
+// so a later run can be compared against it and fail on latency, error rate, or throughput regressions.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// Baseline holds the aggregate metrics of a run.
+type Baseline struct {
+	Created    time.Time `json:"created"`
+	BaseURL    string    `json:"base_url"`
+	Requests   int64     `json:"requests"`
+	ErrorRate  float64   `json:"error_rate"`
+	Throughput float64   `json:"throughput"`
+	MeanMs     float64   `json:"mean_ms"`
+	P50Ms      float64   `json:"p50_ms"`
+	P90Ms      float64   `json:"p90_ms"`
+	P95Ms      float64   `json:"p95_ms"`
+	P99Ms      float64   `json:"p99_ms"`
+}
+
+// BaselineMetric is the comparison of one metric between a baseline and the current run.
+type BaselineMetric struct {
+	Name      string
+	Baseline  float64
+	Current   float64
+	Change    float64 // Relative change for latencies and throughput, absolute change for the error rate
+	Regressed bool
+}
+
+// BaselineComparison is the comparison of the current run against a baseline.
+type BaselineComparison struct {
+	Baseline Baseline
+	Metrics  []BaselineMetric
+}
+
+// newBaseline returns the aggregate metrics of a run.
+func newBaseline(report RunReport) Baseline {
+	baseline := Baseline{
+		Created:    report.EndTime,
+		BaseURL:    report.Config.BaseURL,
+		Requests:   report.Stats.Requests,
+		Throughput: report.Throughput,
+		MeanMs:     durationMillis(report.Latency.Mean),
+		P50Ms:      durationMillis(report.Latency.P50),
+		P90Ms:      durationMillis(report.Latency.P90),
+		P95Ms:      durationMillis(report.Latency.P95),
+		P99Ms:      durationMillis(report.Latency.P99),
+	}
+	if report.Stats.Requests > 0 {
+		baseline.ErrorRate = float64(report.Stats.Failures) / float64(report.Stats.Requests)
+	}
+	return baseline
+}
+
+// saveBaseline writes a baseline to the file at path as JSON.
+func saveBaseline(path string, baseline Baseline) error {
+	data, err := json.MarshalIndent(baseline, "", "  ")
+	if err != nil {
+		slog.Error("Error in saveBaseline", "component", componentOutput, "error", err)
+		return fmt.Errorf("Failed to encode baseline: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0666); err != nil {
+		slog.Error("Error in saveBaseline", "component", componentOutput, "error", err)
+		return fmt.Errorf("Failed to write baseline file: %w", err)
+	}
+	return nil
+}
+
+// loadBaseline reads a baseline from the JSON file at path.
+func loadBaseline(path string) (Baseline, error) {
+	var baseline Baseline
+	data, err := os.ReadFile(path)
+	if err != nil {
+		slog.Error("Error in loadBaseline", "component", componentInput, "error", err)
+		return baseline, fmt.Errorf("Failed to read baseline file: %w", err)
+	}
+	if err := json.Unmarshal(data, &baseline); err != nil {
+		slog.Error("Error in loadBaseline", "component", componentInput, "error", err)
+		return baseline, fmt.Errorf("Failed to decode baseline file: %w", err)
+	}
+	return baseline, nil
+}
+
+// compareToBaseline compares the current run to a baseline.
+// A latency regresses if it grew by more than latencyTolerance relative to the baseline,
+// throughput regresses if it dropped by more than latencyTolerance relative to the baseline,
+// and the error rate regresses if it grew by more than errorRateTolerance.
+func compareToBaseline(baseline, current Baseline, latencyTolerance, errorRateTolerance float64) BaselineComparison {
+	comparison := BaselineComparison{Baseline: baseline}
+
+	latency := func(name string, base, cur float64) {
+		change := relativeChange(base, cur)
+		comparison.Metrics = append(comparison.Metrics, BaselineMetric{
+			Name: name, Baseline: base, Current: cur, Change: change, Regressed: change > latencyTolerance,
+		})
+	}
+	latency("mean_ms", baseline.MeanMs, current.MeanMs)
+	latency("p50_ms", baseline.P50Ms, current.P50Ms)
+	latency("p90_ms", baseline.P90Ms, current.P90Ms)
+	latency("p95_ms", baseline.P95Ms, current.P95Ms)
+	latency("p99_ms", baseline.P99Ms, current.P99Ms)
+
+	throughputChange := relativeChange(baseline.Throughput, current.Throughput)
+	comparison.Metrics = append(comparison.Metrics, BaselineMetric{
+		Name: "throughput", Baseline: baseline.Throughput, Current: current.Throughput,
+		Change: throughputChange, Regressed: throughputChange < -latencyTolerance,
+	})
+
+	errorRateChange := current.ErrorRate - baseline.ErrorRate
+	comparison.Metrics = append(comparison.Metrics, BaselineMetric{
+		Name: "error_rate", Baseline: baseline.ErrorRate, Current: current.ErrorRate,
+		Change: errorRateChange, Regressed: errorRateChange > errorRateTolerance,
+	})
+
+	return comparison
+}
+
+// Regressed reports whether any metric regressed beyond its tolerance.
+func (c BaselineComparison) Regressed() bool {
+	for _, metric := range c.Metrics {
+		if metric.Regressed {
+			return true
+		}
+	}
+	return false
+}
+
+// relativeChange returns the change from base to cur relative to base.
+func relativeChange(base, cur float64) float64 {
+	if base == 0 {
+		if cur == 0 {
+			return 0
+		}
+		return 1
+	}
+	return (cur - base) / base
+}
+
+// printBaselineComparison prints the comparison of the current run against a baseline.
+func printBaselineComparison(comparison BaselineComparison) {
+	fmt.Printf("\n--- BASELINE COMPARISON ---\n")
+	fmt.Printf("Baseline from %s (%d requests)\n", comparison.Baseline.Created.Format(time.RFC3339), comparison.Baseline.Requests)
+	fmt.Printf("%-12s %12s %12s %10s %s\n", "METRIC", "BASELINE", "CURRENT", "CHANGE", "")
+	for _, m := range comparison.Metrics {
+		verdict := "ok"
+		if m.Regressed {
+			verdict = "REGRESSED"
+		}
+		change := fmt.Sprintf("%+.1f%%", 100*m.Change)
+		if m.Name == "error_rate" {
+			change = fmt.Sprintf("%+.2fpp", 100*m.Change)
+		}
+		fmt.Printf("%-12s %12.3f %12.3f %10s %s\n", m.Name, m.Baseline, m.Current, change, verdict)
+	}
+	fmt.Printf("---------------------------\n")
+}
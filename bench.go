@@ -0,0 +1,164 @@
+// bench.go contains the bench subcommand, which measures the maximum request generation rate of the tool itself
+// against a built-in local echo server, so users know the ceiling their hardware imposes before blaming the target.
+// It measures the net/http request path the runs use, with logging on and off; comparing other HTTP engines
+// such as fasthttp is out of its scope.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// benchConfig is one combination of options the bench subcommand measures.
+type benchConfig struct {
+	Logging bool
+}
+
+// benchResult is the measured generation rate of one benchConfig.
+type benchResult struct {
+	benchConfig
+	Requests int64
+	Failures int64
+	Duration time.Duration
+	Latency  LatencySnapshot
+}
+
+// runBench runs the bench subcommand with the given arguments and returns the exit code.
+func runBench(args []string) int {
+	flags := flag.NewFlagSet("bench", flag.ContinueOnError)
+	threads := flags.Int("threads", numOfThreads, "number of threads sending requests")
+	duration := flags.Duration("duration", 5*time.Second, "how long to measure each combination of options")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	// The bench does not need the parameters file, but uses it if present so requests look like a real run
+	if err := loadParameters(); err != nil {
+		parameters = []string{"bench"}
+	}
+	if err := setupRequestInputs(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to set up request inputs: %s\n", err)
+		return 1
+	}
+
+	server, listener, err := startEchoServer()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to start echo server: %s\n", err)
+		return 1
+	}
+	defer server.Close()
+	requestTarget = "http://" + listener.Addr().String() + "/echo"
+	directClient = newDirectClient()
+
+	logFile, err := os.CreateTemp("", "jeet-bench-*.log")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create bench log file: %s\n", err)
+		return 1
+	}
+	defer func() {
+		logFile.Close()
+		os.Remove(logFile.Name())
+	}()
+
+	fmt.Printf("Benchmarking the net/http request path against %s with %d threads, %s per combination\n", requestTarget, *threads, *duration)
+
+	var results []benchResult
+	for _, logging := range []bool{true, false} {
+		config := benchConfig{Logging: logging}
+		if logging {
+			setLogOutput(logFile)
+		} else {
+			setLogOutput(io.Discard)
+		}
+		results = append(results, measureBench(config, *threads, *duration))
+	}
+	setLogOutput(os.Stderr)
+
+	printBenchResults(results)
+
+	return 0
+}
+
+// startEchoServer starts an HTTP server on a random local port that echoes the request query back.
+func startEchoServer() (*http.Server, net.Listener, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		slog.Error("Error in startEchoServer", "component", componentMain, "error", err)
+		return nil, nil, fmt.Errorf("Failed to listen: %w", err)
+	}
+
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			io.WriteString(w, r.URL.RawQuery)
+		}),
+	}
+	go server.Serve(listener)
+
+	return server, listener, nil
+}
+
+// measureBench sends requests through the regular request path from the given number of threads
+// for the given duration, and returns the measured rate.
+func measureBench(config benchConfig, threads int, duration time.Duration) benchResult {
+	collector := newStatsCollector(shardCount())
+	setupShards(collector)
+	latencies.Reset()
+
+	var stop int32
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < threads; i++ {
+		wg.Add(1)
+		go func(sh *shard, id int) {
+			defer wg.Done()
+			for atomic.LoadInt32(&stop) == 0 {
+				for j := 0; j < numOfRequests && atomic.LoadInt32(&stop) == 0; j++ {
+					sendRequest(sh, id, directClient, "")
+				}
+			}
+		}(shardFor(i), i)
+	}
+
+	time.Sleep(duration)
+	atomic.StoreInt32(&stop, 1)
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	for _, s := range shards {
+		s.flush(nil)
+	}
+
+	return benchResult{
+		benchConfig: config,
+		Requests:    collector.Get(CounterRequests),
+		Failures:    collector.Get(CounterFailures),
+		Duration:    elapsed,
+		Latency:     latencies.Snapshot(),
+	}
+}
+
+// printBenchResults prints a table of the measured rates.
+func printBenchResults(results []benchResult) {
+	fmt.Printf("\n--- BENCH ---\n")
+	fmt.Printf("%-8s %10s %9s %12s %10s %10s\n", "LOGGING", "REQUESTS", "FAILURES", "REQUESTS/S", "P50", "P99")
+	for _, r := range results {
+		logging := "off"
+		if r.Logging {
+			logging = "on"
+		}
+		fmt.Printf("%-8s %10d %9d %12.0f %10s %10s\n",
+			logging, r.Requests, r.Failures, float64(r.Requests)/r.Duration.Seconds(),
+			roundDuration(r.Latency.P50), roundDuration(r.Latency.P99))
+	}
+	fmt.Printf("-------------\n")
+}
@@ -0,0 +1,70 @@
+// bodybuf.go contains the pool of buffers response bodies are read into, so high-throughput runs reuse
+// a small set of buffers instead of allocating a fresh one for every response, and the memory stats
+// reported at the end of a run to verify it.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// bodyBuffers holds the buffers response bodies are read into
+var bodyBuffers sync.Pool
+
+// readBody reads a response body into a pooled buffer, counting a newly allocated buffer in the shard's slot.
+// The buffer must be handed back with releaseBody once the body is no longer used, also if reading failed.
+func readBody(sh *shard, r io.Reader) (*bytes.Buffer, error) {
+	buf, ok := bodyBuffers.Get().(*bytes.Buffer)
+	if !ok {
+		buf = new(bytes.Buffer)
+		sh.count(CounterBodyBuffers)
+	}
+	buf.Reset()
+	_, err := buf.ReadFrom(r)
+	return buf, err
+}
+
+// releaseBody returns a buffer to the pool. Buffers grown beyond bodyBufferMaxPooled are dropped,
+// so a few huge responses do not keep their memory for the rest of the run.
+func releaseBody(buf *bytes.Buffer) {
+	if buf.Cap() > bodyBufferMaxPooled {
+		return
+	}
+	bodyBuffers.Put(buf)
+}
+
+// MemoryStats is the allocation activity of a run.
+type MemoryStats struct {
+	BodyBuffers int64 // Body buffers allocated; every other body read reused a pooled buffer
+	TotalAlloc  uint64
+	Mallocs     uint64
+	NumGC       uint32
+	PauseTotal  time.Duration
+}
+
+// currentMemoryStats returns the allocation activity of the process so far, with the body buffers counted by collector.
+func currentMemoryStats(collector *StatsCollector) MemoryStats {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return MemoryStats{
+		BodyBuffers: collector.Get(CounterBodyBuffers),
+		TotalAlloc:  m.TotalAlloc,
+		Mallocs:     m.Mallocs,
+		NumGC:       m.NumGC,
+		PauseTotal:  time.Duration(m.PauseTotalNs),
+	}
+}
+
+// printMemorySummary prints the allocation activity of a run that read the given number of response bodies.
+func printMemorySummary(memory MemoryStats, bodies int64) {
+	fmt.Printf("\n--- MEMORY ---\n")
+	fmt.Printf("Body buffers allocated: %d for %d bodies\n", memory.BodyBuffers, bodies)
+	fmt.Printf("Allocated: %s in %d allocations\n", formatBytes(int64(memory.TotalAlloc)), memory.Mallocs)
+	fmt.Printf("GC cycles: %d (%s paused)\n", memory.NumGC, memory.PauseTotal.Round(time.Microsecond))
+	fmt.Printf("------------------\n")
+}
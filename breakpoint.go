@@ -0,0 +1,166 @@
+// breakpoint.go contains the break-point mode, which raises the target rate step by step until the error rate
+// or p95 latency objective is violated, backs off to confirm the last sustainable step, and then ends the run,
+// reporting the highest throughput the target sustained.
+
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// breakpoint holds the steps and outcome of the break-point search
+var breakpoint = &BreakpointSearch{}
+
+// BreakpointStep is the outcome of running at one target rate for breakpointStepDuration.
+type BreakpointStep struct {
+	TargetRPS   float64
+	AchievedRPS float64
+	ErrorRate   float64
+	P95         time.Duration
+	Passed      bool // Whether the error rate and p95 latency objectives held
+	Confirming  bool // Whether the step re-checked a lower rate after a violation
+}
+
+// BreakpointSearch records the steps of the break-point search and its outcome.
+// It is safe for concurrent use.
+type BreakpointSearch struct {
+	mu          sync.Mutex
+	steps       []BreakpointStep
+	broken      *BreakpointStep // First step that violated an objective
+	sustainable *BreakpointStep // Confirmed highest step that held the objectives
+}
+
+// startBreakpointSearch runs the break-point search if breakpointMode is set, and stops the run when it is done.
+func startBreakpointSearch(collector *StatsCollector) {
+	if !breakpointMode {
+		return
+	}
+
+	go func() {
+		rate := breakpointStartRPS
+		var lastPassed *BreakpointStep
+		confirming := false
+
+		for !stopping() {
+			step, ok := measureBreakpointStep(collector, rate, confirming)
+			if !ok {
+				return
+			}
+			breakpoint.add(step)
+
+			switch {
+			case step.Passed && confirming:
+				// The lower rate held again, so it is the sustainable one
+				breakpoint.finish(&step)
+				requestStop()
+				return
+			case step.Passed:
+				lastPassed = &step
+				rate += breakpointStepRPS
+			default:
+				// Back off one step and confirm that rate holds
+				if !confirming {
+					breakpoint.markBroken(step)
+					confirming = true
+					if lastPassed != nil {
+						rate = lastPassed.TargetRPS
+						break
+					}
+				}
+				rate -= breakpointStepRPS
+				if rate <= 0 {
+					breakpoint.finish(nil)
+					requestStop()
+					return
+				}
+			}
+		}
+	}()
+}
+
+// measureBreakpointStep runs at the given rate for breakpointStepDuration and measures the outcome.
+// It returns false if the run stopped during the step.
+func measureBreakpointStep(collector *StatsCollector, rate float64, confirming bool) (BreakpointStep, bool) {
+	runControl.SetRPS(rate)
+	before := collector.Snapshot()
+	beforeBuckets := latencies.Buckets()
+
+	timer := time.NewTimer(breakpointStepDuration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-runCtx.Done():
+		return BreakpointStep{}, false
+	}
+
+	after := collector.Snapshot()
+	p95, _ := intervalQuantile(beforeBuckets, latencies.Buckets(), 0.95)
+	requests := after.Requests - before.Requests
+	step := BreakpointStep{
+		TargetRPS:   rate,
+		AchievedRPS: perSecond(requests, breakpointStepDuration),
+		P95:         p95,
+		Confirming:  confirming,
+	}
+	if requests > 0 {
+		step.ErrorRate = float64(after.Failures-before.Failures) / float64(requests)
+	}
+	step.Passed = step.ErrorRate <= breakpointMaxErrorRate && step.P95 <= breakpointMaxP95
+	return step, true
+}
+
+// add appends a step to the search.
+func (b *BreakpointSearch) add(step BreakpointStep) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.steps = append(b.steps, step)
+}
+
+// markBroken records the first step that violated an objective.
+func (b *BreakpointSearch) markBroken(step BreakpointStep) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.broken = &step
+}
+
+// finish records the confirmed sustainable step, or nil if no step held the objectives.
+func (b *BreakpointSearch) finish(sustainable *BreakpointStep) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.sustainable = sustainable
+}
+
+// printBreakpointSummary prints the steps of the search and the last sustainable throughput.
+func printBreakpointSummary() {
+	breakpoint.mu.Lock()
+	defer breakpoint.mu.Unlock()
+
+	fmt.Printf("\n--- BREAK POINT ---\n")
+	fmt.Printf("Objectives: error rate <= %.1f%%, p95 <= %s\n", 100*breakpointMaxErrorRate, breakpointMaxP95)
+	fmt.Printf("%10s %12s %10s %10s %s\n", "TARGET", "ACHIEVED", "ERRORS", "P95", "")
+	for _, s := range breakpoint.steps {
+		verdict := "held"
+		if !s.Passed {
+			verdict = "VIOLATED"
+		}
+		if s.Confirming {
+			verdict += " (confirming)"
+		}
+		fmt.Printf("%10.1f %12.1f %9.1f%% %10s %s\n", s.TargetRPS, s.AchievedRPS, 100*s.ErrorRate, s.P95.Round(time.Millisecond), verdict)
+	}
+
+	switch {
+	case breakpoint.sustainable != nil:
+		fmt.Printf("Last sustainable throughput: %.1f requests/s (target %.1f)\n", breakpoint.sustainable.AchievedRPS, breakpoint.sustainable.TargetRPS)
+		if breakpoint.broken != nil {
+			fmt.Printf("Broke at: target %.1f requests/s\n", breakpoint.broken.TargetRPS)
+		}
+	case breakpoint.broken != nil:
+		fmt.Printf("No rate held the objectives; the first step already broke at %.1f requests/s\n", breakpoint.broken.TargetRPS)
+	default:
+		fmt.Printf("The run ended before the break point was found\n")
+	}
+	fmt.Printf("-------------------\n")
+}
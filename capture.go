@@ -0,0 +1,84 @@
+// capture.go contains the response body capture, which saves every captureEvery-th response body, and optionally
+// every response with an error status, to a directory, so anomalous responses found in the stats can be inspected afterwards.
+// The file names encode the sequence number, status code, parameter, and proxy of the response.
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+)
+
+// captureDirPath is the directory response bodies are saved to; empty if capturing is disabled
+var captureDirPath string
+
+// captureResponses counts the responses considered for capture, to pick every captureEvery-th one
+var captureResponses uint64
+
+// capturedBodies counts the response bodies saved
+var capturedBodies uint64
+
+// setupCapture creates the capture directory in dir, if capturing is enabled.
+func setupCapture(dir string) error {
+	if captureDir == "" || discardBodies || (captureEvery <= 0 && !captureErrorStatuses) {
+		return nil
+	}
+
+	path := filepath.Join(dir, captureDir)
+	if err := os.MkdirAll(path, 0755); err != nil {
+		slog.Error("Error in setupCapture", "component", componentOutput, "error", err)
+		return fmt.Errorf("Failed to create capture directory: %w", err)
+	}
+	captureDirPath = path
+
+	return nil
+}
+
+// captureBody saves a response body if it is due for capture: it is the captureEvery-th response,
+// or it has an error status and captureErrorStatuses is set.
+func captureBody(summary RequestSummary, body []byte) {
+	n := atomic.AddUint64(&captureResponses, 1)
+	sampled := captureEvery > 0 && n%captureEvery == 0
+	if !sampled && !(captureErrorStatuses && summary.StatusCode >= 400) {
+		return
+	}
+
+	proxy := "direct"
+	if summary.Proxy != "" {
+		proxy = summary.Proxy
+		if u, err := url.Parse(summary.Proxy); err == nil && u.Host != "" {
+			proxy = u.Host
+		}
+	}
+	name := fmt.Sprintf("%08d_%d_%s_%s.body", n, summary.StatusCode, captureNamePart(summary.Parameter), captureNamePart(proxy))
+
+	if err := os.WriteFile(filepath.Join(captureDirPath, name), body, 0644); err != nil {
+		slog.Error("Failed to capture response body", "component", componentOutput, "error", err)
+		return
+	}
+	atomic.AddUint64(&capturedBodies, 1)
+}
+
+// captureNamePart makes s safe to use in a file name, replacing unsafe characters and limiting its length.
+func captureNamePart(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' || r == '=' {
+			return r
+		}
+		return '_'
+	}, s)
+	if len(s) > 64 {
+		s = s[:64]
+	}
+	return s
+}
+
+// printCaptureSummary prints how many response bodies were saved and where.
+func printCaptureSummary() {
+	fmt.Printf("\nCaptured %d response bodies to %s\n", atomic.LoadUint64(&capturedBodies), captureDirPath)
+}
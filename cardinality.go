@@ -0,0 +1,184 @@
+// cardinality.go contains the tracking of the distinct values of a configured JSON response field,
+// used to verify that randomized parameters actually reach distinct data.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// fieldValues tracks the distinct values of cardinalityField across responses
+var fieldValues = newFieldTracker(cardinalityField, cardinalityMaxValues)
+
+// FieldTracker counts how often each distinct value of a JSON field appears in responses.
+// It is safe for concurrent use.
+type FieldTracker struct {
+	path      []string
+	maxValues int
+
+	mu       sync.Mutex
+	counts   map[string]int64
+	overflow int64 // Occurrences of values not tracked because maxValues was reached
+	missing  int64 // Responses without the field or that are not JSON
+}
+
+// FieldValueCount is the number of occurrences of one distinct field value.
+type FieldValueCount struct {
+	Value string
+	Count int64
+}
+
+// newFieldTracker creates a tracker for the field at the given dot-separated path,
+// tracking at most maxValues distinct values.
+func newFieldTracker(field string, maxValues int) *FieldTracker {
+	return &FieldTracker{
+		path:      strings.Split(field, "."),
+		maxValues: maxValues,
+		counts:    make(map[string]int64),
+	}
+}
+
+// Observe decodes a response body as JSON and counts the values of the tracked field.
+// Numeric path segments index into arrays; other segments are applied to every element of an array.
+func (t *FieldTracker) Observe(body []byte) {
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		t.ObserveValues(nil)
+		return
+	}
+
+	values := lookupField(doc, t.path)
+	keys := make([]string, len(values))
+	for i, value := range values {
+		keys[i] = formatFieldValue(value)
+	}
+	t.ObserveValues(keys)
+}
+
+// ObserveValues counts the values found in one response. A response without values is counted as missing.
+func (t *FieldTracker) ObserveValues(values []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(values) == 0 {
+		t.missing++
+		return
+	}
+	for _, key := range values {
+		if _, ok := t.counts[key]; !ok && len(t.counts) >= t.maxValues {
+			t.overflow++
+			continue
+		}
+		t.counts[key]++
+	}
+}
+
+// Values returns the counted values, most frequent first.
+func (t *FieldTracker) Values() []FieldValueCount {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	values := make([]FieldValueCount, 0, len(t.counts))
+	for value, count := range t.counts {
+		values = append(values, FieldValueCount{Value: value, Count: count})
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if values[i].Count != values[j].Count {
+			return values[i].Count > values[j].Count
+		}
+		return values[i].Value < values[j].Value
+	})
+
+	return values
+}
+
+// Untracked returns the number of occurrences not tracked because maxValues was reached,
+// and the number of responses without the field.
+func (t *FieldTracker) Untracked() (overflow int64, missing int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.overflow, t.missing
+}
+
+// lookupField returns the values at path in a decoded JSON document.
+func lookupField(doc interface{}, path []string) []interface{} {
+	if len(path) == 0 {
+		return []interface{}{doc}
+	}
+
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		child, ok := node[path[0]]
+		if !ok {
+			return nil
+		}
+		return lookupField(child, path[1:])
+	case []interface{}:
+		if i, err := strconv.Atoi(path[0]); err == nil {
+			if i < 0 || i >= len(node) {
+				return nil
+			}
+			return lookupField(node[i], path[1:])
+		}
+		var values []interface{}
+		for _, element := range node {
+			values = append(values, lookupField(element, path)...)
+		}
+		return values
+	default:
+		return nil
+	}
+}
+
+// formatFieldValue formats a decoded JSON value as the key it is counted under.
+func formatFieldValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case nil:
+		return "null"
+	case map[string]interface{}, []interface{}:
+		encoded, _ := json.Marshal(v)
+		return string(encoded)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// printFieldCardinality prints the number of distinct values of the tracked field
+// and the most frequent ones.
+func printFieldCardinality() {
+	printValueCounts("FIELD "+cardinalityField, fieldValues, "Responses without the field")
+}
+
+// printValueCounts prints the distinct values counted by a tracker under the given title, most frequent first,
+// labelling the number of responses without a value with missingLabel.
+func printValueCounts(title string, tracker *FieldTracker, missingLabel string) {
+	values := tracker.Values()
+	overflow, missing := tracker.Untracked()
+
+	var total int64
+	for _, value := range values {
+		total += value.Count
+	}
+
+	fmt.Printf("\n--- %s ---\n", title)
+	fmt.Printf("Distinct values: %d\n", len(values))
+	if overflow > 0 {
+		fmt.Printf("Untracked occurrences (over %d distinct values): %d\n", cardinalityMaxValues, overflow)
+	}
+	fmt.Printf("%s: %d\n", missingLabel, missing)
+	for i, value := range values {
+		if i == cardinalityTopValues {
+			fmt.Printf("... %d more\n", len(values)-i)
+			break
+		}
+		fmt.Printf("%-40s %9d (%.1f%%)\n", value.Value, value.Count, 100*float64(value.Count)/float64(total))
+	}
+	fmt.Printf("------------------\n")
+}
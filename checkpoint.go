@@ -0,0 +1,146 @@
+// checkpoint.go contains the run checkpoints, which periodically save the state of a run to a file:
+// the requests sent so far, the proxies in circulation, and the aggregated stats. A run interrupted by a crash
+// or a reboot is continued from its last checkpoint with -resume, without validating the whole proxy list again.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/vbauerster/mpb/v7"
+)
+
+// Checkpoint is the saved state of a run.
+type Checkpoint struct {
+	SavedAt   time.Time         `json:"saved_at"`
+	Target    string            `json:"target"`
+	Budget    int64             `json:"budget"`
+	Elapsed   time.Duration     `json:"elapsed_ns"`
+	Proxies   []string          `json:"proxies"`
+	Stats     StatsSnapshot     `json:"stats"`
+	Latencies []HistogramBucket `json:"latencies"`
+}
+
+// takeCheckpoint captures the current state of a run that started at start.
+func takeCheckpoint(collector *StatsCollector, start time.Time) Checkpoint {
+	checkpoint := Checkpoint{
+		SavedAt:   time.Now(),
+		Target:    requestTarget,
+		Budget:    totalRequestBudget(),
+		Elapsed:   time.Since(start),
+		Proxies:   make([]string, 0),
+		Stats:     collector.Snapshot(),
+		Latencies: latencies.Buckets(),
+	}
+	activeProxies.Range(func(key, value interface{}) bool {
+		checkpoint.Proxies = append(checkpoint.Proxies, key.(string))
+		return true
+	})
+	return checkpoint
+}
+
+// writeCheckpoint writes a checkpoint to the file at path, replacing it atomically.
+func writeCheckpoint(path string, checkpoint Checkpoint) error {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		slog.Error("Error in writeCheckpoint", "component", componentOutput, "error", err)
+		return fmt.Errorf("Failed to encode checkpoint: %w", err)
+	}
+	if err := replaceFile(path, data); err != nil {
+		slog.Error("Error in writeCheckpoint", "component", componentOutput, "error", err)
+		return fmt.Errorf("Failed to replace checkpoint file: %w", err)
+	}
+	return nil
+}
+
+// readCheckpoint reads the checkpoint file at path.
+// It returns an error if the checkpoint was saved by a run against a different target or with a different request budget.
+func readCheckpoint(path string) (*Checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		slog.Error("Error in readCheckpoint", "component", componentInput, "error", err)
+		return nil, fmt.Errorf("Failed to read checkpoint file: %w", err)
+	}
+
+	var checkpoint Checkpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		slog.Error("Error in readCheckpoint", "component", componentInput, "error", err)
+		return nil, fmt.Errorf("Failed to parse checkpoint file: %w", err)
+	}
+	if checkpoint.Target != requestTarget {
+		return nil, fmt.Errorf("checkpoint is for target %s, not %s", checkpoint.Target, requestTarget)
+	}
+	if !runIndefinitely && checkpoint.Budget != totalRequestBudget() {
+		return nil, fmt.Errorf("checkpoint has a budget of %d requests, not %d", checkpoint.Budget, totalRequestBudget())
+	}
+
+	return &checkpoint, nil
+}
+
+// resumeFromCheckpoint restores the state saved in a checkpoint before the threads start:
+// the stats and latencies continue from the saved counts, the progress bar and the request budget account for
+// the requests already sent, and the saved proxies go straight into the pool without being validated again.
+// It returns the start time of the resumed run, shifted back by the time the run had already lasted.
+func resumeFromCheckpoint(checkpoint *Checkpoint, collector *StatsCollector, bar *mpb.Bar) time.Time {
+	collector.Restore(checkpoint.Stats)
+	for _, bucket := range checkpoint.Latencies {
+		latencies.RecordN(bucket.UpperBound, bucket.Count)
+	}
+
+	// The bar tracks the request budget, so it resumes where the budget does; requests of a batch
+	// that was cut short by the checkpoint were started but never counted against the budget
+	bar.SetCurrent(checkpoint.Stats.BudgetUsed)
+
+	if useProxy {
+		for _, proxy := range checkpoint.Proxies {
+			if _, exists := activeProxies.LoadOrStore(proxy, true); !exists {
+				proxiesPool.Add(proxy)
+			}
+		}
+	}
+
+	fmt.Printf("Resuming run from checkpoint saved at %s: %d requests sent, %d proxies restored\n",
+		checkpoint.SavedAt.Format(time.RFC3339), checkpoint.Stats.Requests, len(checkpoint.Proxies))
+
+	return time.Now().Add(-checkpoint.Elapsed)
+}
+
+// startCheckpoints replaces the checkpoint file at path every checkpointInterval until ctx is cancelled.
+// It returns a function that writes the final checkpoint once ctx is cancelled, or nil if checkpoints are disabled.
+func startCheckpoints(ctx context.Context, collector *StatsCollector, path string, start time.Time) func() {
+	if checkpointInterval <= 0 {
+		return nil
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(checkpointInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := writeCheckpoint(path, takeCheckpoint(collector, start)); err != nil {
+					slog.Error("Failed to write checkpoint", "component", componentOutput, "error", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// The final checkpoint is written once the periodic writer has returned, so it cannot be overwritten by an older one
+	return func() {
+		<-stopped
+		if err := writeCheckpoint(path, takeCheckpoint(collector, start)); err != nil {
+			slog.Error("Failed to write checkpoint", "component", componentOutput, "error", err)
+		}
+	}
+}
@@ -1,4 +1,5 @@
-// client.go contains the function to create a new HTTP client with proxy support.
+// client.go contains the functions to create HTTP clients with proxy support,
+// and the shared client used for direct connections when proxies are disabled.
 
 package main
 
@@ -6,33 +7,69 @@ import (
 	"context"
 	"fmt"
 	"golang.org/x/net/proxy"
-	"log"
+	"log/slog"
 	"net"
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 )
 
-// httpClientPool is a channel that holds HTTP clients.
-// It has a capacity of numOfThreads.
-var httpClientPool = make(chan *http.Client, numOfThreads)
+// directClient is the shared HTTP client used by every thread when useProxy is disabled, created once the flags are parsed
+var directClient *http.Client
 
-// createProxyClient creates a new HTTP client with proxy support.
-// It tries to create a client with the given proxy URL.
-// If it fails, it retries up to retryCount times.
-// If it succeeds, it adds the client to the HTTP client pool.
-// If there is a client available in the pool, it returns that client.
-// If there is no client available in the pool, it creates a new client.
+// httpClients caches one HTTP client per proxy URL.
+// Clients are reused across batches so that a proxy's connections can be kept alive.
+var httpClients sync.Map
+
+// createProxyClient returns the cached HTTP client for the given proxy URL.
+// If no client is cached for the proxy URL yet, it creates one with newProxyClient and adds it to the cache.
 // The function takes a string argument proxyURL which is the URL of the proxy to use.
 // It returns a pointer to an http.Client and an error.
 func createProxyClient(proxyURL string) (*http.Client, error) {
-	// If there is a client available in the pool, return it
-	select {
-	case client := <-httpClientPool:
-		return client, nil
-	default:
+	// If there is a client cached for this proxy, return it
+	if client, ok := httpClients.Load(proxyURL); ok {
+		return client.(*http.Client), nil
+	}
+
+	client, err := newProxyClient(proxyURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// Add the client to the cache, preferring a client stored concurrently for the same proxy
+	actual, _ := httpClients.LoadOrStore(proxyURL, client)
+
+	return actual.(*http.Client), nil
+}
+
+// newProxyClient creates a new HTTP client with proxy support.
+// The function takes a string argument proxyURL which is the URL of the proxy to use.
+// It returns a pointer to an http.Client and an error.
+func newProxyClient(proxyURL string) (*http.Client, error) {
+	dialer, err := newProxyDialer(proxyURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create an HTTP transport with the dialer
+	httpTransport := newTransport(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return dialProxy(ctx, dialer, network, dialTarget(addr))
+	}, *maxIdleConnsFlag, *maxIdleConnsPerHostFlag)
+
+	// Create an HTTP client with the transport
+	client := &http.Client{
+		Transport:     httpTransport,
+		Timeout:       *requestTimeoutFlag,
+		CheckRedirect: checkRedirect,
 	}
 
+	return client, nil
+}
+
+// newProxyDialer creates a SOCKS5 dialer for the given proxy URL.
+// If it fails, it retries up to retryCount times.
+func newProxyDialer(proxyURL string) (proxy.Dialer, error) {
 	// If the proxy URL does not start with "socks5://", add it
 	if !strings.HasPrefix(proxyURL, "socks5://") {
 		proxyURL = "socks5://" + proxyURL
@@ -41,7 +78,7 @@ func createProxyClient(proxyURL string) (*http.Client, error) {
 	// Parse the proxy URL
 	u, err := url.Parse(proxyURL)
 	if err != nil {
-		log.Printf("Error in createProxyClient: %v", err)
+		slog.Error("Error in createProxyClient", "component", componentClient, "proxy", proxyURL, "error", err)
 		return nil, fmt.Errorf("Failed to parse proxy URL: %w", err)
 	}
 
@@ -58,36 +95,115 @@ func createProxyClient(proxyURL string) (*http.Client, error) {
 	// Try to create a dialer up to retryCount times
 	var dialer proxy.Dialer
 	for i := 0; i < retryCount; i++ {
-		dialer, err = proxy.SOCKS5("tcp", u.Host, auth, proxy.Direct)
+		dialer, err = proxy.SOCKS5(dialNetwork(), u.Host, auth, newDialer())
 		if err == nil {
 			break
 		}
 	}
 	if err != nil {
-		log.Printf("Error in createProxyClient: %v", err)
+		slog.Error("Error in createProxyClient", "component", componentClient, "proxy", proxyURL, "error", err)
 		return nil, fmt.Errorf("Failed to create dialer after %d attempts: %w", retryCount, err)
 	}
 
-	// Create an HTTP transport with the dialer
-	httpTransport := &http.Transport{
-		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
-			return dialer.Dial(network, addr)
-		},
-		ForceAttemptHTTP2:     forceAttemptHTTP2,
-		MaxIdleConns:          maxIdleConns,
-		IdleConnTimeout:       idleConnTimeout,
-		TLSHandshakeTimeout:   tlsHandshakeTimeout,
-		ExpectContinueTimeout: expectContinueTimeout,
+	return dialer, nil
+}
+
+// dialProxy dials addr through a proxy dialer, giving up when ctx is done.
+// Dialers that cannot take a context are raced against ctx, and a connection they open after ctx is done is closed.
+func dialProxy(ctx context.Context, dialer proxy.Dialer, network, addr string) (net.Conn, error) {
+	if contextDialer, ok := dialer.(proxy.ContextDialer); ok {
+		return contextDialer.DialContext(ctx, network, addr)
 	}
 
-	// Create an HTTP client with the transport
-	client := &http.Client{
-		Transport: httpTransport,
-		Timeout:   clientTimeout,
+	type dialResult struct {
+		conn net.Conn
+		err  error
 	}
+	done := make(chan dialResult, 1)
+	go func() {
+		conn, err := dialer.Dial(network, addr)
+		done <- dialResult{conn, err}
+	}()
+	select {
+	case result := <-done:
+		return result.conn, result.err
+	case <-ctx.Done():
+		go func() {
+			if result := <-done; result.conn != nil {
+				result.conn.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
 
-	// Add the client to the pool
-	httpClientPool <- client
+// newDirectClient creates the HTTP client for direct connections.
+// It is shared by all threads, so its transport keeps enough idle connections to the target for every thread,
+// and counts every connection it dials so the stats can tell new connections from reused ones.
+func newDirectClient() *http.Client {
+	dialer := newDialer()
+	httpTransport := newTransport(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		countInContext(ctx, CounterDirectDials)
+		return dialDirect(ctx, dialer, addr)
+	}, *maxIdleConnsFlag+numOfThreads, directIdleConnsPerHost())
 
-	return client, nil
+	return &http.Client{
+		Transport:     httpTransport,
+		Timeout:       *requestTimeoutFlag,
+		CheckRedirect: checkRedirect,
+	}
+}
+
+// dialDirect opens a direct connection for addr with dialer: to the Unix domain socket if one is configured,
+// and otherwise to the dial target of addr, resolved through the DNS cache if it is enabled,
+// over the configured IP version and from the next source address.
+func dialDirect(ctx context.Context, dialer *net.Dialer, addr string) (net.Conn, error) {
+	if unixSocketPath != "" {
+		return dialer.DialContext(ctx, "unix", unixSocketPath)
+	}
+	target := dialTarget(addr)
+	if dnsCacheTTL > 0 || dohURL != "" {
+		var err error
+		if target, err = resolveCached(ctx, target); err != nil {
+			return nil, err
+		}
+	}
+	return sourceDialer(dialer).DialContext(ctx, dialNetwork(), target)
+}
+
+// dialTarget returns the address the clients dial for a connection to addr: the -resolve mapping of addr if it has one,
+// dialAddress if it is set and addr is the target's address, and addr otherwise, so proxy tests still reach the test URL.
+func dialTarget(addr string) string {
+	if mapped, ok := resolveOverrides[addr]; ok {
+		return mapped
+	}
+	if dialAddress == "" {
+		return addr
+	}
+	target, err := url.Parse(requestTarget)
+	if err != nil {
+		return addr
+	}
+	port := target.Port()
+	if port == "" {
+		port = "80"
+		if target.Scheme == "https" {
+			port = "443"
+		}
+	}
+	if addr != net.JoinHostPort(target.Hostname(), port) {
+		return addr
+	}
+	return dialAddress
+}
+
+// discardProxyClient removes the cached clients for a proxy URL, including the shard caches,
+// and closes their idle connections.
+func discardProxyClient(proxyURL string) {
+	if client, ok := httpClients.LoadAndDelete(proxyURL); ok {
+		client.(*http.Client).CloseIdleConnections()
+	}
+	for _, s := range shards {
+		s.discardClient(proxyURL)
+	}
 }
@@ -0,0 +1,264 @@
+// collector.go contains the StatsCollector, which holds the run's counters in padded per-shard slots
+// so threads in different shards never write to the same cache line, and sums them on demand.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// Counter identifies a counter in the StatsCollector.
+type Counter int
+
+// The counters kept by the StatsCollector
+const (
+	CounterRequests             Counter = iota // Requests started
+	CounterSuccesses                           // Requests that received a response with a success status that passed the assertions
+	CounterFailures                            // Requests that failed
+	CounterHeadersOnly                         // Responses whose body was intentionally left unread
+	CounterProxySuccesses                      // Proxies that passed validation
+	CounterProxyFailures                       // Proxies that failed validation
+	CounterBytesIn                             // Response body bytes read, after decompression
+	CounterDirectDials                         // Connections dialed by the direct client
+	CounterBudgetUsed                          // Requests counted against the request budget when their batch ends
+	CounterBodyBuffers                         // Response body buffers allocated by the buffer pool
+	CounterTruncated                           // Response bodies cut off at maxBodySize
+	CounterRedirects                           // Redirects followed
+	CounterWireBytes                           // Response body bytes received on the wire, before decompression
+	CounterWebSocketConnects                   // Websocket connections opened
+	CounterWebSocketDisconnects                // Websocket connections lost mid-session
+	CounterDNSCacheHits                        // Direct connections dialed with a cached address
+	CounterDNSCacheMisses                      // Direct connections that resolved their host
+	CounterNewConnections                      // Requests sent on a newly opened connection
+	CounterReusedConnections                   // Requests sent on a reused idle connection
+	CounterRetries                             // Requests sent again after failing without a response; not counted in CounterRequests
+	CounterRetriesDenied                       // Retries refused because the retry budget was used up
+	CounterSlowRequests                        // Requests that took longer than the slow request threshold
+	numCounters
+)
+
+// statusCodeSlots is the number of status code slots; codes outside 1..599 are counted in slot 0
+const statusCodeSlots = 600
+
+// paddedCounters holds one shard's counters, padded to keep neighbouring shards on separate cache lines.
+type paddedCounters struct {
+	values   [numCounters]int64
+	statuses [statusCodeSlots]int64
+	errors   [numErrorClasses]int64
+	_        [cacheLinePad]byte
+}
+
+// StatsCollector holds 64-bit counters split into per-shard slots.
+// It is safe for concurrent use.
+type StatsCollector struct {
+	shards []paddedCounters
+}
+
+// StatsSnapshot is a point-in-time sum of all counters over all shards.
+type StatsSnapshot struct {
+	Requests             int64
+	Successes            int64
+	Failures             int64
+	HeadersOnly          int64
+	ProxySuccesses       int64
+	ProxyFailures        int64
+	BytesIn              int64
+	DirectDials          int64
+	BudgetUsed           int64
+	BodyBuffers          int64
+	Truncated            int64
+	Redirects            int64
+	WireBytes            int64
+	WebSocketConnects    int64
+	WebSocketDisconnects int64
+	DNSCacheHits         int64
+	DNSCacheMisses       int64
+	NewConnections       int64
+	ReusedConnections    int64
+	Retries              int64
+	RetriesDenied        int64
+	SlowRequests         int64
+	StatusCodes          StatusCounts
+	ErrorClasses         ErrorCounts
+}
+
+// ErrorCounts holds the number of failures per error class, indexed by class.
+type ErrorCounts [numErrorClasses]int64
+
+// StatusCounts maps response status codes to the number of responses; code 0 holds codes outside 1..599.
+type StatusCounts map[int]int64
+
+// newStatsCollector creates a StatsCollector with the given number of shard slots.
+func newStatsCollector(shardCount int) *StatsCollector {
+	if shardCount < 1 {
+		shardCount = 1
+	}
+	return &StatsCollector{shards: make([]paddedCounters, shardCount)}
+}
+
+// Add adds delta to a counter in the slot of the given shard.
+// Callers that do not belong to a shard may use any shard index; it is wrapped into range.
+func (c *StatsCollector) Add(shard int, counter Counter, delta int64) {
+	atomic.AddInt64(&c.shards[shard%len(c.shards)].values[counter], delta)
+}
+
+// AddStatus counts a response with the given status code in the slot of the given shard.
+func (c *StatsCollector) AddStatus(shard int, code int) {
+	if code < 1 || code >= statusCodeSlots {
+		code = 0
+	}
+	atomic.AddInt64(&c.shards[shard%len(c.shards)].statuses[code], 1)
+}
+
+// Statuses returns the number of responses per status code over all shards.
+func (c *StatsCollector) Statuses() StatusCounts {
+	counts := make(StatusCounts)
+	for code := 0; code < statusCodeSlots; code++ {
+		var total int64
+		for i := range c.shards {
+			total += atomic.LoadInt64(&c.shards[i].statuses[code])
+		}
+		if total > 0 {
+			counts[code] = total
+		}
+	}
+	return counts
+}
+
+// AddError counts a failure of the given error class in the slot of the given shard.
+func (c *StatsCollector) AddError(shard int, class ErrorClass) {
+	atomic.AddInt64(&c.shards[shard%len(c.shards)].errors[class], 1)
+}
+
+// Errors returns the number of failures per error class over all shards.
+func (c *StatsCollector) Errors() ErrorCounts {
+	var counts ErrorCounts
+	for class := range counts {
+		for i := range c.shards {
+			counts[class] += atomic.LoadInt64(&c.shards[i].errors[class])
+		}
+	}
+	return counts
+}
+
+// Get returns the sum of a counter over all shards.
+func (c *StatsCollector) Get(counter Counter) int64 {
+	var total int64
+	for i := range c.shards {
+		total += atomic.LoadInt64(&c.shards[i].values[counter])
+	}
+	return total
+}
+
+// Snapshot returns the sum of every counter over all shards.
+func (c *StatsCollector) Snapshot() StatsSnapshot {
+	return StatsSnapshot{
+		Requests:             c.Get(CounterRequests),
+		Successes:            c.Get(CounterSuccesses),
+		Failures:             c.Get(CounterFailures),
+		HeadersOnly:          c.Get(CounterHeadersOnly),
+		ProxySuccesses:       c.Get(CounterProxySuccesses),
+		ProxyFailures:        c.Get(CounterProxyFailures),
+		BytesIn:              c.Get(CounterBytesIn),
+		DirectDials:          c.Get(CounterDirectDials),
+		BudgetUsed:           c.Get(CounterBudgetUsed),
+		BodyBuffers:          c.Get(CounterBodyBuffers),
+		Truncated:            c.Get(CounterTruncated),
+		Redirects:            c.Get(CounterRedirects),
+		WireBytes:            c.Get(CounterWireBytes),
+		WebSocketConnects:    c.Get(CounterWebSocketConnects),
+		WebSocketDisconnects: c.Get(CounterWebSocketDisconnects),
+		DNSCacheHits:         c.Get(CounterDNSCacheHits),
+		DNSCacheMisses:       c.Get(CounterDNSCacheMisses),
+		NewConnections:       c.Get(CounterNewConnections),
+		ReusedConnections:    c.Get(CounterReusedConnections),
+		Retries:              c.Get(CounterRetries),
+		RetriesDenied:        c.Get(CounterRetriesDenied),
+		SlowRequests:         c.Get(CounterSlowRequests),
+		StatusCodes:          c.Statuses(),
+		ErrorClasses:         c.Errors(),
+	}
+}
+
+// Restore adds the counts of a snapshot to the slot of the first shard, so a resumed run continues its counts.
+// Body buffer allocations belong to the process that made them and are not restored.
+func (c *StatsCollector) Restore(snapshot StatsSnapshot) {
+	slot := &c.shards[0]
+	for counter, value := range map[Counter]int64{
+		CounterRequests:             snapshot.Requests,
+		CounterSuccesses:            snapshot.Successes,
+		CounterFailures:             snapshot.Failures,
+		CounterHeadersOnly:          snapshot.HeadersOnly,
+		CounterProxySuccesses:       snapshot.ProxySuccesses,
+		CounterProxyFailures:        snapshot.ProxyFailures,
+		CounterBytesIn:              snapshot.BytesIn,
+		CounterDirectDials:          snapshot.DirectDials,
+		CounterBudgetUsed:           snapshot.BudgetUsed,
+		CounterTruncated:            snapshot.Truncated,
+		CounterRedirects:            snapshot.Redirects,
+		CounterWireBytes:            snapshot.WireBytes,
+		CounterWebSocketConnects:    snapshot.WebSocketConnects,
+		CounterWebSocketDisconnects: snapshot.WebSocketDisconnects,
+		CounterDNSCacheHits:         snapshot.DNSCacheHits,
+		CounterDNSCacheMisses:       snapshot.DNSCacheMisses,
+		CounterNewConnections:       snapshot.NewConnections,
+		CounterReusedConnections:    snapshot.ReusedConnections,
+		CounterRetries:              snapshot.Retries,
+		CounterRetriesDenied:        snapshot.RetriesDenied,
+		CounterSlowRequests:         snapshot.SlowRequests,
+	} {
+		atomic.AddInt64(&slot.values[counter], value)
+	}
+	for code, count := range snapshot.StatusCodes {
+		if code < 1 || code >= statusCodeSlots {
+			code = 0
+		}
+		atomic.AddInt64(&slot.statuses[code], count)
+	}
+	for class, count := range snapshot.ErrorClasses {
+		atomic.AddInt64(&slot.errors[class], count)
+	}
+}
+
+// Codes returns the counted status codes in ascending order.
+func (s StatusCounts) Codes() []int {
+	codes := make([]int, 0, len(s))
+	for code := range s {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	return codes
+}
+
+// String formats the counts as "code=count" pairs in ascending code order.
+func (s StatusCounts) String() string {
+	if len(s) == 0 {
+		return "none"
+	}
+	pairs := make([]string, 0, len(s))
+	for _, code := range s.Codes() {
+		label := fmt.Sprint(code)
+		if code == 0 {
+			label = "other"
+		}
+		pairs = append(pairs, fmt.Sprintf("%s=%d", label, s[code]))
+	}
+	return strings.Join(pairs, " ")
+}
+
+// String formats the non-zero counts as "class=count" pairs.
+func (e ErrorCounts) String() string {
+	pairs := make([]string, 0, len(e))
+	for class, count := range e {
+		if count > 0 {
+			pairs = append(pairs, fmt.Sprintf("%s=%d", ErrorClass(class), count))
+		}
+	}
+	if len(pairs) == 0 {
+		return "none"
+	}
+	return strings.Join(pairs, " ")
+}
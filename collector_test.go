@@ -0,0 +1,41 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestStatsCollectorLargeCounters(t *testing.T) {
+	tests := []struct {
+		name   string
+		shards int
+		deltas []int64
+		want   int64
+	}{
+		{"one shard at 2^31", 1, []int64{math.MaxInt32, 1}, 1 << 31},
+		{"one shard above 2^32", 1, []int64{1 << 32, 1 << 32, 5}, 1<<33 + 5},
+		{"spread over shards", 4, []int64{1 << 31, 1 << 31, 1 << 31, 1 << 31}, 1 << 33},
+		{"near max", 2, []int64{math.MaxInt64 - 10, 10}, math.MaxInt64},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newStatsCollector(tt.shards)
+			for i, delta := range tt.deltas {
+				c.Add(i%tt.shards, CounterRequests, delta)
+			}
+			if got := c.Get(CounterRequests); got != tt.want {
+				t.Errorf("Get() = %d, want %d", got, tt.want)
+			}
+			snapshot := c.Snapshot()
+			if snapshot.Requests != tt.want {
+				t.Errorf("Snapshot().Requests = %d, want %d", snapshot.Requests, tt.want)
+			}
+
+			restored := newStatsCollector(tt.shards)
+			restored.Restore(snapshot)
+			if got := restored.Get(CounterRequests); got != tt.want {
+				t.Errorf("Get() after Restore = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -3,38 +3,288 @@
 package main
 
 import (
+	"log/slog"
 	"sync"
 	"time"
 )
 
 // Constants for the application
 const (
-	baseUrl         = "https://thornode.ninerealms.com/thorchain/pool/BTC.BTC/liquidity_providers?height=%rng(12450000,12810000)" // Base URL for the requests
-	clientTimeout   = 10 * time.Second                                                                                            // HTTP client timeout
-	numOfThreads    = 500                                                                                                         // Number of threads to use
-	numOfRequests   = 10                                                                                                          // Number of requests per thread
-	retryCount      = 3                                                                                                           // Number of times to retry failed requests
-	logFileName     = "requests.log"                                                                                              // Name of the log file
-	proxiesLogName  = "proxies.log"                                                                                               // Name of the proxies log file
-	language        = "EL"                                                                                                        // Accept-Language header value
-	contentType     = "application/xml"                                                                                           // Content-Type header value
-	parametersFile  = "parameters.txt"                                                                                            // File containing the parameters for the requests
-	proxiesFile     = "proxy.txt"                                                                                                 // File containing the proxies
-	runIndefinitely = false                                                                                                       // Whether to run indefinitely
-	fireAndForget   = false                                                                                                       // Whether to send the request and hang up on the response
-	useProxy        = true                                                                                                        // Whether to use proxies
-	testUrl         = "http://api.ipify.org"                                                                                      // Test URL for testing proxies
-
-	forceAttemptHTTP2     = false            // Whether to force HTTP/2 for the HTTP transport
+	baseUrl         = "https://thornode.ninerealms.com/thorchain/pool/BTC.BTC/liquidity_providers?height=%height" // Base URL for the requests; %height, %rng(min,max) and {{...}} template tokens are expanded for every request; unix:///path/to/app.sock:/request/path sends them over a Unix domain socket
+	clientTimeout   = 10 * time.Second                                                                            // HTTP client timeout; the default of the overall deadline of every request
+	numOfThreads    = 500                                                                                         // Number of threads to use
+	numOfRequests   = 10                                                                                          // Number of requests per thread
+	retryCount      = 3                                                                                           // Number of times to retry creating a proxy dialer
+	logFileName     = "requests.log"                                                                              // Name of the log file
+	logLevel        = slog.LevelInfo                                                                              // Lowest level of the JSON records written to the log file; warn drops the per-request success lines
+	proxiesLogName  = "proxies.log"                                                                               // Name of the proxies log file
+	language        = "EL"                                                                                        // Accept-Language header value
+	contentType     = "application/xml"                                                                           // Content-Type header value
+	parametersFile  = "parameters.txt"                                                                            // File containing the parameters for the requests; a line is a name, or name=rng(min,max), name=choice(a,b,c) or name=value to draw its own values
+	proxiesFile     = "proxy.txt"                                                                                 // File containing the proxies
+	runIndefinitely = false                                                                                       // Whether to run indefinitely
+	fireAndForget   = false                                                                                       // Whether to send the request and hang up on the response
+	discardBodies   = false                                                                                       // Whether response bodies are counted and discarded without being kept; disables cardinalityField tracking
+	headersOnly     = false                                                                                       // Whether to close the body as soon as the headers arrive, measuring time to first byte
+	parameterOrder  = "random"                                                                                    // How requests pick their parameter: random, roundrobin or partitioned between the threads, the last two sending every parameter once before picking at random
+	dataFile        = ""                                                                                          // CSV file whose header names the columns {{data column}} tokens take their values from, one row per request; empty disables it
+	dataMode        = "sequential"                                                                                // How requests take the rows of the data file: sequential, random, or partitioned between the threads
+	requestBody     = ""                                                                                          // Body POSTed with every request, {{...}} template tokens expanded; empty sends GET requests without a body
+	useProxy        = true                                                                                        // Whether to use proxies
+	testUrl         = "http://api.ipify.org"                                                                      // Test URL for testing proxies
+
+	parameterSummaryFile = ""    // Name of the per-parameter summary CSV file; empty disables it
+	negotiationSweep     = false // Whether to rotate Accept-Language and Accept across sweepLanguages and sweepAccepts
+
+	latencyHighestTrackable     = 1 * time.Hour // Highest request duration tracked by the latency histogram
+	latencySignificantFigures   = 3             // Number of significant figures kept by the latency histogram
+	parameterSignificantFigures = 2             // Number of significant figures kept by the per-parameter latency histograms
+	statsDisplay                = "block"       // How printStats shows the stats every second: block, delta (single line), or inplace
+
+	statsSnapshotFile     = ""              // Name of the JSON stats snapshot file; empty disables it
+	statsSnapshotInterval = 5 * time.Second // How often the JSON stats snapshot file is replaced; 0 disables it
+
+	cardinalityField     = ""    // Dot-separated path of a JSON response field whose distinct values are tracked; empty disables tracking
+	cardinalityMaxValues = 10000 // Maximum number of distinct field values tracked
+	cardinalityTopValues = 20    // Number of most frequent field values printed at the end of a run
+
+	resultsFile          = ""              // Name of the CSV file one row per request is appended to; empty disables it
+	resultsBufferSize    = 64 * 1024       // Size of the results file write buffer in bytes
+	resultsFlushInterval = 1 * time.Second // How often buffered results are flushed to the results file
+
+	runDirectories = false               // Whether to write the logs and result files of each run to a new directory under runsDir
+	runsDir        = "runs"              // Directory the run directories are created in
+	keepRuns       = 20                  // Number of most recent run directories to keep; 0 keeps all
+	keepRunsFor    = 14 * 24 * time.Hour // Age after which run directories are removed; 0 keeps them forever
+
+	ndjsonOutput = ""   // Name of the file each request is streamed to as a JSON line, or "-" for stdout; empty disables it
+	progressBar  = true // Whether to show the progress bar; must be disabled to stream NDJSON to stdout
+
+	htmlReportFile    = ""              // Name of the HTML report written at the end of a run; empty disables it
+	timelineInterval  = 1 * time.Second // How often throughput is sampled for the HTML report
+	timelineMaxPoints = 7200            // Samples kept in memory; older samples are merged in pairs beyond this, so long runs stay bounded
+
+	rollupFile     = ""              // Name of the NDJSON file a rollup of every rollupInterval is appended to; empty disables it
+	rollupInterval = 5 * time.Minute // Length of the rollup windows; 0 disables rollups
+
+	baselineLatencyTolerance   = 0.10 // Default relative latency and throughput change tolerated when comparing against a baseline
+	baselineErrorRateTolerance = 0.01 // Default absolute error rate increase tolerated when comparing against a baseline
+
+	metricsAddr = "" // Address the Prometheus /metrics endpoint listens on, e.g. ":9090"; empty disables it
+
+	statsdAddr          = ""              // Address of the StatsD/DogStatsD agent metrics are pushed to over UDP, e.g. "127.0.0.1:8125"; empty disables it
+	statsdPrefix        = "jeet."         // Prefix of every StatsD metric name
+	statsdFlushInterval = 1 * time.Second // How often buffered StatsD metrics are sent
+
+	influxUrl               = ""              // URL of the InfluxDB v2 server measurements are written to, e.g. "http://localhost:8086"; empty disables it
+	influxOrg               = ""              // InfluxDB organization
+	influxBucket            = "jeet"          // InfluxDB bucket
+	influxToken             = ""              // InfluxDB API token
+	influxBatchSize         = 5000            // Number of lines written to InfluxDB per batch
+	influxFlushInterval     = 1 * time.Second // How often partial batches are written to InfluxDB
+	influxMaxPendingBatches = 16              // Number of batches queued for InfluxDB before batches are dropped
+
+	errorLogName = "" // Name of the log file that gets only the warnings, errors, and proxy errors; empty disables it
+
+	syslogAddr     = ""     // Syslog endpoint the logs are sent to instead of files: udp://host:514, tcp://host:601, or unix:///dev/log; empty writes files
+	syslogFacility = 16     // Syslog facility of the messages; 16 is local0
+	syslogAppName  = "jeet" // APP-NAME of the syslog messages
+
+	slowRequestThreshold = 0 * time.Second        // Duration above which requests are counted and logged with their phases; 0 disables it
+	logSuccessSample     = 1                      // Log only 1 in this many successful requests; failures are always logged
+	logAsync             = true                   // Whether log records are written by a background goroutine instead of the threads that log them
+	logQueueSize         = 65536                  // Number of log records queued for writing; records beyond it are dropped and counted
+	logBatchSize         = 256 << 10              // Size in bytes of the batches queued log records are written in
+	logFlushInterval     = 500 * time.Millisecond // Longest time a queued log record waits to be written
+
+	logMaxSize   = 100 << 20     // Size in bytes at which requests.log and proxies.log are rotated; 0 disables rotation by size
+	logMaxAge    = 0 * time.Hour // Age at which the log files are rotated; 0 disables rotation by age
+	logRetention = 5             // Number of rotated files kept per log file; 0 keeps them all
+	logCompress  = true          // Whether rotated log files are gzipped
+
+	traceSampleFraction = 0.0 // Fraction of requests that get a W3C traceparent header and an exported client span; 0 disables tracing
+
+	requestIDHeader = "X-Request-ID" // Header every request sends its unique ID in, for matching the target's access log; empty sends no ID
+
+	graphiteAddr     = ""               // Address of the carbon server metrics are sent to, e.g. "graphite:2003"; empty disables it
+	graphitePrefix   = "jeet."          // Prefix of every Graphite metric path
+	graphiteInterval = 10 * time.Second // How often metrics are sent to Graphite
+
+	dashboardRefresh    = 500 * time.Millisecond // How often the terminal dashboard is redrawn
+	dashboardErrorLines = 100                    // Number of recent errors kept for the dashboard's error log
+
+	webDashboardAddr = "" // Address the web dashboard listens on, e.g. "127.0.0.1:8080"; empty disables it
+
+	controlAddr       = ""    // Address the HTTP control API listens on, e.g. "127.0.0.1:8081"; empty disables it
+	targetRPS         = 0     // Initial target requests per second over all threads; 0 means unlimited
+	controlMaxThreads = 10000 // Highest thread count the control API can set
+	poissonArrivals   = false // Whether gaps between requests at the target rate are exponentially distributed instead of fixed
+	perThreadRPS      = 0.0   // Requests per second each thread sends at most; 0 means unlimited
+	perProxyRPS       = 0.0   // Requests per second sent through each proxy at most; 0 means unlimited
+
+	requestRetries   = 0                      // Number of times an idempotent request that failed without a response is sent again; 0 disables retries
+	retryBackoffBase = 100 * time.Millisecond // Longest wait before the first retry; it doubles for every further retry
+	retryBackoffMax  = 5 * time.Second        // Longest wait before any retry
+	retryBudget      = 0.1                    // Retries allowed as a fraction of the requests started so far, so a failing target does not cause a retry storm; 0 means unlimited
+	retryBudgetMin   = 10                     // Retries allowed regardless of the retry budget, so the first failures of a run can be retried
+
+	downloadRatePerConn = 0 // Bytes per second each connection reads at most, to emulate slow clients; 0 means unlimited
+	downloadRateGlobal  = 0 // Bytes per second all connections together read at most; 0 means unlimited
+
+	grpcAddr     = "" // Address the gRPC control plane listens on, e.g. "127.0.0.1:9090"; empty disables it
+	grpcCertFile = "" // TLS certificate of the gRPC control plane; empty uses a self-signed certificate
+	grpcKeyFile  = "" // TLS private key of the gRPC control plane
+
+	workerListenAddr        = ":7070"          // Default address a worker accepts the coordinator's assignment on
+	workerResultTimeout     = 10 * time.Minute // How long a finished worker waits for the coordinator to fetch its result
+	coordinatorStartDelay   = 5 * time.Second  // Default time between assigning the workers and their synchronized start
+	coordinatorPollInterval = 2 * time.Second  // How often the coordinator polls the workers for their results
+
+	eventBusKind              = ""               // Event bus requests and proxy events are published to: "nats" or "kafka"; empty disables it
+	eventBusAddr              = "127.0.0.1:4222" // Address of the NATS server, or of the Kafka broker leading kafkaPartition
+	eventBusSubject           = "jeet.requests"  // NATS subject or Kafka topic events are published to
+	kafkaPartition            = 0                // Kafka partition events are produced to
+	eventBusBatchSize         = 500              // Number of events published at once
+	eventBusFlushInterval     = 1 * time.Second  // How often buffered events are published
+	eventBusMaxPendingBatches = 20               // Batches queued for a slow broker before new batches are dropped
+
+	headerProfile    = ""     // Browser header profile sent instead of the fixed Accept-Language and Content-Type: chrome, firefox, mobile, mixed (one per client), or empty for none
+	acceptEncoding   = "gzip" // Accept-Encoding header sent with every request, e.g. "br, gzip" or "identity"; empty sends none
+	decompressBodies = true   // Whether gzip and deflate bodies are decompressed before they are read; other encodings are read as received
+
+	redirectPolicy = "follow" // How redirects are handled: follow, never (the redirect response is the outcome), or record (follow and record every hop)
+	maxRedirects   = 10       // Number of redirects followed before a request fails
+
+	successStatuses = "200-299,304" // Status codes and inclusive ranges counted as success; other responses are failures of the status class
+	assertBodyRegex = ""            // Regular expression every response body must match; empty disables the assertion
+	assertJSONPath  = ""            // Dot-separated path of a JSON response field that must equal assertJSONValue; empty disables the assertion
+	assertJSONValue = ""            // Value the assertJSONPath field must have, formatted like the cardinality field values
+	assertMinSize   = 0             // Smallest response body size in bytes that passes; 0 disables the bound
+	assertMaxSize   = 0             // Largest response body size in bytes that passes; 0 disables the bound
+
+	captureDir           = ""   // Name of the directory sampled response bodies are saved to; empty disables capturing, as does discardBodies
+	captureEvery         = 1000 // Every how many responses a body is captured; 0 captures only error statuses
+	captureErrorStatuses = true // Whether every response with a 4xx or 5xx status is captured as well
+
+	maxBodySize         = 0       // Bytes of a response body read at most, longer bodies are cut off and counted as truncated; 0 means unlimited
+	bodyBufferMaxPooled = 1 << 20 // Capacity above which a response body buffer is dropped instead of returned to the pool
+
+	checkpointFile     = ""               // Name of the checkpoint file a run can be resumed from with -resume; empty disables it
+	checkpointInterval = 30 * time.Second // How often the checkpoint file is replaced; 0 disables checkpoints
+
+	keyboardControls   = false // Whether keys typed in the terminal steer the run: p pause, r resume, +/- threads, s snapshot, q quit
+	keyboardThreadStep = 10    // Number of threads added or removed by the + and - keys
+
+	runDuration = 0 * time.Minute // How long the run may last before it is stopped and reported; 0 runs until the requests are sent or it is stopped
+
+	websocketMode        = false                // Whether to load-test a websocket endpoint instead of sending HTTP requests; every thread holds one connection and sends numOfRequests messages over it
+	websocketURL         = ""                   // ws:// or wss:// URL of the websocket endpoint; empty uses baseUrl with its scheme switched
+	websocketOrigin      = "http://localhost/"  // Origin header of the websocket handshake
+	websocketMessage     = `{"height":%height}` // Message sent over the websocket; %height and %rng(min,max) are expanded for every message
+	websocketMessageRate = 1.0                  // Messages per second sent over each connection; 0 sends the next message as soon as the reply arrives
+
+	graphqlMode          = false                                                         // Whether to POST the GraphQL query to the target instead of sending GET requests with a query parameter
+	graphqlQuery         = `query Pools($limit: Int) { pools(limit: $limit) { asset } }` // GraphQL query or mutation sent with every request
+	graphqlOperationName = ""                                                            // Name of the operation to run if the query defines several; empty sends none
+	graphqlVariables     = `{"%param": %value}`                                          // JSON template of the variables; %param and %value are the parameter name and value of the request, %height and %rng(min,max) are expanded too
+
+	grpcLoadMode = false                            // Whether to send unary gRPC calls to the target's host instead of HTTP GET requests; needs an https target
+	grpcMethod   = "/package.Service/Method"        // Full name of the gRPC method called
+	grpcPayload  = `{"1":"%height","2":%rng(1,10)}` // JSON template of the request message, keyed by field number; %height, %rng(min,max) and {{...}} template tokens, including {{data column}}, are expanded for every call
+
+	shardingThreshold  = 5000                   // Thread count from which threads are sharded into one group per P; see shardCount for the rationale
+	statsFlushInterval = 100 * time.Millisecond // How often shard stats are aggregated into the global stats
+
+	proxyPoolTarget   = numOfThreads           // Number of healthy proxies the pool maintainer keeps in circulation
+	poolCheckInterval = 500 * time.Millisecond // How often the pool maintainer checks for missing proxies
+	proxyBalancing    = "random"               // Proxy selection strategy: random, round-robin, least-latency, least-outstanding, or weighted
+	proxySharing      = false                  // Whether threads may send through a proxy other threads are using; by default every thread has exclusive use of its proxy
+
+	heightQueryUrl    = "https://thornode.ninerealms.com/thorchain/lastblock" // THORNode endpoint queried for the current height at run start
+	heightWindow      = 360000                                                // Number of most recent blocks %height expands into
+	fallbackMinHeight = 12450000                                              // Lowest height %height expands into if the current height cannot be queried
+	fallbackMaxHeight = 12810000                                              // Highest height %height expands into if the current height cannot be queried
+
+	proxyPoolFloor  = numOfThreads     // Number of healthy proxies below which a warning is emitted; 0 disables it
+	poolAlertGrace  = 30 * time.Second // How long the pool may take to first reach the floor before warnings are emitted
+	alertWebhookUrl = ""               // URL warnings and the run completion are posted to as JSON; empty disables the webhook
+
+	breakpointMode         = false                   // Whether the rate is raised step by step until an objective is violated; best with runIndefinitely
+	breakpointStartRPS     = 10.0                    // Target requests per second of the first step
+	breakpointStepRPS      = 10.0                    // Requests per second added after every step that held the objectives
+	breakpointStepDuration = 30 * time.Second        // How long every step runs
+	breakpointMaxErrorRate = 0.05                    // Error rate above which a step violates the objectives
+	breakpointMaxP95       = 1000 * time.Millisecond // p95 latency above which a step violates the objectives
+
+	adaptiveTargetP95       = 0 * time.Millisecond // p95 latency the thread count is adjusted to hold; 0 disables adaptive concurrency
+	adaptiveInterval        = 5 * time.Second      // How often the adaptive controller adjusts the thread count
+	adaptiveStep            = 10                   // Threads added after an interval at or below the target
+	adaptiveBackoff         = 0.75                 // Factor the thread count is multiplied by after an interval above the target
+	adaptiveMinThreads      = 1                    // Lowest thread count the adaptive controller sets
+	adaptiveMinSamples      = 50                   // Requests needed in an interval before the controller acts on it
+	adaptiveStableIntervals = 6                    // Number of final intervals the reported stable concurrency is averaged over
+
+	abortErrorRate           = 0.0              // Error rate over abortErrorWindow above which the run is aborted; 0 disables it
+	abortErrorWindow         = 30 * time.Second // Sliding window the abort error rate is measured over
+	abortMinRequests         = 100              // Requests needed in the window before its error rate is considered
+	abortConsecutiveFailures = 0                // Number of requests failing in a row that aborts the run; 0 disables it
+	abortOnEmptyPool         = false            // Whether the run is aborted when the proxy pool stays empty
+	abortPoolEmptyFor        = 30 * time.Second // How long the proxy pool must stay empty before the run is aborted
+
+	chatWebhookUrl       = ""              // Slack or Discord incoming webhook the run summary is posted to; empty disables it
+	chatWebhookKind      = ""              // "slack" or "discord"; empty detects Discord from the webhook URL
+	chatProgressInterval = 0 * time.Minute // How often progress updates are posted to the chat webhook; 0 disables them
+
+	errorRateAlertThreshold = 0.0              // Error rate over a check interval above which a warning is emitted; 0 disables it
+	errorRateCheckInterval  = 30 * time.Second // How often the error rate is checked against the threshold
+	errorRateMinRequests    = 100              // Requests needed in a check interval before its error rate is considered
+
+	verificationRun      = false        // Whether to send a tiny fraction of the configured load with full dumps instead of the real run
+	verificationFraction = 0.001        // Fraction of numOfThreads * numOfRequests to send during a verification run
+	verificationDumpFile = "verify.log" // Name of the plain-text file the dumps and traces of a verification run are written to, next to stdout
+
 	maxIdleConns          = 100              // Maximum number of idle connections for the HTTP transport
+	maxIdleConnsPerHost   = 0                // Maximum number of idle connections per host; 0 keeps 2 per proxy client and one per thread for the direct client
+	maxConnsPerHost       = 0                // Maximum number of connections per host, including dialing and active ones; 0 is unlimited
+	disableKeepAlives     = false            // Whether every request opens a new connection instead of reusing idle ones
+	disableCompression    = false            // Whether requests send "Accept-Encoding: identity" instead of acceptEncoding
+	writeBufferSize       = 0                // Size of the transport's write buffer in bytes; 0 uses the Go default of 4KB
+	readBufferSize        = 0                // Size of the transport's read buffer in bytes; 0 uses the Go default of 4KB
+	dialTimeout           = 30 * time.Second // Timeout for establishing a connection; 0 waits up to the overall deadline
+	dialKeepAlive         = 30 * time.Second // Interval of TCP keep-alive probes on open connections; negative disables them
 	idleConnTimeout       = 90 * time.Second // Idle connection timeout for the HTTP transport
 	tlsHandshakeTimeout   = 10 * time.Second // TLS handshake timeout for the HTTP transport
 	expectContinueTimeout = 1 * time.Second  // Expect-continue timeout for the HTTP transport
+	responseHeaderTimeout = 0 * time.Second  // Timeout for the response headers after the request is written; 0 waits up to the overall deadline
+	bodyReadTimeout       = 0 * time.Second  // Longest wait for the next bytes of a response body, so slow bodies that keep arriving are not cut off; 0 waits up to the overall deadline
+	tlsMinVersion         = ""               // Lowest TLS version the clients offer: 1.0, 1.1, 1.2, or 1.3; empty uses the Go default
+	tlsMaxVersion         = ""               // Highest TLS version the clients offer, e.g. 1.2 for TLS 1.2-only clients; empty uses the Go default
+	dnsCacheTTL           = 0 * time.Second  // How long direct connections cache resolved addresses, dialing them in turn, before resolving again; 0 resolves for every connection
+	dohURL                = ""               // DNS-over-HTTPS provider resolving the hosts of direct connections, e.g. "https://cloudflare-dns.com/dns-query"; empty uses the resolver
+	dialAddress           = ""               // Address (host:port) dialed for every request instead of the target's, e.g. an origin server behind a CDN; empty dials the target
+	hostOverride          = ""               // Host header and TLS server name sent instead of the target URL's host; empty sends the URL's host
 )
 
 // Global variables for the application
 var (
-	parameters []string // Parameters for the requests
-	proxies    []string // Proxies to use
-	uniqueIPs  sync.Map // Unique IPs, used to keep track of unique IP addresses
+	parameters   []string               // Parameters for the requests
+	proxies      []string               // Proxies to use
+	proxyWeights = make(map[string]int) // Weights of the proxies for the weighted balancing strategy
+	uniqueIPs    sync.Map               // Unique IPs, used to keep track of unique IP addresses
+
+	sweepLanguages = []string{"EL", "EN", "DE", "FR", "ES"}                       // Accept-Language values rotated in the negotiation sweep
+	sweepAccepts   = []string{"application/json", "application/xml", "text/html"} // Accept values rotated in the negotiation sweep
+
+	trackedHeaders   = []string{"Server", "X-Cache", "CF-Ray", "Content-Encoding"} // Response headers recorded with every request and counted in the report; empty disables it
+	headerAssertions = map[string]string{}                                         // Regular expressions response headers must match, by header name; a missing header fails
+
+	requestHeaders = map[string]string{} // Headers sent with every request after the profile, by header name; {{...}} template tokens in the values are expanded for every request
+
+	tlsCipherSuites = []string{} // Names of the TLS 1.0-1.2 cipher suites the clients offer, e.g. "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"; empty uses the Go default. TLS 1.3 suites cannot be restricted
+
+	sourceAddresses = []string{} // Local IP addresses direct connections bind to in turn, to spread a run over several egress IPs; empty lets the system choose
+
+	dnsServers = []string{} // DNS servers (host:port) queried in turn for direct connections instead of the system resolver, e.g. "1.1.1.1:53"
+
+	statsdTags = []string{} // DogStatsD tags added to every StatsD metric, e.g. "env:staging"; plain StatsD agents need this empty
 )
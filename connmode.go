@@ -0,0 +1,68 @@
+// connmode.go contains the connection mode of the clients: reusing idle connections with keep-alive,
+// or opening a fresh TCP and TLS connection for every request, so connection setup cost and server accept limits
+// can be measured. In both modes the connections opened and reused are counted, and the setup times recorded.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptrace"
+	"time"
+)
+
+// The connection modes of the clients
+const (
+	connectionModeReuse = "reuse" // Keep idle connections and reuse them for later requests
+	connectionModeFresh = "fresh" // Open a new connection for every request and close it with the response
+)
+
+// connectionSetupTimes holds the time it took to get every new connection, including the dial, the proxy handshake,
+// and the TLS handshake
+var connectionSetupTimes = newHistogram(latencyHighestTrackable, latencySignificantFigures)
+
+// validateConnectionMode checks the -connection-mode flag.
+func validateConnectionMode() error {
+	switch *connectionModeFlag {
+	case connectionModeReuse, connectionModeFresh:
+		return nil
+	default:
+		return fmt.Errorf("unknown connection mode %q, expected %s or %s", *connectionModeFlag, connectionModeReuse, connectionModeFresh)
+	}
+}
+
+// freshConnections reports whether every request opens a new connection.
+func freshConnections() bool {
+	return *connectionModeFlag == connectionModeFresh
+}
+
+// withConnectionSetup returns a context that records whether a request reused a connection in reused,
+// and the time it took to get a new connection in setup.
+func withConnectionSetup(ctx context.Context, reused *bool, setup *time.Duration) context.Context {
+	var start time.Time
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GetConn: func(hostPort string) {
+			start = time.Now()
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			*reused = info.Reused
+			if !info.Reused {
+				*setup = time.Since(start)
+			}
+		},
+	})
+}
+
+// printConnectionSummary prints the number of new and reused connections and the setup times of the new ones.
+func printConnectionSummary(snapshot StatsSnapshot) {
+	setup := connectionSetupTimes.Snapshot()
+	fmt.Printf("\n--- CONNECTIONS ---\n")
+	fmt.Printf("Mode: %s\n", *connectionModeFlag)
+	fmt.Printf("New connections: %d, reused: %d\n", snapshot.NewConnections, snapshot.ReusedConnections)
+	if setup.Count > 0 {
+		fmt.Printf("Setup time: mean %s, p50 %s, p95 %s, p99 %s, max %s\n",
+			setup.Mean.Round(time.Millisecond), setup.P50.Round(time.Millisecond), setup.P95.Round(time.Millisecond),
+			setup.P99.Round(time.Millisecond), setup.Max.Round(time.Millisecond))
+	}
+	fmt.Printf("-------------------\n")
+}
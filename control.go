@@ -0,0 +1,128 @@
+// control.go contains the HTTP control API, which lets automation pause and resume a running load test,
+// change its thread count and target rate, drain and stop it, and read its stats, without restarting it.
+
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+)
+
+// startControlServer serves the control API on controlAddr for the lifetime of the run:
+//
+//	GET  /run          the state of the run
+//	POST /run/pause    pause before the next request of every thread
+//	POST /run/resume   resume a paused run
+//	PUT  /run/threads  change the thread count, with a body of {"threads": n}
+//	PUT  /run/rps      change the target requests per second, with a body of {"rps": n}; 0 removes the limit
+//	POST /run/drain    let in-flight requests finish, then stop the run and write its reports
+//	GET  /run/stats    the current stats, in the layout of the stats snapshot file
+func startControlServer(collector *StatsCollector) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/run", controlHandler(http.MethodGet, func(r *http.Request) error {
+		return nil
+	}))
+	mux.HandleFunc("/run/pause", controlHandler(http.MethodPost, func(r *http.Request) error {
+		slog.Info("Run paused from the control API", "component", componentControl, "remote_addr", r.RemoteAddr)
+		runControl.Pause()
+		return nil
+	}))
+	mux.HandleFunc("/run/resume", controlHandler(http.MethodPost, func(r *http.Request) error {
+		slog.Info("Run resumed from the control API", "component", componentControl, "remote_addr", r.RemoteAddr)
+		runControl.Resume()
+		return nil
+	}))
+	mux.HandleFunc("/run/threads", controlHandler(http.MethodPut, func(r *http.Request) error {
+		var body struct {
+			Threads *int `json:"threads"`
+		}
+		if err := decodeControlBody(r, &body); err != nil || body.Threads == nil {
+			return errControlBody
+		}
+		threads := runControl.SetThreads(*body.Threads)
+		slog.Info("Thread count set from the control API", "component", componentControl, "threads", threads, "remote_addr", r.RemoteAddr)
+		return nil
+	}))
+	mux.HandleFunc("/run/rps", controlHandler(http.MethodPut, func(r *http.Request) error {
+		var body struct {
+			RPS *float64 `json:"rps"`
+		}
+		if err := decodeControlBody(r, &body); err != nil || body.RPS == nil {
+			return errControlBody
+		}
+		runControl.SetRPS(*body.RPS)
+		slog.Info("Target rate set from the control API", "component", componentControl, "rps", *body.RPS, "remote_addr", r.RemoteAddr)
+		return nil
+	}))
+	mux.HandleFunc("/run/drain", controlHandler(http.MethodPost, func(r *http.Request) error {
+		slog.Info("Run drained from the control API", "component", componentControl, "remote_addr", r.RemoteAddr)
+		requestStop()
+		return nil
+	}))
+	mux.HandleFunc("/run/stats", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		writeControlJSON(w, newStatsSnapshotJSON(takeStatsSample(collector, 0)))
+	})
+
+	go func() {
+		if err := http.ListenAndServe(controlAddr, mux); err != nil {
+			slog.Error("Control server failed", "component", componentControl, "error", err)
+		}
+	}()
+}
+
+// errControlBody is returned by control actions whose request body is missing or malformed
+var errControlBody = &controlError{status: http.StatusBadRequest, message: "malformed request body"}
+
+// controlError is an error returned by a control action, with the HTTP status it is reported with.
+type controlError struct {
+	status  int
+	message string
+}
+
+// Error returns the message of the error.
+func (e *controlError) Error() string {
+	return e.message
+}
+
+// controlHandler returns a handler that runs action for requests with the given method,
+// and responds with the state of the run.
+func controlHandler(method string, action func(r *http.Request) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := action(r); err != nil {
+			status := http.StatusInternalServerError
+			if cerr, ok := err.(*controlError); ok {
+				status = cerr.status
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		writeControlJSON(w, runControl.State())
+	}
+}
+
+// decodeControlBody decodes the JSON body of a control request into v.
+func decodeControlBody(r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(io.LimitReader(r.Body, 1<<16))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// writeControlJSON writes v as the JSON body of a control response.
+func writeControlJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Failed to write control response", "component", componentControl, "error", err)
+	}
+}
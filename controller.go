@@ -0,0 +1,264 @@
+// controller.go contains the runtime controller, which the threads consult before every request,
+// so a running load test can be paused, resized, and rate limited without restarting it.
+
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// runControl steers the threads of the current run
+var runControl = newRunController()
+
+// RunController holds the adjustable state of a run: whether it is paused, how many threads run,
+// and the target request rate shared by all threads.
+// It is safe for concurrent use. Threads of a run that is neither paused nor rate limited are admitted
+// from atomic copies of the state, without taking the lock.
+type RunController struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	paused  bool
+	threads int          // Number of threads that should be running
+	alive   []bool       // Whether the thread with each index is running
+	lowered []bool       // Whether the thread with each index was told to exit because the thread count was lowered
+	spawn   func(id int) // Starts the thread with the given index
+	rps     float64      // Target requests per second over all threads; 0 means unlimited
+	next    time.Time    // Earliest time the next request may be sent at the target rate
+
+	// Atomic copies of the state for the lock-free admission, updated under the lock
+	fastPaused  int32 // 1 while paused
+	fastLimited int32 // 1 while rps is set
+	fastThreads int64 // Copy of threads
+}
+
+// RunState is the adjustable state of a run as reported by the control API.
+type RunState struct {
+	Paused   bool    `json:"paused"`
+	Threads  int     `json:"threads"`
+	Running  int     `json:"running"`
+	RPS      float64 `json:"rps"`
+	Stopping bool    `json:"stopping"`
+}
+
+// newRunController creates a controller for a run that is not paused and not rate limited.
+func newRunController() *RunController {
+	c := &RunController{rps: targetRPS}
+	c.cond = sync.NewCond(&c.mu)
+	c.publish()
+	return c
+}
+
+// start starts threads threads with spawn, which runs the thread with the given index until it returns.
+func (c *RunController) start(threads int, spawn func(id int)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.spawn = spawn
+	c.setThreads(threads)
+}
+
+// publish updates the atomic copies of the state the lock-free admission reads. The caller must hold the lock.
+func (c *RunController) publish() {
+	var paused, limited int32
+	if c.paused {
+		paused = 1
+	}
+	if c.rps > 0 {
+		limited = 1
+	}
+	atomic.StoreInt32(&c.fastPaused, paused)
+	atomic.StoreInt32(&c.fastLimited, limited)
+	atomic.StoreInt64(&c.fastThreads, int64(c.threads))
+}
+
+// admit is called by a thread before each request. It waits while the run is paused and for the next
+// slot at the target rate. It returns false if the thread should exit, because the run is stopping
+// or the thread count was lowered below the thread's index.
+func (c *RunController) admit(ctx context.Context, id int) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	// Without a pause or a rate limit, there is nothing to wait for and no shared state to update
+	if atomic.LoadInt32(&c.fastPaused) == 0 && atomic.LoadInt32(&c.fastLimited) == 0 &&
+		int64(id) < atomic.LoadInt64(&c.fastThreads) {
+		return true
+	}
+
+	c.mu.Lock()
+	for c.paused && id < c.threads && ctx.Err() == nil {
+		c.cond.Wait()
+	}
+	if id >= c.threads {
+		// Marked under the lock, so the thread is restarted if the thread count is raised again before it exits
+		c.lowered[id] = true
+		c.mu.Unlock()
+		return false
+	}
+	if ctx.Err() != nil {
+		c.mu.Unlock()
+		return false
+	}
+	wait := c.reserve(time.Now())
+	c.mu.Unlock()
+
+	if wait <= 0 {
+		return true
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// reserve reserves the next slot at the target rate and returns how long to wait for it.
+// With poissonArrivals the gap to the following slot is drawn from an exponential distribution with the mean
+// of the fixed gap, so arrivals form a Poisson process at the target rate instead of a fixed pace.
+// The caller must hold the lock.
+func (c *RunController) reserve(now time.Time) time.Duration {
+	if c.rps <= 0 {
+		return 0
+	}
+	if c.next.Before(now) {
+		c.next = now
+	}
+	wait := c.next.Sub(now)
+	gap := float64(time.Second) / c.rps
+	if poissonArrivals {
+		gap *= runRand.ExpFloat64()
+	}
+	c.next = c.next.Add(time.Duration(gap))
+	return wait
+}
+
+// Pause makes the threads wait before their next request until the run is resumed.
+func (c *RunController) Pause() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.paused = true
+	c.publish()
+}
+
+// Resume lets paused threads continue.
+func (c *RunController) Resume() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.paused = false
+	c.publish()
+	c.cond.Broadcast()
+}
+
+// SetThreads changes the number of running threads. Threads above the new count exit before their next request,
+// and missing threads are started. It returns the number of threads, clamped to 0..controlMaxThreads.
+func (c *RunController) SetThreads(threads int) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.setThreads(threads)
+}
+
+// AddThreads changes the number of running threads by delta, like SetThreads.
+// It returns the new number of threads.
+func (c *RunController) AddThreads(delta int) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.setThreads(c.threads + delta)
+}
+
+// setThreads changes the number of running threads. The caller must hold the lock.
+func (c *RunController) setThreads(threads int) int {
+	if threads < 0 {
+		threads = 0
+	}
+	if threads > controlMaxThreads {
+		threads = controlMaxThreads
+	}
+	c.threads = threads
+	for len(c.alive) < threads {
+		c.alive = append(c.alive, false)
+		c.lowered = append(c.lowered, false)
+	}
+	c.publish()
+
+	// Wake paused threads above the new count, so they exit
+	c.cond.Broadcast()
+
+	if c.spawn == nil || stopping() {
+		return threads
+	}
+	for id := 0; id < threads; id++ {
+		if !c.alive[id] {
+			c.run(id)
+		}
+	}
+	return threads
+}
+
+// run starts the thread with the given index. The caller must hold the lock.
+func (c *RunController) run(id int) {
+	c.alive[id] = true
+	c.lowered[id] = false
+	threadsRunning.Add(1)
+	go func() {
+		defer threadsRunning.Done()
+		defer c.exited(id)
+		c.spawn(id)
+	}()
+}
+
+// exited marks the thread with the given index as stopped, whatever made it return.
+// A thread that exited because the thread count was lowered is restarted if the count was raised again meanwhile.
+func (c *RunController) exited(id int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.alive[id] = false
+	if c.lowered[id] && id < c.threads && !stopping() {
+		c.run(id)
+	}
+}
+
+// SetRPS changes the target requests per second over all threads; 0 removes the limit.
+func (c *RunController) SetRPS(rps float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if rps < 0 {
+		rps = 0
+	}
+	c.rps = rps
+	c.next = time.Time{}
+	c.publish()
+}
+
+// wake wakes up every paused thread, so they notice that the run is stopped.
+func (c *RunController) wake() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cond.Broadcast()
+}
+
+// State returns the current state of the run.
+func (c *RunController) State() RunState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	running := 0
+	for _, alive := range c.alive {
+		if alive {
+			running++
+		}
+	}
+	return RunState{
+		Paused:   c.paused,
+		Threads:  c.threads,
+		Running:  running,
+		RPS:      c.rps,
+		Stopping: stopping(),
+	}
+}
@@ -0,0 +1,211 @@
+// coordinator.go contains the coordinate subcommand, which partitions the parameters and proxies across worker instances,
+// starts them at the same time, and merges their results into one combined report, so a single machine's network
+// interface is not the bottleneck of a run.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// runCoordinator runs the coordinate subcommand with the given arguments and returns the exit code.
+func runCoordinator(args []string) int {
+	flags := flag.NewFlagSet("coordinate", flag.ContinueOnError)
+	workerList := flags.String("workers", "", "comma-separated addresses of the workers, e.g. 10.0.0.2:7070,10.0.0.3:7070")
+	startDelay := flags.Duration("start-delay", coordinatorStartDelay, "time between assigning the workers and the synchronized start")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	var workers []string
+	for _, addr := range strings.Split(*workerList, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			workers = append(workers, addr)
+		}
+	}
+	if len(workers) == 0 {
+		fmt.Fprintf(os.Stderr, "No workers given; use -workers\n")
+		return 2
+	}
+
+	if err := loadAndShuffleParametersAndProxies(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load and shuffle parameters and proxies: %s\n", err)
+		return 1
+	}
+
+	// Assign every worker its share, all starting at the same time
+	startAt := time.Now().Add(*startDelay)
+	paramShares := partition(parameters, len(workers))
+	proxyShares := partition(proxies, len(workers))
+	for i, addr := range workers {
+		assignment := WorkerAssignment{Parameters: paramShares[i], Proxies: proxyShares[i], StartAt: startAt}
+		if err := assignWorker(addr, assignment); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to assign worker %s: %s\n", addr, err)
+			return 1
+		}
+		fmt.Printf("Assigned %d parameters and %d proxies to %s\n", len(assignment.Parameters), len(assignment.Proxies), addr)
+	}
+	fmt.Printf("Workers start at %s\n", startAt.Format(time.RFC3339Nano))
+
+	// Collect the results as the workers finish
+	results := make([]WorkerResult, len(workers))
+	for i, addr := range workers {
+		result, err := awaitWorkerResult(addr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to collect the result of worker %s: %s\n", addr, err)
+			return 1
+		}
+		results[i] = result
+		fmt.Printf("Collected the result of %s: %d requests\n", addr, result.Stats.Requests)
+	}
+
+	printWorkerSummary(workers, results)
+	printRunReport(mergeWorkerResults(results))
+
+	return 0
+}
+
+// partition splits items into n shares round-robin. If there are fewer items than shares,
+// every share gets all items, so no worker is left without parameters or proxies.
+func partition(items []string, n int) [][]string {
+	shares := make([][]string, n)
+	if len(items) < n {
+		for i := range shares {
+			shares[i] = items
+		}
+		return shares
+	}
+	for i, item := range items {
+		shares[i%n] = append(shares[i%n], item)
+	}
+	return shares
+}
+
+// assignWorker sends an assignment to the worker at addr.
+func assignWorker(addr string, assignment WorkerAssignment) error {
+	body, err := json.Marshal(assignment)
+	if err != nil {
+		slog.Error("Error in assignWorker", "component", componentControl, "error", err)
+		return fmt.Errorf("Failed to encode assignment: %w", err)
+	}
+
+	resp, err := http.Post("http://"+addr+"/assign", "application/json", bytes.NewReader(body))
+	if err != nil {
+		slog.Error("Error in assignWorker", "component", componentControl, "error", err)
+		return fmt.Errorf("Failed to send assignment: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("worker responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// awaitWorkerResult polls the worker at addr every coordinatorPollInterval until its result is ready.
+func awaitWorkerResult(addr string) (WorkerResult, error) {
+	for {
+		resp, err := http.Get("http://" + addr + "/result")
+		if err != nil {
+			slog.Error("Error in awaitWorkerResult", "component", componentControl, "error", err)
+			return WorkerResult{}, fmt.Errorf("Failed to fetch result: %w", err)
+		}
+
+		if resp.StatusCode == http.StatusNotFound {
+			resp.Body.Close()
+			time.Sleep(coordinatorPollInterval)
+			continue
+		}
+
+		var result WorkerResult
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return WorkerResult{}, fmt.Errorf("worker responded with status %d", resp.StatusCode)
+		}
+		if err != nil {
+			slog.Error("Error in awaitWorkerResult", "component", componentControl, "error", err)
+			return WorkerResult{}, fmt.Errorf("Failed to decode result: %w", err)
+		}
+		return result, nil
+	}
+}
+
+// mergeWorkerResults combines the results of all workers into the report of one run.
+// Latency percentiles are recomputed from the merged histograms, so they are exact up to the histogram's precision.
+func mergeWorkerResults(results []WorkerResult) RunReport {
+	merged := newHistogram(latencyHighestTrackable, latencySignificantFigures)
+	ips := make(map[string]bool)
+	report := RunReport{
+		Config: currentRunConfig(),
+		Stats:  StatsSnapshot{StatusCodes: make(StatusCounts)},
+	}
+	report.Config.Threads = 0
+
+	for _, result := range results {
+		if report.StartTime.IsZero() || result.StartTime.Before(report.StartTime) {
+			report.StartTime = result.StartTime
+		}
+		if result.EndTime.After(report.EndTime) {
+			report.EndTime = result.EndTime
+		}
+		report.Config.Threads += result.Config.Threads
+
+		s := result.Stats
+		report.Stats.Requests += s.Requests
+		report.Stats.Successes += s.Successes
+		report.Stats.Failures += s.Failures
+		report.Stats.HeadersOnly += s.HeadersOnly
+		report.Stats.ProxySuccesses += s.ProxySuccesses
+		report.Stats.ProxyFailures += s.ProxyFailures
+		report.Stats.BytesIn += s.BytesIn
+		report.Stats.DirectDials += s.DirectDials
+		for code, count := range s.StatusCodes {
+			report.Stats.StatusCodes[code] += count
+		}
+		for class, count := range s.ErrorClasses {
+			report.Stats.ErrorClasses[class] += count
+		}
+
+		for _, bucket := range result.Latency {
+			merged.RecordN(bucket.UpperBound, bucket.Count)
+		}
+		report.HealthyProxies += result.HealthyProxies
+		report.ProxiesLoaded += result.ProxiesLoaded
+		for _, ip := range result.UniqueIPs {
+			ips[ip] = true
+		}
+	}
+
+	report.Duration = report.EndTime.Sub(report.StartTime)
+	if seconds := report.Duration.Seconds(); seconds > 0 {
+		report.Throughput = float64(report.Stats.Requests) / seconds
+	}
+	report.Latency = merged.Snapshot()
+	report.UniqueIPs = len(ips)
+
+	return report
+}
+
+// printWorkerSummary prints a table of the requests, errors, and throughput of every worker.
+func printWorkerSummary(workers []string, results []WorkerResult) {
+	fmt.Printf("\n--- WORKERS ---\n")
+	fmt.Printf("%-24s %10s %10s %12s %10s\n", "WORKER", "REQUESTS", "FAILURES", "DURATION", "REQ/S")
+	for i, result := range results {
+		duration := result.EndTime.Sub(result.StartTime)
+		var throughput float64
+		if duration > 0 {
+			throughput = float64(result.Stats.Requests) / duration.Seconds()
+		}
+		fmt.Printf("%-24s %10d %10d %12s %10.1f\n", workers[i], result.Stats.Requests, result.Stats.Failures,
+			duration.Round(time.Millisecond), throughput)
+	}
+}
@@ -0,0 +1,103 @@
+// coverage.go contains the parameter order, which decides how requests pick their parameter, and the tracking
+// of parameter coverage. In the roundrobin and partitioned orders every parameter is sent at least once
+// before parameters are reused at random, and the report shows how many parameters were sent at least once.
+
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sync/atomic"
+)
+
+// The orders in which requests pick their parameters
+const (
+	parameterOrderRandom      = "random"      // Every request picks a random parameter
+	parameterOrderRoundRobin  = "roundrobin"  // Requests take the parameters in turn until every one was sent, then pick at random
+	parameterOrderPartitioned = "partitioned" // Every thread takes its own share of the parameters in turn, then picks at random
+)
+
+// The coverage of the parameters, set up by setupParameterOrder
+var (
+	parameterHits       []uint32 // Whether every parameter was sent, by index in parameters
+	parametersCovered   int64    // Parameters sent at least once
+	parameterCursor     uint64   // Next parameter in roundrobin order
+	parameterPartitions []uint64 // Next parameter of every partition in partitioned order, counted within the partition
+	parametersTaken     int64    // Parameters taken from the partitions in partitioned order
+)
+
+// setupParameterOrder checks the parameter order and resets the coverage of the parameters.
+func setupParameterOrder() error {
+	switch parameterOrder {
+	case parameterOrderRandom, parameterOrderRoundRobin, parameterOrderPartitioned:
+	default:
+		return fmt.Errorf("unknown parameter order %q, expected %s, %s or %s",
+			parameterOrder, parameterOrderRandom, parameterOrderRoundRobin, parameterOrderPartitioned)
+	}
+
+	parameterHits = make([]uint32, len(parameters))
+	atomic.StoreInt64(&parametersCovered, 0)
+	atomic.StoreUint64(&parameterCursor, 0)
+	atomic.StoreInt64(&parametersTaken, 0)
+	partitions := numOfThreads
+	if len(parameters) < partitions {
+		partitions = len(parameters)
+	}
+	parameterPartitions = make([]uint64, partitions)
+	return nil
+}
+
+// nextParameter returns the parameters line for the next request of the given thread, and counts its coverage.
+// Threads added beyond numOfThreads share the partitions of the first ones.
+func nextParameter(thread int, r *rand.Rand) string {
+	i := nextParameterIndex(thread, r)
+	if i < len(parameterHits) && atomic.LoadUint32(&parameterHits[i]) == 0 &&
+		atomic.CompareAndSwapUint32(&parameterHits[i], 0, 1) {
+		atomic.AddInt64(&parametersCovered, 1)
+	}
+	return parameters[i]
+}
+
+// nextParameterIndex returns the index in parameters of the parameter for the next request of the given thread.
+func nextParameterIndex(thread int, r *rand.Rand) int {
+	switch {
+	case parameterOrder == parameterOrderRoundRobin:
+		if next := atomic.AddUint64(&parameterCursor, 1) - 1; next < uint64(len(parameters)) {
+			return int(next)
+		}
+	case parameterOrder == parameterOrderPartitioned:
+		if i, ok := nextPartitionedParameterIndex(thread); ok {
+			return i
+		}
+	}
+	return r.Intn(len(parameters))
+}
+
+// nextPartitionedParameterIndex returns the index in parameters of the next parameter of the given thread's partition
+// in partitioned order. A thread whose partition is used up takes from the other partitions, so the partitions of threads
+// that exited, for example because the thread count was lowered, are sent too.
+// It returns false once every parameter was taken.
+func nextPartitionedParameterIndex(thread int) (int, bool) {
+	n := len(parameterPartitions)
+	if n == 0 || atomic.LoadInt64(&parametersTaken) >= int64(len(parameters)) {
+		return 0, false
+	}
+	for j := 0; j < n; j++ {
+		// Partition p holds the parameters p, p+n, p+2n, ... for n partitions
+		partition := (thread + j) % n
+		size := uint64((len(parameters) - partition + n - 1) / n)
+		if atomic.LoadUint64(&parameterPartitions[partition]) >= size {
+			continue
+		}
+		if k := atomic.AddUint64(&parameterPartitions[partition], 1) - 1; k < size {
+			atomic.AddInt64(&parametersTaken, 1)
+			return partition + int(k)*n, true
+		}
+	}
+	return 0, false
+}
+
+// parameterCoverage returns the number of parameters sent at least once, and the number of parameters.
+func parameterCoverage() (int64, int) {
+	return atomic.LoadInt64(&parametersCovered), len(parameterHits)
+}
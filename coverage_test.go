@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPartitionedParametersAfterLoweringThreads(t *testing.T) {
+	tests := []struct {
+		name          string
+		parameters    int
+		threadsBefore int
+		roundsBefore  int
+		threadsAfter  int
+	}{
+		{"lowered to one", 1000, numOfThreads, 1, 1},
+		{"lowered to ten", 1000, numOfThreads, 1, 10},
+		{"lowered before any request", 1000, numOfThreads, 0, 3},
+		{"fewer parameters than threads", 50, 50, 0, 7},
+		{"not lowered", 1000, numOfThreads, 2, numOfThreads},
+	}
+	saved := parameters
+	defer func() {
+		parameters = saved
+		setupParameterOrder()
+	}()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parameters = make([]string, tt.parameters)
+			for i := range parameters {
+				parameters[i] = fmt.Sprint(i)
+			}
+			if err := setupParameterOrder(); err != nil {
+				t.Fatal(err)
+			}
+
+			seen := make(map[int]int)
+			for round := 0; round < tt.roundsBefore; round++ {
+				for thread := 0; thread < tt.threadsBefore; thread++ {
+					if i, ok := nextPartitionedParameterIndex(thread); ok {
+						seen[i]++
+					}
+				}
+			}
+			for thread := 0; ; thread = (thread + 1) % tt.threadsAfter {
+				i, ok := nextPartitionedParameterIndex(thread)
+				if !ok {
+					break
+				}
+				seen[i]++
+			}
+
+			if len(seen) != tt.parameters {
+				t.Errorf("%d parameters were sent, want all %d", len(seen), tt.parameters)
+			}
+			for i, n := range seen {
+				if n != 1 {
+					t.Errorf("parameter %d was sent %d times, want once", i, n)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,256 @@
+// dashboard.go contains the full-screen terminal dashboard, which replaces, if -dashboard is given,
+// the stats printed by printStats and the progress bar with a single screen showing live throughput, latency percentiles, error classes,
+// proxy pool health, and a scrolling log of recent errors.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vbauerster/mpb/v7"
+)
+
+// dashboardEnabled is set before the threads start if the dashboard is shown instead of the plain stats
+var dashboardEnabled bool
+
+// recentErrors holds the most recent request errors shown in the dashboard's error log
+var recentErrors = &errorRing{}
+
+// errorRing is a fixed-size ring of error messages.
+// It is safe for concurrent use.
+type errorRing struct {
+	mu       sync.Mutex
+	messages [dashboardErrorLines]string
+	next     int
+	count    int
+}
+
+// noteError adds a request error to the dashboard's error log, if the dashboard is shown.
+func noteError(format string, args ...interface{}) {
+	if !dashboardEnabled {
+		return
+	}
+	message := time.Now().Format("15:04:05") + " " + fmt.Sprintf(format, args...)
+
+	recentErrors.mu.Lock()
+	recentErrors.messages[recentErrors.next] = message
+	recentErrors.next = (recentErrors.next + 1) % len(recentErrors.messages)
+	if recentErrors.count < len(recentErrors.messages) {
+		recentErrors.count++
+	}
+	recentErrors.mu.Unlock()
+}
+
+// Last returns up to n of the most recent messages, oldest first.
+func (e *errorRing) Last(n int) []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if n > e.count {
+		n = e.count
+	}
+	messages := make([]string, n)
+	for i := 0; i < n; i++ {
+		messages[i] = e.messages[(e.next-n+i+len(e.messages))%len(e.messages)]
+	}
+	return messages
+}
+
+// useDashboard reports whether the dashboard is shown: it is requested with the -dashboard flag,
+// stdout is a terminal, and stdout does not carry the NDJSON stream.
+func useDashboard() bool {
+	if !*dashboardFlag || ndjsonOutput == ndjsonStdout {
+		return false
+	}
+	_, _, ok := terminalSize(os.Stdout)
+	return ok
+}
+
+// startDashboard shows the dashboard on the alternate screen, redrawing it every dashboardRefresh.
+// It returns a function that stops the dashboard and restores the screen.
+func startDashboard(collector *StatsCollector, bar *mpb.Bar, start time.Time) func() {
+	// Switch to the alternate screen and hide the cursor
+	fmt.Print("\033[?1049h\033[?25l")
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(dashboardRefresh)
+		defer ticker.Stop()
+
+		for {
+			renderDashboard(collector, bar, start)
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+		// Show the cursor and switch back to the main screen
+		fmt.Print("\033[?25h\033[?1049l")
+	}
+}
+
+// renderDashboard draws one frame of the dashboard.
+func renderDashboard(collector *StatsCollector, bar *mpb.Bar, start time.Time) {
+	width, height, ok := terminalSize(os.Stdout)
+	if !ok {
+		width, height = 100, 30
+	}
+
+	snapshot := collector.Snapshot()
+	latency := latencies.Snapshot()
+	points := timeline.Points(0)
+
+	var lines []string
+	add := func(format string, args ...interface{}) {
+		lines = append(lines, fmt.Sprintf(format, args...))
+	}
+
+	// Header and progress
+	elapsed := time.Since(start).Round(time.Second)
+	add("\033[1mjeet\033[0m  %s  elapsed %s", requestTarget, elapsed)
+	completed := bar.Current()
+	if runIndefinitely {
+		add("Completed %d requests (running indefinitely)", completed)
+	} else {
+		budget := totalRequestBudget()
+		fraction := float64(completed) / float64(budget)
+		add("%s %d / %d (%.1f%%)", progressGauge(fraction, width-40), completed, budget, 100*fraction)
+	}
+	if keyboardActive {
+		state := runControl.State()
+		paused := ""
+		if state.Paused {
+			paused = "  \033[33mpaused\033[0m"
+		}
+		note, _ := lastKeyboardNote.Load().(string)
+		add("threads %d (%d running)%s  keys: %s  %s", state.Threads, state.Running, paused, keyboardHelp, note)
+	}
+	add("")
+
+	// Throughput
+	var rps float64
+	if len(points) > 0 {
+		rps = points[len(points)-1].Requests
+	}
+	add("\033[1mThroughput\033[0m  %.0f req/s", rps)
+	add("  %s", sparkline(points, width-4))
+	add("  requests %d   ok %d   failed %d   received %s", snapshot.Requests, snapshot.Successes, snapshot.Failures, formatBytes(snapshot.BytesIn))
+	add("")
+
+	// Latency
+	add("\033[1mLatency\033[0m")
+	add("  p50 %-10s p90 %-10s p95 %-10s p99 %-10s max %s",
+		roundDuration(latency.P50), roundDuration(latency.P90), roundDuration(latency.P95), roundDuration(latency.P99), roundDuration(latency.Max))
+	add("")
+
+	// Status codes and errors
+	add("\033[1mStatus codes\033[0m  %s", snapshot.StatusCodes)
+	add("\033[1mErrors\033[0m        %s", snapshot.ErrorClasses)
+	add("")
+
+	// Proxy pool health
+	if useProxy {
+		healthy := proxiesPool.Len()
+		add("\033[1mProxy pool\033[0m  %d / %d healthy   validated %d   failed %d   unique IPs %d",
+			healthy, proxyPoolTarget, snapshot.ProxySuccesses, snapshot.ProxyFailures, countUniqueIPs())
+	} else {
+		add("\033[1mDirect connection\033[0m  %d connections dialed", snapshot.DirectDials)
+	}
+	add("")
+
+	// The error log fills the rest of the screen
+	add("\033[1mRecent errors\033[0m")
+	for _, message := range recentErrors.Last(height - len(lines) - 1) {
+		add("  \033[31m%s\033[0m", message)
+	}
+
+	var b strings.Builder
+	b.WriteString("\033[H")
+	for i, line := range lines {
+		if i >= height {
+			break
+		}
+		b.WriteString("\033[2K")
+		b.WriteString(truncateVisible(line, width))
+		b.WriteString("\n")
+	}
+	// Clear whatever is left of the previous frame
+	b.WriteString("\033[J")
+	fmt.Print(b.String())
+}
+
+// progressGauge returns a bar of the given width filled to fraction.
+func progressGauge(fraction float64, width int) string {
+	if width < 10 {
+		width = 10
+	}
+	if fraction > 1 {
+		fraction = 1
+	}
+	filled := int(fraction * float64(width))
+	return "[" + strings.Repeat("=", filled) + strings.Repeat(" ", width-filled) + "]"
+}
+
+// sparkBlocks are the characters of a sparkline, lowest first
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline returns the requests per second of the most recent timeline points as a sparkline of at most width characters.
+func sparkline(points []TimelinePoint, width int) string {
+	if width < 1 || len(points) == 0 {
+		return ""
+	}
+	if len(points) > width {
+		points = points[len(points)-width:]
+	}
+
+	var max float64
+	for _, point := range points {
+		if point.Requests > max {
+			max = point.Requests
+		}
+	}
+
+	spark := make([]rune, len(points))
+	for i, point := range points {
+		level := 0
+		if max > 0 {
+			level = int(point.Requests / max * float64(len(sparkBlocks)-1))
+		}
+		spark[i] = sparkBlocks[level]
+	}
+	return string(spark)
+}
+
+// truncateVisible truncates a line to width visible characters, skipping ANSI escape sequences when counting.
+func truncateVisible(line string, width int) string {
+	visible := 0
+	inEscape := false
+	for i, r := range line {
+		switch {
+		case inEscape:
+			if r >= '@' && r <= '~' && r != '[' {
+				inEscape = false
+			}
+		case r == '\033':
+			inEscape = true
+		default:
+			visible++
+			if visible > width {
+				return line[:i] + "\033[0m"
+			}
+		}
+	}
+	return line
+}
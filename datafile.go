@@ -0,0 +1,138 @@
+// datafile.go contains the data file, a CSV file whose header row names its columns and whose other rows
+// each supply a set of values to one request, used through {{data column}} template tokens.
+// Rows are consumed in order, at random, or in order from a partition of the rows owned by each thread,
+// so ID distributions exported from production can be replayed as they are.
+
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// The ways rows of the data file are consumed
+const (
+	dataModeSequential  = "sequential"  // Every request takes the next row, wrapping around at the end
+	dataModeRandom      = "random"      // Every request takes a random row
+	dataModePartitioned = "partitioned" // Every thread takes the next row of its own share of the rows
+)
+
+// DataRow holds the values of one row of the data file, by column name.
+type DataRow map[string]string
+
+// The rows of the data file and the cursors into them, set by loadDataFile
+var (
+	dataColumns    []string
+	dataRows       []DataRow
+	dataCursor     uint64   // Next row in sequential mode
+	dataPartitions []uint64 // Next row of every partition in partitioned mode, counted within the partition
+)
+
+// loadDataFile reads the data file into dataRows. It does nothing if dataFile is empty.
+// It returns an error if the data mode is unknown, or the file cannot be read or has no rows.
+func loadDataFile() error {
+	if dataFile == "" {
+		return nil
+	}
+	switch dataMode {
+	case dataModeSequential, dataModeRandom, dataModePartitioned:
+	default:
+		return fmt.Errorf("unknown data mode %q, expected %s, %s or %s", dataMode, dataModeSequential, dataModeRandom, dataModePartitioned)
+	}
+
+	file, err := os.Open(dataFile)
+	if err != nil {
+		slog.Error("Error in loadDataFile", "component", componentInput, "error", err)
+		return fmt.Errorf("Failed to open data file: %w", err)
+	}
+	// Ensure the file is closed after the function returns
+	defer func() {
+		if cerr := file.Close(); cerr != nil {
+			slog.Error("Failed to close data file", "component", componentInput, "error", cerr)
+		}
+	}()
+
+	reader := csv.NewReader(file)
+	header, err := reader.Read()
+	if err != nil {
+		slog.Error("Error in loadDataFile", "component", componentInput, "error", err)
+		return fmt.Errorf("Failed to read data file header: %w", err)
+	}
+	for i := range header {
+		header[i] = strings.TrimSpace(header[i])
+	}
+
+	var rows []DataRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			slog.Error("Error in loadDataFile", "component", componentInput, "error", err)
+			return fmt.Errorf("Failed to read data file: %w", err)
+		}
+		row := make(DataRow, len(header))
+		for i, column := range header {
+			row[column] = record[i]
+		}
+		rows = append(rows, row)
+	}
+	if len(rows) == 0 {
+		return fmt.Errorf("No rows found in data file %s", dataFile)
+	}
+
+	dataColumns = header
+	dataRows = rows
+	dataPartitions = make([]uint64, dataPartitionCount())
+	slog.Info("Loaded data file", "component", componentInput, "file", dataFile, "rows", len(rows), "mode", dataMode)
+	return nil
+}
+
+// dataPartitionCount returns the number of partitions the rows are split into in partitioned mode:
+// one per configured thread, but no more than there are rows.
+func dataPartitionCount() int {
+	if len(dataRows) < numOfThreads {
+		return len(dataRows)
+	}
+	return numOfThreads
+}
+
+// validateDataColumn returns an error if the data file has no column with the given name.
+func validateDataColumn(column string) error {
+	if dataRows == nil {
+		return fmt.Errorf("data needs a data file")
+	}
+	for _, name := range dataColumns {
+		if name == column {
+			return nil
+		}
+	}
+	return fmt.Errorf("data file %s has no column %q", dataFile, column)
+}
+
+// nextDataRow returns the row of the data file for the next request of the given thread, or nil without a data file.
+// Threads added beyond numOfThreads share the partitions of the first ones.
+func nextDataRow(thread int, r *rand.Rand) DataRow {
+	if len(dataRows) == 0 {
+		return nil
+	}
+	switch dataMode {
+	case dataModeRandom:
+		return dataRows[r.Intn(len(dataRows))]
+	case dataModePartitioned:
+		// Partition p holds the rows p, p+n, p+2n, ... for n partitions
+		partition := thread % len(dataPartitions)
+		size := (len(dataRows) - partition + len(dataPartitions) - 1) / len(dataPartitions)
+		k := (atomic.AddUint64(&dataPartitions[partition], 1) - 1) % uint64(size)
+		return dataRows[partition+int(k)*len(dataPartitions)]
+	default:
+		return dataRows[(atomic.AddUint64(&dataCursor, 1)-1)%uint64(len(dataRows))]
+	}
+}
@@ -0,0 +1,91 @@
+// doh.go contains the DNS-over-HTTPS resolver, which resolves the hostnames of direct connections by asking
+// a DoH provider over HTTPS, so the target hostname is not sent to the local network's resolver.
+// It uses the JSON API (application/dns-json) that the major public providers serve.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// The DNS record types queried over DoH
+const (
+	dnsTypeA    = 1
+	dnsTypeAAAA = 28
+)
+
+// dohClient is the HTTP client of the DoH queries; it resolves the provider's own hostname with the system resolver
+var dohClient = &http.Client{Timeout: 10 * time.Second}
+
+// dohResponse is the JSON response to a DoH query
+type dohResponse struct {
+	Status int `json:"Status"`
+	Answer []struct {
+		Type int    `json:"type"`
+		Data string `json:"data"`
+	} `json:"Answer"`
+}
+
+// lookupDoH returns the IPv4 addresses of host, or its IPv6 addresses if it has none, as resolved by the DoH provider at dohURL.
+// Only the addresses of the preferred IP version are queried if there is one.
+func lookupDoH(ctx context.Context, host string) ([]string, error) {
+	recordTypes := []int{dnsTypeA, dnsTypeAAAA}
+	switch *ipVersionFlag {
+	case ipVersion4:
+		recordTypes = []int{dnsTypeA}
+	case ipVersion6:
+		recordTypes = []int{dnsTypeAAAA}
+	}
+	for _, recordType := range recordTypes {
+		addrs, err := queryDoH(ctx, host, recordType)
+		if err != nil {
+			return nil, err
+		}
+		if len(addrs) > 0 {
+			return addrs, nil
+		}
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: host, Server: dohURL, IsNotFound: true}
+}
+
+// queryDoH queries the DoH provider for the records of the given type of host.
+func queryDoH(ctx context.Context, host string, recordType int) ([]string, error) {
+	query := url.Values{"name": {host}, "type": {fmt.Sprint(recordType)}}
+	req, err := http.NewRequestWithContext(ctx, "GET", dohURL+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating DoH query: %w", err)
+	}
+	req.Header.Set("Accept", "application/dns-json")
+
+	resp, err := dohClient.Do(req)
+	if err != nil {
+		return nil, &net.DNSError{Err: err.Error(), Name: host, Server: dohURL, IsTemporary: true}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &net.DNSError{Err: fmt.Sprintf("DoH provider returned status %d", resp.StatusCode), Name: host, Server: dohURL}
+	}
+
+	var response dohResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, &net.DNSError{Err: "invalid DoH response: " + err.Error(), Name: host, Server: dohURL}
+	}
+	if response.Status != 0 {
+		// Status 3 is NXDOMAIN
+		return nil, &net.DNSError{Err: fmt.Sprintf("DoH query failed with rcode %d", response.Status), Name: host, Server: dohURL, IsNotFound: response.Status == 3}
+	}
+
+	var addrs []string
+	for _, answer := range response.Answer {
+		if answer.Type == recordType {
+			addrs = append(addrs, answer.Data)
+		}
+	}
+	return addrs, nil
+}
@@ -0,0 +1,51 @@
+// encoding.go contains the handling of compressed response bodies. The transports never decompress bodies themselves;
+// every request sends acceptEncoding, the compressed bytes are counted as they arrive on the wire,
+// and gzip and deflate bodies are decompressed here, so both the wire bytes and the decompressed bytes are known.
+
+package main
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"strings"
+)
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+// Read reads from the underlying reader and counts the bytes read.
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// decodeBody returns a reader of the decompressed body if the body has the given Content-Encoding,
+// decompressBodies is set, and the encoding is gzip or deflate. Otherwise it returns the body as it is.
+// It returns an error if the compressed stream has an invalid header.
+func decodeBody(body io.Reader, contentEncoding string) (io.Reader, error) {
+	if !decompressBodies {
+		return body, nil
+	}
+	switch strings.ToLower(strings.TrimSpace(contentEncoding)) {
+	case "gzip", "x-gzip":
+		return gzip.NewReader(body)
+	case "deflate":
+		return zlib.NewReader(body)
+	default:
+		return body, nil
+	}
+}
+
+// requestAcceptEncoding returns the Accept-Encoding sent with every request: identity if compression is disabled
+// with -disable-compression, and acceptEncoding otherwise.
+func requestAcceptEncoding() string {
+	if *disableCompressionFlag {
+		return "identity"
+	}
+	return acceptEncoding
+}
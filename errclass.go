@@ -0,0 +1,118 @@
+// errclass.go contains the classification of request failures into error classes,
+// so the stats can tell timeouts, refused connections, DNS, TLS, and proxy failures apart.
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"strings"
+	"syscall"
+)
+
+// ErrorClass is the class of a request failure.
+type ErrorClass int
+
+// The error classes failures are sorted into
+const (
+	ErrorClassNone              ErrorClass = iota // The request did not fail
+	ErrorClassTimeout                             // The request or a dial timed out
+	ErrorClassConnectionRefused                   // The target or proxy refused the connection
+	ErrorClassDNS                                 // A hostname could not be resolved
+	ErrorClassTLS                                 // The TLS handshake or certificate verification failed
+	ErrorClassProxy                               // The SOCKS proxy failed to connect to the target
+	ErrorClassBodyRead                            // The response body could not be read
+	ErrorClassOther                               // Any other failure
+	ErrorClassAssertion                           // The response failed a response assertion
+	ErrorClassStatus                              // The response status is not one of the success statuses
+	ErrorClassGraphQL                             // The GraphQL response has errors
+	numErrorClasses
+)
+
+// errorClassNames holds the names of the error classes, indexed by class
+var errorClassNames = [numErrorClasses]string{
+	ErrorClassNone:              "none",
+	ErrorClassTimeout:           "timeout",
+	ErrorClassConnectionRefused: "connection-refused",
+	ErrorClassDNS:               "dns",
+	ErrorClassTLS:               "tls",
+	ErrorClassProxy:             "proxy",
+	ErrorClassBodyRead:          "body-read",
+	ErrorClassOther:             "other",
+	ErrorClassAssertion:         "assertion",
+	ErrorClassStatus:            "status",
+	ErrorClassGraphQL:           "graphql",
+}
+
+// String returns the name of the error class.
+func (c ErrorClass) String() string {
+	if c < 0 || c >= numErrorClasses {
+		return "unknown"
+	}
+	return errorClassNames[c]
+}
+
+// parseErrorClass returns the error class with the given name.
+// The empty name and unknown names are ErrorClassNone and ErrorClassOther respectively.
+func parseErrorClass(name string) ErrorClass {
+	if name == "" {
+		return ErrorClassNone
+	}
+	for class, className := range errorClassNames {
+		if className == name {
+			return ErrorClass(class)
+		}
+	}
+	return ErrorClassOther
+}
+
+// classifyError sorts an error returned by client.Do into an error class.
+// Errors reading the response body are classified by the caller as ErrorClassBodyRead.
+func classifyError(err error) ErrorClass {
+	if err == nil {
+		return ErrorClassNone
+	}
+
+	// SOCKS dialers wrap their failures in an OpError whose Op starts with "socks"
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && strings.HasPrefix(opErr.Op, "socks") && !isTimeout(err) {
+		return ErrorClassProxy
+	}
+
+	if isTimeout(err) {
+		return ErrorClassTimeout
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return ErrorClassDNS
+	}
+
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return ErrorClassConnectionRefused
+	}
+
+	var recordErr tls.RecordHeaderError
+	var verifyErr *tls.CertificateVerificationError
+	var authorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+	if errors.As(err, &recordErr) || errors.As(err, &verifyErr) || errors.As(err, &authorityErr) ||
+		errors.As(err, &hostnameErr) || errors.As(err, &invalidErr) || strings.Contains(err.Error(), "tls: ") {
+		return ErrorClassTLS
+	}
+
+	return ErrorClassOther
+}
+
+// isTimeout reports whether an error is a deadline or network timeout.
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
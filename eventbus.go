@@ -0,0 +1,299 @@
+// eventbus.go contains the event bus sink, which publishes every completed request and proxy lifecycle event
+// as a JSON message to a NATS subject or Kafka topic, so a downstream pipeline can analyse long runs in real time.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// eventBus publishes the events of the current run; it is nil if no event bus is configured
+var eventBus *EventBusSink
+
+// eventPublisher publishes batches of messages to an event bus.
+// Publish is only called from a single goroutine.
+type eventPublisher interface {
+	Publish(messages [][]byte) error
+	Close() error
+}
+
+// requestEventJSON is the layout of a request event.
+type requestEventJSON struct {
+	Type string `json:"type"`
+	Run  string `json:"run"`
+	requestRecordJSON
+}
+
+// proxyEventJSON is the layout of a proxy lifecycle event.
+type proxyEventJSON struct {
+	Type      string    `json:"type"`
+	Run       string    `json:"run"`
+	Timestamp time.Time `json:"timestamp"`
+	Proxy     string    `json:"proxy"`
+	Event     string    `json:"event"` // validated, failed_validation, or retired
+}
+
+// EventBusSink batches events and hands them to a background goroutine that publishes them,
+// so a slow broker never blocks the threads; if it falls behind by more than eventBusMaxPendingBatches, batches are dropped.
+// It is safe for concurrent use.
+type EventBusSink struct {
+	mu        sync.Mutex
+	batch     [][]byte
+	closed    bool
+	run       string
+	publisher eventPublisher
+	batches   chan [][]byte
+	done      chan struct{} // Closed to stop the periodic flush
+	flushed   chan struct{} // Closed when the periodic flush has stopped
+	sent      chan struct{} // Closed when the sender has published every batch
+}
+
+// openEventBusSink creates a sink publishing to the event bus selected by eventBusKind.
+func openEventBusSink() (*EventBusSink, error) {
+	var publisher eventPublisher
+	switch eventBusKind {
+	case "nats":
+		publisher = &natsPublisher{addr: eventBusAddr, subject: eventBusSubject}
+	case "kafka":
+		publisher = &kafkaPublisher{addr: eventBusAddr, topic: eventBusSubject, partition: kafkaPartition}
+	default:
+		return nil, fmt.Errorf("unknown event bus: %s", eventBusKind)
+	}
+
+	sink := &EventBusSink{
+		run:       time.Now().Format(runDirectoryLayout),
+		publisher: publisher,
+		batches:   make(chan [][]byte, eventBusMaxPendingBatches),
+		done:      make(chan struct{}),
+		flushed:   make(chan struct{}),
+		sent:      make(chan struct{}),
+	}
+	go sink.send()
+	go sink.flushPeriodically()
+
+	return sink, nil
+}
+
+// Write adds a request event to the current batch.
+func (s *EventBusSink) Write(summary RequestSummary) {
+	event := requestEventJSON{
+		Type: "request",
+		Run:  s.run,
+		requestRecordJSON: requestRecordJSON{
+			Timestamp:  summary.Timestamp,
+			RequestID:  summary.RequestID,
+			Parameter:  summary.Parameter,
+			Proxy:      summary.Proxy,
+			StatusCode: summary.StatusCode,
+			DurationMs: durationMillis(summary.Duration),
+			BytesIn:    summary.BytesIn,
+		},
+	}
+	if summary.ErrorClass != ErrorClassNone {
+		event.ErrorClass = summary.ErrorClass.String()
+	}
+	s.add(event)
+}
+
+// publishProxyEvent adds a proxy lifecycle event to the current batch, if an event bus is configured.
+func publishProxyEvent(proxy string, event string) {
+	if eventBus == nil {
+		return
+	}
+	eventBus.add(proxyEventJSON{Type: "proxy", Run: eventBus.run, Timestamp: time.Now(), Proxy: proxy, Event: event})
+}
+
+// add encodes an event and adds it to the current batch.
+func (s *EventBusSink) add(event interface{}) {
+	message, err := json.Marshal(event)
+	if err != nil {
+		slog.Error("Failed to encode event", "component", componentOutput, "error", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.batch = append(s.batch, message)
+	if len(s.batch) >= eventBusBatchSize {
+		s.flushLocked()
+	}
+}
+
+// flushLocked hands the current batch to the sender. The caller must hold the lock.
+func (s *EventBusSink) flushLocked() {
+	if len(s.batch) == 0 {
+		return
+	}
+	batch := s.batch
+	s.batch = nil
+
+	select {
+	case s.batches <- batch:
+	default:
+		slog.Warn("The event bus is falling behind, dropping a batch of events", "component", componentOutput, "events", len(batch))
+	}
+}
+
+// flushPeriodically flushes the current batch every eventBusFlushInterval until the sink is closed.
+func (s *EventBusSink) flushPeriodically() {
+	defer close(s.flushed)
+
+	ticker := time.NewTicker(eventBusFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.mu.Lock()
+			s.flushLocked()
+			s.mu.Unlock()
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// send publishes the batches until the batches channel is closed.
+func (s *EventBusSink) send() {
+	defer close(s.sent)
+
+	for batch := range s.batches {
+		if err := s.publisher.Publish(batch); err != nil {
+			slog.Error("Failed to publish events", "component", componentOutput, "events", len(batch), "error", err)
+		}
+	}
+}
+
+// Close publishes the remaining events, stops the background goroutines, and disconnects from the broker.
+func (s *EventBusSink) Close() error {
+	// Stop the periodic flush first, so nothing queues batches after the channel is closed
+	close(s.done)
+	<-s.flushed
+
+	s.mu.Lock()
+	s.closed = true
+	batch := s.batch
+	s.batch = nil
+	s.mu.Unlock()
+
+	// Queue the last batch and wait for the sender to publish everything
+	if len(batch) > 0 {
+		s.batches <- batch
+	}
+	close(s.batches)
+	<-s.sent
+
+	return s.publisher.Close()
+}
+
+// natsPublisher publishes messages to a NATS subject over the NATS client protocol.
+// It connects on the first publish and reconnects after a failure.
+type natsPublisher struct {
+	addr    string
+	subject string
+
+	mu   sync.Mutex // Guards writes, which come from the publisher and from the PING handler
+	conn net.Conn
+	w    *bufio.Writer
+}
+
+// connect connects to the NATS server, reads its INFO, and sends CONNECT.
+// The caller must hold the lock.
+func (p *natsPublisher) connect() error {
+	conn, err := net.DialTimeout("tcp", p.addr, clientTimeout)
+	if err != nil {
+		slog.Error("Error in connect", "component", componentOutput, "error", err)
+		return fmt.Errorf("Failed to connect to NATS: %w", err)
+	}
+
+	r := bufio.NewReader(conn)
+	conn.SetReadDeadline(time.Now().Add(clientTimeout))
+	info, err := r.ReadString('\n')
+	if err != nil || !strings.HasPrefix(info, "INFO ") {
+		conn.Close()
+		return fmt.Errorf("Failed to read INFO from NATS server: %v", err)
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	w := bufio.NewWriter(conn)
+	fmt.Fprintf(w, "CONNECT {\"verbose\":false,\"pedantic\":false,\"name\":\"jeet\",\"lang\":\"go\",\"version\":\"1\"}\r\n")
+	if err := w.Flush(); err != nil {
+		conn.Close()
+		slog.Error("Error in connect", "component", componentOutput, "error", err)
+		return fmt.Errorf("Failed to send CONNECT to NATS: %w", err)
+	}
+
+	p.conn, p.w = conn, w
+	go p.readLoop(conn, r)
+	return nil
+}
+
+// readLoop answers the server's PINGs and logs its errors until the connection is closed.
+func (p *natsPublisher) readLoop(conn net.Conn, r *bufio.Reader) {
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		switch {
+		case strings.HasPrefix(line, "PING"):
+			p.mu.Lock()
+			if p.conn == conn {
+				p.w.WriteString("PONG\r\n")
+				p.w.Flush()
+			}
+			p.mu.Unlock()
+		case strings.HasPrefix(line, "-ERR"):
+			slog.Error("NATS server error", "component", componentOutput, "error", strings.TrimSpace(line))
+		}
+	}
+}
+
+// Publish publishes every message to the subject.
+func (p *natsPublisher) Publish(messages [][]byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.conn == nil {
+		if err := p.connect(); err != nil {
+			return err
+		}
+	}
+
+	for _, message := range messages {
+		fmt.Fprintf(p.w, "PUB %s %d\r\n", p.subject, len(message))
+		p.w.Write(message)
+		p.w.WriteString("\r\n")
+	}
+	if err := p.w.Flush(); err != nil {
+		p.conn.Close()
+		p.conn = nil
+		slog.Error("Error in Publish", "component", componentOutput, "error", err)
+		return fmt.Errorf("Failed to publish to NATS: %w", err)
+	}
+
+	return nil
+}
+
+// Close disconnects from the NATS server.
+func (p *natsPublisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.conn == nil {
+		return nil
+	}
+	err := p.conn.Close()
+	p.conn = nil
+	return err
+}
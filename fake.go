@@ -0,0 +1,142 @@
+// fake.go contains the fake data template tokens, which fill request templates with realistic looking values:
+// {{name}}, {{firstname}}, {{lastname}}, {{email}}, {{ipv4}}, {{ipv6}}, {{ulid}}, {{date}}, and {{lorem n}}.
+// Every value is drawn from the request's random number generator, so a seeded run sends the same data again.
+
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// fakeDateSpan is how far back from now {{date}} draws its dates
+const fakeDateSpan = 5 * 365 * 24 * time.Hour
+
+// fakeDateLayout is the layout of {{date}} without an explicit layout
+const fakeDateLayout = "2006-01-02"
+
+// ulidAlphabet is the Crockford base32 alphabet ULIDs are encoded with
+const ulidAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// The word lists fake values are drawn from
+var (
+	fakeFirstNames = []string{
+		"James", "Mary", "John", "Patricia", "Robert", "Jennifer", "Michael", "Linda", "David", "Elizabeth",
+		"William", "Barbara", "Richard", "Susan", "Joseph", "Jessica", "Thomas", "Sarah", "Daniel", "Karen",
+		"Maria", "Nikos", "Eleni", "Giorgos", "Sofia", "Lukas", "Emma", "Hiroshi", "Yuki", "Ananya",
+	}
+	fakeLastNames = []string{
+		"Smith", "Johnson", "Williams", "Brown", "Jones", "Garcia", "Miller", "Davis", "Rodriguez", "Martinez",
+		"Hernandez", "Lopez", "Wilson", "Anderson", "Thomas", "Taylor", "Moore", "Jackson", "Martin", "Lee",
+		"Papadopoulos", "Georgiou", "Muller", "Schmidt", "Rossi", "Dubois", "Tanaka", "Sato", "Kumar", "Nowak",
+	}
+	fakeEmailDomains = []string{"example.com", "example.net", "example.org", "mail.test", "inbox.test"}
+	fakeLoremWords   = []string{
+		"lorem", "ipsum", "dolor", "sit", "amet", "consectetur", "adipiscing", "elit", "sed", "do",
+		"eiusmod", "tempor", "incididunt", "ut", "labore", "et", "dolore", "magna", "aliqua", "enim",
+		"ad", "minim", "veniam", "quis", "nostrud", "exercitation", "ullamco", "laboris", "nisi", "aliquip",
+		"ex", "ea", "commodo", "consequat", "duis", "aute", "irure", "in", "reprehenderit", "voluptate",
+	}
+)
+
+// evalFakeToken returns the value of a fake data template token; {{date}} takes an optional Go time layout.
+// It reports false if name is not a fake data token.
+func evalFakeToken(name, args string, r *rand.Rand) (string, bool, error) {
+	switch name {
+	case "firstname", "lastname", "name", "email", "ipv4", "ipv6", "ulid":
+		if args != "" {
+			return "", true, fmt.Errorf("%s takes no arguments", name)
+		}
+	}
+
+	switch name {
+	case "firstname":
+		return pick(r, fakeFirstNames), true, nil
+	case "lastname":
+		return pick(r, fakeLastNames), true, nil
+	case "name":
+		return pick(r, fakeFirstNames) + " " + pick(r, fakeLastNames), true, nil
+	case "email":
+		return fakeEmail(r), true, nil
+	case "ipv4":
+		return fakeIP(r, net.IPv4len), true, nil
+	case "ipv6":
+		return fakeIP(r, net.IPv6len), true, nil
+	case "ulid":
+		return fakeULID(r, time.Now()), true, nil
+	case "date":
+		layout := fakeDateLayout
+		if args != "" {
+			layout = args
+		}
+		return time.Now().Add(-time.Duration(r.Int63n(int64(fakeDateSpan)))).Format(layout), true, nil
+	case "lorem":
+		n, err := strconv.Atoi(args)
+		if err != nil || n < 1 {
+			return "", true, fmt.Errorf("lorem takes a positive number of words")
+		}
+		words := make([]string, n)
+		for i := range words {
+			words[i] = pick(r, fakeLoremWords)
+		}
+		return strings.Join(words, " "), true, nil
+	default:
+		return "", false, nil
+	}
+}
+
+// pick returns one of words, drawn from r.
+func pick(r *rand.Rand, words []string) string {
+	return words[r.Intn(len(words))]
+}
+
+// fakeEmail returns an email address of a fake person at one of the reserved example domains.
+func fakeEmail(r *rand.Rand) string {
+	return fmt.Sprintf("%s.%s%d@%s", strings.ToLower(pick(r, fakeFirstNames)), strings.ToLower(pick(r, fakeLastNames)),
+		r.Intn(100), pick(r, fakeEmailDomains))
+}
+
+// fakeIP returns a random IP address of the given length, IPv4 addresses avoiding the 0 and 255 octets at the ends.
+func fakeIP(r *rand.Rand, length int) string {
+	ip := make(net.IP, length)
+	for i := range ip {
+		ip[i] = byte(r.Intn(256))
+	}
+	if length == net.IPv4len {
+		ip[0] = byte(1 + r.Intn(223))
+		ip[3] = byte(1 + r.Intn(254))
+	}
+	return ip.String()
+}
+
+// fakeULID returns a ULID for the given time, with its 80 random bits drawn from r.
+func fakeULID(r *rand.Rand, t time.Time) string {
+	var id [16]byte
+	ms := uint64(t.UnixMilli())
+	for i := 5; i >= 0; i-- {
+		id[i] = byte(ms)
+		ms >>= 8
+	}
+	for i := 6; i < len(id); i++ {
+		id[i] = byte(r.Intn(256))
+	}
+
+	// Encode the 128 bits as 26 base32 characters, the first one carrying only 3 bits
+	var b strings.Builder
+	b.Grow(26)
+	var acc uint32
+	bits := 2 // Pad the front so 130 bits split into 26 groups of 5
+	for _, c := range id {
+		acc = acc<<8 | uint32(c)
+		bits += 8
+		for bits >= 5 {
+			bits -= 5
+			b.WriteByte(ulidAlphabet[(acc>>uint(bits))&31])
+		}
+	}
+	return b.String()
+}
@@ -2,12 +2,15 @@ module jeet
 
 go 1.21
 
+require (
+	github.com/vbauerster/mpb/v7 v7.5.3
+	golang.org/x/net v0.15.0
+)
+
 require (
 	github.com/VividCortex/ewma v1.2.0 // indirect
 	github.com/acarl005/stripansi v0.0.0-20180116102854-5a71ef0e047d // indirect
 	github.com/mattn/go-runewidth v0.0.13 // indirect
 	github.com/rivo/uniseg v0.2.0 // indirect
-	github.com/vbauerster/mpb/v7 v7.5.3 // indirect
-	golang.org/x/net v0.15.0 // indirect
 	golang.org/x/sys v0.12.0 // indirect
 )
@@ -0,0 +1,127 @@
+// graphite.go contains the Graphite exporter, which periodically sends the counters, gauges,
+// and latency percentiles of the run to a carbon server over TCP in the plaintext protocol.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net"
+	"time"
+)
+
+// GraphiteExporter sends a batch of metrics to carbon every graphiteInterval, reconnecting as needed.
+type GraphiteExporter struct {
+	conn      net.Conn
+	collector *StatsCollector
+}
+
+// startGraphiteExporter starts sending metrics to graphiteAddr every graphiteInterval, if it is set.
+// It returns a function that sends the final metrics, or nil if the exporter is disabled.
+func startGraphiteExporter(collector *StatsCollector) func() {
+	if graphiteAddr == "" {
+		return nil
+	}
+
+	exporter := &GraphiteExporter{collector: collector}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(graphiteInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				exporter.Send(now)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+		exporter.Send(time.Now())
+		exporter.Close()
+	}
+}
+
+// Send sends the current metrics to carbon as one batch.
+func (e *GraphiteExporter) Send(now time.Time) {
+	batch := formatGraphiteMetrics(e.collector, now)
+
+	// Reconnect if there is no connection or the last write failed
+	for attempt := 0; attempt < 2; attempt++ {
+		if e.conn == nil {
+			conn, err := net.DialTimeout("tcp", graphiteAddr, clientTimeout)
+			if err != nil {
+				slog.Error("Failed to connect to Graphite", "component", componentOutput, "error", err)
+				return
+			}
+			e.conn = conn
+		}
+		e.conn.SetWriteDeadline(time.Now().Add(clientTimeout))
+		if _, err := e.conn.Write(batch); err != nil {
+			slog.Error("Failed to send metrics to Graphite", "component", componentOutput, "error", err)
+			e.Close()
+			continue
+		}
+		return
+	}
+}
+
+// Close closes the connection to carbon.
+func (e *GraphiteExporter) Close() {
+	if e.conn != nil {
+		e.conn.Close()
+		e.conn = nil
+	}
+}
+
+// formatGraphiteMetrics formats the current metrics in the Graphite plaintext protocol.
+func formatGraphiteMetrics(collector *StatsCollector, now time.Time) []byte {
+	var b bytes.Buffer
+	timestamp := now.Unix()
+	metric := func(name string, value interface{}) {
+		fmt.Fprintf(&b, "%s%s %v %d\n", graphitePrefix, name, value, timestamp)
+	}
+
+	snapshot := collector.Snapshot()
+	metric("requests.started", snapshot.Requests)
+	metric("requests.successes", snapshot.Successes)
+	metric("requests.failures", snapshot.Failures)
+	metric("requests.per_second", timeline.Last().Requests)
+	metric("response.bytes", snapshot.BytesIn)
+	for _, code := range snapshot.StatusCodes.Codes() {
+		label := fmt.Sprint(code)
+		if code == 0 {
+			label = "other"
+		}
+		metric("status."+label, snapshot.StatusCodes[code])
+	}
+	for class, count := range snapshot.ErrorClasses {
+		if class != int(ErrorClassNone) {
+			metric("errors."+ErrorClass(class).String(), count)
+		}
+	}
+
+	latency := latencies.Snapshot()
+	metric("latency.mean_ms", formatMillis(latency.Mean))
+	metric("latency.p50_ms", formatMillis(latency.P50))
+	metric("latency.p90_ms", formatMillis(latency.P90))
+	metric("latency.p95_ms", formatMillis(latency.P95))
+	metric("latency.p99_ms", formatMillis(latency.P99))
+	metric("latency.max_ms", formatMillis(latency.Max))
+
+	if useProxy {
+		metric("proxies.pool_size", proxiesPool.Len())
+		metric("proxies.validated", snapshot.ProxySuccesses)
+		metric("proxies.failed_validation", snapshot.ProxyFailures)
+		metric("proxies.unique_ips", countUniqueIPs())
+	}
+
+	return b.Bytes()
+}
@@ -0,0 +1,85 @@
+// graphql.go contains the GraphQL mode, which POSTs a query or mutation to the target instead of sending GET requests.
+// The variables of every request are drawn from the parameters file like the query parameters of GET requests,
+// and a response whose errors array is not empty counts as a failure even if its status is a success.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+)
+
+// graphqlPayload is the JSON body of a GraphQL request
+type graphqlPayload struct {
+	Query         string          `json:"query"`
+	OperationName string          `json:"operationName,omitempty"`
+	Variables     json.RawMessage `json:"variables,omitempty"`
+}
+
+// validateGraphQL returns an error if the GraphQL mode cannot run: the errors array can only be checked in bodies
+// that are kept, and the variables template has to expand to a JSON object.
+func validateGraphQL() error {
+	if discardBodies || headersOnly {
+		return fmt.Errorf("GraphQL responses are checked for errors, which needs discardBodies and headersOnly to be disabled")
+	}
+	if strings.TrimSpace(graphqlQuery) == "" {
+		return fmt.Errorf("GraphQL query is empty")
+	}
+	variables := expandGraphQLVariables("name", "1", rand.New(rand.NewSource(runSeed)))
+	var object map[string]interface{}
+	if err := json.Unmarshal([]byte(variables), &object); err != nil {
+		return fmt.Errorf("GraphQL variables %s are not a JSON object: %w", variables, err)
+	}
+	return nil
+}
+
+// expandGraphQLVariables expands the variables template for a request with the given parameter name and value.
+func expandGraphQLVariables(name, value string, r *rand.Rand) string {
+	if graphqlVariables == "" {
+		return ""
+	}
+	return expandPlaceholders(strings.NewReplacer("%param", name, "%value", value).Replace(graphqlVariables), r)
+}
+
+// newGraphQLRequest creates a POST request of the GraphQL query to url, with the variables expanded
+// for the given parameter name and value.
+func newGraphQLRequest(ctx context.Context, url, name, value string, r *rand.Rand) (*http.Request, error) {
+	payload := graphqlPayload{
+		Query:         graphqlQuery,
+		OperationName: graphqlOperationName,
+	}
+	if variables := expandGraphQLVariables(name, value, r); variables != "" {
+		payload.Variables = json.RawMessage(variables)
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("encoding GraphQL payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// checkGraphQLErrors returns a description of the errors in a GraphQL response, or the empty string if it has none.
+func checkGraphQLErrors(body []byte) string {
+	var response struct {
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return "GraphQL response is not valid JSON"
+	}
+	if len(response.Errors) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d GraphQL error(s), first: %s", len(response.Errors), response.Errors[0].Message)
+}
@@ -0,0 +1,250 @@
+// grpc.go contains the gRPC control plane defined in jeet.proto, served over HTTP/2 with TLS,
+// so an orchestrator can steer many instances and stream their stats with typed messages instead of scraping logs.
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// grpcServicePath is the path prefix of the methods of the Control service
+const grpcServicePath = "/jeet.v1.Control/"
+
+// The gRPC status codes returned by the control plane
+const (
+	grpcOK              = 0
+	grpcInvalidArgument = 3
+	grpcUnimplemented   = 12
+	grpcInternal        = 13
+)
+
+// grpcUnaryMethods holds the unary methods of the Control service, which respond with the state of the run
+var grpcUnaryMethods = map[string]func(req protoFields){
+	"GetState":   func(req protoFields) {},
+	"Pause":      func(req protoFields) { runControl.Pause() },
+	"Resume":     func(req protoFields) { runControl.Resume() },
+	"SetThreads": func(req protoFields) { runControl.SetThreads(int(int32(req.Int(1)))) },
+	"SetRate":    func(req protoFields) { runControl.SetRPS(req.Double(1)) },
+	"Drain":      func(req protoFields) { requestStop() },
+}
+
+// startGRPCServer serves the Control service on grpcAddr for the lifetime of the run.
+// It uses the certificate in grpcCertFile and grpcKeyFile, or a self-signed one if they are not set.
+func startGRPCServer(collector *StatsCollector, start time.Time) error {
+	cert, err := grpcCertificate()
+	if err != nil {
+		slog.Error("Error in startGRPCServer", "component", componentControl, "error", err)
+		return fmt.Errorf("Failed to load gRPC certificate: %w", err)
+	}
+
+	server := &http.Server{
+		Addr: grpcAddr,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			serveGRPC(w, r, collector, start)
+		}),
+		TLSConfig: &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			NextProtos:   []string{"h2"},
+		},
+	}
+
+	go func() {
+		if err := server.ListenAndServeTLS("", ""); err != nil {
+			slog.Error("gRPC server failed", "component", componentControl, "error", err)
+		}
+	}()
+
+	return nil
+}
+
+// grpcCertificate loads the configured certificate, or generates a self-signed one and logs its fingerprint.
+func grpcCertificate() (tls.Certificate, error) {
+	if grpcCertFile != "" {
+		return tls.LoadX509KeyPair(grpcCertFile, grpcKeyFile)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "jeet"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	slog.Info("gRPC server uses a self-signed certificate", "component", componentControl, "sha256_fingerprint", fmt.Sprintf("%x", sha256.Sum256(der)))
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+// serveGRPC handles a gRPC call to the Control service.
+func serveGRPC(w http.ResponseWriter, r *http.Request, collector *StatsCollector, start time.Time) {
+	if r.ProtoMajor != 2 || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		http.Error(w, "gRPC requests only", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+
+	req, err := readGRPCMessage(r.Body)
+	if err != nil {
+		finishGRPC(w, grpcInvalidArgument, err.Error())
+		return
+	}
+
+	method := strings.TrimPrefix(r.URL.Path, grpcServicePath)
+	if method == "StreamStats" {
+		streamGRPCStats(w, r, req, collector, start)
+		return
+	}
+	action, ok := grpcUnaryMethods[method]
+	if !ok || !strings.HasPrefix(r.URL.Path, grpcServicePath) {
+		finishGRPC(w, grpcUnimplemented, "unknown method "+r.URL.Path)
+		return
+	}
+
+	slog.Info("gRPC method called", "component", componentControl, "method", method, "remote_addr", r.RemoteAddr)
+	action(req)
+	if err := writeGRPCMessage(w, encodeRunState(runControl.State())); err != nil {
+		return
+	}
+	finishGRPC(w, grpcOK, "")
+}
+
+// streamGRPCStats sends a StatsFrame at the requested interval until the run stops or the call is cancelled.
+func streamGRPCStats(w http.ResponseWriter, r *http.Request, req protoFields, collector *StatsCollector, start time.Time) {
+	interval := time.Duration(req.Int(1)) * time.Millisecond
+	if interval <= 0 {
+		interval = 1 * time.Second
+	}
+	if interval < 100*time.Millisecond {
+		interval = 100 * time.Millisecond
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	previous := collector.Get(CounterRequests)
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-runCtx.Done():
+			writeGRPCMessage(w, encodeStatsFrame(collector, start, previous, interval))
+			finishGRPC(w, grpcOK, "")
+			return
+		case <-ticker.C:
+			if err := writeGRPCMessage(w, encodeStatsFrame(collector, start, previous, interval)); err != nil {
+				return
+			}
+			previous = collector.Get(CounterRequests)
+		}
+	}
+}
+
+// readGRPCMessage reads the single length-prefixed message of a gRPC request and decodes its scalar fields.
+func readGRPCMessage(body io.Reader) (protoFields, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(body, prefix[:]); err != nil {
+		if err == io.EOF {
+			return protoFields{}, nil
+		}
+		return nil, fmt.Errorf("reading message prefix: %w", err)
+	}
+	if prefix[0] != 0 {
+		return nil, fmt.Errorf("compressed messages are not supported")
+	}
+	length := binary.BigEndian.Uint32(prefix[1:])
+	if length > 1<<16 {
+		return nil, fmt.Errorf("message of %d bytes is too large", length)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(body, data); err != nil {
+		return nil, fmt.Errorf("reading message: %w", err)
+	}
+	return decodeProtoFields(data)
+}
+
+// writeGRPCMessage writes a length-prefixed gRPC message and flushes it to the client.
+func writeGRPCMessage(w http.ResponseWriter, message protoMessage) error {
+	frame := make([]byte, 5, 5+len(message))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(message)))
+	if _, err := w.Write(append(frame, message...)); err != nil {
+		return err
+	}
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return nil
+}
+
+// finishGRPC ends a gRPC call with the given status in the trailers.
+func finishGRPC(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Grpc-Status", strconv.Itoa(status))
+	if message != "" {
+		w.Header().Set("Grpc-Message", message)
+	}
+}
+
+// encodeRunState encodes the state of the run as a RunState message.
+func encodeRunState(state RunState) protoMessage {
+	return protoMessage{}.
+		Bool(1, state.Paused).
+		Int(2, int64(state.Threads)).
+		Int(3, int64(state.Running)).
+		Double(4, state.RPS).
+		Bool(5, state.Stopping)
+}
+
+// encodeStatsFrame encodes the current stats as a StatsFrame message.
+// The rate is counted from previous, the request count at the start of the interval.
+func encodeStatsFrame(collector *StatsCollector, start time.Time, previous int64, interval time.Duration) protoMessage {
+	snapshot := newStatsSnapshotJSON(takeStatsSample(collector, 0))
+	latency := protoMessage{}.
+		Int(1, snapshot.Latency.Count).
+		Double(2, snapshot.Latency.Mean).
+		Double(3, snapshot.Latency.P50).
+		Double(4, snapshot.Latency.P90).
+		Double(5, snapshot.Latency.P95).
+		Double(6, snapshot.Latency.P99).
+		Double(7, snapshot.Latency.Max)
+
+	frame := protoMessage{}.
+		Double(1, time.Since(start).Seconds()).
+		Int(2, snapshot.Requests).
+		Int(3, snapshot.Successes).
+		Int(4, snapshot.Failures).
+		Double(5, float64(snapshot.Requests-previous)/interval.Seconds()).
+		Int(6, snapshot.BytesIn).
+		Bytes(7, latency).
+		Counts(8, snapshot.StatusCodes).
+		Counts(9, snapshot.Errors)
+	if useProxy {
+		frame = frame.Int(10, int64(proxiesPool.Len())).Int(11, int64(snapshot.UniqueIPs))
+	}
+	return frame.Bytes(12, encodeRunState(runControl.State()))
+}
@@ -0,0 +1,261 @@
+// grpcload.go contains the gRPC load mode, which sends unary gRPC calls instead of HTTP GET requests.
+// Calls are framed by hand and sent over the HTTP/2 connections of the same clients, so they go through
+// the proxy dialer too. The request message is built from a JSON template keyed by protobuf field number,
+// since no descriptor of the target's service is available. The gRPC status of every call is counted.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// grpcStatusNames holds the names of the gRPC status codes, indexed by code
+var grpcStatusNames = []string{
+	"OK", "CANCELLED", "UNKNOWN", "INVALID_ARGUMENT", "DEADLINE_EXCEEDED", "NOT_FOUND", "ALREADY_EXISTS",
+	"PERMISSION_DENIED", "RESOURCE_EXHAUSTED", "FAILED_PRECONDITION", "ABORTED", "OUT_OF_RANGE",
+	"UNIMPLEMENTED", "INTERNAL", "UNAVAILABLE", "DATA_LOSS", "UNAUTHENTICATED",
+}
+
+// grpcStatusValues counts the gRPC statuses of the calls
+var grpcStatusValues = newFieldTracker("grpc-status", cardinalityMaxValues)
+
+// validateGRPCLoad returns an error if the gRPC load mode cannot reach the target:
+// gRPC needs HTTP/2, which the clients only speak over TLS, and the expanded payload template has to encode.
+func validateGRPCLoad() error {
+	target, err := url.Parse(requestTarget)
+	if err != nil {
+		return fmt.Errorf("Failed to parse target URL: %w", err)
+	}
+	if target.Scheme != "https" {
+		return fmt.Errorf("gRPC calls need an https target, HTTP/2 without TLS is not supported")
+	}
+	if *protocolFlag == protocolHTTP1 {
+		return fmt.Errorf("gRPC calls need HTTP/2, but the protocol is %s", protocolHTTP1)
+	}
+	if !strings.HasPrefix(grpcMethod, "/") || strings.Count(grpcMethod, "/") != 2 {
+		return fmt.Errorf("gRPC method %q is not of the form /package.Service/Method", grpcMethod)
+	}
+	if err := validateTemplate(grpcPayload); err != nil {
+		return fmt.Errorf("gRPC payload: %w", err)
+	}
+	var row DataRow
+	if len(dataRows) > 0 {
+		row = dataRows[0]
+	}
+	if _, err := encodeProtoJSON(expandRowPlaceholders(grpcPayload, rand.New(rand.NewSource(runSeed)), row)); err != nil {
+		return fmt.Errorf("Failed to encode gRPC payload: %w", err)
+	}
+	return nil
+}
+
+// sendGRPCCall sends a unary gRPC call of the given thread through the given proxy's client, updates the shard's stats
+// and advances the progress bar. The payload takes its {{data column}} tokens from the thread's next row of the data file.
+// It returns true if a response was received, and false if the call could not be completed.
+func sendGRPCCall(sh *shard, thread int, client *http.Client, proxy string) bool {
+	// Increment the requests counter
+	sh.count(CounterRequests)
+
+	// Build the call from the payload template, framed as a single uncompressed gRPC message
+	message, err := encodeProtoJSON(expandRowPlaceholders(grpcPayload, sh.rng, nextDataRow(thread, sh.rng)))
+	if err != nil {
+		slog.Error("Failed to encode gRPC payload", "component", componentRequest, "proxy", proxy, "error", err)
+		noteError("Failed to encode gRPC payload: %s", err)
+		sh.countFailure(ErrorClassOther)
+		sh.complete() // Advance the progress bar
+		return false
+	}
+	frame := make([]byte, 5, 5+len(message))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(message)))
+	frame = append(frame, message...)
+
+	ctx, cancel := withRequestTimeout(withShard(context.Background(), sh))
+	defer cancel()
+
+	target, _ := url.Parse(requestTarget)
+	req, err := http.NewRequestWithContext(ctx, "POST", target.Scheme+"://"+target.Host+grpcMethod, bytes.NewReader(frame))
+	if err != nil {
+		slog.Error("Failed to create gRPC call", "component", componentRequest, "method", grpcMethod, "proxy", proxy, "error", err)
+		noteError("Failed to create gRPC call %s: %s", grpcMethod, err)
+		sh.countFailure(ErrorClassOther)
+		sh.complete() // Advance the progress bar
+		return false
+	}
+	req.Header.Set("Content-Type", "application/grpc+proto")
+	req.Header.Set("TE", "trailers")
+	if hostOverride != "" {
+		req.Host = hostOverride
+	}
+	id := tagRequest(req)
+
+	// Send the call and measure the time it takes
+	start := time.Now()
+	summary := RequestSummary{
+		Timestamp: start,
+		RequestID: id,
+		Parameter: grpcMethod,
+		Proxy:     proxy,
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		summary.Duration = time.Since(start)
+		summary.ErrorClass = classifyError(err)
+		slog.Error("Failed on gRPC call", "component", componentRequest, "request_id", id, "method", grpcMethod, "proxy", proxy,
+			"error_class", summary.ErrorClass.String(), "duration_ms", durationMillis(summary.Duration), "error", err)
+		noteError("%s: %s %s (%s)", summary.ErrorClass, id, grpcMethod, err)
+		summary.ErrorCount++
+		sh.countFailure(summary.ErrorClass)
+		recordSummary(sh, req, summary)
+		sh.complete() // Advance the progress bar
+		return false
+	}
+
+	// Read the response messages; the status arrives in the trailers, which are only known once the body is read
+	buf, readErr := readBody(sh, resp.Body)
+	defer releaseBody(buf)
+	if err := resp.Body.Close(); err != nil {
+		slog.Warn("Failed to close response body", "component", componentRequest, "request_id", id, "error", err)
+	}
+	summary.Duration = time.Since(start)
+	summary.StatusCode = resp.StatusCode
+	summary.Protocol = resp.Proto
+	summary.BytesIn = buf.Len()
+	summary.WireBytes = buf.Len()
+	sh.countStatus(resp.StatusCode)
+	sh.countBytes(buf.Len())
+	sh.countWireBytes(int64(buf.Len()))
+
+	// Count the gRPC status, which a trailers-only response sends in the headers
+	status := resp.Trailer.Get("Grpc-Status")
+	if status == "" {
+		status = resp.Header.Get("Grpc-Status")
+	}
+	code, codeErr := strconv.Atoi(status)
+	switch {
+	case readErr != nil:
+		failResponse(sh, &summary, ErrorClassBodyRead, readErr.Error())
+	case resp.StatusCode != http.StatusOK:
+		failResponse(sh, &summary, ErrorClassStatus, fmt.Sprintf("status %d", resp.StatusCode))
+	case codeErr != nil:
+		grpcStatusValues.ObserveValues(nil)
+		failResponse(sh, &summary, ErrorClassStatus, "no grpc-status in the response")
+	default:
+		grpcStatusValues.ObserveValues([]string{grpcStatusName(code)})
+		if code != grpcOK {
+			failResponse(sh, &summary, ErrorClassStatus, fmt.Sprintf("grpc status %s: %s", grpcStatusName(code), resp.Trailer.Get("Grpc-Message")))
+		}
+	}
+
+	// Add the duration to the shard's latency histogram, and the summary to the per-parameter aggregation
+	sh.latencies.Record(summary.Duration)
+	recordSummary(sh, req, summary)
+
+	// Increment the success counter unless the call was counted as a failure
+	if summary.ErrorClass == ErrorClassNone {
+		if sampleSuccessLog() {
+			slog.Info("Successful gRPC call", "component", componentRequest, "request_id", id, "method", grpcMethod, "proxy", proxy,
+				"status", summary.StatusCode, "bytes", buf.Len(), "duration_ms", durationMillis(summary.Duration), "sample", *logSampleFlag)
+		}
+		sh.count(CounterSuccesses)
+	}
+
+	// Advance the progress bar
+	sh.complete()
+
+	return true
+}
+
+// grpcStatusName returns the name of a gRPC status code.
+func grpcStatusName(code int) string {
+	if code < 0 || code >= len(grpcStatusNames) {
+		return strconv.Itoa(code)
+	}
+	return grpcStatusNames[code]
+}
+
+// encodeProtoJSON encodes a JSON object keyed by field number as a protobuf message.
+// Strings become string fields, integers varint fields, other numbers double fields, booleans bool fields,
+// objects embedded messages, and arrays repeated fields of their elements.
+func encodeProtoJSON(payload string) (protoMessage, error) {
+	decoder := json.NewDecoder(strings.NewReader(payload))
+	decoder.UseNumber()
+	var doc map[string]interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return encodeProtoObject(doc)
+}
+
+// encodeProtoObject encodes the fields of a decoded JSON object in ascending field number order.
+func encodeProtoObject(doc map[string]interface{}) (protoMessage, error) {
+	fields := make([]int, 0, len(doc))
+	for key := range doc {
+		field, err := strconv.Atoi(key)
+		if err != nil || field < 1 {
+			return nil, fmt.Errorf("key %q is not a field number", key)
+		}
+		fields = append(fields, field)
+	}
+	sort.Ints(fields)
+
+	message := protoMessage{}
+	for _, field := range fields {
+		var err error
+		if message, err = encodeProtoValue(message, field, doc[strconv.Itoa(field)]); err != nil {
+			return nil, err
+		}
+	}
+	return message, nil
+}
+
+// encodeProtoValue appends a decoded JSON value as the given field.
+func encodeProtoValue(message protoMessage, field int, value interface{}) (protoMessage, error) {
+	switch v := value.(type) {
+	case string:
+		return message.String(field, v), nil
+	case bool:
+		return message.Bool(field, v), nil
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return message.Int(field, n), nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("field %d: %w", field, err)
+		}
+		return message.Double(field, f), nil
+	case map[string]interface{}:
+		embedded, err := encodeProtoObject(v)
+		if err != nil {
+			return nil, fmt.Errorf("field %d: %w", field, err)
+		}
+		return message.Bytes(field, embedded), nil
+	case []interface{}:
+		for _, element := range v {
+			var err error
+			if message, err = encodeProtoValue(message, field, element); err != nil {
+				return nil, err
+			}
+		}
+		return message, nil
+	case nil:
+		return message, nil
+	}
+	return nil, fmt.Errorf("field %d has an unsupported value %v", field, value)
+}
+
+// printGRPCSummary prints the number of calls per gRPC status.
+func printGRPCSummary() {
+	printValueCounts("GRPC STATUSES "+grpcMethod, grpcStatusValues, "Responses without a gRPC status")
+}
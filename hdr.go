@@ -0,0 +1,285 @@
+// hdr.go contains a high dynamic range (HDR) histogram of durations.
+// It records values with a fixed number of significant figures in log-linear buckets,
+// so percentiles stay accurate with bounded memory no matter how many values are recorded.
+
+package main
+
+import (
+	"math"
+	"math/bits"
+	"sync"
+	"time"
+)
+
+// Histogram is an HDR histogram of durations with microsecond resolution.
+// Values above the highest trackable value are clamped to it.
+// It is safe for concurrent use.
+type Histogram struct {
+	mu sync.Mutex
+
+	highestTrackable            int64
+	subBucketHalfCountMagnitude uint
+	subBucketHalfCount          int64
+	subBucketMask               int64
+	counts                      []int64
+
+	count int64
+	sum   int64
+	min   int64
+	max   int64
+}
+
+// newHistogram creates a histogram that tracks durations from one microsecond up to highest,
+// keeping the given number of significant decimal figures (1 to 5).
+func newHistogram(highest time.Duration, significantFigures int) *Histogram {
+	highestTrackable := int64(highest / time.Microsecond)
+	if highestTrackable < 2 {
+		highestTrackable = 2
+	}
+
+	// Number of linear sub-buckets needed to keep the requested precision
+	largestValueWithSingleUnitResolution := 2 * int64(math.Pow10(significantFigures))
+	subBucketCountMagnitude := uint(math.Ceil(math.Log2(float64(largestValueWithSingleUnitResolution))))
+	if subBucketCountMagnitude < 1 {
+		subBucketCountMagnitude = 1
+	}
+	subBucketCount := int64(1) << subBucketCountMagnitude
+
+	// Number of exponential buckets needed to cover the highest trackable value
+	bucketCount := 1
+	for smallestUntrackable := subBucketCount; smallestUntrackable <= highestTrackable; smallestUntrackable <<= 1 {
+		bucketCount++
+	}
+
+	return &Histogram{
+		highestTrackable:            highestTrackable,
+		subBucketHalfCountMagnitude: subBucketCountMagnitude - 1,
+		subBucketHalfCount:          subBucketCount / 2,
+		subBucketMask:               subBucketCount - 1,
+		counts:                      make([]int64, (bucketCount+1)*int(subBucketCount/2)),
+	}
+}
+
+// Record adds a duration to the histogram.
+func (h *Histogram) Record(d time.Duration) {
+	h.RecordN(d, 1)
+}
+
+// RecordN adds a duration to the histogram n times.
+func (h *Histogram) RecordN(d time.Duration, n int64) {
+	if n <= 0 {
+		return
+	}
+	v := int64(d / time.Microsecond)
+	if v < 0 {
+		v = 0
+	}
+	if v > h.highestTrackable {
+		v = h.highestTrackable
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.counts[h.countsIndex(v)] += n
+	h.count += n
+	if v > 0 && n > math.MaxInt64/v {
+		h.sum = math.MaxInt64
+	} else {
+		h.sum = addSaturating(h.sum, v*n)
+	}
+	if h.count == n || v < h.min {
+		h.min = v
+	}
+	if v > h.max {
+		h.max = v
+	}
+}
+
+// Merge adds all values recorded in other to the histogram.
+// Both histograms must have been created with the same parameters.
+func (h *Histogram) Merge(other *Histogram) {
+	other.mu.Lock()
+	counts := make([]int64, len(other.counts))
+	copy(counts, other.counts)
+	count, sum, min, max := other.count, other.sum, other.min, other.max
+	other.mu.Unlock()
+
+	if count == 0 {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, c := range counts {
+		h.counts[i] += c
+	}
+	if h.count == 0 || min < h.min {
+		h.min = min
+	}
+	if max > h.max {
+		h.max = max
+	}
+	h.count += count
+	h.sum = addSaturating(h.sum, sum)
+}
+
+// DrainInto adds all values recorded in the histogram to dst and resets the histogram, atomically.
+// Both histograms must have been created with the same parameters.
+func (h *Histogram) DrainInto(dst *Histogram) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.count == 0 {
+		return
+	}
+
+	dst.mu.Lock()
+	defer dst.mu.Unlock()
+
+	for i, c := range h.counts {
+		if c != 0 {
+			dst.counts[i] += c
+			h.counts[i] = 0
+		}
+	}
+	if dst.count == 0 || h.min < dst.min {
+		dst.min = h.min
+	}
+	if h.max > dst.max {
+		dst.max = h.max
+	}
+	dst.count += h.count
+	dst.sum = addSaturating(dst.sum, h.sum)
+	h.count, h.sum, h.min, h.max = 0, 0, 0, 0
+}
+
+// Reset removes all recorded values.
+func (h *Histogram) Reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i := range h.counts {
+		h.counts[i] = 0
+	}
+	h.count, h.sum, h.min, h.max = 0, 0, 0, 0
+}
+
+// Count returns the number of recorded values.
+func (h *Histogram) Count() int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.count
+}
+
+// Sum returns the sum of the recorded durations.
+func (h *Histogram) Sum() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return time.Duration(h.sum) * time.Microsecond
+}
+
+// ValueAtQuantile returns the recorded duration at quantile q (0..1).
+func (h *Histogram) ValueAtQuantile(q float64) time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return time.Duration(h.valueAtQuantile(q)) * time.Microsecond
+}
+
+// Snapshot returns the current count, min, max, mean, and percentiles.
+func (h *Histogram) Snapshot() LatencySnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	snapshot := LatencySnapshot{
+		Count: h.count,
+		Min:   time.Duration(h.min) * time.Microsecond,
+		Max:   time.Duration(h.max) * time.Microsecond,
+		P50:   time.Duration(h.valueAtQuantile(0.50)) * time.Microsecond,
+		P90:   time.Duration(h.valueAtQuantile(0.90)) * time.Microsecond,
+		P95:   time.Duration(h.valueAtQuantile(0.95)) * time.Microsecond,
+		P99:   time.Duration(h.valueAtQuantile(0.99)) * time.Microsecond,
+	}
+	if h.count > 0 {
+		snapshot.Mean = time.Duration(h.sum/h.count) * time.Microsecond
+	}
+
+	return snapshot
+}
+
+// HistogramBucket is the number of recorded values up to an upper bound.
+type HistogramBucket struct {
+	UpperBound time.Duration
+	Count      int64
+}
+
+// Buckets returns the non-empty buckets of the histogram in ascending order.
+func (h *Histogram) Buckets() []HistogramBucket {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var buckets []HistogramBucket
+	for i, c := range h.counts {
+		if c != 0 {
+			buckets = append(buckets, HistogramBucket{
+				UpperBound: time.Duration(h.highestEquivalentValue(i)) * time.Microsecond,
+				Count:      c,
+			})
+		}
+	}
+	return buckets
+}
+
+// valueAtQuantile walks the buckets until the cumulative count reaches quantile q.
+// It returns the highest value equivalent to the bucket it stops in, clamped to the recorded maximum.
+// The caller must hold the lock.
+func (h *Histogram) valueAtQuantile(q float64) int64 {
+	if h.count == 0 {
+		return 0
+	}
+	target := int64(math.Ceil(q * float64(h.count)))
+	if target < 1 {
+		target = 1
+	}
+
+	var cumulative int64
+	for i, c := range h.counts {
+		cumulative += c
+		if cumulative >= target {
+			v := h.highestEquivalentValue(i)
+			if v > h.max {
+				v = h.max
+			}
+			return v
+		}
+	}
+
+	return h.max
+}
+
+// countsIndex returns the index in counts of the bucket holding value v.
+func (h *Histogram) countsIndex(v int64) int {
+	bucketIndex := int64(63-bits.LeadingZeros64(uint64(v|h.subBucketMask))) - int64(h.subBucketHalfCountMagnitude)
+	subBucketIndex := v >> uint(bucketIndex)
+	return int(((bucketIndex + 1) << h.subBucketHalfCountMagnitude) + (subBucketIndex - h.subBucketHalfCount))
+}
+
+// highestEquivalentValue returns the highest value stored in the bucket at counts index i.
+func (h *Histogram) highestEquivalentValue(i int) int64 {
+	bucketIndex := int64(i>>h.subBucketHalfCountMagnitude) - 1
+	subBucketIndex := int64(i)&(h.subBucketHalfCount-1) + h.subBucketHalfCount
+	if bucketIndex < 0 {
+		subBucketIndex -= h.subBucketHalfCount
+		bucketIndex = 0
+	}
+	return (subBucketIndex << uint(bucketIndex)) + (int64(1) << uint(bucketIndex)) - 1
+}
+
+// addSaturating returns a + b for non-negative values, saturating at math.MaxInt64 instead of wrapping around.
+func addSaturating(a, b int64) int64 {
+	if a > math.MaxInt64-b {
+		return math.MaxInt64
+	}
+	return a + b
+}
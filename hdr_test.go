@@ -0,0 +1,58 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestAddSaturating(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b int64
+		want int64
+	}{
+		{"zero", 0, 0, 0},
+		{"small", 2, 3, 5},
+		{"above 2^31", math.MaxInt32, math.MaxInt32, 2 * math.MaxInt32},
+		{"one below max", math.MaxInt64 - 2, 1, math.MaxInt64 - 1},
+		{"exactly max", math.MaxInt64 - 1, 1, math.MaxInt64},
+		{"max plus zero", math.MaxInt64, 0, math.MaxInt64},
+		{"one past max", math.MaxInt64, 1, math.MaxInt64},
+		{"max plus max", math.MaxInt64, math.MaxInt64, math.MaxInt64},
+		{"halves past max", math.MaxInt64/2 + 1, math.MaxInt64/2 + 1, math.MaxInt64},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := addSaturating(tt.a, tt.b); got != tt.want {
+				t.Errorf("addSaturating(%d, %d) = %d, want %d", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHistogramRecordNLargeCounts(t *testing.T) {
+	tests := []struct {
+		name      string
+		d         time.Duration
+		n         int64
+		wantCount int64
+		wantSum   int64 // In microseconds
+	}{
+		{"count above 2^31", time.Millisecond, 1 << 32, 1 << 32, 1000 << 32},
+		{"sum above 2^31", time.Second, 1 << 12, 1 << 12, 1000000 << 12},
+		{"sum saturates", time.Minute, math.MaxInt64 / 2, math.MaxInt64 / 2, math.MaxInt64},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newHistogram(time.Hour, 3)
+			h.RecordN(tt.d, tt.n)
+			if got := h.Count(); got != tt.wantCount {
+				t.Errorf("Count() = %d, want %d", got, tt.wantCount)
+			}
+			if h.sum != tt.wantSum {
+				t.Errorf("sum = %d, want %d", h.sum, tt.wantSum)
+			}
+		})
+	}
+}
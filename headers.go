@@ -0,0 +1,96 @@
+// headers.go contains the tracking of selected response headers, which are recorded with every request and counted
+// in a frequency table per header, useful for spotting which servers or CDN pops served the traffic,
+// and the assertions on response header values.
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// headerValues tracks the distinct values of every tracked response header, by canonical header name
+var headerValues = make(map[string]*FieldTracker)
+
+// headerPatterns holds the compiled headerAssertions, by canonical header name
+var headerPatterns = make(map[string]*regexp.Regexp)
+
+// setupHeaderTracking creates a tracker for every header in trackedHeaders and compiles the headerAssertions.
+// It returns an error if an assertion is not a valid regular expression.
+func setupHeaderTracking() error {
+	for _, name := range trackedHeaders {
+		name = http.CanonicalHeaderKey(name)
+		headerValues[name] = newFieldTracker(name, cardinalityMaxValues)
+	}
+
+	for name, expr := range headerAssertions {
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			slog.Error("Error in setupHeaderTracking", "component", componentMain, "error", err)
+			return fmt.Errorf("Failed to compile assertion on header %s: %w", name, err)
+		}
+		headerPatterns[http.CanonicalHeaderKey(name)] = pattern
+	}
+
+	return nil
+}
+
+// recordHeaders counts the values of the tracked headers of a response and returns them by header name.
+// It returns nil if the response has none of the tracked headers.
+func recordHeaders(header http.Header) map[string]string {
+	var recorded map[string]string
+	for name, tracker := range headerValues {
+		value := header.Get(name)
+		if value == "" {
+			tracker.ObserveValues(nil)
+			continue
+		}
+		if recorded == nil {
+			recorded = make(map[string]string, len(headerValues))
+		}
+		recorded[name] = value
+		tracker.ObserveValues([]string{headerFrequencyKey(name, value)})
+	}
+	return recorded
+}
+
+// headerFrequencyKey returns the key a header value is counted under in the frequency table.
+// CF-Ray values are unique per request, so they are counted by the Cloudflare pop they end with.
+func headerFrequencyKey(name, value string) string {
+	if name == "Cf-Ray" {
+		if i := strings.LastIndexByte(value, '-'); i >= 0 {
+			return value[i+1:]
+		}
+	}
+	return value
+}
+
+// checkHeaderAssertions checks the headers of a response against the headerAssertions.
+// It returns a description of the first failed assertion, or an empty string if all pass.
+func checkHeaderAssertions(header http.Header) string {
+	for name, pattern := range headerPatterns {
+		values, ok := header[name]
+		if !ok {
+			return fmt.Sprintf("header %s is missing", name)
+		}
+		if !pattern.MatchString(strings.Join(values, ", ")) {
+			return fmt.Sprintf("header %s does not match %q", name, pattern)
+		}
+	}
+	return ""
+}
+
+// printHeaderFrequencies prints the most frequent values of every tracked header.
+func printHeaderFrequencies() {
+	for _, name := range trackedHeaders {
+		name = http.CanonicalHeaderKey(name)
+		title := "HEADER " + name
+		if name == "Cf-Ray" {
+			title += " (by pop)"
+		}
+		printValueCounts(title, headerValues[name], "Responses without the header")
+	}
+}
@@ -0,0 +1,136 @@
+// height.go contains the THORChain height helper, which queries the current block height at run start
+// so the %height placeholder in baseUrl expands to heights within a recent window instead of stale constants.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// heightPlaceholder is replaced with a random height within the recent height window
+const heightPlaceholder = "%height"
+
+// rngPlaceholder matches %rng(min,max) placeholders, which are replaced with a random number in [min, max]
+var rngPlaceholder = regexp.MustCompile(`%rng\((\d+),(\d+)\)`)
+
+// The window of recent heights %height expands into, set by setupHeightWindow
+var (
+	minHeight = fallbackMinHeight
+	maxHeight = fallbackMaxHeight
+)
+
+// lastBlock is one entry of the THORNode lastblock response.
+type lastBlock struct {
+	Chain     string `json:"chain"`
+	Thorchain int64  `json:"thorchain"`
+}
+
+// setupHeightWindow queries the current THORChain height and sets the height window to the
+// heightWindow most recent blocks. It does nothing if baseUrl has no %height placeholder.
+// If the height cannot be queried, the fallback window is kept.
+func setupHeightWindow() {
+	if !strings.Contains(baseUrl, heightPlaceholder) {
+		return
+	}
+
+	height, err := queryCurrentHeight()
+	if err != nil {
+		slog.Warn("Failed to query current height, using the default heights", "component", componentMain, "min_height", minHeight, "max_height", maxHeight, "error", err)
+		return
+	}
+
+	maxHeight = int(height)
+	minHeight = maxHeight - heightWindow
+	if minHeight < 1 {
+		minHeight = 1
+	}
+	slog.Info("Queried current height", "component", componentMain, "height", height, "min_height", minHeight, "max_height", maxHeight)
+}
+
+// queryCurrentHeight returns the current THORChain height reported by heightQueryUrl.
+func queryCurrentHeight() (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), clientTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", heightQueryUrl, nil)
+	if err != nil {
+		slog.Error("Error in queryCurrentHeight", "component", componentMain, "error", err)
+		return 0, fmt.Errorf("Failed to create height request: %w", err)
+	}
+	req.Header.Add("Accept", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		slog.Error("Error in queryCurrentHeight", "component", componentMain, "error", err)
+		return 0, fmt.Errorf("Failed to query height: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("Received non-200 response code: %d", resp.StatusCode)
+	}
+
+	var blocks []lastBlock
+	if err := json.NewDecoder(resp.Body).Decode(&blocks); err != nil {
+		slog.Error("Error in queryCurrentHeight", "component", componentMain, "error", err)
+		return 0, fmt.Errorf("Failed to decode height response: %w", err)
+	}
+
+	// Every chain reports the same THORChain height, but take the highest in case one lags
+	var height int64
+	for _, block := range blocks {
+		if block.Thorchain > height {
+			height = block.Thorchain
+		}
+	}
+	if height == 0 {
+		return 0, fmt.Errorf("No height in response")
+	}
+
+	return height, nil
+}
+
+// expandPlaceholders replaces every %height and %rng(min,max) placeholder and every {{...}} template token in s
+// with a random value.
+func expandPlaceholders(s string, r *rand.Rand) string {
+	return expandRowPlaceholders(s, r, nil)
+}
+
+// expandRowPlaceholders is expandPlaceholders for a request with a row of the data file,
+// which {{data column}} tokens take their values from.
+func expandRowPlaceholders(s string, r *rand.Rand, row DataRow) string {
+	return expandTemplate(expandNumberPlaceholders(s, r), r, row)
+}
+
+// expandURLPlaceholders is expandRowPlaceholders for a URL, escaping the values of template tokens
+// for the part of the URL they land in.
+func expandURLPlaceholders(s string, r *rand.Rand, row DataRow) string {
+	return expandURLTemplate(expandNumberPlaceholders(s, r), r, row)
+}
+
+// expandNumberPlaceholders replaces every %height and %rng(min,max) placeholder in s with a random number.
+func expandNumberPlaceholders(s string, r *rand.Rand) string {
+	for strings.Contains(s, heightPlaceholder) {
+		s = strings.Replace(s, heightPlaceholder, rng(r, minHeight, maxHeight), 1)
+	}
+
+	s = rngPlaceholder.ReplaceAllStringFunc(s, func(placeholder string) string {
+		bounds := rngPlaceholder.FindStringSubmatch(placeholder)
+		min, _ := strconv.Atoi(bounds[1])
+		max, _ := strconv.Atoi(bounds[2])
+		if max < min {
+			min, max = max, min
+		}
+		return rng(r, min, max)
+	})
+
+	return s
+}
@@ -0,0 +1,254 @@
+// htmlreport.go contains the self-contained HTML report, rendered at the end of a run from an embedded template
+// with inline SVG charts of the latency distribution and throughput over time, and the error, status, and parameter tables.
+
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"math"
+	"os"
+	"strings"
+	"time"
+)
+
+// htmlReportTemplate is the template of the HTML report
+//
+//go:embed report.html.tmpl
+var htmlReportTemplate string
+
+// The size of the charts in the HTML report, in SVG user units
+const (
+	chartWidth  = 900
+	chartHeight = 240
+	chartMargin = 40
+)
+
+// htmlReportData is the data the HTML report template is executed with.
+type htmlReportData struct {
+	Report     RunReport
+	Generated  time.Time
+	Latency    svgChart
+	Throughput svgChart
+	Statuses   []labelledCount
+	Errors     []labelledCount
+}
+
+// labelledCount is a row of a breakdown table.
+type labelledCount struct {
+	Label   string
+	Count   int64
+	Percent float64
+}
+
+// svgChart holds the precomputed geometry of an inline SVG chart.
+type svgChart struct {
+	Width   int
+	Height  int
+	Bars    []svgBar
+	Lines   []svgLine
+	XLabels []svgLabel
+	YMax    string
+}
+
+// svgBar is a bar of a bar chart.
+type svgBar struct {
+	X, Y, W, H float64
+	Title      string
+}
+
+// svgLine is a series of a line chart.
+type svgLine struct {
+	Name   string
+	Color  string
+	Points string
+}
+
+// svgLabel is a label on the x axis of a chart.
+type svgLabel struct {
+	X    float64
+	Text string
+}
+
+// writeHTMLReport renders the HTML report for a run to the file at path.
+func writeHTMLReport(path string, report RunReport) error {
+	tmpl, err := template.New("report").Funcs(template.FuncMap{
+		"millis":     formatMillis,
+		"mulPercent": func(rate float64) float64 { return 100 * rate },
+	}).Parse(htmlReportTemplate)
+	if err != nil {
+		slog.Error("Error in writeHTMLReport", "component", componentOutput, "error", err)
+		return fmt.Errorf("Failed to parse HTML report template: %w", err)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		slog.Error("Error in writeHTMLReport", "component", componentOutput, "error", err)
+		return fmt.Errorf("Failed to create HTML report file: %w", err)
+	}
+	// Ensure the file is closed after the function returns
+	defer func() {
+		if cerr := file.Close(); cerr != nil {
+			slog.Error("Failed to close HTML report file", "component", componentOutput, "error", cerr)
+		}
+	}()
+
+	data := htmlReportData{
+		Report:     report,
+		Generated:  time.Now(),
+		Latency:    latencyChart(latencies.Buckets()),
+		Throughput: throughputChart(timeline.Points(chartWidth - 2*chartMargin)),
+		Statuses:   statusRows(report.Stats.StatusCodes),
+		Errors:     errorRows(report.Stats.ErrorClasses),
+	}
+	if err := tmpl.Execute(file, data); err != nil {
+		slog.Error("Error in writeHTMLReport", "component", componentOutput, "error", err)
+		return fmt.Errorf("Failed to render HTML report: %w", err)
+	}
+
+	return nil
+}
+
+// latencyChart groups histogram buckets into logarithmically spaced bins and lays them out as a bar chart.
+func latencyChart(buckets []HistogramBucket) svgChart {
+	const bins = 40
+	chart := svgChart{Width: chartWidth, Height: chartHeight}
+	if len(buckets) == 0 {
+		return chart
+	}
+
+	lowest := math.Log(math.Max(float64(buckets[0].UpperBound), float64(time.Microsecond)))
+	highest := math.Log(float64(buckets[len(buckets)-1].UpperBound))
+	if highest <= lowest {
+		highest = lowest + 1
+	}
+
+	// Sort the buckets into bins by the logarithm of their upper bound
+	counts := make([]int64, bins)
+	for _, bucket := range buckets {
+		i := int(float64(bins-1) * (math.Log(math.Max(float64(bucket.UpperBound), float64(time.Microsecond))) - lowest) / (highest - lowest))
+		counts[i] += bucket.Count
+	}
+	var maxCount int64
+	for _, c := range counts {
+		if c > maxCount {
+			maxCount = c
+		}
+	}
+
+	plotWidth := float64(chartWidth - 2*chartMargin)
+	plotHeight := float64(chartHeight - 2*chartMargin)
+	barWidth := plotWidth / bins
+	binBound := func(i int) time.Duration {
+		return time.Duration(math.Exp(lowest + (highest-lowest)*float64(i+1)/bins))
+	}
+	for i, c := range counts {
+		h := plotHeight * float64(c) / float64(maxCount)
+		chart.Bars = append(chart.Bars, svgBar{
+			X:     chartMargin + float64(i)*barWidth,
+			Y:     chartMargin + plotHeight - h,
+			W:     barWidth - 1,
+			H:     h,
+			Title: fmt.Sprintf("up to %s: %d", roundDuration(binBound(i)), c),
+		})
+		if i%8 == 0 || i == bins-1 {
+			chart.XLabels = append(chart.XLabels, svgLabel{
+				X:    chartMargin + float64(i)*barWidth + barWidth/2,
+				Text: roundDuration(binBound(i)).String(),
+			})
+		}
+	}
+	chart.YMax = fmt.Sprint(maxCount)
+
+	return chart
+}
+
+// throughputChart lays out the timeline as a line chart of requests, successes, and failures per second.
+func throughputChart(points []TimelinePoint) svgChart {
+	chart := svgChart{Width: chartWidth, Height: chartHeight}
+	if len(points) == 0 {
+		return chart
+	}
+
+	var maxRate float64
+	for _, point := range points {
+		maxRate = math.Max(maxRate, point.Requests)
+		maxRate = math.Max(maxRate, point.Successes)
+	}
+	if maxRate == 0 {
+		maxRate = 1
+	}
+
+	plotWidth := float64(chartWidth - 2*chartMargin)
+	plotHeight := float64(chartHeight - 2*chartMargin)
+	step := plotWidth / math.Max(float64(len(points)-1), 1)
+	series := func(value func(TimelinePoint) float64) string {
+		coords := make([]string, len(points))
+		for i, point := range points {
+			coords[i] = fmt.Sprintf("%.1f,%.1f", chartMargin+float64(i)*step, chartMargin+plotHeight-plotHeight*value(point)/maxRate)
+		}
+		return strings.Join(coords, " ")
+	}
+	chart.Lines = []svgLine{
+		{Name: "requests/s", Color: "#4e79a7", Points: series(func(p TimelinePoint) float64 { return p.Requests })},
+		{Name: "successes/s", Color: "#59a14f", Points: series(func(p TimelinePoint) float64 { return p.Successes })},
+		{Name: "failures/s", Color: "#e15759", Points: series(func(p TimelinePoint) float64 { return p.Failures })},
+	}
+	for _, i := range []int{0, len(points) / 2, len(points) - 1} {
+		chart.XLabels = append(chart.XLabels, svgLabel{
+			X:    chartMargin + float64(i)*step,
+			Text: points[i].Elapsed.Round(time.Second).String(),
+		})
+	}
+	chart.YMax = fmt.Sprintf("%.0f/s", maxRate)
+
+	return chart
+}
+
+// statusRows returns the status code breakdown as table rows.
+func statusRows(statuses StatusCounts) []labelledCount {
+	var total int64
+	for _, count := range statuses {
+		total += count
+	}
+
+	rows := make([]labelledCount, 0, len(statuses))
+	for _, code := range statuses.Codes() {
+		label := fmt.Sprint(code)
+		if code == 0 {
+			label = "other"
+		}
+		rows = append(rows, labelledCount{Label: label, Count: statuses[code], Percent: 100 * float64(statuses[code]) / float64(total)})
+	}
+	return rows
+}
+
+// errorRows returns the error class breakdown as table rows.
+func errorRows(errorClasses ErrorCounts) []labelledCount {
+	var total int64
+	for _, count := range errorClasses {
+		total += count
+	}
+
+	var rows []labelledCount
+	for class, count := range errorClasses {
+		if count > 0 {
+			rows = append(rows, labelledCount{Label: ErrorClass(class).String(), Count: count, Percent: 100 * float64(count) / float64(total)})
+		}
+	}
+	return rows
+}
+
+// roundDuration rounds a duration to a precision that suits its magnitude.
+func roundDuration(d time.Duration) time.Duration {
+	switch {
+	case d >= time.Second:
+		return d.Round(10 * time.Millisecond)
+	case d >= time.Millisecond:
+		return d.Round(100 * time.Microsecond)
+	default:
+		return d.Round(time.Microsecond)
+	}
+}
@@ -0,0 +1,213 @@
+// influx.go contains the InfluxDB sink, which writes request measurements and proxy stats
+// to InfluxDB v2 over HTTP in line protocol batches, tagged with the run and host.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// influxTagEscaper escapes the characters that are special in line protocol tag keys and values
+var influxTagEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "=", `\=`)
+
+// InfluxSink batches measurements in line protocol and writes them to InfluxDB v2.
+// Batches are written by a background goroutine, so a slow database never blocks the threads;
+// if it falls behind by more than influxMaxPendingBatches, batches are dropped.
+// It is safe for concurrent use.
+type InfluxSink struct {
+	mu      sync.Mutex
+	buf     bytes.Buffer
+	lines   int
+	closed  bool
+	tags    string // Preformatted run and host tags
+	writeTo string // Write API URL including org, bucket, and precision
+	batches chan []byte
+	done    chan struct{} // Closed to stop the periodic flush
+	flushed chan struct{} // Closed when the periodic flush has stopped
+	sent    chan struct{} // Closed when the sender has written every batch
+
+	collector *StatsCollector // Counters the periodic flush writes
+}
+
+// openInfluxSink creates a sink writing to the InfluxDB v2 server at influxUrl.
+func openInfluxSink(collector *StatsCollector) (*InfluxSink, error) {
+	writeTo, err := url.Parse(strings.TrimSuffix(influxUrl, "/") + "/api/v2/write")
+	if err != nil {
+		slog.Error("Error in openInfluxSink", "component", componentOutput, "error", err)
+		return nil, fmt.Errorf("Failed to parse InfluxDB URL: %w", err)
+	}
+	query := writeTo.Query()
+	query.Set("org", influxOrg)
+	query.Set("bucket", influxBucket)
+	query.Set("precision", "ns")
+	writeTo.RawQuery = query.Encode()
+
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+
+	sink := &InfluxSink{
+		tags:    ",run=" + influxTagEscaper.Replace(time.Now().Format(runDirectoryLayout)) + ",host=" + influxTagEscaper.Replace(host),
+		writeTo: writeTo.String(),
+		batches: make(chan []byte, influxMaxPendingBatches),
+		done:    make(chan struct{}),
+		flushed: make(chan struct{}),
+		sent:    make(chan struct{}),
+
+		collector: collector,
+	}
+	go sink.send()
+	go sink.flushPeriodically()
+
+	return sink, nil
+}
+
+// Write adds a request measurement to the current batch.
+func (s *InfluxSink) Write(summary RequestSummary) {
+	var line strings.Builder
+	line.WriteString("jeet_request")
+	line.WriteString(s.tags)
+	line.WriteString(",parameter=")
+	line.WriteString(influxTagEscaper.Replace(parameterName(summary.Parameter)))
+	if summary.Proxy != "" {
+		line.WriteString(",proxy=")
+		line.WriteString(influxTagEscaper.Replace(summary.Proxy))
+	}
+	if summary.StatusCode != 0 {
+		line.WriteString(",status=")
+		line.WriteString(strconv.Itoa(summary.StatusCode))
+	}
+	if summary.ErrorClass != ErrorClassNone {
+		line.WriteString(",error_class=")
+		line.WriteString(summary.ErrorClass.String())
+	}
+	fmt.Fprintf(&line, " duration_ms=%s,bytes=%di %d\n", formatMillis(summary.Duration), summary.BytesIn, summary.Timestamp.UnixNano())
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.buf.WriteString(line.String())
+	s.lines++
+	if s.lines >= influxBatchSize {
+		s.flushLocked()
+	}
+}
+
+// flushLocked hands the current batch to the sender. The caller must hold the lock.
+func (s *InfluxSink) flushLocked() {
+	if s.lines == 0 {
+		return
+	}
+	batch := append([]byte(nil), s.buf.Bytes()...)
+	s.buf.Reset()
+	s.lines = 0
+
+	select {
+	case s.batches <- batch:
+	default:
+		slog.Warn("InfluxDB is falling behind, dropping a batch of measurements", "component", componentOutput)
+	}
+}
+
+// flushPeriodically adds the proxy stats to the batch and flushes it every influxFlushInterval until the sink is closed.
+func (s *InfluxSink) flushPeriodically() {
+	defer close(s.flushed)
+
+	ticker := time.NewTicker(influxFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			snapshot := s.collector.Snapshot()
+			s.mu.Lock()
+			if useProxy && proxiesPool != nil {
+				fmt.Fprintf(&s.buf, "jeet_proxies%s pool_size=%di,validated=%di,failed_validation=%di,unique_ips=%di %d\n",
+					s.tags, proxiesPool.Len(), snapshot.ProxySuccesses, snapshot.ProxyFailures, countUniqueIPs(), now.UnixNano())
+				s.lines++
+			}
+			s.flushLocked()
+			s.mu.Unlock()
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// send writes the batches to InfluxDB until the batches channel is closed.
+func (s *InfluxSink) send() {
+	defer close(s.sent)
+
+	for batch := range s.batches {
+		if err := s.writeBatch(batch); err != nil {
+			slog.Error("Failed to write measurements to InfluxDB", "component", componentOutput, "error", err)
+		}
+	}
+}
+
+// writeBatch posts a batch of lines to the InfluxDB write API.
+func (s *InfluxSink) writeBatch(batch []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), clientTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", s.writeTo, bytes.NewReader(batch))
+	if err != nil {
+		slog.Error("Error in writeBatch", "component", componentOutput, "error", err)
+		return fmt.Errorf("Failed to create InfluxDB request: %w", err)
+	}
+	req.Header.Add("Content-Type", "text/plain; charset=utf-8")
+	if influxToken != "" {
+		req.Header.Add("Authorization", "Token "+influxToken)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		slog.Error("Error in writeBatch", "component", componentOutput, "error", err)
+		return fmt.Errorf("Failed to post to InfluxDB: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("Received response code %d from InfluxDB: %s", resp.StatusCode, body)
+	}
+
+	return nil
+}
+
+// Close writes the remaining measurements and stops the background goroutines.
+func (s *InfluxSink) Close() error {
+	// Stop the periodic flush first, so nothing queues batches after the channel is closed
+	close(s.done)
+	<-s.flushed
+
+	s.mu.Lock()
+	s.closed = true
+	batch := append([]byte(nil), s.buf.Bytes()...)
+	s.buf.Reset()
+	s.lines = 0
+	s.mu.Unlock()
+
+	// Queue the last batch and wait for the sender to write everything
+	if len(batch) > 0 {
+		s.batches <- batch
+	}
+	close(s.batches)
+	<-s.sent
+
+	return nil
+}
@@ -0,0 +1,83 @@
+// ipfamily.go contains the IP version preference of the dialers: IPv4 only, IPv6 only, or both with happy eyeballs.
+// It applies to direct connections and to the connections to the proxies, and the address family of the connection
+// every request was sent over is recorded and counted.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http/httptrace"
+)
+
+// The IP version preferences
+const (
+	ipVersionAny = "any" // Dial IPv4 and IPv6 addresses with happy eyeballs
+	ipVersion4   = "4"   // Only dial IPv4 addresses
+	ipVersion6   = "6"   // Only dial IPv6 addresses
+)
+
+// addressFamilyValues counts the address families of the connections the requests were sent over
+var addressFamilyValues = newFieldTracker("address-family", cardinalityMaxValues)
+
+// validateIPVersion returns an error if the -ip-version flag is not a known preference.
+func validateIPVersion() error {
+	switch *ipVersionFlag {
+	case ipVersionAny, ipVersion4, ipVersion6:
+		return nil
+	}
+	return fmt.Errorf("unknown IP version %q", *ipVersionFlag)
+}
+
+// dialNetwork returns the network the dialers dial TCP connections on.
+func dialNetwork() string {
+	switch *ipVersionFlag {
+	case ipVersion4:
+		return "tcp4"
+	case ipVersion6:
+		return "tcp6"
+	}
+	return "tcp"
+}
+
+// lookupNetwork returns the network hostnames are resolved for.
+func lookupNetwork() string {
+	switch *ipVersionFlag {
+	case ipVersion4:
+		return "ip4"
+	case ipVersion6:
+		return "ip6"
+	}
+	return "ip"
+}
+
+// withAddressFamily returns a context that stores the address family of the connection a request gets in family.
+func withAddressFamily(ctx context.Context, family *string) context.Context {
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			*family = addressFamily(info.Conn.RemoteAddr())
+		},
+	})
+}
+
+// addressFamily returns the family of a connection's remote address: ipv4, ipv6, or the network of other addresses.
+// The remote address of a proxied connection is the proxy's.
+func addressFamily(addr net.Addr) string {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		if addr == nil {
+			return ""
+		}
+		return addr.Network()
+	}
+	if tcpAddr.IP.To4() != nil {
+		return "ipv4"
+	}
+	return "ipv6"
+}
+
+// printAddressFamilySummary prints the number of requests per address family.
+func printAddressFamilySummary() {
+	printValueCounts("ADDRESS FAMILIES", addressFamilyValues, "Requests without a connection")
+}
@@ -0,0 +1,183 @@
+// kafka.go contains a minimal Kafka producer for the event bus sink, which sends batches of messages
+// to one partition of a topic with Produce requests (version 3, record batch format 2).
+// It talks to a single broker, which must be the leader of the partition; it does not discover leaders.
+
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"time"
+)
+
+// The Produce request the producer sends
+const (
+	kafkaProduceKey     = 0
+	kafkaProduceVersion = 3
+	kafkaAcks           = 1 // Wait for the leader to write the batch
+
+	kafkaMaxResponseSize = 64 << 10 // Largest Produce response accepted; one topic and partition need a few dozen bytes
+)
+
+// kafkaCRC is the CRC-32C table used for record batch checksums
+var kafkaCRC = crc32.MakeTable(crc32.Castagnoli)
+
+// kafkaPublisher publishes messages to a Kafka topic partition.
+// It connects on the first publish and reconnects after a failure.
+type kafkaPublisher struct {
+	addr      string
+	topic     string
+	partition int
+
+	conn          net.Conn
+	r             *bufio.Reader
+	correlationID int32
+}
+
+// Publish sends the messages as one record batch and waits for the broker to acknowledge it.
+func (p *kafkaPublisher) Publish(messages [][]byte) error {
+	if p.conn == nil {
+		conn, err := net.DialTimeout("tcp", p.addr, *requestTimeoutFlag)
+		if err != nil {
+			return fmt.Errorf("Failed to connect to Kafka: %w", err)
+		}
+		p.conn, p.r = conn, bufio.NewReader(conn)
+	}
+
+	p.correlationID++
+	request := p.produceRequest(p.correlationID, encodeKafkaRecordBatch(messages, time.Now()))
+
+	p.conn.SetDeadline(requestDeadline(time.Now()))
+	if _, err := p.conn.Write(request); err != nil {
+		p.reset()
+		return fmt.Errorf("Failed to send Produce request: %w", err)
+	}
+	if err := p.readProduceResponse(p.correlationID); err != nil {
+		p.reset()
+		return err
+	}
+
+	return nil
+}
+
+// reset closes the connection, so the next publish reconnects.
+func (p *kafkaPublisher) reset() {
+	p.conn.Close()
+	p.conn = nil
+}
+
+// Close disconnects from the broker.
+func (p *kafkaPublisher) Close() error {
+	if p.conn == nil {
+		return nil
+	}
+	err := p.conn.Close()
+	p.conn = nil
+	return err
+}
+
+// produceRequest builds a size-prefixed Produce request for a record batch.
+func (p *kafkaPublisher) produceRequest(correlationID int32, batch []byte) []byte {
+	b := make([]byte, 4, 64+len(p.topic)+len(batch))
+
+	// Request header
+	b = binary.BigEndian.AppendUint16(b, kafkaProduceKey)
+	b = binary.BigEndian.AppendUint16(b, kafkaProduceVersion)
+	b = binary.BigEndian.AppendUint32(b, uint32(correlationID))
+	b = appendKafkaString(b, "jeet")
+
+	// Produce request body with a single topic and partition
+	b = binary.BigEndian.AppendUint16(b, 0xffff) // No transactional id
+	b = binary.BigEndian.AppendUint16(b, kafkaAcks)
+	b = binary.BigEndian.AppendUint32(b, uint32(*requestTimeoutFlag/time.Millisecond))
+	b = binary.BigEndian.AppendUint32(b, 1)
+	b = appendKafkaString(b, p.topic)
+	b = binary.BigEndian.AppendUint32(b, 1)
+	b = binary.BigEndian.AppendUint32(b, uint32(p.partition))
+	b = binary.BigEndian.AppendUint32(b, uint32(len(batch)))
+	b = append(b, batch...)
+
+	binary.BigEndian.PutUint32(b, uint32(len(b)-4))
+	return b
+}
+
+// readProduceResponse reads the response to a Produce request and returns the partition's error, if any.
+func (p *kafkaPublisher) readProduceResponse(correlationID int32) error {
+	var size [4]byte
+	if _, err := io.ReadFull(p.r, size[:]); err != nil {
+		return fmt.Errorf("Failed to read Produce response: %w", err)
+	}
+	length := binary.BigEndian.Uint32(size[:])
+	if length > kafkaMaxResponseSize {
+		return fmt.Errorf("Produce response of %d bytes exceeds the limit of %d bytes", length, kafkaMaxResponseSize)
+	}
+	resp := make([]byte, length)
+	if _, err := io.ReadFull(p.r, resp); err != nil {
+		return fmt.Errorf("Failed to read Produce response: %w", err)
+	}
+
+	// Correlation id, topic count, topic name, partition count, partition, error code
+	if len(resp) < 14 || int32(binary.BigEndian.Uint32(resp)) != correlationID {
+		return fmt.Errorf("malformed Produce response")
+	}
+	nameLen := int(binary.BigEndian.Uint16(resp[8:]))
+	offset := 10 + nameLen + 4 + 4
+	if len(resp) < offset+2 {
+		return fmt.Errorf("malformed Produce response")
+	}
+	if code := int16(binary.BigEndian.Uint16(resp[offset:])); code != 0 {
+		return fmt.Errorf("Kafka returned error code %d", code)
+	}
+
+	return nil
+}
+
+// encodeKafkaRecordBatch encodes messages as a record batch (magic 2) without keys or headers.
+func encodeKafkaRecordBatch(messages [][]byte, now time.Time) []byte {
+	timestamp := now.UnixMilli()
+
+	var records []byte
+	for i, message := range messages {
+		var record []byte
+		record = append(record, 0) // Attributes
+		record = binary.AppendVarint(record, 0)
+		record = binary.AppendVarint(record, int64(i))
+		record = binary.AppendVarint(record, -1) // No key
+		record = binary.AppendVarint(record, int64(len(message)))
+		record = append(record, message...)
+		record = binary.AppendVarint(record, 0) // No headers
+
+		records = binary.AppendVarint(records, int64(len(record)))
+		records = append(records, record...)
+	}
+
+	// The part of the batch covered by the checksum, from the attributes to the end
+	var body []byte
+	body = binary.BigEndian.AppendUint16(body, 0) // Attributes: no compression
+	body = binary.BigEndian.AppendUint32(body, uint32(len(messages)-1))
+	body = binary.BigEndian.AppendUint64(body, uint64(timestamp))
+	body = binary.BigEndian.AppendUint64(body, uint64(timestamp))
+	body = binary.BigEndian.AppendUint64(body, ^uint64(0)) // No producer id
+	body = binary.BigEndian.AppendUint16(body, 0xffff)     // No producer epoch
+	body = binary.BigEndian.AppendUint32(body, ^uint32(0)) // No base sequence
+	body = binary.BigEndian.AppendUint32(body, uint32(len(messages)))
+	body = append(body, records...)
+
+	var batch []byte
+	batch = binary.BigEndian.AppendUint64(batch, 0)                       // Base offset
+	batch = binary.BigEndian.AppendUint32(batch, uint32(4+1+4+len(body))) // Batch length after this field
+	batch = binary.BigEndian.AppendUint32(batch, ^uint32(0))              // Partition leader epoch
+	batch = append(batch, 2)                                              // Magic
+	batch = binary.BigEndian.AppendUint32(batch, crc32.Checksum(body, kafkaCRC))
+	return append(batch, body...)
+}
+
+// appendKafkaString appends a string with an int16 length prefix.
+func appendKafkaString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+)
+
+// kafkaGolden decodes the hex fields of a golden encoding, ignoring the spaces between them.
+func kafkaGolden(t *testing.T, fields ...string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(strings.ReplaceAll(strings.Join(fields, ""), " ", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestEncodeKafkaRecordBatch(t *testing.T) {
+	now := time.UnixMilli(1700000000000)
+	tests := []struct {
+		name     string
+		messages [][]byte
+		want     []string // Golden hex fields of the batch
+	}{
+		{
+			"one message",
+			[][]byte{[]byte("hello")},
+			[]string{
+				"00000000 00000000", // Base offset
+				"0000003d",          // Batch length
+				"ffffffff",          // Partition leader epoch
+				"02",                // Magic
+				"e641a44b",          // CRC-32C of the rest
+				"0000",              // Attributes
+				"00000000",          // Last offset delta
+				"0000018b cfe56800", // First timestamp
+				"0000018b cfe56800", // Max timestamp
+				"ffffffff ffffffff", // Producer id
+				"ffff",              // Producer epoch
+				"ffffffff",          // Base sequence
+				"00000001",          // Record count
+				"16 00 00 00 01 0a", // Length, attributes, timestamp and offset deltas, no key, value length
+				"68656c6c6f 00",     // Value, no headers
+			},
+		},
+		{
+			"two messages",
+			[][]byte{[]byte("a"), []byte("bc")},
+			[]string{
+				"00000000 00000000",
+				"00000042",
+				"ffffffff",
+				"02",
+				"af2b6054",
+				"0000",
+				"00000001",
+				"0000018b cfe56800",
+				"0000018b cfe56800",
+				"ffffffff ffffffff",
+				"ffff",
+				"ffffffff",
+				"00000002",
+				"0e 00 00 00 01 02 61 00",   // Offset delta 0
+				"10 00 00 02 01 04 6263 00", // Offset delta 1
+			},
+		},
+		{
+			"multi-byte varints",
+			[][]byte{bytes.Repeat([]byte("x"), 64)},
+			[]string{
+				"00000000 00000000",
+				"0000007a",
+				"ffffffff",
+				"02",
+				"f6c17598",
+				"0000",
+				"00000000",
+				"0000018b cfe56800",
+				"0000018b cfe56800",
+				"ffffffff ffffffff",
+				"ffff",
+				"ffffffff",
+				"00000001",
+				"8e01 00 00 00 01 8001", // Length 70 and value length 64 take two bytes
+				strings.Repeat("78", 64) + " 00",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := kafkaGolden(t, tt.want...)
+			if got := encodeKafkaRecordBatch(tt.messages, now); !bytes.Equal(got, want) {
+				t.Errorf("encodeKafkaRecordBatch() =\n%x\nwant\n%x", got, want)
+			}
+		})
+	}
+}
+
+func TestKafkaProduceRequest(t *testing.T) {
+	saved := *requestTimeoutFlag
+	defer func() { *requestTimeoutFlag = saved }()
+	*requestTimeoutFlag = 5 * time.Second
+
+	tests := []struct {
+		name          string
+		topic         string
+		partition     int
+		correlationID int32
+		batch         []byte
+		want          []string // Golden hex fields of the request
+	}{
+		{
+			"small batch",
+			"events", 3, 7, []byte{0xde, 0xad},
+			[]string{
+				"00000030",          // Size
+				"0000",              // API key: Produce
+				"0003",              // API version
+				"00000007",          // Correlation id
+				"0004 6a656574",     // Client id "jeet"
+				"ffff",              // No transactional id
+				"0001",              // Acks
+				"00001388",          // Timeout in milliseconds
+				"00000001",          // Topic count
+				"0006 6576656e7473", // Topic "events"
+				"00000001",          // Partition count
+				"00000003",          // Partition
+				"00000002 dead",     // Record batch
+			},
+		},
+		{
+			"empty topic",
+			"", 0, 1, nil,
+			[]string{
+				"00000028",
+				"0000",
+				"0003",
+				"00000001",
+				"0004 6a656574",
+				"ffff",
+				"0001",
+				"00001388",
+				"00000001",
+				"0000",
+				"00000001",
+				"00000000",
+				"00000000",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &kafkaPublisher{topic: tt.topic, partition: tt.partition}
+			want := kafkaGolden(t, tt.want...)
+			if got := p.produceRequest(tt.correlationID, tt.batch); !bytes.Equal(got, want) {
+				t.Errorf("produceRequest() =\n%x\nwant\n%x", got, want)
+			}
+		})
+	}
+}
+
+func TestKafkaReadProduceResponse(t *testing.T) {
+	tests := []struct {
+		name     string
+		response []string // Golden hex fields of the response
+		wantErr  bool
+	}{
+		{
+			"acknowledged",
+			[]string{
+				"0000002a",          // Size
+				"00000007",          // Correlation id
+				"00000001",          // Topic count
+				"0006 6576656e7473", // Topic "events"
+				"00000001",          // Partition count
+				"00000003",          // Partition
+				"0000",              // Error code
+				"00000000 0000002a", // Base offset
+				"ffffffff ffffffff", // Log append time
+			},
+			false,
+		},
+		{
+			"error code",
+			[]string{"0000001a", "00000007", "00000001", "0006 6576656e7473", "00000001", "00000003", "0006"},
+			true,
+		},
+		{
+			"other correlation id",
+			[]string{"0000001a", "00000008", "00000001", "0006 6576656e7473", "00000001", "00000003", "0000"},
+			true,
+		},
+		{
+			"truncated after the topic",
+			[]string{"00000018", "00000007", "00000001", "0006 6576656e7473", "00000001", "00000003"},
+			true,
+		},
+		{
+			"shorter than the header",
+			[]string{"00000004", "00000007"},
+			true,
+		},
+		{
+			"larger than the limit",
+			[]string{"00010001"},
+			true,
+		},
+		{
+			"cut off",
+			[]string{"00000018", "00000007"},
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &kafkaPublisher{r: bufio.NewReader(bytes.NewReader(kafkaGolden(t, tt.response...)))}
+			if err := p.readProduceResponse(7); (err != nil) != tt.wantErr {
+				t.Errorf("readProduceResponse() error = %v, wantErr %t", err, tt.wantErr)
+			}
+		})
+	}
+}
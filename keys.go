@@ -0,0 +1,91 @@
+// keys.go contains the keyboard controls, which let long runs be steered from the terminal without killing the process:
+// p pauses, r resumes, + and - add or remove keyboardThreadStep threads, s writes a stats snapshot, and q stops the run
+// gracefully, so it still ends with its final report.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// keyboardHelp lists the keyboard controls
+const keyboardHelp = "p pause  r resume  +/- threads  s snapshot  q quit"
+
+// keyboardActive is set before the threads start if the keyboard controls are read
+var keyboardActive bool
+
+// lastKeyboardNote holds the most recent confirmation of a key, shown by the dashboard
+var lastKeyboardNote atomic.Value
+
+// startKeyboardControls reads keys from the terminal and applies them to the run until ctx is cancelled.
+// Snapshots are written to timestamped files in dir. It returns a function that restores the terminal,
+// or nil if keyboardControls is disabled or stdin is not a terminal.
+func startKeyboardControls(ctx context.Context, collector *StatsCollector, dir string) func() {
+	if !keyboardControls {
+		return nil
+	}
+	restore, ok := enableKeyInput(os.Stdin)
+	if !ok {
+		return nil
+	}
+	keyboardActive = true
+	keyboardNote("Keys: %s", keyboardHelp)
+
+	// The read cannot be interrupted, so the goroutine only notices the cancelled context after the next key
+	go func() {
+		key := make([]byte, 1)
+		for ctx.Err() == nil {
+			if _, err := os.Stdin.Read(key); err != nil {
+				return
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			handleKey(key[0], collector, dir)
+		}
+	}()
+
+	return restore
+}
+
+// handleKey applies a single key to the run. Unknown keys are ignored.
+func handleKey(key byte, collector *StatsCollector, dir string) {
+	switch key {
+	case 'p':
+		runControl.Pause()
+		keyboardNote("Paused")
+	case 'r':
+		runControl.Resume()
+		keyboardNote("Resumed")
+	case '+', '=':
+		keyboardNote("Threads: %d", runControl.AddThreads(keyboardThreadStep))
+	case '-', '_':
+		keyboardNote("Threads: %d", runControl.AddThreads(-keyboardThreadStep))
+	case 's':
+		path := filepath.Join(dir, "snapshot-"+time.Now().Format("20060102-150405")+".json")
+		if err := writeStatsSnapshotFile(path, takeStatsSample(collector, 0)); err != nil {
+			slog.Error("Failed to write stats snapshot", "component", componentControl, "error", err)
+			return
+		}
+		keyboardNote("Wrote stats snapshot to %s", path)
+	case 'q':
+		keyboardNote("Stopping the run")
+		requestStop()
+	}
+}
+
+// keyboardNote confirms a key on its own line, or in the dashboard's header while the dashboard is shown.
+func keyboardNote(format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	if dashboardEnabled {
+		lastKeyboardNote.Store(message)
+		return
+	}
+	fmt.Printf("\n%s\n", message)
+}
@@ -0,0 +1,30 @@
+// latency.go contains the streaming aggregation of request durations
+// used to report latency percentiles in the stats.
+
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// latencies aggregates the durations of all completed requests across all threads
+var latencies = newHistogram(latencyHighestTrackable, latencySignificantFigures)
+
+// LatencySnapshot is a point-in-time view of the aggregated durations.
+type LatencySnapshot struct {
+	Count int64
+	Min   time.Duration
+	Max   time.Duration
+	Mean  time.Duration
+	P50   time.Duration
+	P90   time.Duration
+	P95   time.Duration
+	P99   time.Duration
+}
+
+// String formats the snapshot as a single line.
+func (s LatencySnapshot) String() string {
+	return fmt.Sprintf("min %s, mean %s, p50 %s, p90 %s, p95 %s, p99 %s, max %s",
+		s.Min, s.Mean, s.P50, s.P90, s.P95, s.P99, s.Max)
+}
@@ -0,0 +1,190 @@
+// logging.go contains the structured logging of requests.log. Every record is a JSON object with the time,
+// level, message, and component, and the attributes of the event, such as the request ID, parameter, proxy,
+// and duration, so the log is machine-parseable. Lines still written with the log package become records too.
+// The level is set per run: -q keeps only warnings and errors, dropping the per-request success lines,
+// and -v adds debug records with transport-level detail. With -log-sample N only 1 in N successful requests is logged,
+// each with its sample rate, while every failure is. If errorLogName is set, warnings, errors, and proxy errors
+// are also written to that file, so failures can be triaged without reading past the success lines.
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net/http/httptrace"
+	"sync/atomic"
+	"time"
+)
+
+// The components of the log records
+const (
+	componentMain      = "main"      // Setup and the end of the run
+	componentRequest   = "request"   // Requests and their responses
+	componentClient    = "client"    // Proxy clients and dialers
+	componentInput     = "input"     // Parameters, proxies, data, checkpoint, baseline, and results files read by the run
+	componentProxy     = "proxy"     // Proxy validation and retirement, in the error-only log
+	componentTransport = "transport" // Name resolution, connections, and TLS handshakes of requests, logged at debug level
+	componentOutput    = "output"    // Result sinks, reports, snapshots, and metrics exporters
+	componentControl   = "control"   // Control API, dashboards, keyboard controls, alerts, notifications, and distributed runs
+)
+
+// errorLog is the error-only log file, and errorLogHandler writes its records; both are nil if errorLogName is empty
+var (
+	errorLog        io.WriteCloser
+	errorLogHandler slog.Handler
+)
+
+// openErrorLog opens the error-only log file at path and makes the warnings and errors logged from now on go to it.
+func openErrorLog(path string) error {
+	file, err := openRotatingFile(path)
+	if err != nil {
+		return err
+	}
+	errorLog = file
+	if logAsync {
+		errorLog = newAsyncWriter(file, true)
+	}
+	errorLogHandler = slog.NewJSONHandler(errorLog, &slog.HandlerOptions{Level: slog.LevelWarn})
+	return nil
+}
+
+// closeErrorLog closes the error-only log file if it is open.
+func closeErrorLog() error {
+	if errorLog == nil {
+		return nil
+	}
+	return errorLog.Close()
+}
+
+// logProxyError writes a proxy error to the proxies log, and to the error-only log if it is open.
+func logProxyError(proxiesLogger *log.Logger, proxy string, format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	proxiesLogger.Println(msg)
+	if errorLogHandler != nil {
+		slog.New(errorLogHandler).Error(msg, "component", componentProxy, "proxy", proxy)
+	}
+}
+
+// teeHandler passes each record to two handlers, each of which decides whether to write it.
+type teeHandler struct {
+	a, b slog.Handler
+}
+
+// Enabled reports whether either handler writes records of the given level.
+func (h *teeHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.a.Enabled(ctx, level) || h.b.Enabled(ctx, level)
+}
+
+// Handle passes the record to the handlers that write records of its level.
+func (h *teeHandler) Handle(ctx context.Context, r slog.Record) error {
+	var err error
+	if h.a.Enabled(ctx, r.Level) {
+		err = h.a.Handle(ctx, r.Clone())
+	}
+	if h.b.Enabled(ctx, r.Level) {
+		if berr := h.b.Handle(ctx, r); err == nil {
+			err = berr
+		}
+	}
+	return err
+}
+
+// WithAttrs returns a teeHandler whose handlers both have the attributes.
+func (h *teeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &teeHandler{a: h.a.WithAttrs(attrs), b: h.b.WithAttrs(attrs)}
+}
+
+// WithGroup returns a teeHandler whose handlers both have the group.
+func (h *teeHandler) WithGroup(name string) slog.Handler {
+	return &teeHandler{a: h.a.WithGroup(name), b: h.b.WithGroup(name)}
+}
+
+// successLogCount counts the successful requests considered for logging
+var successLogCount uint64
+
+// sampleSuccessLog reports whether a successful request is logged: 1 in -log-sample of them are.
+func sampleSuccessLog() bool {
+	if *logSampleFlag <= 1 {
+		return true
+	}
+	return (atomic.AddUint64(&successLogCount, 1)-1)%uint64(*logSampleFlag) == 0
+}
+
+// logLevelVar holds the lowest level of the records written, set by setupLogLevel
+var logLevelVar = new(slog.LevelVar)
+
+// setupLogLevel sets the lowest level of the records written from the -log-level, -v, and -q flags,
+// falling back to logLevel.
+func setupLogLevel() error {
+	level := logLevel
+	if *logLevelFlag != "" {
+		if err := level.UnmarshalText([]byte(*logLevelFlag)); err != nil {
+			return fmt.Errorf("unknown log level %q, expected debug, info, warn, or error", *logLevelFlag)
+		}
+	}
+	switch {
+	case *verboseFlag && *quietFlag:
+		return fmt.Errorf("-v and -q cannot be combined")
+	case *verboseFlag:
+		level = slog.LevelDebug
+	case *quietFlag:
+		level = slog.LevelWarn
+	}
+	logLevelVar.Set(level)
+	return nil
+}
+
+// withDebugTrace returns a context that logs the transport events of the request with the given ID
+// as debug records, if debug records are written.
+func withDebugTrace(ctx context.Context, id string) context.Context {
+	if logLevelVar.Level() > slog.LevelDebug {
+		return ctx
+	}
+	// The hooks run on the transport's goroutines, such as the parallel dials of Happy Eyeballs, so start is shared atomically
+	var start atomic.Value
+	since := func() float64 {
+		t, _ := start.Load().(time.Time)
+		return durationMillis(time.Since(t))
+	}
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GetConn: func(hostPort string) {
+			start.Store(time.Now())
+			slog.Debug("Getting connection", "component", componentTransport, "request_id", id, "host", hostPort)
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			slog.Debug("Resolved host", "component", componentTransport, "request_id", id, "addrs", fmt.Sprint(info.Addrs),
+				"elapsed_ms", since(), "error", info.Err)
+		},
+		ConnectDone: func(network, addr string, err error) {
+			slog.Debug("Connected", "component", componentTransport, "request_id", id, "network", network, "addr", addr,
+				"elapsed_ms", since(), "error", err)
+		},
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			slog.Debug("TLS handshake done", "component", componentTransport, "request_id", id,
+				"version", tls.VersionName(state.Version), "cipher_suite", tls.CipherSuiteName(state.CipherSuite),
+				"alpn", state.NegotiatedProtocol, "resumed", state.DidResume, "elapsed_ms", since(), "error", err)
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			slog.Debug("Got connection", "component", componentTransport, "request_id", id,
+				"remote_addr", info.Conn.RemoteAddr().String(), "local_addr", info.Conn.LocalAddr().String(),
+				"reused", info.Reused, "was_idle", info.WasIdle, "elapsed_ms", since())
+		},
+		GotFirstResponseByte: func() {
+			slog.Debug("Got first response byte", "component", componentTransport, "request_id", id, "elapsed_ms", since())
+		},
+	})
+}
+
+// setLogOutput makes the default slog logger, and with it the log package, write JSON records to w,
+// and the warnings and errors also to the error-only log if it is open.
+func setLogOutput(w io.Writer) {
+	var handler slog.Handler = slog.NewJSONHandler(w, &slog.HandlerOptions{Level: logLevelVar})
+	if errorLogHandler != nil {
+		handler = &teeHandler{a: handler, b: errorLogHandler}
+	}
+	slog.SetDefault(slog.New(handler))
+}
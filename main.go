@@ -5,38 +5,157 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
 	"math"
 	"math/rand"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
-	"sync/atomic"
+	"strings"
 	"time"
 
 	"github.com/vbauerster/mpb/v7"
 	"github.com/vbauerster/mpb/v7/decor"
 )
 
-// Initialize counters
-var successCount int32
-var failureCount int32
-var totalRequests int32
-var successfulProxyConnections int32
-var failedProxyConnections int32
-
 // Proxies pool
-var proxiesPool = make(chan string, numOfThreads)
+var proxiesPool *ProxyPool
+
+// Command line flags
+var (
+	reportMarkdownPath  = flag.String("report-md", "", "write a Markdown summary report to this file")
+	saveBaselinePath    = flag.String("save-baseline", "", "save the aggregate metrics of the run as a baseline to this file")
+	compareBaselinePath = flag.String("compare", "", "compare the run against the baseline in this file and exit non-zero on regressions")
+	latencyTolerance    = flag.Float64("tolerance", baselineLatencyTolerance, "relative latency and throughput change tolerated when comparing against a baseline")
+	errorRateTolerance  = flag.Float64("error-tolerance", baselineErrorRateTolerance, "absolute error rate increase tolerated when comparing against a baseline")
+	dashboardFlag       = flag.Bool("dashboard", false, "show the full-screen dashboard instead of the per-second stats and the progress bar")
+	slaMaxP99           = flag.Duration("max-p99", 0, "fail the run if its p99 latency is above this")
+	slaMaxErrorRate     = flag.Float64("max-error-rate", 0, "fail the run if its error rate (0..1) is above this")
+	slaMinRPS           = flag.Float64("min-rps", 0, "fail the run if its throughput in requests per second is below this")
+	seedFlag            = flag.Int64("seed", 0, "seed every random choice of the run with this value, to reproduce an earlier run")
+	resumePath          = flag.String("resume", "", "continue the run saved in this checkpoint file instead of starting over")
+	tlsInsecure         = flag.Bool("insecure", false, "skip verification of the certificates presented by the target and proxies")
+	tlsCAFile           = flag.String("ca-file", "", "trust the root certificates in this PEM bundle instead of the system roots")
+	tlsPinnedCert       = flag.String("pin-cert", "", "reject the target unless its certificate has this hex SHA-256 fingerprint")
+	resolveFlag         = flag.String("resolve", "", "comma-separated host:port:addr mappings dialed instead of resolving host, like curl's --resolve")
+	ipVersionFlag       = flag.String("ip-version", ipVersionAny, "IP version of direct and proxy connections: any (happy eyeballs), 4, or 6")
+	protocolFlag        = flag.String("protocol", protocolAuto, "HTTP protocol of the clients: auto (negotiate), h1 (HTTP/1.1 only), or h2 (HTTP/2 only, https targets)")
+	logLevelFlag        = flag.String("log-level", "", "lowest level written to the log file: debug, info, warn, or error; empty uses the configured level")
+	verboseFlag         = flag.Bool("v", false, "verbose: also log transport-level debug detail")
+	quietFlag           = flag.Bool("q", false, "quiet: log only warnings and errors, without the per-request success lines")
+	slowThresholdFlag   = flag.Duration("slow-threshold", slowRequestThreshold, "count and log requests slower than this with their phase breakdown; 0 disables it")
+	logSampleFlag       = flag.Int("log-sample", logSuccessSample, "log only 1 in this many successful requests; failures are always logged")
+	connectionModeFlag  = flag.String("connection-mode", connectionModeReuse, "reuse (keep idle connections) or fresh (open a new TCP and TLS connection for every request)")
+
+	maxIdleConnsFlag          = flag.Int("max-idle-conns", maxIdleConns, "maximum number of idle connections of each transport")
+	maxIdleConnsPerHostFlag   = flag.Int("max-idle-conns-per-host", maxIdleConnsPerHost, "maximum number of idle connections per host; 0 keeps 2 per proxy client and one per thread for the direct client")
+	maxConnsPerHostFlag       = flag.Int("max-conns-per-host", maxConnsPerHost, "maximum number of connections per host of each transport; 0 is unlimited")
+	disableKeepAlivesFlag     = flag.Bool("disable-keepalives", disableKeepAlives, "open a new connection for every request")
+	disableCompressionFlag    = flag.Bool("disable-compression", disableCompression, "send \"Accept-Encoding: identity\" instead of requesting compressed bodies")
+	writeBufferSizeFlag       = flag.Int("write-buffer-size", writeBufferSize, "size of the transports' write buffers in bytes; 0 uses the Go default")
+	readBufferSizeFlag        = flag.Int("read-buffer-size", readBufferSize, "size of the transports' read buffers in bytes; 0 uses the Go default")
+	requestTimeoutFlag        = flag.Duration("timeout", clientTimeout, "overall deadline of every request, from the dial to the end of its body; 0 has none")
+	dialTimeoutFlag           = flag.Duration("dial-timeout", dialTimeout, "timeout for establishing a connection; 0 waits up to the overall deadline")
+	dialKeepAliveFlag         = flag.Duration("dial-keepalive", dialKeepAlive, "interval of TCP keep-alive probes; negative disables them")
+	idleConnTimeoutFlag       = flag.Duration("idle-conn-timeout", idleConnTimeout, "how long idle connections are kept open")
+	tlsHandshakeTimeoutFlag   = flag.Duration("tls-handshake-timeout", tlsHandshakeTimeout, "timeout for TLS handshakes")
+	expectContinueTimeoutFlag = flag.Duration("expect-continue-timeout", expectContinueTimeout, "how long to wait for a 100-continue response")
+	responseHeaderTimeoutFlag = flag.Duration("response-header-timeout", responseHeaderTimeout, "timeout for the response headers after the request is written; 0 waits up to the overall deadline")
+	bodyReadTimeoutFlag       = flag.Duration("read-timeout", bodyReadTimeout, "longest wait for the next bytes of a response body; 0 waits up to the overall deadline")
+)
+
+// requestTarget is the URL template requests are built from; the bench subcommand points it at the local echo server
+var requestTarget = baseUrl
 
-// main is the entry point of the application. It loads and shuffles parameters and proxies,
-// sets up loggers and the progress bar, starts threads for sending requests, and prints stats.
+// main is the entry point of the application. It runs the bench, worker, coordinate, or aggregate subcommand if requested,
+// and otherwise parses the flags and runs the load, exiting with the exit code of the run.
 func main() {
+	// Run a subcommand instead of a load run if requested
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "bench":
+			os.Exit(runBench(os.Args[2:]))
+		case "worker":
+			os.Exit(runWorker(os.Args[2:]))
+		case "coordinate":
+			os.Exit(runCoordinator(os.Args[2:]))
+		case "aggregate":
+			os.Exit(runAggregate(os.Args[2:]))
+		}
+	}
+	flag.Parse()
+
+	os.Exit(run())
+}
+
+// run loads and shuffles parameters and proxies, sets up loggers and the progress bar,
+// starts threads for sending requests, and prints stats.
+// It returns a non-zero exit code if the run regressed against the baseline it is compared to, or missed an SLA threshold.
+func run() int {
+	// Seed the random source of the run before anything random happens
+	setupSeed()
+
+	// Set the level of the log records before anything is logged
+	if err := setupLogLevel(); err != nil {
+		log.Fatalf("Failed to set up log level: %s", err)
+	}
+
+	// Send the requests over the target's socket if it is a unix:// address
+	if err := setupUnixTarget(); err != nil {
+		log.Fatalf("Failed to set up unix socket target: %s", err)
+	}
+
+	// Configure the IP version, name resolution, source addresses, the protocol, and certificate verification,
+	// and create the direct client with them, before any client connects
+	if err := validateIPVersion(); err != nil {
+		log.Fatalf("Failed to set up IP version: %s", err)
+	}
+	if err := setupResolver(); err != nil {
+		log.Fatalf("Failed to set up name resolution: %s", err)
+	}
+	if err := setupSourceAddresses(); err != nil {
+		log.Fatalf("Failed to set up source addresses: %s", err)
+	}
+	if err := validateProtocol(); err != nil {
+		log.Fatalf("Failed to set up protocol: %s", err)
+	}
+	if err := validateConnectionMode(); err != nil {
+		log.Fatalf("Failed to set up connection mode: %s", err)
+	}
+	if err := setupTLS(); err != nil {
+		log.Fatalf("Failed to set up TLS: %s", err)
+	}
+	directClient = newDirectClient()
+	printTransportConfig()
+
 	// Load and shuffle parameters and proxies
 	if err := loadAndShuffleParametersAndProxies(); err != nil {
 		log.Fatalf("Failed to load and shuffle parameters and proxies: %s", err)
 	}
+	if err := setupRequestInputs(); err != nil {
+		log.Fatalf("Failed to set up request inputs: %s", err)
+	}
+
+	// Create the proxies pool with the configured balancing strategy
+	pool, err := newProxyPool(proxyBalancing, proxySharing)
+	if err != nil {
+		log.Fatalf("Failed to create proxies pool: %s", err)
+	}
+	proxiesPool = pool
+
+	// Read the checkpoint of the run to resume, if requested
+	var resumed *Checkpoint
+	if *resumePath != "" {
+		resumed, err = readCheckpoint(*resumePath)
+		if err != nil {
+			log.Fatalf("Failed to resume run: %s", err)
+		}
+	}
 
 	// Get current directory
 	dir, err := os.Getwd()
@@ -44,6 +163,14 @@ func main() {
 		log.Fatalf("Failed to get current directory: %v", err)
 	}
 
+	// Write the logs and result files of this run to a directory of its own if requested
+	if runDirectories {
+		dir, err = setupRunDirectory(dir)
+		if err != nil {
+			log.Fatalf("Failed to set up run directory: %v", err)
+		}
+	}
+
 	// Construct log file paths
 	logFilePath := filepath.Join(dir, logFileName)
 	proxiesLogPath := filepath.Join(dir, proxiesLogName)
@@ -56,81 +183,444 @@ func main() {
 	// Ensure logFile is closed properly
 	defer func() {
 		if err := logFile.Close(); err != nil {
-			log.Printf("Failed to close log file: %s", err)
+			slog.Error("Failed to close log file", "component", componentMain, "error", err)
+		}
+		if err := closeErrorLog(); err != nil {
+			fmt.Printf("Failed to close error log file: %s\n", err)
 		}
 	}()
 
+	// Collect the counters of the run, with one slot per shard
+	collector := newStatsCollector(shardCount())
+
+	// Open the per-request results file, NDJSON stream, and metrics sinks if they are enabled
+	if resultsFile != "" {
+		rw, err := openResultsWriter(filepath.Join(dir, resultsFile))
+		if err != nil {
+			log.Fatalf("Failed to open results file: %s", err)
+		}
+		resultSinks = append(resultSinks, rw)
+	}
+	if ndjsonOutput != "" {
+		nw, err := openNDJSONWriter(ndjsonOutput, dir)
+		if err != nil {
+			log.Fatalf("Failed to open NDJSON output: %s", err)
+		}
+		resultSinks = append(resultSinks, nw)
+	}
+	if statsdAddr != "" {
+		sink, err := openStatsDSink(statsdAddr)
+		if err != nil {
+			log.Fatalf("Failed to open StatsD sink: %s", err)
+		}
+		resultSinks = append(resultSinks, sink)
+	}
+	if influxUrl != "" {
+		sink, err := openInfluxSink(collector)
+		if err != nil {
+			log.Fatalf("Failed to open InfluxDB sink: %s", err)
+		}
+		resultSinks = append(resultSinks, sink)
+	}
+	if eventBusKind != "" {
+		sink, err := openEventBusSink()
+		if err != nil {
+			log.Fatalf("Failed to open event bus sink: %s", err)
+		}
+		eventBus = sink
+		resultSinks = append(resultSinks, sink)
+	}
+	// Ensure the buffered results are written when the run ends
+	defer closeResultSinks()
+
+	// Query the current height so %height expands to recent heights
+	setupHeightWindow()
+
+	// Check the header profile and redirect policy, compile the response assertions, and set up the tracking of response headers
+	if err := validateHeaderProfile(); err != nil {
+		log.Fatalf("Failed to set up header profile: %s", err)
+	}
+	if err := validateRedirectPolicy(); err != nil {
+		log.Fatalf("Failed to set up redirect policy: %s", err)
+	}
+	if websocketMode {
+		if err := validateWebSocketTarget(); err != nil {
+			log.Fatalf("Failed to set up websocket mode: %s", err)
+		}
+	}
+	if graphqlMode {
+		if err := validateGraphQL(); err != nil {
+			log.Fatalf("Failed to set up GraphQL mode: %s", err)
+		}
+	}
+	if grpcLoadMode {
+		if err := validateGRPCLoad(); err != nil {
+			log.Fatalf("Failed to set up gRPC load mode: %s", err)
+		}
+	}
+	if err := setupAssertions(); err != nil {
+		log.Fatalf("Failed to set up response assertions: %s", err)
+	}
+	if err := setupHeaderTracking(); err != nil {
+		log.Fatalf("Failed to set up response header tracking: %s", err)
+	}
+
+	// Create the directory sampled response bodies are saved to, if requested
+	if err := setupCapture(dir); err != nil {
+		log.Fatalf("Failed to set up response capture: %s", err)
+	}
+
+	// Run a small verification pass instead of the real run if requested
+	if verificationRun {
+		if err := runVerification(filepath.Join(dir, verificationDumpFile)); err != nil {
+			log.Fatalf("Verification run failed: %s", err)
+		}
+		return exitOK
+	}
+
+	// Export client spans of traced requests if requested; this must happen before the threads start
+	exportFinalSpans := startSpanExporter()
+
+	// Show the dashboard instead of the plain stats and progress bar if requested and stdout is a terminal
+	dashboardEnabled = useDashboard()
+
 	// Setup progress bar
 	p, bar := setupProgressBar()
 
-	// Start threads for sending requests
+	// Shard the threads, and restore the state of the run being resumed
+	setupShards(collector)
+	var resumedStart time.Time
+	if resumed != nil {
+		resumedStart = resumeFromCheckpoint(resumed, collector, bar)
+	}
+
+	// Start threads for sending requests, at the time the coordinator set when running as a worker
+	if currentAssignment != nil {
+		waitForAssignedStart()
+	}
+	// Everything the run starts from here on stops once the run context is cancelled
+	ctx := setupRunContext()
+	startTime := time.Now()
+	if resumed != nil {
+		startTime = resumedStart
+	}
 	if runIndefinitely {
-		startThreadsIndefinitely(bar, proxiesLogger)
+		startThreadsIndefinitely(ctx, collector, bar, proxiesLogger)
 	} else {
-		startThreads(bar, proxiesLogger)
+		startThreads(ctx, collector, bar, proxiesLogger)
+	}
+
+	// Sample throughput over time for the HTML report
+	recordTimeline(ctx, collector, startTime)
+
+	// End the run early once a stop is requested
+	go abortOnStop(ctx, bar)
+
+	// Warn when the error rate rises above the threshold, and post progress to chat if requested
+	startErrorRateMonitor(collector)
+	startChatProgress(collector, startTime)
+
+	// Stop the run early when an abort condition is met
+	startAbortMonitor(collector)
+
+	// Adjust the thread count to hold the target p95 latency, or search for the break point, if requested
+	startAdaptiveConcurrency()
+	startBreakpointSearch(collector)
+
+	// Serve the web dashboard if requested
+	if webDashboardAddr != "" {
+		startWebDashboard(collector, startTime)
+	}
+
+	// Serve the control API if requested
+	if controlAddr != "" {
+		startControlServer(collector)
+	}
+	if grpcAddr != "" {
+		if err := startGRPCServer(collector, startTime); err != nil {
+			log.Fatalf("Failed to start gRPC server: %s", err)
+		}
+	}
+
+	// Export the metrics to an OpenTelemetry collector if one is configured in the environment
+	exportFinalOTLPMetrics := startOTLPExporter(collector, startTime)
+
+	// Send the metrics to Graphite if requested
+	sendFinalGraphiteMetrics := startGraphiteExporter(collector)
+
+	// Serve the Prometheus metrics if requested
+	if metricsAddr != "" {
+		startMetricsServer(collector)
 	}
 
-	// Print stats periodically
-	printStats()
+	// Steer the run from the terminal if stdin is one
+	restoreTerminal := startKeyboardControls(ctx, collector, dir)
+
+	// Show the dashboard, or print stats periodically unless stdout carries the NDJSON stream,
+	// and write the stats to the JSON stats snapshot file
+	stopDashboard := func() {}
+	if dashboardEnabled {
+		stopDashboard = startDashboard(collector, bar, startTime)
+	} else if ndjsonOutput != ndjsonStdout {
+		printStats(ctx, collector)
+	}
+	statsSnapshotPath := filepath.Join(dir, statsSnapshotFile)
+	if statsSnapshotFile != "" {
+		writeStatsSnapshots(ctx, collector, statsSnapshotPath)
+	}
+
+	// Append a rollup of every window to the rollups file for soak tests
+	var writeFinalRollup func()
+	if rollupFile != "" {
+		writeFinalRollup = startRollups(collector, filepath.Join(dir, rollupFile), startTime)
+	}
+
+	// Save the state of the run periodically, so it can be resumed after a crash
+	var writeFinalCheckpoint func()
+	if checkpointFile != "" {
+		writeFinalCheckpoint = startCheckpoints(ctx, collector, filepath.Join(dir, checkpointFile), startTime)
+	}
 
 	// Wait for all progress bars to complete
 	p.Wait()
+	stopDashboard()
+	if restoreTerminal != nil {
+		restoreTerminal()
+	}
+
+	// Stop the goroutines that are still running now that the threads are done
+	requestStop()
+
+	// Write the final stats so the snapshot file reflects the whole run
+	if statsSnapshotFile != "" && statsSnapshotInterval > 0 {
+		if err := writeStatsSnapshotFile(statsSnapshotPath, takeStatsSample(collector, 0)); err != nil {
+			slog.Error("Failed to write stats snapshot", "component", componentMain, "error", err)
+		}
+	}
+
+	// Export the final metrics and spans so the collector sees the whole run
+	if exportFinalOTLPMetrics != nil {
+		exportFinalOTLPMetrics()
+	}
+	if exportFinalSpans != nil {
+		exportFinalSpans()
+	}
+	if sendFinalGraphiteMetrics != nil {
+		sendFinalGraphiteMetrics()
+	}
+	if writeFinalRollup != nil {
+		writeFinalRollup()
+	}
+	if writeFinalCheckpoint != nil {
+		writeFinalCheckpoint()
+	}
+
+	// Print the end-of-run summary report, and hand it to the coordinator when running as a worker
+	report := buildRunReport(collector, startTime, time.Now())
+	printRunReport(report)
+	if currentAssignment != nil {
+		publishWorkerResult(report)
+	}
+	notifyRunCompleted(report)
+	notifyChatCompleted(report)
+
+	// Write the Markdown summary if requested
+	if *reportMarkdownPath != "" {
+		if err := writeMarkdownReport(*reportMarkdownPath, report); err != nil {
+			slog.Error("Failed to write Markdown report", "component", componentMain, "error", err)
+		}
+	}
+
+	// Render the HTML report next to the log file
+	if htmlReportFile != "" {
+		if err := writeHTMLReport(filepath.Join(dir, htmlReportFile), report); err != nil {
+			slog.Error("Failed to write HTML report", "component", componentMain, "error", err)
+		}
+	}
+
+	// Print the per-parameter table, and write it to a CSV file if requested
+	printParameterSummary(report.Parameters)
+	if parameterSummaryFile != "" {
+		if err := writeParameterSummaryCSV(filepath.Join(dir, parameterSummaryFile), report.Parameters); err != nil {
+			slog.Error("Failed to write parameter summary", "component", componentMain, "error", err)
+		}
+	}
+
+	// Print the per-combination table when sweeping content negotiation headers
+	if negotiationSweep {
+		printNegotiationSummary()
+	}
+
+	// Print the concurrency the adaptive controller settled at, and the break point
+	if adaptiveTargetP95 > 0 {
+		printAdaptiveSummary()
+	}
+	if breakpointMode {
+		printBreakpointSummary()
+	}
+
+	// Print the distinct values of the tracked JSON field, and where response bodies were captured
+	if cardinalityField != "" {
+		printFieldCardinality()
+	}
+	if captureDirPath != "" {
+		printCaptureSummary()
+	}
+
+	// Print the protocols the responses were received with, or the websocket connections in websocket mode,
+	// and the gRPC statuses in gRPC load mode
+	if websocketMode {
+		printWebSocketSummary(report.Stats)
+	} else {
+		printProtocolSummary()
+		printAddressFamilySummary()
+		printConnectionSummary(report.Stats)
+	}
+	if grpcLoadMode {
+		printGRPCSummary()
+	}
+
+	// Print the frequency of the tracked response header values
+	if len(trackedHeaders) > 0 {
+		printHeaderFrequencies()
+	}
+
+	// Report why the run was aborted, and evaluate the SLA thresholds if any are set
+	exitCode := exitOK
+	if abortReason != "" {
+		fmt.Printf("\nRun aborted: %s\n", abortReason)
+		exitCode = exitAborted
+	}
+	if checks := evaluateSLA(report, *slaMaxP99, *slaMaxErrorRate, *slaMinRPS); len(checks) > 0 {
+		printSLAVerdict(checks)
+		if !slaPassed(checks) && exitCode == exitOK {
+			exitCode = exitSLAFailed
+		}
+	}
+
+	// Save the run as a baseline and compare it to a previous baseline if requested
+	if *saveBaselinePath != "" {
+		if err := saveBaseline(*saveBaselinePath, newBaseline(report)); err != nil {
+			slog.Error("Failed to save baseline", "component", componentMain, "error", err)
+		}
+	}
+	if *compareBaselinePath != "" {
+		baseline, err := loadBaseline(*compareBaselinePath)
+		if err != nil {
+			fmt.Printf("Failed to load baseline: %s\n", err)
+			return exitRegression
+		}
+		comparison := compareToBaseline(baseline, newBaseline(report), *latencyTolerance, *errorRateTolerance)
+		printBaselineComparison(comparison)
+		if comparison.Regressed() {
+			return exitRegression
+		}
+	}
+
+	return exitCode
 }
 
 // loadAndShuffleParametersAndProxies loads parameters and proxies from files and shuffles them.
 // It returns an error if loading parameters or proxies fails.
+// When running as a worker, the coordinator's assignment is used instead of the files.
 func loadAndShuffleParametersAndProxies() error {
+	if currentAssignment != nil {
+		parameters = currentAssignment.Parameters
+		proxies = currentAssignment.Proxies
+		// The proxy checks pick from the assignment's proxies, so a proxied run needs at least one
+		if useProxy && len(proxies) == 0 {
+			slog.Error("Error in loadAndShuffleParametersAndProxies: No proxies in the assignment", "component", componentMain)
+			return fmt.Errorf("No proxies in the assignment")
+		}
+		return nil
+	}
+
 	// Load parameters
 	if err := loadParameters(); err != nil {
-		log.Printf("Error in loadAndShuffleParametersAndProxies: %v", err)
+		slog.Error("Error in loadAndShuffleParametersAndProxies", "component", componentMain, "error", err)
 		return fmt.Errorf("Failed to load parameters: %w", err)
 	}
 	// Load proxies if useProxy is enabled
 	if useProxy {
 		if err := loadProxies(); err != nil {
-			log.Printf("Error in loadAndShuffleParametersAndProxies: %v", err)
+			slog.Error("Error in loadAndShuffleParametersAndProxies", "component", componentMain, "error", err)
 			return fmt.Errorf("Failed to load proxies: %w", err)
 		}
 	}
 
 	// Shuffle proxies and parameters
-	rand.Shuffle(len(proxies), func(i, j int) { proxies[i], proxies[j] = proxies[j], proxies[i] })
-	rand.Shuffle(len(parameters), func(i, j int) { parameters[i], parameters[j] = parameters[j], parameters[i] })
+	runRand.Shuffle(len(proxies), func(i, j int) { proxies[i], proxies[j] = proxies[j], proxies[i] })
+	runRand.Shuffle(len(parameters), func(i, j int) { parameters[i], parameters[j] = parameters[j], parameters[i] })
 
 	return nil
 }
 
-// setupLoggers sets up the main and proxies loggers.
+// setupRequestInputs loads the data file and sets up the parameter generators, the parameter order, and the
+// request templates, from which both a run and the bench subcommand generate their requests.
+// It returns an error for the first input that is malformed.
+func setupRequestInputs() error {
+	if err := loadDataFile(); err != nil {
+		return fmt.Errorf("Failed to load data file: %w", err)
+	}
+	if err := setupParameterGenerators(); err != nil {
+		return fmt.Errorf("Failed to set up parameter generators: %w", err)
+	}
+	if err := setupParameterOrder(); err != nil {
+		return fmt.Errorf("Failed to set up parameter order: %w", err)
+	}
+	if err := setupTemplates(); err != nil {
+		return fmt.Errorf("Failed to set up request templates: %w", err)
+	}
+	return nil
+}
+
+// setupLoggers sets up the main, error-only, and proxies loggers, writing to log files that rotate themselves,
+// or to syslog if syslogAddr is set.
 // It returns the log file, the proxies logger, and an error if setting up loggers fails.
-func setupLoggers(logFilePath string, proxiesLogPath string) (*os.File, *log.Logger, error) {
+func setupLoggers(logFilePath string, proxiesLogPath string) (io.WriteCloser, *log.Logger, error) {
+	// Send the logs to syslog instead of files if it is configured
+	if syslogAddr != "" {
+		return setupSyslogLoggers()
+	}
+
 	// Set up logging to a file
-	logFile, err := os.OpenFile(logFilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	logFile, err := openRotatingFile(logFilePath)
 	if err != nil {
-		log.Printf("Error in setupLoggers: %v", err)
+		slog.Error("Error in setupLoggers", "component", componentMain, "error", err)
 		return nil, nil, fmt.Errorf("Failed to open log file: %w", err)
 	}
-	log.SetOutput(logFile)
+	if errorLogName != "" {
+		if err := openErrorLog(filepath.Join(filepath.Dir(logFilePath), errorLogName)); err != nil {
+			slog.Error("Error in setupLoggers", "component", componentMain, "error", err)
+			return nil, nil, fmt.Errorf("Failed to open error log file: %w", err)
+		}
+	}
+	var logOutput io.WriteCloser = logFile
+	if logAsync {
+		logOutput = newAsyncWriter(logFile, true)
+	}
+	setLogOutput(logOutput)
 
 	// Set up logging for proxies to a separate file
 	proxiesLogger, err := setupProxiesLogger(proxiesLogPath)
 	if err != nil {
-		log.Printf("Error in setupLoggers: %v", err)
+		slog.Error("Error in setupLoggers", "component", componentMain, "error", err)
 		return nil, nil, fmt.Errorf("Failed to set up proxies logger: %w", err)
 	}
 
-	return logFile, proxiesLogger, nil
+	return logOutput, proxiesLogger, nil
 }
 
 // setupProgressBar sets up the progress bar.
 // It returns the progress object and the bar object.
 func setupProgressBar() (*mpb.Progress, *mpb.Bar) {
 	// Create a new progress bar with a large total
-	p := mpb.New(mpb.WithWidth(60))
+	p := mpb.New(mpb.WithWidth(60), mpb.ContainerOptional(mpb.WithOutput(nil), !progressBar || dashboardEnabled))
 	var total int64
 	if runIndefinitely {
 		total = int64(math.MaxInt64)
 	} else {
-		total = int64(numOfThreads * numOfRequests)
+		total = totalRequestBudget()
 	}
 	bar := p.AddBar(total,
 		mpb.PrependDecorators(
@@ -145,207 +635,509 @@ func setupProgressBar() (*mpb.Progress, *mpb.Bar) {
 	return p, bar
 }
 
-// Global variable for the total number of requests sent by all threads
-var totalRequestCount int32
-
-// worker is a goroutine that continuously creates and tests proxies.
-func worker(proxiesLogger *log.Logger) {
-	for {
-		// Break the loop after all threads have obtained a proxy
-		if atomic.LoadInt32(&successfulProxyConnections) >= numOfThreads {
-			break
-		}
+// totalRequestBudget returns the total number of requests of a run that does not run indefinitely.
+func totalRequestBudget() int64 {
+	return requestBudget(numOfThreads, numOfRequests)
+}
 
-		var proxy string
-		if useProxy {
-			for {
-				proxy = proxies[rand.Intn(len(proxies))]
-
-				// Check if the proxy IP is unique
-				if _, exists := uniqueIPs.Load(proxy); !exists {
-					// Test the proxy
-					client, err := createProxyClient(proxy)
-					if err != nil || !testProxy(client, proxiesLogger) {
-						atomic.AddInt32(&failedProxyConnections, 1)
-						continue
-					}
-
-					atomic.AddInt32(&successfulProxyConnections, 1)
-					uniqueIPs.Store(proxy, true)
-					break
-				}
-			}
-		}
-		proxiesPool <- proxy
+// requestBudget returns the number of requests sent by the given number of threads sending the given number of requests each.
+// The multiplication is done in 64 bits so large configurations cannot overflow, and saturates at math.MaxInt64.
+func requestBudget(threads, requests int) int64 {
+	if threads <= 0 || requests <= 0 {
+		return 0
+	}
+	if int64(requests) > math.MaxInt64/int64(threads) {
+		return math.MaxInt64
 	}
+	return int64(threads) * int64(requests)
 }
 
 // thread is a goroutine that sends requests and calculates stats.
-// It gets a unique proxy from the proxies pool, creates a client, sends requests, and then discards the client.
-// It keeps sending requests indefinitely or until it fails.
-func thread(bar *mpb.Bar, proxiesLogger *log.Logger) {
-	for {
-		// Get a unique proxy from the proxies pool
-		proxy := <-proxiesPool
+// It gets a proxy from the proxies pool, creates a client, sends requests, and then returns the proxy to the pool.
+// If every request in a batch failed, the proxy is retired instead, and the pool maintainer replaces it.
+// It keeps sending requests until the total number of requests has been sent, or the run controller lets it exit.
+func thread(ctx context.Context, sh *shard, id int, proxiesLogger *log.Logger) {
+	pace := newPacer(perThreadRPS)
+	for runControl.admit(ctx, id) {
+		// Get a proxy from the proxies pool
+		proxy, ok := proxiesPool.Acquire(ctx, sh.rng)
+		if !ok {
+			return
+		}
 
-		// Create a client with the proxy
-		client, err := createProxyClient(proxy)
+		// Get the shard's client for the proxy
+		client, err := sh.client(proxy)
 		if err != nil {
-			proxiesLogger.Printf("Failed to create client with proxy %s: %s\n", proxy, err)
+			logProxyError(proxiesLogger, proxy, "Failed to create client with proxy %s: %s", proxy, err)
+			releaseProxy(proxy, false, proxiesLogger)
 			continue
 		}
 
-		summaries := make([]RequestSummary, 0)
-		durations := make([]time.Duration, 0)
-		sizes := make([]int, 0)
-
 		requestCount := 0
+		successes := 0
+		admitted := true
 		for {
-			sendRequest(client, bar, &summaries, &durations, &sizes)
+			if admitted = waitForRateLimits(ctx, pace, proxy); !admitted {
+				break
+			}
+			start := time.Now()
+			ok := sendRequest(sh, id, client, proxy)
+			proxiesPool.Observe(proxy, time.Since(start), ok)
+			countProxyRequest(proxy, ok)
+			if ok {
+				successes++
+			}
 			requestCount++
 
 			if requestCount >= numOfRequests {
 				break
 			}
+			if admitted = runControl.admit(ctx, id); !admitted {
+				break
+			}
 		}
 
-		if atomic.AddInt32(&totalRequestCount, int32(requestCount)) >= int32(numOfThreads*numOfRequests) {
+		releaseProxy(proxy, successes > 0 || requestCount == 0, proxiesLogger)
+
+		if sh.countBatch(requestCount) >= totalRequestBudget() || !admitted {
 			return
 		}
 	}
 }
 
 // threadIndefinitely is a goroutine that sends requests indefinitely and calculates stats.
-// It gets a unique proxy from the proxies pool, creates a client, sends requests, and then returns the proxy to the pool.
-func threadIndefinitely(bar *mpb.Bar, proxiesLogger *log.Logger) {
-	for {
-		// Get a unique proxy from the proxies pool
-		proxy := <-proxiesPool
+// It gets a proxy from the proxies pool, creates a client, sends requests, and then returns the proxy to the pool.
+// If every request in a batch failed, the proxy is retired instead, and the pool maintainer replaces it.
+// It stops when the run controller lets it exit.
+func threadIndefinitely(ctx context.Context, sh *shard, id int, proxiesLogger *log.Logger) {
+	pace := newPacer(perThreadRPS)
+	for runControl.admit(ctx, id) {
+		// Get a proxy from the proxies pool
+		proxy, ok := proxiesPool.Acquire(ctx, sh.rng)
+		if !ok {
+			return
+		}
 
-		// Create a client with the proxy
-		client, err := createProxyClient(proxy)
+		// Get the shard's client for the proxy
+		client, err := sh.client(proxy)
 		if err != nil {
-			proxiesLogger.Printf("Failed to create client with proxy %s: %s\n", proxy, err)
+			logProxyError(proxiesLogger, proxy, "Failed to create client with proxy %s: %s", proxy, err)
+			releaseProxy(proxy, false, proxiesLogger)
 			continue
 		}
 
-		summaries := make([]RequestSummary, 0)
-		durations := make([]time.Duration, 0)
-		sizes := make([]int, 0)
-
 		requestCount := 0
+		successes := 0
+		admitted := true
 		for {
-			sendRequest(client, bar, &summaries, &durations, &sizes)
+			if admitted = waitForRateLimits(ctx, pace, proxy); !admitted {
+				break
+			}
+			start := time.Now()
+			ok := sendRequest(sh, id, client, proxy)
+			proxiesPool.Observe(proxy, time.Since(start), ok)
+			countProxyRequest(proxy, ok)
+			if ok {
+				successes++
+			}
 			requestCount++
 
 			if requestCount >= numOfRequests {
 				break
 			}
+			if admitted = runControl.admit(ctx, id); !admitted {
+				break
+			}
 		}
 
-		// Return the proxy to the pool for reuse
-		proxiesPool <- proxy
+		// Return the proxy to the pool for reuse, or retire it if it looks dead
+		releaseProxy(proxy, successes > 0 || requestCount == 0, proxiesLogger)
+
+		if !admitted {
+			return
+		}
 	}
 }
 
-// startThreads starts the threads for sending requests.
-func startThreads(bar *mpb.Bar, proxiesLogger *log.Logger) {
-	// Start the workers
-	for i := 0; i < numOfThreads; i++ {
-		go worker(proxiesLogger)
-	}
+// directThread is a goroutine that sends requests over the shared direct client, without any proxy machinery.
+// Unless indefinitely is set, it keeps sending requests until the total number of requests has been sent.
+// It stops when the run controller lets it exit.
+func directThread(ctx context.Context, sh *shard, id int, indefinitely bool) {
+	pace := newPacer(perThreadRPS)
+	for {
+		requestCount := 0
+		admitted := true
+		for requestCount < numOfRequests {
+			if admitted = runControl.admit(ctx, id) && pace.Wait(ctx); !admitted {
+				break
+			}
+			sendRequest(sh, id, directClient, "")
+			requestCount++
+		}
 
-	// Start the threads
-	for i := 0; i < numOfThreads; i++ {
-		go thread(bar, proxiesLogger)
+		if !indefinitely && sh.countBatch(requestCount) >= totalRequestBudget() || !admitted {
+			return
+		}
 	}
 }
 
-// startThreadsIndefinitely starts the threads for sending requests indefinitely.
-func startThreadsIndefinitely(bar *mpb.Bar, proxiesLogger *log.Logger) {
-	// Start the workers
-	for i := 0; i < numOfThreads; i++ {
-		go worker(proxiesLogger)
+// startThreads starts the proxy pool maintainer and the threads for sending requests.
+// If useProxy is disabled, it starts direct threads instead, and no proxy pool maintainer.
+func startThreads(ctx context.Context, collector *StatsCollector, bar *mpb.Bar, proxiesLogger *log.Logger) {
+	// Start flushing the shard stats
+	go flushShards(ctx, bar)
+
+	if websocketMode {
+		startWebSocketThreads(ctx, collector, proxiesLogger)
+		return
 	}
 
+	if !useProxy {
+		runControl.start(numOfThreads, func(id int) {
+			directThread(ctx, shardFor(id), id, false)
+		})
+		return
+	}
+
+	// Start the proxy pool maintainer
+	go maintainProxyPool(ctx, collector, proxiesLogger)
+
 	// Start the threads
-	for {
-		if atomic.LoadInt32(&successfulProxyConnections) >= numOfThreads {
-			break
-		}
-		go threadIndefinitely(bar, proxiesLogger)
+	runControl.start(numOfThreads, func(id int) {
+		thread(ctx, shardFor(id), id, proxiesLogger)
+	})
+}
+
+// startThreadsIndefinitely starts the proxy pool maintainer and the threads for sending requests indefinitely.
+// If useProxy is disabled, it starts direct threads instead, and no proxy pool maintainer.
+func startThreadsIndefinitely(ctx context.Context, collector *StatsCollector, bar *mpb.Bar, proxiesLogger *log.Logger) {
+	// Start flushing the shard stats
+	go flushShards(ctx, bar)
+
+	if websocketMode {
+		startWebSocketThreads(ctx, collector, proxiesLogger)
+		return
+	}
+
+	if !useProxy {
+		runControl.start(numOfThreads, func(id int) {
+			directThread(ctx, shardFor(id), id, true)
+		})
+		return
 	}
+
+	// Start the proxy pool maintainer
+	go maintainProxyPool(ctx, collector, proxiesLogger)
+
+	// Start the threads
+	runControl.start(numOfThreads, func(id int) {
+		threadIndefinitely(ctx, shardFor(id), id, proxiesLogger)
+	})
 }
 
-// sendRequest sends a request, updates the stats and increments the progress bar.
-func sendRequest(client *http.Client, bar *mpb.Bar, summaries *[]RequestSummary, durations *[]time.Duration, sizes *[]int) {
-	// Select a random parameter and generate a unique random number for each request
-	param := parameters[rand.Intn(len(parameters))] + "=" + rng()
+// buildRequest creates a new request of the given thread for the next parameter in the parameter order, with a value
+// drawn from r by the parameter's generator, taking the values of {{data column}} tokens from the thread's next data row.
+// It returns the request, the parameter used, and an error if the request could not be created.
+func buildRequest(ctx context.Context, r *rand.Rand, profile *HeaderProfile, thread int) (*http.Request, string, error) {
+	// Select the next parameter and draw its value with the parameter's generator
+	row := nextDataRow(thread, r)
+	generator := parameterGeneratorFor(nextParameter(thread, r))
+	name := generator.Name
+	value := generator.Generate(r, row)
+	param := name + "=" + value
 
-	// Call onRequest function to increment the total requests and requests per minute counters
-	onRequest()
+	// Expand the placeholders in the base URL, and append the query-escaped parameter to its query,
+	// or POST it as the variables of the GraphQL query in GraphQL mode
+	target := expandURLPlaceholders(requestTarget, r, row)
+	var req *http.Request
+	var err error
+	if graphqlMode {
+		req, err = newGraphQLRequest(ctx, target, name, value, r)
+	} else {
+		if strings.Contains(target, "?") {
+			target += "&"
+		} else {
+			target += "?"
+		}
+		target += url.QueryEscape(name) + "=" + url.QueryEscape(value)
+		if requestBody != "" {
+			req, err = http.NewRequestWithContext(ctx, "POST", target, strings.NewReader(expandRowPlaceholders(requestBody, r, row)))
+		} else {
+			req, err = http.NewRequestWithContext(ctx, "GET", target, nil)
+		}
+	}
+	if err != nil {
+		return nil, param, err
+	}
+	// Send the headers of the client's profile, or the fixed Accept-Language and Content-Type without one
+	if profile != nil {
+		profile.apply(req)
+	} else {
+		req.Header.Add("Accept-Language", language)
+		req.Header.Add("Content-Type", contentType)
+	}
+	applyTemplateHeaders(req, r, row)
+	if graphqlMode {
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/graphql-response+json, application/json")
+	}
+	if hostOverride != "" {
+		req.Host = hostOverride
+	}
+	req.Close = freshConnections()
+	if negotiationSweep {
+		sweepLanguage, sweepAccept := nextNegotiationHeaders()
+		req.Header.Set("Accept-Language", sweepLanguage)
+		req.Header.Set("Accept", sweepAccept)
+	}
+	if encoding := requestAcceptEncoding(); encoding != "" {
+		req.Header.Add("Accept-Encoding", encoding)
+	}
+	traceRequest(req, r)
 
-	summary := RequestSummary{
-		Parameter: param,
+	return req, param, nil
+}
+
+// sendRequest sends a request of the given thread through the given proxy's client, updates the shard's stats
+// and advances the progress bar.
+// It returns true if a response was received, and false if the request could not be completed.
+func sendRequest(sh *shard, thread int, client *http.Client, proxy string) bool {
+	// Send a gRPC call instead in gRPC load mode
+	if grpcLoadMode {
+		return sendGRPCCall(sh, thread, client, proxy)
 	}
 
-	url := baseUrl + "?" + param
+	// Increment the requests counter
+	sh.count(CounterRequests)
 
-	// Create a new request
-	ctx, cancel := context.WithTimeout(context.Background(), clientTimeout)
-	defer cancel()
+	// Create a new request, collecting the redirects it follows if they are recorded
+	id := newRequestID()
+	var hops []RedirectHop
+	var family string
+	var reused bool
+	var setup time.Duration
+	phases := &RequestPhases{}
+	traceCtx := withRequestPhases(withDebugTrace(withShard(context.Background(), sh), id), phases)
+	traceCtx = withConnectionSetup(withAddressFamily(withRedirectHops(traceCtx, &hops), &family), &reused, &setup)
+	ctx, cancel := withRequestTimeout(traceCtx)
+	defer func() { cancel() }()
 
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	req, param, err := buildRequest(ctx, sh.rng, headerProfileFor(proxy), thread)
 	if err != nil {
-		log.Printf("Failed to create request with parameter %s: %s\n", param, err)
-		atomic.AddInt32(&failureCount, 1)
-		return
+		slog.Error("Failed to create request", "component", componentRequest, "parameter", param, "proxy", proxy, "error", err)
+		noteError("Failed to create request with parameter %s: %s", param, err)
+		sh.countFailure(ErrorClassOther)
+		sh.complete() // Advance the progress bar
+		return false
 	}
-	req.Header.Add("Accept-Language", language)
-	req.Header.Add("Content-Type", contentType)
+	setRequestID(req, id)
+
 	// Send the request and measure the time it takes
 	start := time.Now()
+	summary := RequestSummary{
+		Timestamp: start,
+		RequestID: id,
+		Parameter: param,
+		Proxy:     proxy,
+		Phases:    phases,
+	}
 	resp, err := client.Do(req)
+
+	// Send an idempotent request that failed without a response again, each attempt with its own deadline
+	for attempt := 0; err != nil && shouldRetry(sh, req, attempt); attempt++ {
+		slog.Warn("Retrying request", "component", componentRequest, "request_id", id, "parameter", param, "proxy", proxy,
+			"error_class", classifyError(err).String(), "error", err)
+		if !waitRetryBackoff(attempt + 1) {
+			break
+		}
+		cancel()
+		ctx, cancel = withRequestTimeout(traceCtx)
+		req = req.Clone(ctx)
+		hops, family = nil, ""
+		sh.count(CounterRetries)
+		summary.Retries++
+		start = time.Now()
+		summary.Timestamp = start
+		resp, err = client.Do(req)
+	}
 	if fireAndForget {
-		bar.Increment() // Increment the progress bar
-		return
+		sh.complete() // Advance the progress bar
+		return err == nil
 	}
 	duration := time.Since(start)
 	summary.Duration = duration
+	summary.Redirects = hops
+	summary.AddressFamily = family
+	if family != "" { // The request got a connection
+		addressFamilyValues.ObserveValues([]string{family})
+		sh.countConnection(reused, setup)
+	}
 	if err != nil {
-		log.Printf("Failed on request with parameter %s: %s\n", param, err)
+		summary.ErrorClass = classifyError(err)
+		slog.Error("Failed on request", "component", componentRequest, "request_id", id, "parameter", param, "proxy", proxy,
+			"error_class", summary.ErrorClass.String(), "duration_ms", durationMillis(duration), "error", err)
+		noteError("%s: %s %s (%s)", summary.ErrorClass, id, param, err)
 		summary.ErrorCount++
-		atomic.AddInt32(&failureCount, 1)
-		bar.Increment() // Increment the progress bar
-		return
+		sh.countFailure(summary.ErrorClass)
+		recordSummary(sh, req, summary)
+		sh.complete() // Advance the progress bar
+		return false
 	}
 
-	// Read the response body
+	// Count the response status code
+	summary.StatusCode = resp.StatusCode
+	sh.countStatus(resp.StatusCode)
+
+	// Count a response without a success status, or failing a header assertion, as a failure
+	if !isSuccessStatus(resp.StatusCode) {
+		failResponse(sh, &summary, ErrorClassStatus, fmt.Sprintf("status %d", resp.StatusCode))
+	}
+	summary.Protocol = resp.Proto
+	protocolValues.ObserveValues([]string{resp.Proto})
+	summary.Headers = recordHeaders(resp.Header)
+	if failure := checkHeaderAssertions(resp.Header); failure != "" {
+		failResponse(sh, &summary, ErrorClassAssertion, failure)
+	}
+
+	// In headers-only mode, hang up on the body as soon as the headers have arrived
+	if headersOnly {
+		if err := resp.Body.Close(); err != nil {
+			slog.Warn("Failed to close response body", "component", componentRequest, "request_id", id, "error", err)
+		}
+		sh.latencies.Record(duration)
+		recordSummary(sh, req, summary)
+		sh.count(CounterHeadersOnly)
+		if summary.ErrorClass == ErrorClassNone {
+			if sampleSuccessLog() {
+				slog.Info("Headers-only request", "component", componentRequest, "request_id", id, "parameter", param, "proxy", proxy,
+					"status", resp.StatusCode, "duration_ms", durationMillis(duration), "sample", *logSampleFlag)
+			}
+			sh.count(CounterSuccesses)
+		}
+		sh.complete() // Advance the progress bar
+		return true
+	}
+
+	// Count the bytes on the wire, and decompress the body if it is compressed.
+	// The request is canceled if the next bytes of the body take longer than the read timeout.
+	timedBody, stopReadTimeout := withReadTimeout(resp.Body, cancel)
+	defer stopReadTimeout()
+	wire := &countingReader{r: timedBody}
+	bodyReader, err := decodeBody(wire, resp.Header.Get("Content-Encoding"))
+
+	// Read at most maxBodySize bytes of the body; one more byte is read to tell whether it was cut off
+	if maxBodySize > 0 {
+		bodyReader = io.LimitReader(bodyReader, maxBodySize+1)
+	}
+
+	// Read the response body into a pooled buffer, or only count its bytes if bodies are discarded
 	var body []byte
-	body, err = io.ReadAll(resp.Body)
+	var bytesIn int
 	if err != nil {
-		log.Printf("Failed to read response body for request with parameter %s: %s\n", param, err)
-		summary.ErrorCount++
-		atomic.AddInt32(&failureCount, 1)
+		// The compressed stream could not be opened, so there is nothing to read
+	} else if discardBodies {
+		var n int64
+		n, err = io.Copy(io.Discard, bodyReader)
+		bytesIn = int(n)
 	} else {
-		summary.BytesIn = len(body)
-		*sizes = append(*sizes, len(body))
+		buf, readErr := readBody(sh, bodyReader)
+		defer releaseBody(buf)
+		body, err = buf.Bytes(), readErr
+		bytesIn = len(body)
+	}
+	if err == nil && maxBodySize > 0 && bytesIn > maxBodySize {
+		bytesIn = maxBodySize
+		if body != nil {
+			body = body[:maxBodySize]
+		}
+		summary.Truncated = true
+		sh.count(CounterTruncated)
+	}
+	summary.WireBytes = int(wire.n)
+	sh.countWireBytes(wire.n)
+	if err != nil {
+		class := ErrorClassBodyRead
+		if isTimeout(err) {
+			class = ErrorClassTimeout
+		}
+		failResponse(sh, &summary, class, err.Error())
+	} else {
+		summary.BytesIn = bytesIn
+		sh.countBytes(bytesIn)
+
+		// Count a response that fails an assertion, or has GraphQL errors, as a failure
+		if failure := checkAssertions(body, bytesIn); failure != "" {
+			failResponse(sh, &summary, ErrorClassAssertion, failure)
+		}
+		if graphqlMode {
+			if failure := checkGraphQLErrors(body); failure != "" {
+				failResponse(sh, &summary, ErrorClassGraphQL, failure)
+			}
+		}
+
+		// Count the value of the tracked JSON field
+		if cardinalityField != "" && !discardBodies {
+			fieldValues.Observe(body)
+		}
+
+		// Save the body if it is sampled for capture
+		if captureDirPath != "" {
+			captureBody(summary, body)
+		}
 	}
 
 	// Close the response body and handle any error
 	if err := resp.Body.Close(); err != nil {
-		log.Printf("Failed to close response body: %s", err)
+		slog.Warn("Failed to close response body", "component", componentRequest, "request_id", id, "error", err)
 	}
 
-	// Append the duration and the summary to their respective slices
-	*durations = append(*durations, duration)
-	*summaries = append(*summaries, summary)
+	// Add the duration to the shard's latency histogram
+	sh.latencies.Record(duration)
+
+	// Add the summary to the per-parameter aggregation
+	recordSummary(sh, req, summary)
 
-	log.Printf("Successful request with parameter %s: %d bytes, %s\n", param, len(body), duration)
+	// Increment the success counter unless the response was counted as a failure
+	if summary.ErrorClass == ErrorClassNone {
+		if sampleSuccessLog() {
+			slog.Info("Successful request", "component", componentRequest, "request_id", id, "parameter", param, "proxy", proxy,
+				"status", resp.StatusCode, "bytes", bytesIn, "duration_ms", durationMillis(duration), "sample", *logSampleFlag)
+		}
+		sh.count(CounterSuccesses)
+	}
 
-	// Increment the success counter
-	atomic.AddInt32(&successCount, 1)
+	// Advance the progress bar
+	sh.complete()
 
-	// Increment the progress bar
-	bar.Increment()
+	return true
+}
+
+// failResponse counts a received response as a failure of the given class, unless it was already counted as one.
+// The response still counts as received for the proxy that carried it.
+func failResponse(sh *shard, summary *RequestSummary, class ErrorClass, detail string) {
+	if summary.ErrorClass != ErrorClassNone {
+		return
+	}
+	slog.Error("Failed on request", "component", componentRequest, "request_id", summary.RequestID, "parameter", summary.Parameter,
+		"proxy", summary.Proxy, "error_class", class.String(), "status", summary.StatusCode, "duration_ms", durationMillis(summary.Duration), "error", detail)
+	noteError("%s: %s %s (%s)", class, summary.RequestID, summary.Parameter, detail)
+	summary.ErrorCount++
+	summary.ErrorClass = class
+	sh.countFailure(class)
+}
+
+// recordSummary adds the outcome of a request to the per-parameter aggregation,
+// to the per-combination aggregation when sweeping content negotiation headers,
+// to every result sink, and to the span exporter if the request was traced, and counts it towards the consecutive failures.
+func recordSummary(sh *shard, req *http.Request, summary RequestSummary) {
+	parameterStats.Record(summary)
+	if negotiationSweep {
+		negotiationStats.RecordAs(negotiationKey(req.Header.Get("Accept-Language"), req.Header.Get("Accept")), summary)
+	}
+	for _, sink := range resultSinks {
+		sink.Write(summary)
+	}
+	recordSpan(req, summary)
+	checkSlowRequest(sh, summary)
+	countConsecutiveFailure(summary.ErrorClass != ErrorClassNone)
 }
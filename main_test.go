@@ -0,0 +1,37 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRequestBudget(t *testing.T) {
+	tests := []struct {
+		name              string
+		threads, requests int
+		want              int64
+	}{
+		{"defaults", 500, 10, 5000},
+		{"no threads", 0, 10, 0},
+		{"no requests", 500, 0, 0},
+		{"at 2^31", 1 << 16, 1 << 15, 1 << 31},
+		{"above 2^31", 100000, 100000, 10000000000},
+		{"max int32 squared", math.MaxInt32, math.MaxInt32, math.MaxInt32 * math.MaxInt32},
+		{"exactly max", 1, math.MaxInt64, math.MaxInt64},
+		{"past max", 4, math.MaxInt64 / 2, math.MaxInt64},
+		{"max squared", math.MaxInt64, math.MaxInt64, math.MaxInt64},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := requestBudget(tt.threads, tt.requests); got != tt.want {
+				t.Errorf("requestBudget(%d, %d) = %d, want %d", tt.threads, tt.requests, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTotalRequestBudget(t *testing.T) {
+	if got, want := totalRequestBudget(), int64(numOfThreads)*int64(numOfRequests); got != want {
+		t.Errorf("totalRequestBudget() = %d, want %d", got, want)
+	}
+}
@@ -0,0 +1,79 @@
+// markdown.go contains the Markdown summary report, a compact version of the end-of-run report
+// that can be pasted into issues and pull requests without reformatting.
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+)
+
+// markdownTopParameters is the number of slowest parameters listed in the Markdown report
+const markdownTopParameters = 10
+
+// writeMarkdownReport writes the Markdown summary of a run to the file at path.
+func writeMarkdownReport(path string, report RunReport) error {
+	if err := os.WriteFile(path, []byte(formatMarkdownReport(report)), 0666); err != nil {
+		slog.Error("Error in writeMarkdownReport", "component", componentOutput, "error", err)
+		return fmt.Errorf("Failed to write Markdown report: %w", err)
+	}
+	return nil
+}
+
+// formatMarkdownReport formats the summary of a run as Markdown.
+func formatMarkdownReport(report RunReport) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "## Load test summary\n\n")
+	fmt.Fprintf(&b, "`%s`, started %s, ran for %s.\n\n", report.Config.BaseURL, report.StartTime.Format("2006-01-02 15:04:05 MST"), report.Duration.Round(time.Second))
+
+	fmt.Fprintf(&b, "### Configuration\n\n")
+	fmt.Fprintf(&b, "| Threads | Requests/thread | Indefinite | Proxies | Balancing | Timeout |\n")
+	fmt.Fprintf(&b, "|---:|---:|---|---|---|---:|\n")
+	fmt.Fprintf(&b, "| %d | %d | %t | %t | %s | %s |\n\n",
+		report.Config.Threads, report.Config.RequestsPerThread, report.Config.RunIndefinitely,
+		report.Config.UseProxy, report.Config.ProxyBalancing, report.Config.ClientTimeout)
+
+	fmt.Fprintf(&b, "### Totals\n\n")
+	fmt.Fprintf(&b, "| Requests | Successes | Failures | Throughput | Received |\n")
+	fmt.Fprintf(&b, "|---:|---:|---:|---:|---:|\n")
+	fmt.Fprintf(&b, "| %d | %d | %d | %.1f req/s | %s |\n\n",
+		report.Stats.Requests, report.Stats.Successes, report.Stats.Failures, report.Throughput, formatBytes(report.Stats.BytesIn))
+	fmt.Fprintf(&b, "Status codes: %s  \nErrors: %s\n\n", report.Stats.StatusCodes, report.Stats.ErrorClasses)
+
+	fmt.Fprintf(&b, "### Latency\n\n")
+	fmt.Fprintf(&b, "| min | mean | p50 | p90 | p95 | p99 | max |\n")
+	fmt.Fprintf(&b, "|---:|---:|---:|---:|---:|---:|---:|\n")
+	fmt.Fprintf(&b, "| %s | %s | %s | %s | %s | %s | %s |\n\n",
+		roundDuration(report.Latency.Min), roundDuration(report.Latency.Mean), roundDuration(report.Latency.P50),
+		roundDuration(report.Latency.P90), roundDuration(report.Latency.P95), roundDuration(report.Latency.P99),
+		roundDuration(report.Latency.Max))
+
+	if len(report.Parameters) > 0 {
+		fmt.Fprintf(&b, "### Slowest parameters\n\n")
+		fmt.Fprintf(&b, "| Parameter | Requests | Errors | Mean | p95 | p99 |\n")
+		fmt.Fprintf(&b, "|---|---:|---:|---:|---:|---:|\n")
+		for i, s := range report.Parameters {
+			if i == markdownTopParameters {
+				break
+			}
+			fmt.Fprintf(&b, "| `%s` | %d | %.1f%% | %s | %s | %s |\n",
+				s.Parameter, s.Requests, 100*s.ErrorRate,
+				roundDuration(s.MeanDuration), roundDuration(s.P95Duration), roundDuration(s.P99Duration))
+		}
+		fmt.Fprintf(&b, "\n")
+	}
+
+	if report.Config.UseProxy {
+		fmt.Fprintf(&b, "### Proxy health\n\n")
+		fmt.Fprintf(&b, "| Loaded | Healthy at end | Validated | Failed validation | Unique IPs |\n")
+		fmt.Fprintf(&b, "|---:|---:|---:|---:|---:|\n")
+		fmt.Fprintf(&b, "| %d | %d | %d | %d | %d |\n",
+			report.ProxiesLoaded, report.HealthyProxies, report.Stats.ProxySuccesses, report.Stats.ProxyFailures, report.UniqueIPs)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,184 @@
+// metrics.go contains the optional Prometheus endpoint, which exposes the counters, gauges,
+// and latency histogram of the run in the Prometheus text format so long runs can be monitored.
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// latencyBucketBounds are the upper bounds of the buckets of the exported latency histogram
+var latencyBucketBounds = []time.Duration{
+	5 * time.Millisecond, 10 * time.Millisecond, 25 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond,
+	1 * time.Second, 2500 * time.Millisecond, 5 * time.Second, 10 * time.Second,
+}
+
+// proxyRequests counts the requests sent through each proxy, for the per-proxy metrics
+var proxyRequests sync.Map
+
+// proxyRequestCounts holds the request counts of a proxy.
+type proxyRequestCounts struct {
+	requests int64
+	failures int64
+}
+
+// countProxyRequest counts a request sent through a proxy, if the metrics endpoint is enabled.
+func countProxyRequest(proxy string, ok bool) {
+	if metricsAddr == "" {
+		return
+	}
+	value, loaded := proxyRequests.Load(proxy)
+	if !loaded {
+		value, _ = proxyRequests.LoadOrStore(proxy, &proxyRequestCounts{})
+	}
+	counts := value.(*proxyRequestCounts)
+	atomic.AddInt64(&counts.requests, 1)
+	if !ok {
+		atomic.AddInt64(&counts.failures, 1)
+	}
+}
+
+// startMetricsServer serves the metrics at /metrics on metricsAddr, for the lifetime of the run.
+func startMetricsServer(collector *StatsCollector) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		fmt.Fprint(w, formatPrometheusMetrics(collector))
+	})
+
+	go func() {
+		if err := http.ListenAndServe(metricsAddr, mux); err != nil {
+			slog.Error("Metrics server failed", "component", componentOutput, "error", err)
+		}
+	}()
+}
+
+// formatPrometheusMetrics formats the current metrics in the Prometheus text format.
+func formatPrometheusMetrics(collector *StatsCollector) string {
+	var b strings.Builder
+	snapshot := collector.Snapshot()
+
+	fmt.Fprintf(&b, "# HELP jeet_requests_total Responses received, by status code.\n")
+	fmt.Fprintf(&b, "# TYPE jeet_requests_total counter\n")
+	for _, code := range snapshot.StatusCodes.Codes() {
+		label := fmt.Sprint(code)
+		if code == 0 {
+			label = "other"
+		}
+		fmt.Fprintf(&b, "jeet_requests_total{status=%q} %d\n", label, snapshot.StatusCodes[code])
+	}
+
+	fmt.Fprintf(&b, "# HELP jeet_request_failures_total Requests that failed, by error class.\n")
+	fmt.Fprintf(&b, "# TYPE jeet_request_failures_total counter\n")
+	for class, count := range snapshot.ErrorClasses {
+		if class != int(ErrorClassNone) {
+			fmt.Fprintf(&b, "jeet_request_failures_total{class=%q} %d\n", ErrorClass(class), count)
+		}
+	}
+
+	fmt.Fprintf(&b, "# HELP jeet_requests_started_total Requests started.\n")
+	fmt.Fprintf(&b, "# TYPE jeet_requests_started_total counter\n")
+	fmt.Fprintf(&b, "jeet_requests_started_total %d\n", snapshot.Requests)
+
+	fmt.Fprintf(&b, "# HELP jeet_request_retries_total Requests sent again after failing without a response.\n")
+	fmt.Fprintf(&b, "# TYPE jeet_request_retries_total counter\n")
+	fmt.Fprintf(&b, "jeet_request_retries_total %d\n", snapshot.Retries)
+
+	fmt.Fprintf(&b, "# HELP jeet_request_retries_denied_total Retries refused because the retry budget was used up.\n")
+	fmt.Fprintf(&b, "# TYPE jeet_request_retries_denied_total counter\n")
+	fmt.Fprintf(&b, "jeet_request_retries_denied_total %d\n", snapshot.RetriesDenied)
+
+	covered, total := parameterCoverage()
+	fmt.Fprintf(&b, "# HELP jeet_parameters_covered Parameters sent at least once.\n")
+	fmt.Fprintf(&b, "# TYPE jeet_parameters_covered gauge\n")
+	fmt.Fprintf(&b, "jeet_parameters_covered %d\n", covered)
+	fmt.Fprintf(&b, "# HELP jeet_parameters Parameters the run picks from.\n")
+	fmt.Fprintf(&b, "# TYPE jeet_parameters gauge\n")
+	fmt.Fprintf(&b, "jeet_parameters %d\n", total)
+
+	fmt.Fprintf(&b, "# HELP jeet_slow_requests_total Requests that took longer than the slow request threshold.\n")
+	fmt.Fprintf(&b, "# TYPE jeet_slow_requests_total counter\n")
+	fmt.Fprintf(&b, "jeet_slow_requests_total %d\n", snapshot.SlowRequests)
+
+	fmt.Fprintf(&b, "# HELP jeet_log_records_dropped_total Log records dropped because the log queue was full.\n")
+	fmt.Fprintf(&b, "# TYPE jeet_log_records_dropped_total counter\n")
+	fmt.Fprintf(&b, "jeet_log_records_dropped_total %d\n", atomic.LoadInt64(&droppedLogRecords))
+
+	fmt.Fprintf(&b, "# HELP jeet_response_bytes_total Response body bytes read, after decompression.\n")
+	fmt.Fprintf(&b, "# TYPE jeet_response_bytes_total counter\n")
+	fmt.Fprintf(&b, "jeet_response_bytes_total %d\n", snapshot.BytesIn)
+
+	fmt.Fprintf(&b, "# HELP jeet_response_wire_bytes_total Response body bytes received on the wire, before decompression.\n")
+	fmt.Fprintf(&b, "# TYPE jeet_response_wire_bytes_total counter\n")
+	fmt.Fprintf(&b, "jeet_response_wire_bytes_total %d\n", snapshot.WireBytes)
+
+	fmt.Fprintf(&b, "# HELP jeet_truncated_bodies_total Response bodies cut off at the maximum body size.\n")
+	fmt.Fprintf(&b, "# TYPE jeet_truncated_bodies_total counter\n")
+	fmt.Fprintf(&b, "jeet_truncated_bodies_total %d\n", snapshot.Truncated)
+
+	fmt.Fprintf(&b, "# HELP jeet_body_buffers_allocated_total Response body buffers allocated by the buffer pool.\n")
+	fmt.Fprintf(&b, "# TYPE jeet_body_buffers_allocated_total counter\n")
+	fmt.Fprintf(&b, "jeet_body_buffers_allocated_total %d\n", snapshot.BodyBuffers)
+
+	if useProxy {
+		fmt.Fprintf(&b, "# HELP jeet_proxy_requests_total Requests sent, by proxy and outcome.\n")
+		fmt.Fprintf(&b, "# TYPE jeet_proxy_requests_total counter\n")
+		var proxyNames []string
+		proxyRequests.Range(func(key, value interface{}) bool {
+			proxyNames = append(proxyNames, key.(string))
+			return true
+		})
+		sort.Strings(proxyNames)
+		for _, proxy := range proxyNames {
+			value, _ := proxyRequests.Load(proxy)
+			counts := value.(*proxyRequestCounts)
+			failures := atomic.LoadInt64(&counts.failures)
+			fmt.Fprintf(&b, "jeet_proxy_requests_total{proxy=%q,outcome=\"success\"} %d\n", proxy, atomic.LoadInt64(&counts.requests)-failures)
+			fmt.Fprintf(&b, "jeet_proxy_requests_total{proxy=%q,outcome=\"failure\"} %d\n", proxy, failures)
+		}
+
+		fmt.Fprintf(&b, "# HELP jeet_proxy_validations_total Proxy validations, by outcome.\n")
+		fmt.Fprintf(&b, "# TYPE jeet_proxy_validations_total counter\n")
+		fmt.Fprintf(&b, "jeet_proxy_validations_total{outcome=\"success\"} %d\n", snapshot.ProxySuccesses)
+		fmt.Fprintf(&b, "jeet_proxy_validations_total{outcome=\"failure\"} %d\n", snapshot.ProxyFailures)
+
+		fmt.Fprintf(&b, "# HELP jeet_proxy_pool_size Healthy proxies in the pool.\n")
+		fmt.Fprintf(&b, "# TYPE jeet_proxy_pool_size gauge\n")
+		fmt.Fprintf(&b, "jeet_proxy_pool_size %d\n", proxiesPool.Len())
+
+		fmt.Fprintf(&b, "# HELP jeet_unique_ips Unique proxy exit IPs seen.\n")
+		fmt.Fprintf(&b, "# TYPE jeet_unique_ips gauge\n")
+		fmt.Fprintf(&b, "jeet_unique_ips %d\n", countUniqueIPs())
+	}
+
+	fmt.Fprintf(&b, "# HELP jeet_requests_per_second Requests started during the last timeline interval, per second.\n")
+	fmt.Fprintf(&b, "# TYPE jeet_requests_per_second gauge\n")
+	fmt.Fprintf(&b, "jeet_requests_per_second %g\n", timeline.Last().Requests)
+
+	fmt.Fprintf(&b, "# HELP jeet_request_duration_seconds Duration of completed requests.\n")
+	fmt.Fprintf(&b, "# TYPE jeet_request_duration_seconds histogram\n")
+	buckets := latencies.Buckets()
+	var cumulative int64
+	next := 0
+	for _, bound := range latencyBucketBounds {
+		for next < len(buckets) && buckets[next].UpperBound <= bound {
+			cumulative += buckets[next].Count
+			next++
+		}
+		fmt.Fprintf(&b, "jeet_request_duration_seconds_bucket{le=\"%g\"} %d\n", bound.Seconds(), cumulative)
+	}
+	count := latencies.Count()
+	fmt.Fprintf(&b, "jeet_request_duration_seconds_bucket{le=\"+Inf\"} %d\n", count)
+	fmt.Fprintf(&b, "jeet_request_duration_seconds_sum %g\n", latencies.Sum().Seconds())
+	fmt.Fprintf(&b, "jeet_request_duration_seconds_count %d\n", count)
+
+	return b.String()
+}
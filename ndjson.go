@@ -0,0 +1,114 @@
+// ndjson.go contains the NDJSON result stream, which writes every completed request as a JSON line
+// to a file or stdout, so results can be piped into tools like jq, Vector, or Logstash in real time.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ndjsonStdout is the ndjsonOutput value that streams to stdout
+const ndjsonStdout = "-"
+
+// requestRecordJSON is the layout of a request in the NDJSON stream.
+type requestRecordJSON struct {
+	Timestamp     time.Time         `json:"timestamp"`
+	RequestID     string            `json:"request_id,omitempty"`
+	Parameter     string            `json:"parameter"`
+	Proxy         string            `json:"proxy,omitempty"`
+	StatusCode    int               `json:"status,omitempty"`
+	DurationMs    float64           `json:"duration_ms"`
+	BytesIn       int               `json:"bytes"`
+	WireBytes     int               `json:"wire_bytes"`
+	Protocol      string            `json:"protocol,omitempty"`
+	AddressFamily string            `json:"ip_family,omitempty"`
+	ErrorClass    string            `json:"error_class,omitempty"`
+	Retries       int               `json:"retries,omitempty"`
+	Truncated     bool              `json:"truncated,omitempty"`
+	Headers       map[string]string `json:"headers,omitempty"`
+	Redirects     []RedirectHop     `json:"redirects,omitempty"`
+}
+
+// NDJSONWriter writes RequestSummaries as JSON lines.
+// Every line is written as soon as the request completes.
+// It is safe for concurrent use.
+type NDJSONWriter struct {
+	mu     sync.Mutex
+	file   *os.File
+	enc    *json.Encoder
+	stdout bool
+}
+
+// openNDJSONWriter opens the NDJSON stream. If output is "-", it streams to stdout,
+// and everything else that would be printed to stdout is moved to stderr so the stream stays valid.
+// Otherwise output is the name of a file in dir that is appended to.
+func openNDJSONWriter(output string, dir string) (*NDJSONWriter, error) {
+	if output == ndjsonStdout {
+		if progressBar {
+			return nil, fmt.Errorf("The progress bar must be disabled to stream NDJSON to stdout")
+		}
+		file := os.Stdout
+		// Send the summary report and warnings to stderr instead of interleaving them with the stream
+		os.Stdout = os.Stderr
+		return &NDJSONWriter{file: file, enc: json.NewEncoder(file), stdout: true}, nil
+	}
+
+	file, err := os.OpenFile(filepath.Join(dir, output), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		slog.Error("Error in openNDJSONWriter", "component", componentOutput, "error", err)
+		return nil, fmt.Errorf("Failed to open NDJSON file: %w", err)
+	}
+
+	return &NDJSONWriter{file: file, enc: json.NewEncoder(file)}, nil
+}
+
+// Write writes a request as a JSON line.
+func (nw *NDJSONWriter) Write(summary RequestSummary) {
+	record := requestRecordJSON{
+		Timestamp:     summary.Timestamp,
+		RequestID:     summary.RequestID,
+		Parameter:     summary.Parameter,
+		Proxy:         summary.Proxy,
+		StatusCode:    summary.StatusCode,
+		DurationMs:    durationMillis(summary.Duration),
+		BytesIn:       summary.BytesIn,
+		WireBytes:     summary.WireBytes,
+		Protocol:      summary.Protocol,
+		AddressFamily: summary.AddressFamily,
+		Retries:       summary.Retries,
+		Truncated:     summary.Truncated,
+		Headers:       summary.Headers,
+		Redirects:     summary.Redirects,
+	}
+	if summary.ErrorClass != ErrorClassNone {
+		record.ErrorClass = summary.ErrorClass.String()
+	}
+
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	if err := nw.enc.Encode(record); err != nil {
+		slog.Error("Failed to write NDJSON record", "component", componentOutput, "error", err)
+	}
+}
+
+// Close closes the NDJSON file. The stdout stream is left open.
+func (nw *NDJSONWriter) Close() error {
+	if nw.stdout {
+		return nil
+	}
+
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	if err := nw.file.Close(); err != nil {
+		slog.Error("Error in Close", "component", componentOutput, "error", err)
+		return fmt.Errorf("Failed to close NDJSON file: %w", err)
+	}
+
+	return nil
+}
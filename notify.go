@@ -0,0 +1,103 @@
+// notify.go contains the chat notifier, which posts a formatted summary of the run, and optionally periodic
+// progress updates, to a Slack or Discord incoming webhook, with the headline percentiles and error counts.
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// discordMaxContent is the longest message Discord accepts from a webhook
+const discordMaxContent = 2000
+
+// chatIsDiscord reports whether chatWebhookUrl is a Discord webhook; anything else is treated as Slack.
+func chatIsDiscord() bool {
+	return chatWebhookKind == "discord" ||
+		(chatWebhookKind == "" && (strings.Contains(chatWebhookUrl, "discord.com/") || strings.Contains(chatWebhookUrl, "discordapp.com/")))
+}
+
+// postChat posts a Markdown message to the chat webhook.
+func postChat(message string) error {
+	if chatIsDiscord() {
+		if len(message) > discordMaxContent {
+			message = message[:discordMaxContent-3] + "..."
+		}
+		return postWebhook(chatWebhookUrl, map[string]string{"content": message})
+	}
+	return postWebhook(chatWebhookUrl, map[string]interface{}{"text": message, "mrkdwn": true})
+}
+
+// startChatProgress posts a progress update to the chat webhook every chatProgressInterval for the lifetime of the run.
+// It does nothing if no chat webhook is configured or the interval is not positive.
+func startChatProgress(collector *StatsCollector, start time.Time) {
+	if chatWebhookUrl == "" || chatProgressInterval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(chatProgressInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := postChat(formatChatProgress(takeStatsSample(collector, 0), time.Since(start))); err != nil {
+				slog.Error("Failed to post progress to chat webhook", "component", componentControl, "error", err)
+			}
+		}
+	}()
+}
+
+// notifyChatCompleted posts the summary of the run to the chat webhook, if one is configured.
+func notifyChatCompleted(report RunReport) {
+	if chatWebhookUrl == "" {
+		return
+	}
+	if err := postChat(formatChatSummary(report)); err != nil {
+		slog.Error("Failed to post summary to chat webhook", "component", componentControl, "error", err)
+	}
+}
+
+// formatChatProgress formats a progress update of a run that has been running for elapsed.
+func formatChatProgress(sample statsSample, elapsed time.Duration) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*jeet progress* after %s against `%s`\n", elapsed.Round(time.Second), baseUrl)
+	fmt.Fprintf(&b, "Requests: %d (%d failed, %s)\n", sample.Requests, sample.Failures, formatChatRate(sample.Failures, sample.Requests))
+	fmt.Fprintf(&b, "Throughput: %.1f requests/s\n", perSecond(sample.Requests, elapsed))
+	fmt.Fprintf(&b, "Latency: p50 %s, p95 %s, p99 %s\n",
+		sample.Latency.P50.Round(time.Millisecond), sample.Latency.P95.Round(time.Millisecond), sample.Latency.P99.Round(time.Millisecond))
+	if errors := sample.ErrorClasses.String(); errors != "none" {
+		fmt.Fprintf(&b, "Errors: %s\n", errors)
+	}
+	return b.String()
+}
+
+// formatChatSummary formats the summary of a finished run.
+func formatChatSummary(report RunReport) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*jeet run finished* against `%s`\n", report.Config.BaseURL)
+	fmt.Fprintf(&b, "Duration: %s with %d threads\n", report.Duration.Round(time.Second), report.Config.Threads)
+	fmt.Fprintf(&b, "Requests: %d (%d succeeded, %d failed, %s)\n",
+		report.Stats.Requests, report.Stats.Successes, report.Stats.Failures, formatChatRate(report.Stats.Failures, report.Stats.Requests))
+	fmt.Fprintf(&b, "Throughput: %.1f requests/s\n", report.Throughput)
+	fmt.Fprintf(&b, "Latency: p50 %s, p95 %s, p99 %s, max %s\n",
+		report.Latency.P50.Round(time.Millisecond), report.Latency.P95.Round(time.Millisecond),
+		report.Latency.P99.Round(time.Millisecond), report.Latency.Max.Round(time.Millisecond))
+	fmt.Fprintf(&b, "Status codes: %s\n", report.Stats.StatusCodes)
+	if errors := report.Stats.ErrorClasses.String(); errors != "none" {
+		fmt.Fprintf(&b, "Errors: %s\n", errors)
+	}
+	if report.Config.UseProxy {
+		fmt.Fprintf(&b, "Proxies: %d healthy at end, %d unique IPs\n", report.HealthyProxies, report.UniqueIPs)
+	}
+	return b.String()
+}
+
+// formatChatRate formats failures out of requests as a percentage.
+func formatChatRate(failures, requests int64) string {
+	if requests == 0 {
+		return "0.0%"
+	}
+	return fmt.Sprintf("%.1f%%", 100*float64(failures)/float64(requests))
+}
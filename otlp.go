@@ -0,0 +1,342 @@
+// otlp.go contains the OpenTelemetry metrics exporter, which periodically pushes the counters,
+// gauges, and latency histogram of the run to an OTLP collector over HTTP with the JSON encoding,
+// and the OTLP plumbing shared with the span exporter.
+// It is configured through the standard OTEL_EXPORTER_OTLP_* environment variables.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// otlpConfig is the exporter configuration read from the environment.
+type otlpConfig struct {
+	Endpoint   string
+	Headers    map[string]string
+	Timeout    time.Duration
+	Interval   time.Duration
+	Attributes []otlpKeyValue
+}
+
+// The OTLP JSON encoding of metrics, limited to the fields the exporter uses
+type (
+	otlpExportRequest struct {
+		ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+	}
+	otlpResourceMetrics struct {
+		Resource     otlpResource       `json:"resource"`
+		ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+	}
+	otlpResource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	}
+	otlpScopeMetrics struct {
+		Scope   otlpScope    `json:"scope"`
+		Metrics []otlpMetric `json:"metrics"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpMetric struct {
+		Name      string         `json:"name"`
+		Unit      string         `json:"unit,omitempty"`
+		Sum       *otlpSum       `json:"sum,omitempty"`
+		Gauge     *otlpGauge     `json:"gauge,omitempty"`
+		Histogram *otlpHistogram `json:"histogram,omitempty"`
+	}
+	otlpSum struct {
+		DataPoints             []otlpNumberDataPoint `json:"dataPoints"`
+		AggregationTemporality int                   `json:"aggregationTemporality"`
+		IsMonotonic            bool                  `json:"isMonotonic"`
+	}
+	otlpGauge struct {
+		DataPoints []otlpNumberDataPoint `json:"dataPoints"`
+	}
+	otlpHistogram struct {
+		DataPoints             []otlpHistogramDataPoint `json:"dataPoints"`
+		AggregationTemporality int                      `json:"aggregationTemporality"`
+	}
+	otlpNumberDataPoint struct {
+		Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+		StartTimeUnixNano string         `json:"startTimeUnixNano"`
+		TimeUnixNano      string         `json:"timeUnixNano"`
+		AsInt             string         `json:"asInt"`
+	}
+	otlpHistogramDataPoint struct {
+		StartTimeUnixNano string    `json:"startTimeUnixNano"`
+		TimeUnixNano      string    `json:"timeUnixNano"`
+		Count             string    `json:"count"`
+		Sum               float64   `json:"sum"`
+		BucketCounts      []string  `json:"bucketCounts"`
+		ExplicitBounds    []float64 `json:"explicitBounds"`
+	}
+	otlpKeyValue struct {
+		Key   string       `json:"key"`
+		Value otlpAnyValue `json:"value"`
+	}
+	otlpAnyValue struct {
+		StringValue string `json:"stringValue,omitempty"`
+		IntValue    string `json:"intValue,omitempty"`
+	}
+)
+
+// otlpCumulative is the OTLP aggregation temporality of values accumulated since the start of the run
+const otlpCumulative = 2
+
+// otlpConfigFromEnv reads the exporter configuration of a signal ("metrics" or "traces")
+// from the OTEL_* environment variables, with the given default export interval.
+// It returns false if neither the signal-specific OTEL_EXPORTER_OTLP_<SIGNAL>_ENDPOINT
+// nor OTEL_EXPORTER_OTLP_ENDPOINT is set.
+func otlpConfigFromEnv(signal string, interval time.Duration) (otlpConfig, bool) {
+	config := otlpConfig{
+		Headers:  make(map[string]string),
+		Timeout:  10 * time.Second,
+		Interval: interval,
+	}
+	prefix := "OTEL_EXPORTER_OTLP_" + strings.ToUpper(signal) + "_"
+
+	// The signal-specific endpoint is used as is; the generic one gets the signal path appended
+	if endpoint := os.Getenv(prefix + "ENDPOINT"); endpoint != "" {
+		config.Endpoint = endpoint
+	} else if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); endpoint != "" {
+		config.Endpoint = strings.TrimSuffix(endpoint, "/") + "/v1/" + signal
+	} else {
+		return config, false
+	}
+
+	if protocol := firstEnv(prefix+"PROTOCOL", "OTEL_EXPORTER_OTLP_PROTOCOL"); protocol != "" && protocol != "http/json" {
+		slog.Warn("OTLP protocol is not supported, exporting with http/json", "component", componentOutput, "protocol", protocol)
+	}
+	for key, value := range parseOTELList(firstEnv(prefix+"HEADERS", "OTEL_EXPORTER_OTLP_HEADERS")) {
+		config.Headers[key] = value
+	}
+	if ms, err := strconv.Atoi(firstEnv(prefix+"TIMEOUT", "OTEL_EXPORTER_OTLP_TIMEOUT")); err == nil && ms > 0 {
+		config.Timeout = time.Duration(ms) * time.Millisecond
+	}
+	serviceName := "jeet"
+	attributes := parseOTELList(os.Getenv("OTEL_RESOURCE_ATTRIBUTES"))
+	if name, ok := attributes["service.name"]; ok {
+		serviceName = name
+		delete(attributes, "service.name")
+	}
+	if name := os.Getenv("OTEL_SERVICE_NAME"); name != "" {
+		serviceName = name
+	}
+	config.Attributes = append(config.Attributes, otlpString("service.name", serviceName))
+	for key, value := range attributes {
+		config.Attributes = append(config.Attributes, otlpString(key, value))
+	}
+
+	return config, true
+}
+
+// firstEnv returns the value of the first of the given environment variables that is set.
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// parseOTELList parses a "key1=value1,key2=value2" list as used by the OTEL_* environment variables.
+func parseOTELList(list string) map[string]string {
+	pairs := make(map[string]string)
+	for _, pair := range strings.Split(list, ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if unescaped, err := url.PathUnescape(value); err == nil {
+			value = unescaped
+		}
+		pairs[strings.TrimSpace(key)] = value
+	}
+	return pairs
+}
+
+// otlpString returns a string attribute.
+func otlpString(key, value string) otlpKeyValue {
+	return otlpKeyValue{Key: key, Value: otlpAnyValue{StringValue: value}}
+}
+
+// otlpInt returns an integer attribute.
+func otlpInt(key string, value int64) otlpKeyValue {
+	return otlpKeyValue{Key: key, Value: otlpAnyValue{IntValue: strconv.FormatInt(value, 10)}}
+}
+
+// postOTLP posts an OTLP export request encoded as JSON to the collector.
+func postOTLP(config otlpConfig, request interface{}) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		slog.Error("Error in postOTLP", "component", componentOutput, "error", err)
+		return fmt.Errorf("Failed to encode OTLP request: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", config.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		slog.Error("Error in postOTLP", "component", componentOutput, "error", err)
+		return fmt.Errorf("Failed to create OTLP request: %w", err)
+	}
+	req.Header.Add("Content-Type", "application/json")
+	for key, value := range config.Headers {
+		req.Header.Add(key, value)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		slog.Error("Error in postOTLP", "component", componentOutput, "error", err)
+		return fmt.Errorf("Failed to post to OTLP collector: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("Received response code %d from OTLP collector: %s", resp.StatusCode, message)
+	}
+
+	return nil
+}
+
+// startOTLPExporter exports the metrics every configured interval for the lifetime of the run,
+// if an OTLP endpoint is configured. It returns a function that exports the final metrics,
+// or nil if the exporter is disabled.
+func startOTLPExporter(collector *StatsCollector, start time.Time) func() {
+	config, ok := otlpConfigFromEnv("metrics", 60*time.Second)
+	if !ok {
+		return nil
+	}
+	if ms, err := strconv.Atoi(os.Getenv("OTEL_METRIC_EXPORT_INTERVAL")); err == nil && ms > 0 {
+		config.Interval = time.Duration(ms) * time.Millisecond
+	}
+
+	export := func() {
+		if err := exportOTLPMetrics(config, collector, start); err != nil {
+			slog.Error("Failed to export OTLP metrics", "component", componentOutput, "error", err)
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(config.Interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			export()
+		}
+	}()
+
+	return export
+}
+
+// exportOTLPMetrics posts the current metrics to the collector.
+func exportOTLPMetrics(config otlpConfig, collector *StatsCollector, start time.Time) error {
+	return postOTLP(config, buildOTLPRequest(config, collector, start, time.Now()))
+}
+
+// buildOTLPRequest converts the current metrics to an OTLP export request.
+func buildOTLPRequest(config otlpConfig, collector *StatsCollector, start, now time.Time) otlpExportRequest {
+	snapshot := collector.Snapshot()
+	startNano := strconv.FormatInt(start.UnixNano(), 10)
+	nowNano := strconv.FormatInt(now.UnixNano(), 10)
+
+	point := func(value int64, attributes ...otlpKeyValue) otlpNumberDataPoint {
+		return otlpNumberDataPoint{Attributes: attributes, StartTimeUnixNano: startNano, TimeUnixNano: nowNano, AsInt: strconv.FormatInt(value, 10)}
+	}
+	counter := func(name, unit string, points ...otlpNumberDataPoint) otlpMetric {
+		return otlpMetric{Name: name, Unit: unit, Sum: &otlpSum{DataPoints: points, AggregationTemporality: otlpCumulative, IsMonotonic: true}}
+	}
+
+	var statusPoints []otlpNumberDataPoint
+	for _, code := range snapshot.StatusCodes.Codes() {
+		label := fmt.Sprint(code)
+		if code == 0 {
+			label = "other"
+		}
+		statusPoints = append(statusPoints, point(snapshot.StatusCodes[code], otlpString("status", label)))
+	}
+	var errorPoints []otlpNumberDataPoint
+	for class, count := range snapshot.ErrorClasses {
+		if class != int(ErrorClassNone) {
+			errorPoints = append(errorPoints, point(count, otlpString("class", ErrorClass(class).String())))
+		}
+	}
+
+	metrics := []otlpMetric{
+		counter("jeet.requests.started", "{request}", point(snapshot.Requests)),
+		counter("jeet.requests", "{request}", statusPoints...),
+		counter("jeet.request.failures", "{request}", errorPoints...),
+		counter("jeet.response.bytes", "By", point(snapshot.BytesIn)),
+	}
+	if useProxy {
+		metrics = append(metrics,
+			counter("jeet.proxy.validations", "{proxy}",
+				point(snapshot.ProxySuccesses, otlpString("outcome", "success")),
+				point(snapshot.ProxyFailures, otlpString("outcome", "failure"))),
+			otlpMetric{Name: "jeet.proxy.pool_size", Unit: "{proxy}", Gauge: &otlpGauge{DataPoints: []otlpNumberDataPoint{point(int64(proxiesPool.Len()))}}},
+		)
+	}
+	metrics = append(metrics, otlpLatencyHistogram(startNano, nowNano))
+
+	return otlpExportRequest{ResourceMetrics: []otlpResourceMetrics{{
+		Resource: otlpResource{Attributes: config.Attributes},
+		ScopeMetrics: []otlpScopeMetrics{{
+			Scope:   otlpScope{Name: "jeet"},
+			Metrics: metrics,
+		}},
+	}}}
+}
+
+// otlpLatencyHistogram converts the latency histogram to an OTLP histogram with latencyBucketBounds as bounds.
+func otlpLatencyHistogram(startNano, nowNano string) otlpMetric {
+	buckets := latencies.Buckets()
+	bounds := make([]float64, len(latencyBucketBounds))
+	counts := make([]int64, len(latencyBucketBounds)+1)
+	for i, bound := range latencyBucketBounds {
+		bounds[i] = bound.Seconds()
+	}
+
+	var total int64
+	for _, bucket := range buckets {
+		i := 0
+		for i < len(latencyBucketBounds) && bucket.UpperBound > latencyBucketBounds[i] {
+			i++
+		}
+		counts[i] += bucket.Count
+		total += bucket.Count
+	}
+	bucketCounts := make([]string, len(counts))
+	for i, c := range counts {
+		bucketCounts[i] = strconv.FormatInt(c, 10)
+	}
+
+	return otlpMetric{
+		Name: "jeet.request.duration",
+		Unit: "s",
+		Histogram: &otlpHistogram{
+			AggregationTemporality: otlpCumulative,
+			DataPoints: []otlpHistogramDataPoint{{
+				StartTimeUnixNano: startNano,
+				TimeUnixNano:      nowNano,
+				Count:             strconv.FormatInt(total, 10),
+				Sum:               latencies.Sum().Seconds(),
+				BucketCounts:      bucketCounts,
+				ExplicitBounds:    bounds,
+			}},
+		},
+	}
+}
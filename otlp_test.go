@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestOTLPAttributeEncoding(t *testing.T) {
+	tests := []struct {
+		name      string
+		attribute otlpKeyValue
+		want      string
+	}{
+		{"string", otlpString("service.name", "jeet"), `{"key":"service.name","value":{"stringValue":"jeet"}}`},
+		{"empty string", otlpString("env", ""), `{"key":"env","value":{}}`},
+		{"int", otlpInt("threads", 500), `{"key":"threads","value":{"intValue":"500"}}`},
+		{"negative int", otlpInt("offset", -5), `{"key":"offset","value":{"intValue":"-5"}}`},
+		{"zero int", otlpInt("retries", 0), `{"key":"retries","value":{"intValue":"0"}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := json.Marshal(tt.attribute)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("encoded %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseOTELList(t *testing.T) {
+	tests := []struct {
+		name string
+		list string
+		want map[string]string
+	}{
+		{"empty", "", map[string]string{}},
+		{"one pair", "service.name=api", map[string]string{"service.name": "api"}},
+		{"several pairs", "a=1,b=2", map[string]string{"a": "1", "b": "2"}},
+		{"spaces trimmed", " a = 1 , b=2 ", map[string]string{"a": "1", "b": "2"}},
+		{"percent-encoded value", "Authorization=Bearer%20token", map[string]string{"Authorization": "Bearer token"}},
+		{"invalid escape kept", "a=100%", map[string]string{"a": "100%"}},
+		{"equals in value", "a=b=c", map[string]string{"a": "b=c"}},
+		{"pair without equals skipped", "a,b=2", map[string]string{"b": "2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseOTELList(tt.list); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseOTELList(%q) = %v, want %v", tt.list, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildOTLPRequestGolden(t *testing.T) {
+	savedPool, savedLatencies := proxiesPool, latencies
+	defer func() { proxiesPool, latencies = savedPool, savedLatencies }()
+
+	pool, err := newProxyPool("random", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.Add("10.0.0.1:1080")
+	pool.Add("10.0.0.2:1080")
+	proxiesPool = pool
+
+	latencies = newHistogram(latencyHighestTrackable, latencySignificantFigures)
+	for _, d := range []time.Duration{3 * time.Millisecond, 20 * time.Millisecond, 20 * time.Millisecond, 2 * time.Second} {
+		latencies.Record(d)
+	}
+
+	collector := newStatsCollector(1)
+	collector.Add(0, CounterRequests, 4)
+	collector.Add(0, CounterBytesIn, 1234)
+	collector.Add(0, CounterProxySuccesses, 2)
+	collector.Add(0, CounterProxyFailures, 1)
+	for _, code := range []int{200, 200, 200, 0} {
+		collector.AddStatus(0, code)
+	}
+	collector.AddError(0, ErrorClassTimeout)
+
+	start := time.Unix(1700000000, 0)
+	config := otlpConfig{Attributes: []otlpKeyValue{otlpString("service.name", "jeet")}}
+	request := buildOTLPRequest(config, collector, start, start.Add(10*time.Second))
+
+	// The points of a counter share the start and end times
+	const times = `"startTimeUnixNano":"1700000000000000000","timeUnixNano":"1700000010000000000"`
+	failure := func(class, count string) string {
+		return `{"attributes":[{"key":"class","value":{"stringValue":"` + class + `"}}],` + times + `,"asInt":"` + count + `"}`
+	}
+	want := `{"resourceMetrics":[{` +
+		`"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"jeet"}}]},` +
+		`"scopeMetrics":[{"scope":{"name":"jeet"},"metrics":[` +
+		`{"name":"jeet.requests.started","unit":"{request}","sum":{"dataPoints":[{` + times + `,"asInt":"4"}],"aggregationTemporality":2,"isMonotonic":true}},` +
+		`{"name":"jeet.requests","unit":"{request}","sum":{"dataPoints":[` +
+		`{"attributes":[{"key":"status","value":{"stringValue":"other"}}],` + times + `,"asInt":"1"},` +
+		`{"attributes":[{"key":"status","value":{"stringValue":"200"}}],` + times + `,"asInt":"3"}` +
+		`],"aggregationTemporality":2,"isMonotonic":true}},` +
+		`{"name":"jeet.request.failures","unit":"{request}","sum":{"dataPoints":[` +
+		failure("timeout", "1") + "," + failure("connection-refused", "0") + "," + failure("dns", "0") + "," +
+		failure("tls", "0") + "," + failure("proxy", "0") + "," + failure("body-read", "0") + "," +
+		failure("other", "0") + "," + failure("assertion", "0") + "," + failure("status", "0") + "," + failure("graphql", "0") +
+		`],"aggregationTemporality":2,"isMonotonic":true}},` +
+		`{"name":"jeet.response.bytes","unit":"By","sum":{"dataPoints":[{` + times + `,"asInt":"1234"}],"aggregationTemporality":2,"isMonotonic":true}},` +
+		`{"name":"jeet.proxy.validations","unit":"{proxy}","sum":{"dataPoints":[` +
+		`{"attributes":[{"key":"outcome","value":{"stringValue":"success"}}],` + times + `,"asInt":"2"},` +
+		`{"attributes":[{"key":"outcome","value":{"stringValue":"failure"}}],` + times + `,"asInt":"1"}` +
+		`],"aggregationTemporality":2,"isMonotonic":true}},` +
+		`{"name":"jeet.proxy.pool_size","unit":"{proxy}","gauge":{"dataPoints":[{` + times + `,"asInt":"2"}]}},` +
+		`{"name":"jeet.request.duration","unit":"s","histogram":{"dataPoints":[{` + times + `,` +
+		`"count":"4","sum":2.043,` +
+		`"bucketCounts":["1","0","2","0","0","0","0","0","1","0","0","0"],` +
+		`"explicitBounds":[0.005,0.01,0.025,0.05,0.1,0.25,0.5,1,2.5,5,10]` +
+		`}],"aggregationTemporality":2}}` +
+		`]}]}]}`
+
+	// The request posted to the collector carries exactly the golden encoding
+	var posted []byte
+	var contentType, header string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posted, _ = io.ReadAll(r.Body)
+		contentType, header = r.Header.Get("Content-Type"), r.Header.Get("X-Api-Key")
+	}))
+	defer server.Close()
+	config.Endpoint = server.URL + "/v1/metrics"
+	config.Headers = map[string]string{"X-Api-Key": "secret"}
+	config.Timeout = 5 * time.Second
+	if err := postOTLP(config, request); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(posted, []byte(want)) {
+		t.Errorf("posted\n%s\nwant\n%s", posted, want)
+	}
+	if contentType != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", contentType)
+	}
+	if header != "secret" {
+		t.Errorf("X-Api-Key = %q, want the configured header", header)
+	}
+
+	// The golden encoding decodes back into the request it was built from
+	var decoded otlpExportRequest
+	if err := json.Unmarshal([]byte(want), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, request) {
+		t.Errorf("decoded golden request = %+v, want %+v", decoded, request)
+	}
+}
@@ -0,0 +1,128 @@
+// paramgen.go contains the per-parameter value generators. A line of the parameters file is a bare name,
+// which gets a random number from the default range, or a name with its own generator:
+// name=rng(min,max), name=choice(a,b,c), or name=value, a fixed value whose placeholders are expanded.
+
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// generatorKind is the way a ParameterGenerator draws its values.
+type generatorKind int
+
+// The kinds of parameter generators
+const (
+	generatorDefault generatorKind = iota // A random number in the default rng() range
+	generatorRange                        // A random number in [min, max]
+	generatorChoice                       // One of the choices, picked uniformly
+	generatorFixed                        // The fixed value, with its placeholders expanded
+)
+
+// generatorSpec matches the rng(...) and choice(...) generators of a parameter line
+var generatorSpec = regexp.MustCompile(`^(rng|choice)\((.*)\)$`)
+
+// ParameterGenerator draws the values of one parameter.
+type ParameterGenerator struct {
+	Name     string
+	kind     generatorKind
+	min, max int
+	choices  []string
+	value    string
+}
+
+// parameterGenerators holds the generators of the parameters, by parameters line, set by setupParameterGenerators
+var parameterGenerators = make(map[string]*ParameterGenerator)
+
+// setupParameterGenerators parses the generator of every parameter.
+// It returns an error for the first line whose generator is malformed.
+func setupParameterGenerators() error {
+	generators := make(map[string]*ParameterGenerator, len(parameters))
+	for _, line := range parameters {
+		generator, err := parseParameterGenerator(line)
+		if err != nil {
+			return fmt.Errorf("parameter %q: %w", line, err)
+		}
+		generators[line] = generator
+	}
+	parameterGenerators = generators
+	return nil
+}
+
+// parseParameterGenerator parses a line of the parameters file into its generator.
+func parseParameterGenerator(line string) (*ParameterGenerator, error) {
+	name, spec, found := strings.Cut(line, "=")
+	if !found {
+		return &ParameterGenerator{Name: line, kind: generatorDefault}, nil
+	}
+	if name == "" {
+		return nil, fmt.Errorf("no parameter name")
+	}
+
+	match := generatorSpec.FindStringSubmatch(spec)
+	if match == nil {
+		if err := validateTemplate(spec); err != nil {
+			return nil, err
+		}
+		return &ParameterGenerator{Name: name, kind: generatorFixed, value: spec}, nil
+	}
+
+	args := strings.Split(match[2], ",")
+	for i := range args {
+		args[i] = strings.TrimSpace(args[i])
+	}
+	switch match[1] {
+	case "rng":
+		if len(args) != 2 {
+			return nil, fmt.Errorf("rng takes a minimum and a maximum")
+		}
+		min, err := strconv.Atoi(args[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid minimum: %w", err)
+		}
+		max, err := strconv.Atoi(args[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid maximum: %w", err)
+		}
+		if max < min {
+			min, max = max, min
+		}
+		return &ParameterGenerator{Name: name, kind: generatorRange, min: min, max: max}, nil
+	default:
+		if match[2] == "" {
+			return nil, fmt.Errorf("choice takes at least one option")
+		}
+		return &ParameterGenerator{Name: name, kind: generatorChoice, choices: args}, nil
+	}
+}
+
+// parameterGeneratorFor returns the generator of a parameters line. Lines that were not set up
+// are parsed on the spot, and fall back to the default generator if they are malformed.
+func parameterGeneratorFor(line string) *ParameterGenerator {
+	if generator, ok := parameterGenerators[line]; ok {
+		return generator
+	}
+	generator, err := parseParameterGenerator(line)
+	if err != nil {
+		return &ParameterGenerator{Name: line, kind: generatorDefault}
+	}
+	return generator
+}
+
+// Generate draws a value of the parameter from r, fixed values taking their {{data column}} tokens from row.
+func (g *ParameterGenerator) Generate(r *rand.Rand, row DataRow) string {
+	switch g.kind {
+	case generatorRange:
+		return rng(r, g.min, g.max)
+	case generatorChoice:
+		return g.choices[r.Intn(len(g.choices))]
+	case generatorFixed:
+		return expandRowPlaceholders(g.value, r, row)
+	default:
+		return rng(r)
+	}
+}
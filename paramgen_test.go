@@ -0,0 +1,81 @@
+package main
+
+import (
+	"math/rand"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestParseParameterGenerator(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    ParameterGenerator
+		wantErr bool
+	}{
+		{"bare name", "height", ParameterGenerator{Name: "height", kind: generatorDefault}, false},
+		{"range", "id=rng(1,10)", ParameterGenerator{Name: "id", kind: generatorRange, min: 1, max: 10}, false},
+		{"range with spaces", "id=rng( 1 , 10 )", ParameterGenerator{Name: "id", kind: generatorRange, min: 1, max: 10}, false},
+		{"range swapped", "id=rng(10,1)", ParameterGenerator{Name: "id", kind: generatorRange, min: 1, max: 10}, false},
+		{"range negative", "id=rng(-5,5)", ParameterGenerator{Name: "id", kind: generatorRange, min: -5, max: 5}, false},
+		{"choice", "asset=choice(BTC.BTC, ETH.ETH)", ParameterGenerator{Name: "asset", kind: generatorChoice, choices: []string{"BTC.BTC", "ETH.ETH"}}, false},
+		{"single choice", "asset=choice(BTC.BTC)", ParameterGenerator{Name: "asset", kind: generatorChoice, choices: []string{"BTC.BTC"}}, false},
+		{"fixed", "format=json", ParameterGenerator{Name: "format", kind: generatorFixed, value: "json"}, false},
+		{"fixed with template", "name={{name}}", ParameterGenerator{Name: "name", kind: generatorFixed, value: "{{name}}"}, false},
+		{"fixed empty", "flag=", ParameterGenerator{Name: "flag", kind: generatorFixed, value: ""}, false},
+		{"fixed with equals", "q=a=b", ParameterGenerator{Name: "q", kind: generatorFixed, value: "a=b"}, false},
+		{"unclosed generator is fixed", "id=rng(1,10", ParameterGenerator{Name: "id", kind: generatorFixed, value: "rng(1,10"}, false},
+		{"no name", "=rng(1,10)", ParameterGenerator{}, true},
+		{"range with one bound", "id=rng(1)", ParameterGenerator{}, true},
+		{"range with three bounds", "id=rng(1,2,3)", ParameterGenerator{}, true},
+		{"range with invalid minimum", "id=rng(a,10)", ParameterGenerator{}, true},
+		{"range with invalid maximum", "id=rng(1,b)", ParameterGenerator{}, true},
+		{"empty choice", "asset=choice()", ParameterGenerator{}, true},
+		{"fixed with data token and no data file", "user={{data user}}", ParameterGenerator{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseParameterGenerator(tt.line)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseParameterGenerator(%q) error = %v, wantErr %t", tt.line, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("parseParameterGenerator(%q) = %+v, want %+v", tt.line, *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParameterGeneratorGenerate(t *testing.T) {
+	tests := []struct {
+		name  string
+		line  string
+		valid func(string) bool
+	}{
+		{"range", "id=rng(3,5)", func(v string) bool {
+			n, err := strconv.Atoi(v)
+			return err == nil && n >= 3 && n <= 5
+		}},
+		{"choice", "asset=choice(a,b)", func(v string) bool { return v == "a" || v == "b" }},
+		{"fixed", "format=json", func(v string) bool { return v == "json" }},
+		{"fixed with range placeholder", "id=%rng(7,7)", func(v string) bool { return v == "7" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			generator, err := parseParameterGenerator(tt.line)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := rand.New(rand.NewSource(1))
+			for i := 0; i < 100; i++ {
+				if v := generator.Generate(r, nil); !tt.valid(v) {
+					t.Fatalf("Generate() for %q = %q", tt.line, v)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+// paramstats.go contains the aggregation of request outcomes per parameter across all threads,
+// and the per-parameter table and CSV emitted at the end of a run.
+
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// parameterStats aggregates the outcome of requests per parameter across all threads
+var parameterStats = newParameterAggregator()
+
+// parameterAggregate holds the aggregated outcome of the requests for one parameter.
+type parameterAggregate struct {
+	latencies *Histogram
+	requests  int64
+	errors    int64
+	bytes     int64
+	bodies    int64 // Responses whose body was read
+}
+
+// ParameterAggregator aggregates RequestSummaries per parameter name.
+// It is safe for concurrent use.
+type ParameterAggregator struct {
+	mu     sync.RWMutex
+	params map[string]*parameterAggregate
+}
+
+// newParameterAggregator creates an empty ParameterAggregator.
+func newParameterAggregator() *ParameterAggregator {
+	return &ParameterAggregator{params: make(map[string]*parameterAggregate)}
+}
+
+// parameterName returns the name of a "name=value" parameter.
+func parameterName(param string) string {
+	if i := strings.IndexByte(param, '='); i >= 0 {
+		return param[:i]
+	}
+	return param
+}
+
+// aggregate returns the aggregate for a parameter name, creating it if needed.
+func (a *ParameterAggregator) aggregate(name string) *parameterAggregate {
+	a.mu.RLock()
+	agg, ok := a.params[name]
+	a.mu.RUnlock()
+	if ok {
+		return agg
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if agg, ok = a.params[name]; !ok {
+		agg = &parameterAggregate{latencies: newHistogram(latencyHighestTrackable, parameterSignificantFigures)}
+		a.params[name] = agg
+	}
+	return agg
+}
+
+// Record adds the outcome of a request to the aggregate of its parameter.
+func (a *ParameterAggregator) Record(summary RequestSummary) {
+	a.RecordAs(parameterName(summary.Parameter), summary)
+}
+
+// RecordAs adds the outcome of a request to the aggregate with the given key.
+func (a *ParameterAggregator) RecordAs(key string, summary RequestSummary) {
+	agg := a.aggregate(key)
+
+	atomic.AddInt64(&agg.requests, 1)
+	if summary.ErrorCount > 0 {
+		atomic.AddInt64(&agg.errors, 1)
+		return
+	}
+	agg.latencies.Record(summary.Duration)
+	if summary.BytesIn > 0 {
+		atomic.AddInt64(&agg.bytes, int64(summary.BytesIn))
+		atomic.AddInt64(&agg.bodies, 1)
+	}
+}
+
+// Summaries returns a ParameterSummary per parameter, slowest mean duration first.
+func (a *ParameterAggregator) Summaries() []ParameterSummary {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	summaries := make([]ParameterSummary, 0, len(a.params))
+	for name, agg := range a.params {
+		latency := agg.latencies.Snapshot()
+		summary := ParameterSummary{
+			Parameter:    name,
+			Requests:     atomic.LoadInt64(&agg.requests),
+			Errors:       atomic.LoadInt64(&agg.errors),
+			MeanDuration: latency.Mean,
+			P50Duration:  latency.P50,
+			P95Duration:  latency.P95,
+			P99Duration:  latency.P99,
+		}
+		if summary.Requests > 0 {
+			summary.ErrorRate = float64(summary.Errors) / float64(summary.Requests)
+		}
+		if bodies := atomic.LoadInt64(&agg.bodies); bodies > 0 {
+			summary.MeanSize = int(atomic.LoadInt64(&agg.bytes) / bodies)
+		}
+		summaries = append(summaries, summary)
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].MeanDuration != summaries[j].MeanDuration {
+			return summaries[i].MeanDuration > summaries[j].MeanDuration
+		}
+		return summaries[i].Parameter < summaries[j].Parameter
+	})
+
+	return summaries
+}
+
+// printParameterSummary prints the per-parameter table, slowest mean duration first.
+func printParameterSummary(summaries []ParameterSummary) {
+	printSummaryTable("PARAMETERS", "PARAMETER", summaries)
+}
+
+// printSummaryTable prints a table of aggregated summaries under the given title,
+// labelling the key column with keyLabel.
+func printSummaryTable(title string, keyLabel string, summaries []ParameterSummary) {
+	fmt.Printf("\n--- %s ---\n", title)
+	fmt.Printf("%-24s %9s %8s %10s %10s %10s %10s %10s\n", keyLabel, "REQUESTS", "ERRORS", "MEAN", "P50", "P95", "P99", "MEAN SIZE")
+	for _, s := range summaries {
+		fmt.Printf("%-24s %9d %7.1f%% %10s %10s %10s %10s %10d\n",
+			s.Parameter, s.Requests, 100*s.ErrorRate,
+			s.MeanDuration.Round(time.Millisecond), s.P50Duration.Round(time.Millisecond),
+			s.P95Duration.Round(time.Millisecond), s.P99Duration.Round(time.Millisecond), s.MeanSize)
+	}
+	fmt.Printf("%s\n", strings.Repeat("-", len(title)+8))
+}
+
+// writeParameterSummaryCSV writes the per-parameter table to a CSV file.
+func writeParameterSummaryCSV(path string, summaries []ParameterSummary) error {
+	file, err := os.Create(path)
+	if err != nil {
+		slog.Error("Error in writeParameterSummaryCSV", "component", componentOutput, "error", err)
+		return fmt.Errorf("Failed to create parameter summary file: %w", err)
+	}
+	// Ensure the file is closed after the function returns
+	defer func() {
+		if cerr := file.Close(); cerr != nil {
+			slog.Error("Failed to close parameter summary file", "component", componentOutput, "error", cerr)
+		}
+	}()
+
+	w := csv.NewWriter(file)
+	records := [][]string{{"parameter", "requests", "errors", "error_rate", "mean_ms", "p50_ms", "p95_ms", "p99_ms", "mean_size"}}
+	for _, s := range summaries {
+		records = append(records, []string{
+			s.Parameter,
+			strconv.FormatInt(s.Requests, 10),
+			strconv.FormatInt(s.Errors, 10),
+			strconv.FormatFloat(s.ErrorRate, 'f', 4, 64),
+			formatMillis(s.MeanDuration),
+			formatMillis(s.P50Duration),
+			formatMillis(s.P95Duration),
+			formatMillis(s.P99Duration),
+			strconv.Itoa(s.MeanSize),
+		})
+	}
+	if err := w.WriteAll(records); err != nil {
+		slog.Error("Error in writeParameterSummaryCSV", "component", componentOutput, "error", err)
+		return fmt.Errorf("Failed to write parameter summary file: %w", err)
+	}
+
+	return nil
+}
+
+// formatMillis formats a duration as fractional milliseconds.
+func formatMillis(d time.Duration) string {
+	return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64)
+}
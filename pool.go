@@ -0,0 +1,189 @@
+// pool.go contains the proxy pool, which hands out healthy proxies through a ProxyBalancer,
+// and the pool maintainer, which keeps the pool topped up with validated proxies
+// for the lifetime of the run and replaces proxies that die.
+
+package main
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// validatingProxies is the number of proxy validations currently in flight
+var validatingProxies int64
+
+// activeProxies holds the proxies that are validated and in circulation, so they are not validated twice
+var activeProxies sync.Map
+
+// ProxyPool holds the healthy proxies and hands them out to threads through a ProxyBalancer.
+// It is safe for concurrent use.
+type ProxyPool struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	balancer ProxyBalancer
+}
+
+// newProxyPool creates a proxy pool that selects proxies with the given balancing strategy.
+// If shared is false, threads wait for a proxy no other thread is using.
+// It returns an error if the strategy is unknown.
+func newProxyPool(strategy string, shared bool) (*ProxyPool, error) {
+	balancer, err := newProxyBalancer(strategy, shared)
+	if err != nil {
+		return nil, err
+	}
+	pool := &ProxyPool{balancer: balancer}
+	pool.cond = sync.NewCond(&pool.mu)
+	return pool, nil
+}
+
+// Add adds a healthy proxy to the pool and wakes up a thread waiting for one.
+func (p *ProxyPool) Add(proxy string) {
+	p.mu.Lock()
+	p.balancer.Add(proxy)
+	p.mu.Unlock()
+	p.cond.Signal()
+}
+
+// Acquire selects a proxy for the next batch of requests, waiting until one is available.
+// rng is the calling thread's random source, used by the randomized strategies.
+// It returns false if ctx is cancelled while waiting.
+func (p *ProxyPool) Acquire(ctx context.Context, rng *rand.Rand) (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for ctx.Err() == nil {
+		if proxy, ok := p.balancer.Next(rng); ok {
+			return proxy, true
+		}
+		p.cond.Wait()
+	}
+	return "", false
+}
+
+// WakeAll wakes up every thread waiting for a proxy, so they notice that the run is stopped.
+func (p *ProxyPool) WakeAll() {
+	p.mu.Lock()
+	p.cond.Broadcast()
+	p.mu.Unlock()
+}
+
+// Observe records the outcome of a single request sent through a proxy.
+func (p *ProxyPool) Observe(proxy string, latency time.Duration, ok bool) {
+	p.mu.Lock()
+	p.balancer.Observe(proxy, latency, ok)
+	p.mu.Unlock()
+}
+
+// Release marks a batch of requests sent through a proxy as finished and wakes up a thread waiting for one.
+func (p *ProxyPool) Release(proxy string) {
+	p.mu.Lock()
+	p.balancer.Release(proxy)
+	p.mu.Unlock()
+	p.cond.Signal()
+}
+
+// Remove removes a proxy from the pool.
+// It returns false if the proxy was not in the pool, for example because another thread already removed it.
+func (p *ProxyPool) Remove(proxy string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	before := p.balancer.Len()
+	p.balancer.Remove(proxy)
+	return p.balancer.Len() < before
+}
+
+// Len returns the number of healthy proxies in the pool.
+func (p *ProxyPool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.balancer.Len()
+}
+
+// maintainProxyPool keeps the proxies pool topped up to proxyPoolTarget healthy proxies.
+// Every poolCheckInterval it starts a validation for each missing proxy, and warns if the pool is below proxyPoolFloor.
+// Validated proxies are added to the proxies pool. It returns once ctx is cancelled.
+func maintainProxyPool(ctx context.Context, collector *StatsCollector, proxiesLogger *log.Logger) {
+	ticker := time.NewTicker(poolCheckInterval)
+	defer ticker.Stop()
+
+	target := int64(proxyPoolTarget)
+	monitor := newPoolFloorMonitor(proxyPoolFloor)
+
+	for {
+		healthy := proxiesPool.Len()
+		monitor.Check(healthy, proxiesLogger)
+
+		missing := target - int64(healthy) - atomic.LoadInt64(&validatingProxies)
+		for i := int64(0); i < missing; i++ {
+			atomic.AddInt64(&validatingProxies, 1)
+			go func() {
+				defer atomic.AddInt64(&validatingProxies, -1)
+
+				proxy, ok := validateProxy(ctx, collector, proxiesLogger)
+				if !ok {
+					return
+				}
+				proxiesPool.Add(proxy)
+			}()
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// validateProxy picks a random proxy that is not already in circulation and tests it.
+// The outcome is counted in collector.
+// It returns the proxy and true if the proxy works, and false otherwise or if ctx is cancelled during the test.
+func validateProxy(ctx context.Context, collector *StatsCollector, proxiesLogger *log.Logger) (string, bool) {
+	if len(proxies) == 0 {
+		return "", false
+	}
+	proxy := proxies[runRand.Intn(len(proxies))]
+
+	// Check that the proxy is not already in circulation
+	if _, exists := activeProxies.LoadOrStore(proxy, true); exists {
+		return "", false
+	}
+
+	// Test the proxy
+	client, err := createProxyClient(proxy)
+	if err != nil || !testProxy(ctx, client, proxy, proxiesLogger) {
+		collector.Add(0, CounterProxyFailures, 1)
+		activeProxies.Delete(proxy)
+		discardProxyClient(proxy)
+		publishProxyEvent(proxy, "failed_validation")
+		return "", false
+	}
+
+	collector.Add(0, CounterProxySuccesses, 1)
+	publishProxyEvent(proxy, "validated")
+	return proxy, true
+}
+
+// releaseProxy returns a proxy to the proxies pool after a batch of requests.
+// If the proxy is no longer healthy, it is retired instead.
+func releaseProxy(proxy string, healthy bool, proxiesLogger *log.Logger) {
+	proxiesPool.Release(proxy)
+	if !healthy {
+		retireProxy(proxy, proxiesLogger)
+	}
+}
+
+// retireProxy removes a dead proxy from circulation so that the pool maintainer replaces it.
+// The proxy may be validated again later if it comes back.
+func retireProxy(proxy string, proxiesLogger *log.Logger) {
+	if !proxiesPool.Remove(proxy) {
+		return
+	}
+	logProxyError(proxiesLogger, proxy, "Retiring proxy %s", proxy)
+	activeProxies.Delete(proxy)
+	discardProxyClient(proxy)
+	publishProxyEvent(proxy, "retired")
+}
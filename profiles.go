@@ -0,0 +1,103 @@
+// profiles.go contains the header profiles that make requests look like they come from a real browser.
+// A profile sets a coherent User-Agent, Accept, Accept-Language, and Sec-Fetch-* header set; with the "mixed"
+// profile every client is assigned one of the profiles, so the traffic of each proxy stays consistent.
+
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"sort"
+)
+
+// HeaderProfile is a set of request headers sent by one kind of browser.
+type HeaderProfile struct {
+	Name    string
+	Headers [][2]string // Header names and values, in the order the browser sends them
+}
+
+// headerProfileMixed assigns one of the profiles to every client
+const headerProfileMixed = "mixed"
+
+// headerProfiles holds the built-in profiles by name
+var headerProfiles = map[string]*HeaderProfile{
+	"chrome": {
+		Name: "chrome",
+		Headers: [][2]string{
+			{"Sec-Ch-Ua", `"Chromium";v="124", "Google Chrome";v="124", "Not-A.Brand";v="99"`},
+			{"Sec-Ch-Ua-Mobile", "?0"},
+			{"Sec-Ch-Ua-Platform", `"Windows"`},
+			{"Upgrade-Insecure-Requests", "1"},
+			{"User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36"},
+			{"Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7"},
+			{"Sec-Fetch-Site", "none"},
+			{"Sec-Fetch-Mode", "navigate"},
+			{"Sec-Fetch-User", "?1"},
+			{"Sec-Fetch-Dest", "document"},
+			{"Accept-Language", "en-US,en;q=0.9"},
+		},
+	},
+	"firefox": {
+		Name: "firefox",
+		Headers: [][2]string{
+			{"User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:125.0) Gecko/20100101 Firefox/125.0"},
+			{"Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"},
+			{"Accept-Language", "en-US,en;q=0.5"},
+			{"Upgrade-Insecure-Requests", "1"},
+			{"Sec-Fetch-Dest", "document"},
+			{"Sec-Fetch-Mode", "navigate"},
+			{"Sec-Fetch-Site", "none"},
+			{"Sec-Fetch-User", "?1"},
+		},
+	},
+	"mobile": {
+		Name: "mobile",
+		Headers: [][2]string{
+			{"User-Agent", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1"},
+			{"Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"},
+			{"Sec-Fetch-Site", "none"},
+			{"Sec-Fetch-Mode", "navigate"},
+			{"Sec-Fetch-Dest", "document"},
+			{"Accept-Language", "en-GB,en;q=0.9"},
+		},
+	},
+}
+
+// validateHeaderProfile returns an error if headerProfile is neither empty, "mixed", nor a built-in profile.
+func validateHeaderProfile() error {
+	if headerProfile == "" || headerProfile == headerProfileMixed {
+		return nil
+	}
+	if _, ok := headerProfiles[headerProfile]; !ok {
+		return fmt.Errorf("unknown header profile %q", headerProfile)
+	}
+	return nil
+}
+
+// headerProfileFor returns the profile of the client for the given proxy, or nil if no profile is used.
+// With the "mixed" profile, the profile is picked by a hash of the proxy, so a client always sends the same one.
+func headerProfileFor(proxy string) *HeaderProfile {
+	switch headerProfile {
+	case "":
+		return nil
+	case headerProfileMixed:
+		names := make([]string, 0, len(headerProfiles))
+		for name := range headerProfiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		h := fnv.New32a()
+		h.Write([]byte(proxy))
+		return headerProfiles[names[h.Sum32()%uint32(len(names))]]
+	default:
+		return headerProfiles[headerProfile]
+	}
+}
+
+// apply sets the headers of the profile on a request.
+func (p *HeaderProfile) apply(req *http.Request) {
+	for _, header := range p.Headers {
+		req.Header.Set(header[0], header[1])
+	}
+}
@@ -0,0 +1,66 @@
+// protocol.go contains the selection of the HTTP protocol the clients speak: HTTP/1.1 only, HTTP/2 only,
+// or whichever the target negotiates. HTTP/2 is negotiated with ALPN over the connections of the dialers,
+// including the SOCKS dialer, and the protocol of every response is recorded and counted.
+
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// The protocol selections
+const (
+	protocolAuto  = "auto" // Offer HTTP/2 and HTTP/1.1 and use whichever the target picks
+	protocolHTTP1 = "h1"   // Only speak HTTP/1.1
+	protocolHTTP2 = "h2"   // Only speak HTTP/2; connections that do not negotiate it fail
+)
+
+// protocolValues counts the protocols of the responses
+var protocolValues = newFieldTracker("protocol", cardinalityMaxValues)
+
+// validateProtocol returns an error if the -protocol flag is not a known selection,
+// or if it requires HTTP/2 from a target that can only be reached without TLS.
+func validateProtocol() error {
+	switch *protocolFlag {
+	case protocolAuto, protocolHTTP1:
+		return nil
+	case protocolHTTP2:
+		target, err := url.Parse(requestTarget)
+		if err != nil {
+			return fmt.Errorf("Failed to parse target URL: %w", err)
+		}
+		if target.Scheme != "https" {
+			return fmt.Errorf("protocol %s needs an https target, HTTP/2 without TLS is not supported", protocolHTTP2)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown protocol %q", *protocolFlag)
+}
+
+// configureProtocol sets up a transport to speak the selected protocol.
+func configureProtocol(t *http.Transport) {
+	switch *protocolFlag {
+	case protocolHTTP1:
+		// A non-nil, empty TLSNextProto disables HTTP/2
+		t.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	default:
+		// Custom dialers disable HTTP/2 unless it is forced
+		t.ForceAttemptHTTP2 = true
+	}
+}
+
+// requireHTTP2 is a VerifyConnection function that rejects connections that did not negotiate HTTP/2.
+func requireHTTP2(state tls.ConnectionState) error {
+	if state.NegotiatedProtocol != "h2" {
+		return fmt.Errorf("tls: server did not negotiate h2 (negotiated %q)", state.NegotiatedProtocol)
+	}
+	return nil
+}
+
+// printProtocolSummary prints the number of responses per protocol.
+func printProtocolSummary() {
+	printValueCounts("PROTOCOLS", protocolValues, "Requests without a response")
+}
@@ -0,0 +1,139 @@
+// protowire.go contains a minimal encoder and decoder for the protobuf wire format,
+// enough for the flat messages of the gRPC control plane defined in jeet.proto.
+
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"sort"
+)
+
+// The protobuf wire types used by the control plane messages
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// errProtoTruncated is returned when a protobuf message ends in the middle of a field
+var errProtoTruncated = errors.New("truncated protobuf message")
+
+// protoMessage builds an encoded protobuf message. Fields with zero values are omitted, as in proto3.
+type protoMessage []byte
+
+// tag appends the key of a field.
+func (m protoMessage) tag(field int, wireType int) protoMessage {
+	return binary.AppendUvarint(m, uint64(field)<<3|uint64(wireType))
+}
+
+// Int appends an int32 or int64 field.
+func (m protoMessage) Int(field int, v int64) protoMessage {
+	if v == 0 {
+		return m
+	}
+	return binary.AppendUvarint(m.tag(field, wireVarint), uint64(v))
+}
+
+// Bool appends a bool field.
+func (m protoMessage) Bool(field int, v bool) protoMessage {
+	if !v {
+		return m
+	}
+	return binary.AppendUvarint(m.tag(field, wireVarint), 1)
+}
+
+// Double appends a double field.
+func (m protoMessage) Double(field int, v float64) protoMessage {
+	if v == 0 {
+		return m
+	}
+	return binary.LittleEndian.AppendUint64(m.tag(field, wireFixed64), math.Float64bits(v))
+}
+
+// String appends a string field.
+func (m protoMessage) String(field int, v string) protoMessage {
+	if v == "" {
+		return m
+	}
+	return m.Bytes(field, []byte(v))
+}
+
+// Bytes appends a length-delimited field, which also holds embedded messages.
+func (m protoMessage) Bytes(field int, v []byte) protoMessage {
+	m = binary.AppendUvarint(m.tag(field, wireBytes), uint64(len(v)))
+	return append(m, v...)
+}
+
+// Counts appends a map<string, int64> field, one entry per key in ascending key order.
+func (m protoMessage) Counts(field int, counts map[string]int64) protoMessage {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		m = m.Bytes(field, protoMessage{}.String(1, key).Int(2, counts[key]))
+	}
+	return m
+}
+
+// protoFields holds the scalar fields of a decoded protobuf message, by field number.
+// Varint fields hold their raw value, fixed fields their bits, and length-delimited fields are dropped.
+type protoFields map[int]uint64
+
+// decodeProtoFields decodes the scalar fields of a protobuf message. Later occurrences of a field win.
+func decodeProtoFields(data []byte) (protoFields, error) {
+	fields := make(protoFields)
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, errProtoTruncated
+		}
+		data = data[n:]
+		field := int(key >> 3)
+
+		switch key & 7 {
+		case wireVarint:
+			v, n := binary.Uvarint(data)
+			if n <= 0 {
+				return nil, errProtoTruncated
+			}
+			fields[field] = v
+			data = data[n:]
+		case wireFixed64:
+			if len(data) < 8 {
+				return nil, errProtoTruncated
+			}
+			fields[field] = binary.LittleEndian.Uint64(data)
+			data = data[8:]
+		case wireFixed32:
+			if len(data) < 4 {
+				return nil, errProtoTruncated
+			}
+			fields[field] = uint64(binary.LittleEndian.Uint32(data))
+			data = data[4:]
+		case wireBytes:
+			length, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < length {
+				return nil, errProtoTruncated
+			}
+			data = data[n+int(length):]
+		default:
+			return nil, errors.New("unsupported protobuf wire type")
+		}
+	}
+	return fields, nil
+}
+
+// Int returns an int32 or int64 field, or 0 if it is missing.
+func (f protoFields) Int(field int) int64 {
+	return int64(f[field])
+}
+
+// Double returns a double field, or 0 if it is missing.
+func (f protoFields) Double(field int) float64 {
+	return math.Float64frombits(f[field])
+}
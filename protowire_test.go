@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// protoGolden decodes the hex fields of a golden encoding, ignoring the spaces between them.
+func protoGolden(t *testing.T, fields ...string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(strings.ReplaceAll(strings.Join(fields, ""), " ", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestProtoMessageEncoding(t *testing.T) {
+	tests := []struct {
+		name    string
+		message protoMessage
+		want    []string // Golden hex fields of the message
+	}{
+		{"zero values omitted", protoMessage{}.Int(1, 0).Bool(2, false).Double(3, 0).String(4, ""), nil},
+		{"int", protoMessage{}.Int(1, 150), []string{"08 9601"}},
+		{"negative int", protoMessage{}.Int(2, -1), []string{"10 ffffffffffffffffff01"}},
+		{"bool", protoMessage{}.Bool(5, true), []string{"28 01"}},
+		{"double", protoMessage{}.Double(4, 1.5), []string{"21 000000000000f83f"}},
+		{"string", protoMessage{}.String(2, "testing"), []string{"12 07 74657374696e67"}},
+		{"empty bytes kept", protoMessage{}.Bytes(7, nil), []string{"3a 00"}},
+		{"embedded message", protoMessage{}.Bytes(3, protoMessage{}.Int(1, 150)), []string{"1a 03 089601"}},
+		{"field number above 15", protoMessage{}.Int(16, 1), []string{"8001 01"}},
+		{
+			"counts in key order",
+			protoMessage{}.Counts(8, map[string]int64{"b": 2, "a": 1}),
+			[]string{"42 05 0a0161 1001", "42 05 0a0162 1002"},
+		},
+		{"count of zero", protoMessage{}.Counts(9, map[string]int64{"x": 0}), []string{"4a 03 0a0178"}},
+		{"fields in call order", protoMessage{}.Int(2, 1).Int(1, 2), []string{"10 01", "08 02"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := protoGolden(t, tt.want...)
+			if got := []byte(tt.message); !bytes.Equal(got, want) {
+				t.Errorf("encoded %x, want %x", got, want)
+			}
+		})
+	}
+}
+
+func TestDecodeProtoFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []string // Golden hex fields of the message
+		want    protoFields
+		wantErr bool
+	}{
+		{"empty", nil, protoFields{}, false},
+		{"varint", []string{"08 9601"}, protoFields{1: 150}, false},
+		{"negative int", []string{"10 ffffffffffffffffff01"}, protoFields{2: 1<<64 - 1}, false},
+		{"double bits", []string{"21 000000000000f83f"}, protoFields{4: 0x3ff8000000000000}, false},
+		{"fixed32", []string{"2d 01000000"}, protoFields{5: 1}, false},
+		{"length-delimited dropped", []string{"12 07 74657374696e67", "08 01"}, protoFields{1: 1}, false},
+		{"later occurrence wins", []string{"08 01", "08 02"}, protoFields{1: 2}, false},
+		{"truncated key", []string{"80"}, nil, true},
+		{"truncated varint", []string{"08 96"}, nil, true},
+		{"truncated fixed64", []string{"21 0000"}, nil, true},
+		{"truncated fixed32", []string{"2d 00"}, nil, true},
+		{"truncated bytes", []string{"12 07 7465"}, nil, true},
+		{"unsupported wire type", []string{"0b"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeProtoFields(protoGolden(t, tt.data...))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeProtoFields() error = %v, wantErr %t", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeProtoFields() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProtoRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		int    int64
+		double float64
+	}{
+		{"zero", 0, 0},
+		{"positive", 500, 2.5},
+		{"negative", -3, -0.125},
+		{"large", 1 << 62, 1e300},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields, err := decodeProtoFields(protoMessage{}.Int(1, tt.int).Double(2, tt.double).String(3, "ignored"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := fields.Int(1); got != tt.int {
+				t.Errorf("Int(1) = %d, want %d", got, tt.int)
+			}
+			if got := fields.Double(2); got != tt.double {
+				t.Errorf("Double(2) = %g, want %g", got, tt.double)
+			}
+		})
+	}
+}
+
+func TestEncodeRunState(t *testing.T) {
+	tests := []struct {
+		name  string
+		state RunState
+		want  []string // Golden hex fields of the RunState message
+	}{
+		{"zero", RunState{}, nil},
+		{
+			"running",
+			RunState{Threads: 500, Running: 3, RPS: 2.5},
+			[]string{"10 f403", "18 03", "21 0000000000000440"},
+		},
+		{
+			"paused and stopping",
+			RunState{Paused: true, Threads: 1, Running: 1, Stopping: true},
+			[]string{"08 01", "10 01", "18 01", "28 01"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := protoGolden(t, tt.want...)
+			if got := []byte(encodeRunState(tt.state)); !bytes.Equal(got, want) {
+				t.Errorf("encodeRunState(%+v) = %x, want %x", tt.state, got, want)
+			}
+		})
+	}
+}
+
+func TestReadGRPCMessage(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    []string // Golden hex fields of the request body
+		want    protoFields
+		wantErr bool
+	}{
+		{"no message", nil, protoFields{}, false},
+		{"empty message", []string{"00 00000000"}, protoFields{}, false},
+		{"message", []string{"00 00000009", "21 000000000000f83f"}, protoFields{4: 0x3ff8000000000000}, false},
+		{"compressed", []string{"01 00000002", "0801"}, nil, true},
+		{"too large", []string{"00 00010001"}, nil, true},
+		{"truncated prefix", []string{"00 0000"}, nil, true},
+		{"truncated message", []string{"00 00000005", "0801"}, nil, true},
+		{"malformed message", []string{"00 00000001", "08"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readGRPCMessage(bytes.NewReader(protoGolden(t, tt.body...)))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readGRPCMessage() error = %v, wantErr %t", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readGRPCMessage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteGRPCMessage(t *testing.T) {
+	tests := []struct {
+		name    string
+		message protoMessage
+		want    []string // Golden hex fields of the response body
+	}{
+		{"empty", protoMessage{}, []string{"00 00000000"}},
+		{"run state", encodeRunState(RunState{Threads: 500}), []string{"00 00000003", "10 f403"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			if err := writeGRPCMessage(w, tt.message); err != nil {
+				t.Fatal(err)
+			}
+			want := protoGolden(t, tt.want...)
+			if got := w.Body.Bytes(); !bytes.Equal(got, want) {
+				t.Errorf("writeGRPCMessage() wrote %x, want %x", got, want)
+			}
+			if !w.Flushed {
+				t.Errorf("writeGRPCMessage() did not flush the message")
+			}
+		})
+	}
+}
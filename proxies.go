@@ -5,6 +5,7 @@ package main
 import (
 	"fmt"
 	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
 )
@@ -19,22 +20,22 @@ import (
 func setupProxiesLogger(proxiesLogPath string) (*log.Logger, error) {
 	// Check if proxies log file path is valid
 	if !filepath.IsAbs(proxiesLogPath) {
-		log.Printf("Error in setupProxiesLogger: proxies log file path is not an absolute path: %s", proxiesLogPath)
+		slog.Error("Error in setupProxiesLogger: proxies log file path is not an absolute path", "component", componentMain, "path", proxiesLogPath)
 		return nil, fmt.Errorf("proxies log file path is not an absolute path: %s", proxiesLogPath)
 	}
 
 	// Open or create the proxies log file
-	proxiesLogFile, err := os.OpenFile(proxiesLogPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	proxiesLogFile, err := openRotatingFile(proxiesLogPath)
 	if err != nil {
 		// Distinguish between different kinds of errors for better error handling
 		if os.IsPermission(err) {
-			log.Printf("Error in setupProxiesLogger: permission denied while trying to open proxies log file: %v", err)
+			slog.Error("Error in setupProxiesLogger: permission denied while trying to open proxies log file", "component", componentMain, "error", err)
 			return nil, fmt.Errorf("permission denied while trying to open proxies log file: %w", err)
 		} else if os.IsNotExist(err) {
-			log.Printf("Error in setupProxiesLogger: proxies log file does not exist: %v", err)
+			slog.Error("Error in setupProxiesLogger: proxies log file does not exist", "component", componentMain, "error", err)
 			return nil, fmt.Errorf("proxies log file does not exist: %w", err)
 		} else {
-			log.Printf("Error in setupProxiesLogger: failed to open proxies log file: %v", err)
+			slog.Error("Error in setupProxiesLogger: failed to open proxies log file", "component", componentMain, "error", err)
 			return nil, fmt.Errorf("failed to open proxies log file: %w", err)
 		}
 	}
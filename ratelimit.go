@@ -0,0 +1,75 @@
+// ratelimit.go contains the per-thread and per-proxy rate limits, which space the requests of a single thread
+// or a single proxy, so individual exit IPs stay under the target's per-IP limits while the aggregate load stays high.
+
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// proxyPacers holds the pacer of every proxy when perProxyRPS is set
+var proxyPacers sync.Map
+
+// pacer spaces events at a fixed rate. A nil pacer does not limit.
+// It is safe for concurrent use.
+type pacer struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// newPacer creates a pacer for the given events per second, or returns nil if rps is not positive.
+func newPacer(rps float64) *pacer {
+	if rps <= 0 {
+		return nil
+	}
+	return &pacer{interval: time.Duration(float64(time.Second) / rps)}
+}
+
+// Wait waits for the next slot. It returns false if ctx is cancelled while waiting.
+func (p *pacer) Wait(ctx context.Context) bool {
+	if p == nil {
+		return true
+	}
+
+	p.mu.Lock()
+	now := time.Now()
+	if p.next.Before(now) {
+		p.next = now
+	}
+	wait := p.next.Sub(now)
+	p.next = p.next.Add(p.interval)
+	p.mu.Unlock()
+
+	if wait <= 0 {
+		return true
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// proxyPacer returns the pacer of a proxy, or nil if perProxyRPS is not set.
+func proxyPacer(proxy string) *pacer {
+	if perProxyRPS <= 0 || proxy == "" {
+		return nil
+	}
+	if p, ok := proxyPacers.Load(proxy); ok {
+		return p.(*pacer)
+	}
+	p, _ := proxyPacers.LoadOrStore(proxy, newPacer(perProxyRPS))
+	return p.(*pacer)
+}
+
+// waitForRateLimits waits until both the thread's pacer and the proxy's pacer allow the next request.
+// It returns false if ctx is cancelled while waiting.
+func waitForRateLimits(ctx context.Context, threadPacer *pacer, proxy string) bool {
+	return threadPacer.Wait(ctx) && proxyPacer(proxy).Wait(ctx)
+}
@@ -0,0 +1,64 @@
+// redirect.go contains the redirect policy of the HTTP clients: redirects are followed up to maxRedirects,
+// never followed, in which case the redirect response itself is the outcome of the request,
+// or followed with the status and location of every hop recorded with the request.
+// Every redirect followed is counted, so the stats show how much of the traffic was redirected.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// The redirect policies
+const (
+	redirectFollow = "follow" // Follow up to maxRedirects redirects
+	redirectNever  = "never"  // Never follow redirects
+	redirectRecord = "record" // Follow up to maxRedirects redirects and record every hop
+)
+
+// RedirectHop is a redirect followed by a request.
+type RedirectHop struct {
+	StatusCode int    `json:"status"`
+	Location   string `json:"location"`
+}
+
+// redirectHopsKey is the context key of the hops recorded for a request
+type redirectHopsKey struct{}
+
+// validateRedirectPolicy returns an error if redirectPolicy is not a known policy.
+func validateRedirectPolicy() error {
+	switch redirectPolicy {
+	case redirectFollow, redirectNever, redirectRecord:
+		return nil
+	}
+	return fmt.Errorf("unknown redirect policy %q", redirectPolicy)
+}
+
+// withRedirectHops returns a context that collects the redirects followed by a request into hops,
+// if redirectPolicy records them, and ctx otherwise.
+func withRedirectHops(ctx context.Context, hops *[]RedirectHop) context.Context {
+	if redirectPolicy != redirectRecord {
+		return ctx
+	}
+	return context.WithValue(ctx, redirectHopsKey{}, hops)
+}
+
+// checkRedirect is the CheckRedirect function of the HTTP clients. It is called before every redirect is followed,
+// with the request for the redirect target and the requests made so far, oldest first.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if redirectPolicy == redirectNever {
+		return http.ErrUseLastResponse
+	}
+	if len(via) > maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+
+	countInContext(req.Context(), CounterRedirects)
+	if hops, ok := req.Context().Value(redirectHopsKey{}).(*[]RedirectHop); ok && req.Response != nil {
+		*hops = append(*hops, RedirectHop{StatusCode: req.Response.StatusCode, Location: req.URL.String()})
+	}
+
+	return nil
+}
@@ -0,0 +1,225 @@
+// report.go contains the end-of-run summary report, which captures the run configuration
+// and the final totals, throughput, latency percentiles, and breakdowns of the whole run.
+
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// RunConfig is the configuration a run was started with.
+type RunConfig struct {
+	BaseURL           string
+	Threads           int
+	RequestsPerThread int
+	RunIndefinitely   bool
+	UseProxy          bool
+	ProxyBalancing    string
+	ClientTimeout     time.Duration
+	FireAndForget     bool
+	HeadersOnly       bool
+	DiscardBodies     bool
+	HeaderProfile     string
+	Protocol          string
+	ConnectionMode    string
+	AcceptEncoding    string
+	DecompressBodies  bool
+	Seed              int64
+}
+
+// RunReport is the summary of a whole run.
+type RunReport struct {
+	Config         RunConfig
+	StartTime      time.Time
+	EndTime        time.Time
+	Duration       time.Duration
+	Stats          StatsSnapshot
+	Throughput     float64 // Requests per second over the whole run
+	Latency        LatencySnapshot
+	HealthyProxies int
+	ProxiesLoaded  int
+	UniqueIPs      int
+	Parameters     []ParameterSummary
+	Memory         MemoryStats
+	DroppedLogs    int64 // Log records dropped because the log queue was full
+	ParamsCovered  int64 // Parameters sent at least once
+	ParamsTotal    int   // Parameters the run could pick from
+}
+
+// currentRunConfig returns the configuration of the current run.
+func currentRunConfig() RunConfig {
+	return RunConfig{
+		BaseURL:           baseUrl,
+		Threads:           numOfThreads,
+		RequestsPerThread: numOfRequests,
+		RunIndefinitely:   runIndefinitely,
+		UseProxy:          useProxy,
+		ProxyBalancing:    proxyBalancing,
+		ClientTimeout:     *requestTimeoutFlag,
+		FireAndForget:     fireAndForget,
+		HeadersOnly:       headersOnly,
+		DiscardBodies:     discardBodies,
+		HeaderProfile:     headerProfile,
+		Protocol:          *protocolFlag,
+		ConnectionMode:    *connectionModeFlag,
+		AcceptEncoding:    requestAcceptEncoding(),
+		DecompressBodies:  decompressBodies,
+		Seed:              runSeed,
+	}
+}
+
+// buildRunReport collects the final stats of the run that started at start and ended at end.
+func buildRunReport(collector *StatsCollector, start, end time.Time) RunReport {
+	report := RunReport{
+		Config:         currentRunConfig(),
+		StartTime:      start,
+		EndTime:        end,
+		Duration:       end.Sub(start),
+		Stats:          collector.Snapshot(),
+		Latency:        latencies.Snapshot(),
+		HealthyProxies: proxiesPool.Len(),
+		ProxiesLoaded:  len(proxies),
+		UniqueIPs:      countUniqueIPs(),
+		Parameters:     parameterStats.Summaries(),
+		Memory:         currentMemoryStats(collector),
+		DroppedLogs:    atomic.LoadInt64(&droppedLogRecords),
+	}
+	report.ParamsCovered, report.ParamsTotal = parameterCoverage()
+	if seconds := report.Duration.Seconds(); seconds > 0 {
+		report.Throughput = float64(report.Stats.Requests) / seconds
+	}
+
+	return report
+}
+
+// printRunReport prints the end-of-run summary report.
+func printRunReport(report RunReport) {
+	fmt.Printf("\n=== RUN SUMMARY ===\n")
+
+	fmt.Printf("\n--- CONFIGURATION ---\n")
+	fmt.Printf("Base URL: %s\n", report.Config.BaseURL)
+	fmt.Printf("Threads: %d\n", report.Config.Threads)
+	fmt.Printf("Requests per thread: %d\n", report.Config.RequestsPerThread)
+	fmt.Printf("Run indefinitely: %t\n", report.Config.RunIndefinitely)
+	fmt.Printf("Use proxy: %t (balancing: %s)\n", report.Config.UseProxy, report.Config.ProxyBalancing)
+	fmt.Printf("Client timeout: %s\n", report.Config.ClientTimeout)
+	fmt.Printf("Fire and forget: %t, headers only: %t, discard bodies: %t\n", report.Config.FireAndForget, report.Config.HeadersOnly, report.Config.DiscardBodies)
+	fmt.Printf("Protocol: %s, header profile: %q, Accept-Encoding: %q, decompress bodies: %t\n", report.Config.Protocol, report.Config.HeaderProfile, report.Config.AcceptEncoding, report.Config.DecompressBodies)
+	fmt.Printf("Connection mode: %s\n", report.Config.ConnectionMode)
+	fmt.Printf("Seed: %d\n", report.Config.Seed)
+
+	fmt.Printf("\n--- TOTALS ---\n")
+	fmt.Printf("Started: %s\n", report.StartTime.Format(time.RFC3339))
+	fmt.Printf("Duration: %s\n", report.Duration.Round(time.Millisecond))
+	fmt.Printf("Total requests: %d\n", report.Stats.Requests)
+	fmt.Printf("Success count: %d\n", report.Stats.Successes)
+	fmt.Printf("Failure count: %d\n", report.Stats.Failures)
+	if report.Stats.HeadersOnly > 0 {
+		fmt.Printf("Headers-only responses: %d\n", report.Stats.HeadersOnly)
+	}
+	fmt.Printf("Throughput: %.1f requests/s\n", report.Throughput)
+	fmt.Printf("Bytes received: %d (%s)\n", report.Stats.BytesIn, formatBytes(report.Stats.BytesIn))
+	if report.Stats.WireBytes != report.Stats.BytesIn {
+		fmt.Printf("Bytes on the wire: %d (%s)\n", report.Stats.WireBytes, formatBytes(report.Stats.WireBytes))
+	}
+	if lookups := report.Stats.DNSCacheHits + report.Stats.DNSCacheMisses; lookups > 0 {
+		fmt.Printf("DNS cache: %d hits, %d misses (%.1f%% hit rate)\n", report.Stats.DNSCacheHits, report.Stats.DNSCacheMisses,
+			100*float64(report.Stats.DNSCacheHits)/float64(lookups))
+	}
+	printRetrySummary(report.Stats)
+	if report.ParamsTotal > 0 {
+		fmt.Printf("Parameter coverage: %d/%d parameters sent at least once (%.1f%%, %s order)\n", report.ParamsCovered, report.ParamsTotal,
+			100*float64(report.ParamsCovered)/float64(report.ParamsTotal), parameterOrder)
+	}
+	if report.Stats.SlowRequests > 0 {
+		fmt.Printf("Slow requests: %d (over %s, logged with their phases)\n", report.Stats.SlowRequests, *slowThresholdFlag)
+	}
+	if report.DroppedLogs > 0 {
+		fmt.Printf("Log records dropped: %d (log queue full)\n", report.DroppedLogs)
+	}
+	if report.Stats.Redirects > 0 {
+		fmt.Printf("Redirects followed: %d\n", report.Stats.Redirects)
+	}
+	if report.Stats.Truncated > 0 {
+		fmt.Printf("Truncated bodies: %d (cut off at %s)\n", report.Stats.Truncated, formatBytes(maxBodySize))
+	}
+
+	printLatencySummary(report.Latency)
+	printStatusSummary(report.Stats.StatusCodes)
+	printErrorSummary(report.Stats.ErrorClasses)
+	printMemorySummary(report.Memory, report.Stats.Successes-report.Stats.HeadersOnly)
+
+	if !report.Config.UseProxy {
+		fmt.Printf("\n--- DIRECT CONNECTION ---\n")
+		fmt.Printf("Connections dialed: %d\n", report.Stats.DirectDials)
+		if report.Stats.DirectDials > 0 {
+			fmt.Printf("Requests per connection: %.1f\n", float64(report.Stats.Requests)/float64(report.Stats.DirectDials))
+		}
+		fmt.Printf("------------------\n")
+		return
+	}
+
+	fmt.Printf("\n--- PROXY POOL ---\n")
+	fmt.Printf("Proxies loaded: %d\n", report.ProxiesLoaded)
+	fmt.Printf("Healthy proxies at end: %d\n", report.HealthyProxies)
+	fmt.Printf("Successful proxy connections: %d\n", report.Stats.ProxySuccesses)
+	fmt.Printf("Failed proxy connections: %d\n", report.Stats.ProxyFailures)
+	fmt.Printf("Unique IPs: %d\n", report.UniqueIPs)
+	fmt.Printf("------------------\n")
+}
+
+// printLatencySummary prints the latency percentiles over the whole run.
+func printLatencySummary(snapshot LatencySnapshot) {
+	fmt.Printf("\n--- LATENCY ---\n")
+	fmt.Printf("Requests measured: %d\n", snapshot.Count)
+	fmt.Printf("Min: %s\n", snapshot.Min)
+	fmt.Printf("Mean: %s\n", snapshot.Mean)
+	fmt.Printf("p50: %s\n", snapshot.P50)
+	fmt.Printf("p90: %s\n", snapshot.P90)
+	fmt.Printf("p95: %s\n", snapshot.P95)
+	fmt.Printf("p99: %s\n", snapshot.P99)
+	fmt.Printf("Max: %s\n", snapshot.Max)
+}
+
+// printStatusSummary prints the distribution of response status codes over the whole run.
+func printStatusSummary(statuses StatusCounts) {
+	var total int64
+	for _, count := range statuses {
+		total += count
+	}
+
+	fmt.Printf("\n--- STATUS CODES ---\n")
+	for _, code := range statuses.Codes() {
+		label := fmt.Sprint(code)
+		if code == 0 {
+			label = "other"
+		}
+		fmt.Printf("%s: %d (%.1f%%)\n", label, statuses[code], 100*float64(statuses[code])/float64(total))
+	}
+}
+
+// printErrorSummary prints the number of failures per error class over the whole run.
+func printErrorSummary(errorClasses ErrorCounts) {
+	fmt.Printf("\n--- ERRORS ---\n")
+	for class, count := range errorClasses {
+		if count > 0 {
+			fmt.Printf("%s: %d\n", ErrorClass(class), count)
+		}
+	}
+}
+
+// formatBytes formats a byte count with a binary unit.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -6,30 +6,51 @@ package main
 import (
 	"bufio"
 	"fmt"
-	"log"
+	"log/slog"
 	"math/rand"
 	"os"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
 
 // RequestSummary represents the summary of a request.
 type RequestSummary struct {
-	Parameter  string
-	BytesIn    int
-	Duration   time.Duration
-	ErrorCount int
+	Timestamp     time.Time
+	RequestID     string // Unique ID of the request, sent in requestIDHeader
+	Parameter     string
+	Proxy         string
+	StatusCode    int
+	BytesIn       int    // Body bytes read, after decompression
+	WireBytes     int    // Body bytes received on the wire, before decompression
+	Protocol      string // Protocol of the response, e.g. "HTTP/2.0"
+	AddressFamily string // Address family of the connection, ipv4 or ipv6; for proxied requests that of the proxy
+	Duration      time.Duration
+	ErrorCount    int
+	Retries       int // Times the request was sent again after failing without a response
+	ErrorClass    ErrorClass
+	Truncated     bool              // The body was cut off at maxBodySize
+	Headers       map[string]string // Values of the tracked response headers the response had
+	Redirects     []RedirectHop     // Redirects followed, if redirectPolicy records them
+	Phases        *RequestPhases    // Times of the connection and exchange phases, if slow requests are logged
 }
 
 // ParameterSummary represents the summary of a parameter.
 type ParameterSummary struct {
 	Parameter    string
+	Requests     int64
+	Errors       int64
+	ErrorRate    float64
 	MeanDuration time.Duration
+	P50Duration  time.Duration
+	P95Duration  time.Duration
+	P99Duration  time.Duration
 	MeanSize     int
 }
 
-// rng generates a random number as a string.
-func rng(args ...int) string {
+// rng generates a random number as a string using the given random number generator.
+func rng(r *rand.Rand, args ...int) string {
 	var min int
 	var max int
 
@@ -41,24 +62,25 @@ func rng(args ...int) string {
 		max = 1000000
 	}
 
-	return fmt.Sprintf("%d", rand.Intn(max-min+1)+min)
+	return fmt.Sprintf("%d", r.Intn(max-min+1)+min)
 }
 
 // loadProxies loads the proxies from the proxies file in parallel.
 // It reads the proxies from a file and sends them to a channel.
+// Each line may carry an optional weight for the weighted balancing strategy.
 // Another goroutine receives the proxies from the channel and adds them to the proxies slice.
 // If no proxies are found in the file, it returns an error.
 func loadProxies() error {
 	// Open the proxies file
 	file, err := os.Open(proxiesFile)
 	if err != nil {
-		log.Printf("Error in loadProxies: %v", err)
+		slog.Error("Error in loadProxies", "component", componentInput, "error", err)
 		return fmt.Errorf("Failed to open proxies file: %w", err)
 	}
 	// Ensure the file is closed after the function returns
 	defer func() {
 		if cerr := file.Close(); cerr != nil {
-			log.Printf("Failed to close proxies file: %s", cerr)
+			slog.Error("Failed to close proxies file", "component", componentInput, "error", cerr)
 		}
 	}()
 
@@ -80,8 +102,15 @@ func loadProxies() error {
 
 	// Start another goroutine to receive proxies from the channel and add them to the proxies slice
 	go func() {
-		for proxy := range proxyChan {
+		for line := range proxyChan {
+			proxy, weight, ok := parseProxyLine(line)
+			if !ok {
+				continue
+			}
 			proxies = append(proxies, proxy)
+			if weight != 1 {
+				proxyWeights[proxy] = weight
+			}
 		}
 		wg.Done() // This goroutine is done
 	}()
@@ -90,24 +119,51 @@ func loadProxies() error {
 
 	// If no proxies were found in the file, return an error
 	if len(proxies) == 0 {
-		log.Printf("Error in loadProxies: No proxies found in the file")
+		slog.Error("Error in loadProxies: No proxies found in the file", "component", componentInput, "file", proxiesFile)
 		return fmt.Errorf("No proxies found in the file")
 	}
 
 	return nil
 }
 
+// parseProxyLine parses a line of the proxies file.
+// A line holds a proxy, optionally followed by whitespace and a positive weight used by the weighted balancing strategy.
+// It returns false for blank lines.
+func parseProxyLine(line string) (string, int, bool) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return "", 0, false
+	}
+	weight := 1
+	if len(fields) > 1 {
+		if w, err := strconv.Atoi(fields[1]); err == nil && w > 0 {
+			weight = w
+		} else {
+			slog.Warn("Ignoring invalid proxy weight", "component", componentInput, "proxy", fields[0], "weight", fields[1])
+		}
+	}
+	return fields[0], weight, true
+}
+
+// proxyWeight returns the configured weight of a proxy, which defaults to 1.
+func proxyWeight(proxy string) int {
+	if weight, ok := proxyWeights[proxy]; ok {
+		return weight
+	}
+	return 1
+}
+
 // loadParameters loads parameters from a file and appends them to the parameters slice.
 func loadParameters() error {
 	file, err := os.Open(parametersFile)
 	if err != nil {
-		log.Printf("Error in loadParameters: %v", err)
+		slog.Error("Error in loadParameters", "component", componentInput, "error", err)
 		return fmt.Errorf("Failed to open parameters file: %w", err)
 	}
 	// Defer file.Close() with error handling
 	defer func() {
 		if cerr := file.Close(); cerr != nil {
-			log.Printf("Failed to close parameters file: %s", cerr)
+			slog.Error("Failed to close parameters file", "component", componentInput, "error", cerr)
 		}
 	}()
 
@@ -137,7 +193,7 @@ func loadParameters() error {
 	wg.Wait() // Wait for all goroutines to finish
 
 	if len(parameters) == 0 {
-		log.Printf("Error in loadParameters: No parameters found in the file")
+		slog.Error("Error in loadParameters: No parameters found in the file", "component", componentInput, "file", parametersFile)
 		return fmt.Errorf("No parameters found in the file")
 	}
 
@@ -0,0 +1,48 @@
+// requestid.go contains the request IDs, which give every request a unique ID that is sent in requestIDHeader
+// and included in its log lines and result records, so a failure in the log can be matched with the target's access log.
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+)
+
+// requestIDPrefix is the random prefix of the request IDs of this process, so IDs of different runs do not collide
+var requestIDPrefix = newRequestIDPrefix()
+
+// requestIDSequence numbers the requests of this process
+var requestIDSequence uint64
+
+// newRequestIDPrefix returns 8 random hex digits. It is drawn from crypto/rand, so the seeded random sources
+// of a run, and the requests they generate, are the same with and without request IDs.
+func newRequestIDPrefix() string {
+	var b [4]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "00000000"
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// newRequestID returns a request ID that is unique within the run and very likely across runs.
+func newRequestID() string {
+	return fmt.Sprintf("%s-%08x", requestIDPrefix, atomic.AddUint64(&requestIDSequence, 1))
+}
+
+// tagRequest gives a request a new ID, sends it in requestIDHeader unless that is empty, and returns it.
+func tagRequest(req *http.Request) string {
+	id := newRequestID()
+	setRequestID(req, id)
+	return id
+}
+
+// setRequestID sends the ID of a request in requestIDHeader unless that is empty.
+// Retries of the request are sent as clones with the same ID.
+func setRequestID(req *http.Request, id string) {
+	if requestIDHeader != "" {
+		req.Header.Set(requestIDHeader, id)
+	}
+}
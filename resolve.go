@@ -0,0 +1,137 @@
+// resolve.go contains the name resolution overrides of the clients: static host:port mappings given with -resolve,
+// like curl's --resolve, and a list of DNS servers queried instead of the system resolver.
+// Mappings apply to every connection; proxied connections leave the remaining names to the proxy to resolve,
+// so the DNS servers and the DNS-over-HTTPS provider only apply to direct connections. Direct connections can also
+// cache resolved addresses for dnsCacheTTL, rotating through them, so high request rates do not query the resolver
+// for every connection.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// resolveOverrides maps host:port addresses to the addr:port dialed instead
+var resolveOverrides = make(map[string]string)
+
+// clientResolver is the resolver of the direct connections, or nil to use the system resolver
+var clientResolver *net.Resolver
+
+// dnsServerCounter is used to rotate through the DNS servers
+var dnsServerCounter uint64
+
+// dnsCacheEntry holds the addresses a host resolved to, until they expire.
+type dnsCacheEntry struct {
+	addrs   []string
+	expires time.Time
+	next    int // Index of the address dialed next
+}
+
+// dnsCache caches the addresses of the hosts dialed by direct connections, by host
+var dnsCache = struct {
+	mu      sync.Mutex
+	entries map[string]*dnsCacheEntry
+}{entries: make(map[string]*dnsCacheEntry)}
+
+// setupResolver parses the -resolve flag into resolveOverrides, and creates clientResolver if dnsServers is set.
+func setupResolver() error {
+	for _, entry := range strings.Split(*resolveFlag, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+			return fmt.Errorf("resolve entry %q is not of the form host:port:addr", entry)
+		}
+		addr := strings.TrimSuffix(strings.TrimPrefix(parts[2], "["), "]")
+		if net.ParseIP(addr) == nil {
+			return fmt.Errorf("resolve entry %q does not map to an IP address", entry)
+		}
+		resolveOverrides[net.JoinHostPort(parts[0], parts[1])] = net.JoinHostPort(addr, parts[1])
+	}
+
+	if len(dnsServers) > 0 {
+		for _, server := range dnsServers {
+			if _, _, err := net.SplitHostPort(server); err != nil {
+				return fmt.Errorf("DNS server %q is not a host:port address: %w", server, err)
+			}
+		}
+		clientResolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				server := dnsServers[(atomic.AddUint64(&dnsServerCounter, 1)-1)%uint64(len(dnsServers))]
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, network, server)
+			},
+		}
+	}
+
+	return nil
+}
+
+// resolveCached returns addr with its host replaced by one of the addresses it resolves to, looked up with lookupHost
+// and cached for dnsCacheTTL if it is set. Cached addresses are dialed in turn, and re-resolved once they expire.
+// IP addresses are returned unchanged.
+func resolveCached(ctx context.Context, addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || net.ParseIP(host) != nil {
+		return addr, nil
+	}
+	if dnsCacheTTL <= 0 {
+		addrs, err := lookupHost(ctx, host)
+		if err != nil {
+			return "", err
+		}
+		return net.JoinHostPort(addrs[0], port), nil
+	}
+
+	dnsCache.mu.Lock()
+	if entry, ok := dnsCache.entries[host]; ok && time.Now().Before(entry.expires) {
+		ip := entry.addrs[entry.next%len(entry.addrs)]
+		entry.next++
+		dnsCache.mu.Unlock()
+		countInContext(ctx, CounterDNSCacheHits)
+		return net.JoinHostPort(ip, port), nil
+	}
+	dnsCache.mu.Unlock()
+	countInContext(ctx, CounterDNSCacheMisses)
+
+	addrs, err := lookupHost(ctx, host)
+	if err != nil {
+		return "", err
+	}
+
+	dnsCache.mu.Lock()
+	dnsCache.entries[host] = &dnsCacheEntry{addrs: addrs, expires: time.Now().Add(dnsCacheTTL), next: 1}
+	dnsCache.mu.Unlock()
+
+	return net.JoinHostPort(addrs[0], port), nil
+}
+
+// lookupHost returns the addresses of host of the preferred IP version, resolved by the DoH provider if dohURL is set,
+// and by clientResolver or the system resolver otherwise.
+func lookupHost(ctx context.Context, host string) ([]string, error) {
+	if dohURL != "" {
+		return lookupDoH(ctx, host)
+	}
+	resolver := clientResolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	ips, err := resolver.LookupIP(ctx, lookupNetwork(), host)
+	if err != nil {
+		return nil, err
+	}
+	addrs := make([]string, len(ips))
+	for i, ip := range ips {
+		addrs[i] = ip.String()
+	}
+	return addrs, nil
+}
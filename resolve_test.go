@@ -0,0 +1,45 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSetupResolverOverrides(t *testing.T) {
+	tests := []struct {
+		name    string
+		flag    string
+		want    map[string]string
+		wantErr bool
+	}{
+		{"empty", "", map[string]string{}, false},
+		{"ipv4", "example.com:443:127.0.0.1", map[string]string{"example.com:443": "127.0.0.1:443"}, false},
+		{"ipv6", "example.com:443:::1", map[string]string{"example.com:443": "[::1]:443"}, false},
+		{"bracketed ipv6", "example.com:443:[::1]", map[string]string{"example.com:443": "[::1]:443"}, false},
+		{"several", "a.com:80:10.0.0.1, b.com:443:10.0.0.2", map[string]string{"a.com:80": "10.0.0.1:80", "b.com:443": "10.0.0.2:443"}, false},
+		{"empty entries skipped", ",a.com:80:10.0.0.1,", map[string]string{"a.com:80": "10.0.0.1:80"}, false},
+		{"missing addr", "example.com:443", nil, true},
+		{"empty host", ":443:127.0.0.1", nil, true},
+		{"empty port", "example.com::127.0.0.1", nil, true},
+		{"empty addr", "example.com:443:", nil, true},
+		{"host name addr", "example.com:443:localhost", nil, true},
+	}
+	saved := *resolveFlag
+	defer func() {
+		*resolveFlag = saved
+		resolveOverrides = make(map[string]string)
+	}()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			*resolveFlag = tt.flag
+			resolveOverrides = make(map[string]string)
+			err := setupResolver()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("setupResolver() with -resolve %q error = %v, wantErr %t", tt.flag, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(resolveOverrides, tt.want) {
+				t.Errorf("setupResolver() with -resolve %q = %v, want %v", tt.flag, resolveOverrides, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+// results.go contains the sinks that receive every completed request, and the per-request results file,
+// which appends one CSV row per request through a buffered writer so results can be analysed after a run.
+
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// resultSinks receive the per-request records of the current run
+var resultSinks []resultSink
+
+// resultSink receives a RequestSummary for every completed request.
+// Implementations must be safe for concurrent use.
+type resultSink interface {
+	Write(summary RequestSummary)
+	Close() error
+}
+
+// resultsHeader is the header row of the results file
+var resultsHeader = []string{"timestamp", "parameter", "proxy", "status", "duration_ms", "bytes", "error_class", "request_id"}
+
+// ResultsWriter appends RequestSummaries to a CSV file.
+// It is safe for concurrent use.
+type ResultsWriter struct {
+	mu   sync.Mutex
+	file *os.File
+	w    *csv.Writer
+	done chan struct{}
+}
+
+// openResultsWriter opens the results file at path for appending, writing the header row if the file is new.
+// The buffered rows are flushed every resultsFlushInterval and when the writer is closed.
+func openResultsWriter(path string) (*ResultsWriter, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		slog.Error("Error in openResultsWriter", "component", componentOutput, "error", err)
+		return nil, fmt.Errorf("Failed to open results file: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		slog.Error("Error in openResultsWriter", "component", componentOutput, "error", err)
+		return nil, fmt.Errorf("Failed to stat results file: %w", err)
+	}
+
+	rw := &ResultsWriter{
+		file: file,
+		w:    csv.NewWriter(bufio.NewWriterSize(file, resultsBufferSize)),
+		done: make(chan struct{}),
+	}
+	if info.Size() == 0 {
+		if err := rw.w.Write(resultsHeader); err != nil {
+			file.Close()
+			slog.Error("Error in openResultsWriter", "component", componentOutput, "error", err)
+			return nil, fmt.Errorf("Failed to write results header: %w", err)
+		}
+	}
+
+	go rw.flushPeriodically()
+
+	return rw, nil
+}
+
+// closeResultSinks flushes and closes every result sink.
+func closeResultSinks() {
+	for _, sink := range resultSinks {
+		if err := sink.Close(); err != nil {
+			slog.Error("Failed to close result sink", "component", componentOutput, "error", err)
+		}
+	}
+}
+
+// Write appends a row for a request to the buffer.
+func (rw *ResultsWriter) Write(summary RequestSummary) {
+	errorClass := ""
+	if summary.ErrorClass != ErrorClassNone {
+		errorClass = summary.ErrorClass.String()
+	}
+	row := []string{
+		summary.Timestamp.Format(time.RFC3339Nano),
+		summary.Parameter,
+		summary.Proxy,
+		strconv.Itoa(summary.StatusCode),
+		formatMillis(summary.Duration),
+		strconv.Itoa(summary.BytesIn),
+		errorClass,
+		summary.RequestID,
+	}
+
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	if err := rw.w.Write(row); err != nil {
+		slog.Error("Failed to write result", "component", componentOutput, "error", err)
+	}
+}
+
+// flushPeriodically flushes the buffered rows every resultsFlushInterval until the writer is closed.
+func (rw *ResultsWriter) flushPeriodically() {
+	ticker := time.NewTicker(resultsFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			rw.mu.Lock()
+			rw.w.Flush()
+			if err := rw.w.Error(); err != nil {
+				slog.Error("Failed to flush results", "component", componentOutput, "error", err)
+			}
+			rw.mu.Unlock()
+		case <-rw.done:
+			return
+		}
+	}
+}
+
+// Close flushes the buffered rows and closes the results file.
+func (rw *ResultsWriter) Close() error {
+	close(rw.done)
+
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
+	rw.w.Flush()
+	if err := rw.w.Error(); err != nil {
+		rw.file.Close()
+		slog.Error("Error in Close", "component", componentOutput, "error", err)
+		return fmt.Errorf("Failed to flush results: %w", err)
+	}
+	if err := rw.file.Close(); err != nil {
+		slog.Error("Error in Close", "component", componentOutput, "error", err)
+		return fmt.Errorf("Failed to close results file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+// retry.go contains the retries of requests that failed without a response. Idempotent requests are sent again
+// up to requestRetries times after a jittered exponential backoff, and the retries are counted apart from the requests.
+// The retries of a run are capped by a retry budget, a fraction of the requests started, so a dying target
+// does not multiply the intended load.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+)
+
+// shouldRetry reports whether a request that failed on its given attempt, counting from 0, is sent again:
+// it must be idempotent, have attempts left, the run must not be stopping, and the retry budget must not be used up.
+// A retry refused by the budget is counted in the shard's slot.
+func shouldRetry(sh *shard, req *http.Request, attempt int) bool {
+	if attempt >= requestRetries || fireAndForget || stopping() {
+		return false
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+	default:
+		return false
+	}
+	if sh.stats.Get(CounterRetries) >= retryBudgetLimit(sh.stats.Get(CounterRequests)) {
+		sh.count(CounterRetriesDenied)
+		return false
+	}
+	return true
+}
+
+// retryBudgetLimit returns the number of retries the retry budget allows after the given number of requests.
+func retryBudgetLimit(requests int64) int64 {
+	if retryBudget <= 0 {
+		return math.MaxInt64
+	}
+	return retryBudgetMin + int64(retryBudget*float64(requests))
+}
+
+// printRetrySummary prints the retries of the run against the retry budget.
+func printRetrySummary(snapshot StatsSnapshot) {
+	if snapshot.Retries == 0 && snapshot.RetriesDenied == 0 {
+		return
+	}
+	if retryBudget <= 0 {
+		fmt.Printf("Retries: %d (no retry budget)\n", snapshot.Retries)
+		return
+	}
+	limit := retryBudgetLimit(snapshot.Requests)
+	fmt.Printf("Retries: %d of a budget of %d (%.1f%% used), %d refused by the budget\n",
+		snapshot.Retries, limit, 100*float64(snapshot.Retries)/float64(limit), snapshot.RetriesDenied)
+}
+
+// retryBackoff returns the wait before the given retry, counting from 1: a random duration of up to
+// retryBackoffBase doubled for every earlier retry, capped at retryBackoffMax ("full jitter"),
+// so the retries of many threads do not arrive at the target together.
+func retryBackoff(retry int) time.Duration {
+	backoff := retryBackoffBase
+	for i := 1; i < retry && backoff < retryBackoffMax; i++ {
+		backoff *= 2
+	}
+	if backoff > retryBackoffMax {
+		backoff = retryBackoffMax
+	}
+	if backoff <= 0 {
+		return 0
+	}
+	return time.Duration(runRand.Int63n(int64(backoff) + 1))
+}
+
+// waitRetryBackoff waits out the backoff before the given retry, counting from 1.
+// It returns false without waiting any longer once the run is asked to stop.
+func waitRetryBackoff(retry int) bool {
+	timer := time.NewTimer(retryBackoff(retry))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-runCtx.Done():
+		return false
+	}
+}
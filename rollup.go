@@ -0,0 +1,137 @@
+// rollup.go contains the soak test rollups, which aggregate every rollupInterval of the run into one line
+// of an NDJSON file, so slow degradation of the target or the proxy pool shows up over multi-hour runs.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// rollupJSON is the layout of a rollup in the rollups file.
+type rollupJSON struct {
+	Start          time.Time        `json:"start"`
+	End            time.Time        `json:"end"`
+	Requests       int64            `json:"requests"`
+	Successes      int64            `json:"successes"`
+	Failures       int64            `json:"failures"`
+	ErrorRate      float64          `json:"error_rate"`
+	RequestsPerSec float64          `json:"rps"`
+	BytesIn        int64            `json:"bytes_in"`
+	P50Ms          float64          `json:"p50_ms"`
+	P95Ms          float64          `json:"p95_ms"`
+	P99Ms          float64          `json:"p99_ms"`
+	StatusCodes    map[string]int64 `json:"status_codes"`
+	Errors         map[string]int64 `json:"errors"`
+	HealthyProxies int              `json:"healthy_proxies,omitempty"`
+	ProxyFailures  int64            `json:"proxy_failures,omitempty"`
+	UniqueIPs      int              `json:"unique_ips,omitempty"`
+}
+
+// rollupWindow is the state at the start of the current rollup window.
+type rollupWindow struct {
+	start   time.Time
+	stats   StatsSnapshot
+	buckets []HistogramBucket
+}
+
+// startRollups appends a rollup of every rollupInterval to the file at path for the lifetime of the run.
+// It returns a function that writes the rollup of the final, partial window, or nil if rollups are disabled.
+func startRollups(collector *StatsCollector, path string, start time.Time) func() {
+	if rollupInterval <= 0 {
+		return nil
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		slog.Error("Failed to open rollups file", "component", componentOutput, "error", err)
+		return nil
+	}
+	enc := json.NewEncoder(file)
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	window := rollupWindow{start: start, stats: collector.Snapshot(), buckets: latencies.Buckets()}
+	write := func(now time.Time) {
+		next := rollupWindow{start: now, stats: collector.Snapshot(), buckets: latencies.Buckets()}
+		if err := enc.Encode(newRollup(window, next)); err != nil {
+			slog.Error("Failed to write rollup", "component", componentOutput, "error", err)
+		}
+		window = next
+	}
+
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(rollupInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case now := <-ticker.C:
+				write(now)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+		write(time.Now())
+		if err := file.Close(); err != nil {
+			slog.Error("Failed to close rollups file", "component", componentOutput, "error", err)
+		}
+	}
+}
+
+// newRollup aggregates the window from one state to the next.
+func newRollup(from, to rollupWindow) rollupJSON {
+	requests := to.stats.Requests - from.stats.Requests
+	rollup := rollupJSON{
+		Start:          from.start,
+		End:            to.start,
+		Requests:       requests,
+		Successes:      to.stats.Successes - from.stats.Successes,
+		Failures:       to.stats.Failures - from.stats.Failures,
+		RequestsPerSec: perSecond(requests, to.start.Sub(from.start)),
+		BytesIn:        to.stats.BytesIn - from.stats.BytesIn,
+		StatusCodes:    make(map[string]int64),
+		Errors:         make(map[string]int64),
+	}
+	if requests > 0 {
+		rollup.ErrorRate = float64(rollup.Failures) / float64(requests)
+	}
+
+	p50, _ := intervalQuantile(from.buckets, to.buckets, 0.50)
+	p95, _ := intervalQuantile(from.buckets, to.buckets, 0.95)
+	p99, _ := intervalQuantile(from.buckets, to.buckets, 0.99)
+	rollup.P50Ms, rollup.P95Ms, rollup.P99Ms = durationMillis(p50), durationMillis(p95), durationMillis(p99)
+
+	for code, count := range to.stats.StatusCodes {
+		if delta := count - from.stats.StatusCodes[code]; delta > 0 {
+			label := fmt.Sprint(code)
+			if code == 0 {
+				label = "other"
+			}
+			rollup.StatusCodes[label] = delta
+		}
+	}
+	for class, count := range to.stats.ErrorClasses {
+		if delta := count - from.stats.ErrorClasses[class]; delta > 0 {
+			rollup.Errors[ErrorClass(class).String()] = delta
+		}
+	}
+
+	if useProxy {
+		rollup.HealthyProxies = proxiesPool.Len()
+		rollup.ProxyFailures = to.stats.ProxyFailures - from.stats.ProxyFailures
+		rollup.UniqueIPs = countUniqueIPs()
+	}
+
+	return rollup
+}
@@ -0,0 +1,185 @@
+// rotate.go contains the rotation of the log files. When requests.log or proxies.log reaches logMaxSize bytes
+// or logMaxAge, it is renamed with a timestamp suffix and a new file is started; rotated files beyond logRetention
+// are deleted, and with logCompress they are gzipped in the background.
+
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rotatedTimeFormat is the timestamp suffix of rotated log files
+const rotatedTimeFormat = "20060102-150405.000"
+
+// RotatingFile is a log file that rotates itself by size and age.
+// It is safe for concurrent use.
+type RotatingFile struct {
+	mu     sync.Mutex
+	path   string
+	file   *os.File
+	size   int64
+	opened time.Time
+}
+
+// openRotatingFile opens or creates the log file at path for appending.
+// It returns the error of os.OpenFile as it is, so callers can inspect it with os.IsPermission and os.IsNotExist.
+func openRotatingFile(path string) (*RotatingFile, error) {
+	f := &RotatingFile{path: path}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// open opens the log file and takes its current size. The caller must hold the lock or own f.
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size, f.opened = file, info.Size(), time.Now()
+	return nil
+}
+
+// Write appends p to the log file, rotating it first if p would take it past logMaxSize or it is older than logMaxAge.
+// A failed rotation is logged and writing continues to the current file.
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.due(len(p)) {
+		if err := f.rotate(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to rotate log file %s: %s\n", f.path, err)
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// due reports whether the file has to be rotated before n more bytes are written. The caller must hold the lock.
+func (f *RotatingFile) due(n int) bool {
+	if f.size == 0 {
+		return false
+	}
+	return logMaxSize > 0 && f.size+int64(n) > logMaxSize || logMaxAge > 0 && time.Since(f.opened) >= logMaxAge
+}
+
+// rotate renames the log file with a timestamp suffix, starts a new one, and prunes the rotated files.
+// The caller must hold the lock.
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	rotated := f.path + "." + time.Now().Format(rotatedTimeFormat)
+	renameErr := os.Rename(f.path, rotated)
+	if err := f.open(); err != nil {
+		return err
+	}
+	if renameErr != nil {
+		return renameErr
+	}
+
+	go func() {
+		if logCompress {
+			if err := gzipFile(rotated); err != nil {
+				slog.Error("Failed to compress rotated log file", "component", componentMain, "file", rotated, "error", err)
+			}
+		}
+		pruneRotatedFiles(f.path)
+	}()
+
+	return nil
+}
+
+// Close closes the log file.
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
+
+// gzipFile compresses a file to the same path with a .gz suffix and removes the original.
+func gzipFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(path + ".gz")
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	if _, err := io.Copy(zw, in); err != nil {
+		out.Close()
+		os.Remove(out.Name())
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		out.Close()
+		os.Remove(out.Name())
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(out.Name())
+		return err
+	}
+
+	return os.Remove(path)
+}
+
+// rotatedMu serializes the pruning of rotated files
+var rotatedMu sync.Mutex
+
+// pruneRotatedFiles deletes the oldest rotated files of the log file at path beyond logRetention.
+// A rotated file that is still being compressed is counted once.
+func pruneRotatedFiles(path string) {
+	if logRetention <= 0 {
+		return
+	}
+
+	rotatedMu.Lock()
+	defer rotatedMu.Unlock()
+
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil {
+		return
+	}
+	rotations := make(map[string][]string)
+	for _, match := range matches {
+		stamp := strings.TrimSuffix(strings.TrimPrefix(match, path+"."), ".gz")
+		if _, err := time.Parse(rotatedTimeFormat, stamp); err != nil {
+			continue
+		}
+		rotations[stamp] = append(rotations[stamp], match)
+	}
+
+	stamps := make([]string, 0, len(rotations))
+	for stamp := range rotations {
+		stamps = append(stamps, stamp)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(stamps)))
+	for _, stamp := range stamps[min(len(stamps), logRetention):] {
+		for _, file := range rotations[stamp] {
+			if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+				slog.Error("Failed to remove rotated log file", "component", componentMain, "file", file, "error", err)
+			}
+		}
+	}
+}
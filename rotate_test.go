@@ -0,0 +1,185 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestRotatingFileDue(t *testing.T) {
+	tests := []struct {
+		name string
+		size int64
+		n    int
+		want bool
+	}{
+		{"empty file", 0, logMaxSize + 1, false},
+		{"below the limit", logMaxSize - 10, 5, false},
+		{"up to the limit", logMaxSize - 10, 10, false},
+		{"past the limit", logMaxSize - 10, 11, true},
+		{"already past the limit", logMaxSize + 1, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &RotatingFile{size: tt.size, opened: time.Now()}
+			if got := f.due(tt.n); got != tt.want {
+				t.Errorf("due(%d) with %d bytes = %t, want %t", tt.n, tt.size, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPruneRotatedFiles(t *testing.T) {
+	stamp := func(minutes int) string {
+		return time.Date(2024, 1, 1, 0, minutes, 0, 0, time.UTC).Format(rotatedTimeFormat)
+	}
+	tests := []struct {
+		name  string
+		files []string // Files next to requests.log, by suffix
+		want  []string // Files left, by suffix
+	}{
+		{"fewer than kept", []string{stamp(1), stamp(2)}, []string{stamp(1), stamp(2)}},
+		{
+			"oldest removed",
+			[]string{stamp(1), stamp(2), stamp(3), stamp(4), stamp(5), stamp(6), stamp(7)},
+			[]string{stamp(3), stamp(4), stamp(5), stamp(6), stamp(7)},
+		},
+		{
+			"compressed files counted",
+			[]string{stamp(1) + ".gz", stamp(2) + ".gz", stamp(3), stamp(4), stamp(5), stamp(6) + ".gz"},
+			[]string{stamp(2) + ".gz", stamp(3), stamp(4), stamp(5), stamp(6) + ".gz"},
+		},
+		{
+			"file being compressed counted once",
+			[]string{stamp(1), stamp(2), stamp(3), stamp(4), stamp(5), stamp(6), stamp(6) + ".gz"},
+			[]string{stamp(2), stamp(3), stamp(4), stamp(5), stamp(6), stamp(6) + ".gz"},
+		},
+		{
+			"other files kept",
+			[]string{"bak", "20240101", stamp(1), stamp(2), stamp(3), stamp(4), stamp(5), stamp(6)},
+			[]string{"20240101", "bak", stamp(2), stamp(3), stamp(4), stamp(5), stamp(6)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "requests.log")
+			for _, suffix := range append(tt.files, "") {
+				name := path
+				if suffix != "" {
+					name += "." + suffix
+				}
+				if err := os.WriteFile(name, nil, 0666); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			pruneRotatedFiles(path)
+
+			matches, err := filepath.Glob(path + ".*")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]string, len(matches))
+			for i, match := range matches {
+				got[i] = match[len(path)+1:]
+			}
+			want := append([]string(nil), tt.want...)
+			sort.Strings(want)
+			if len(got) != len(want) {
+				t.Fatalf("left %v, want %v", got, want)
+			}
+			for i := range got {
+				if got[i] != want[i] {
+					t.Fatalf("left %v, want %v", got, want)
+				}
+			}
+			if _, err := os.Stat(path); err != nil {
+				t.Errorf("the log file itself was removed: %s", err)
+			}
+		})
+	}
+}
+
+func TestGzipFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"empty", ""},
+		{"lines", "{\"level\":\"INFO\"}\n{\"level\":\"ERROR\"}\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "requests.log.1")
+			if err := os.WriteFile(path, []byte(tt.content), 0666); err != nil {
+				t.Fatal(err)
+			}
+			if err := gzipFile(path); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Errorf("the original file was not removed")
+			}
+
+			file, err := os.Open(path + ".gz")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+			zr, err := gzip.NewReader(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(zr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.content {
+				t.Errorf("decompressed %q, want %q", got, tt.content)
+			}
+		})
+	}
+}
+
+func TestRotatingFileRotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "requests.log")
+	f, err := openRotatingFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write([]byte("first\n")); err != nil {
+		t.Fatal(err)
+	}
+	// Pretend the file is full, so the next write rotates it
+	f.size = logMaxSize
+	if _, err := f.Write([]byte("second\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "second\n" {
+		t.Errorf("the new log file holds %q, want %q", content, "second\n")
+	}
+
+	// The rotated file is compressed in the background
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		matches, _ := filepath.Glob(path + ".*.gz")
+		if len(matches) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no compressed rotated file after rotation")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
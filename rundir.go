@@ -0,0 +1,87 @@
+// rundir.go contains the optional per-run directories, which keep the logs and result files of each run apart,
+// and the retention policy that removes old run directories so long-lived hosts do not fill their disks.
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// runDirectoryLayout is the time layout run directories are named with, so their names sort by start time
+const runDirectoryLayout = "20060102-150405.000"
+
+// setupRunDirectory creates a directory for the current run under runsDir in base,
+// and removes old run directories according to the retention policy.
+// It returns the path of the new run directory.
+func setupRunDirectory(base string) (string, error) {
+	root := filepath.Join(base, runsDir)
+	dir := filepath.Join(root, time.Now().Format(runDirectoryLayout))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		slog.Error("Error in setupRunDirectory", "component", componentMain, "error", err)
+		return "", fmt.Errorf("Failed to create run directory: %w", err)
+	}
+
+	if err := pruneRunDirectories(root, dir, keepRuns, keepRunsFor); err != nil {
+		// Failing to clean up must not stop the run
+		slog.Error("Failed to remove old run directories", "component", componentMain, "error", err)
+	}
+
+	return dir, nil
+}
+
+// pruneRunDirectories removes the run directories in root beyond the newest keep directories,
+// and those last modified more than maxAge ago. The current run directory is never removed.
+// A keep or maxAge of zero disables the respective limit.
+func pruneRunDirectories(root string, current string, keep int, maxAge time.Duration) error {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		slog.Error("Error in pruneRunDirectories", "component", componentMain, "error", err)
+		return fmt.Errorf("Failed to read runs directory: %w", err)
+	}
+
+	type runDirectory struct {
+		path    string
+		modTime time.Time
+	}
+	var runs []runDirectory
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			slog.Error("Failed to stat run directory", "component", componentMain, "dir", entry.Name(), "error", err)
+			continue
+		}
+		runs = append(runs, runDirectory{path: filepath.Join(root, entry.Name()), modTime: info.ModTime()})
+	}
+
+	// Newest first
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].modTime.After(runs[j].modTime)
+	})
+
+	cutoff := time.Now().Add(-maxAge)
+	for i, run := range runs {
+		if run.path == current {
+			continue
+		}
+		tooMany := keep > 0 && i >= keep
+		tooOld := maxAge > 0 && run.modTime.Before(cutoff)
+		if !tooMany && !tooOld {
+			continue
+		}
+		if err := os.RemoveAll(run.path); err != nil {
+			slog.Error("Failed to remove run directory", "component", componentMain, "dir", run.path, "error", err)
+			continue
+		}
+		slog.Info("Removed old run directory", "component", componentMain, "dir", run.path)
+	}
+
+	return nil
+}
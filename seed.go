@@ -0,0 +1,45 @@
+// seed.go contains the random source of the run. Every random choice, from the shuffles to the parameter values,
+// is drawn from it, so a problematic run can be reproduced by running again with the seed it printed.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// runSeed is the seed of the current run's random source
+var runSeed int64
+
+// runRand is the random source of the current run. It is safe for concurrent use.
+var runRand = newLockedRand(time.Now().UnixNano())
+
+// newLockedRand creates a random number generator with the given seed that is safe for concurrent use.
+func newLockedRand(seed int64) *rand.Rand {
+	return rand.New(&lockedSource{src: rand.NewSource(seed).(rand.Source64)})
+}
+
+// setupSeed seeds the run's random source with the -seed flag, or with a generated seed if the flag is not given,
+// and prints the seed so the run can be reproduced.
+func setupSeed() {
+	seeded := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "seed" {
+			seeded = true
+		}
+	})
+
+	runSeed = *seedFlag
+	if !seeded {
+		runSeed = time.Now().UnixNano()
+	}
+	runRand = newLockedRand(runSeed)
+
+	if seeded {
+		fmt.Printf("Seed: %d\n", runSeed)
+	} else {
+		fmt.Printf("Seed: %d (generated; pass -seed %d to reproduce this run)\n", runSeed, runSeed)
+	}
+}
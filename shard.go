@@ -0,0 +1,235 @@
+// shard.go contains the sharding of threads into per-P groups.
+// Each shard has its own random number generator, stats collector slot, latency histogram, and client cache,
+// so threads in different shards do not contend on shared atomics, locks, or channels on the hot path.
+// Shard latencies and progress are aggregated into the global histogram and progress bar periodically.
+
+package main
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/vbauerster/mpb/v7"
+)
+
+// cacheLinePad is the size of the padding that keeps shard counters on separate cache lines
+const cacheLinePad = 64
+
+// shards holds the shards threads are assigned to
+var shards []*shard
+
+// shardCounters holds the per-shard values that are flushed periodically.
+// The padding keeps the counters of different shards on separate cache lines.
+type shardCounters struct {
+	completed int64 // Requests that advance the progress bar
+	_         [cacheLinePad]byte
+}
+
+// shard is a group of threads that share a random number generator, stats counters, and client cache.
+type shard struct {
+	id        int
+	rng       *rand.Rand
+	stats     *StatsCollector
+	counters  shardCounters
+	latencies *Histogram
+
+	clientsMu sync.Mutex
+	clients   map[string]*http.Client
+}
+
+// lockedSource is a rand.Source that is safe for concurrent use by the threads of a shard.
+type lockedSource struct {
+	mu  sync.Mutex
+	src rand.Source64
+}
+
+// Int63 returns a non-negative pseudo-random 63-bit integer.
+func (s *lockedSource) Int63() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.src.Int63()
+}
+
+// Uint64 returns a pseudo-random 64-bit integer.
+func (s *lockedSource) Uint64() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.src.Uint64()
+}
+
+// Seed seeds the source.
+func (s *lockedSource) Seed(seed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.src.Seed(seed)
+}
+
+// newShard creates a shard that counts into its slot of the given stats collector,
+// with its own random number generator seeded from the run's random source.
+func newShard(id int, collector *StatsCollector) *shard {
+	return &shard{
+		id:        id,
+		rng:       newLockedRand(runRand.Int63()),
+		stats:     collector,
+		latencies: newHistogram(latencyHighestTrackable, latencySignificantFigures),
+		clients:   make(map[string]*http.Client),
+	}
+}
+
+// shardCount returns the number of shards for the configured number of threads, which is also the number of
+// slots of the run's stats collector. Below shardingThreshold threads there is a single shard; above it there is one per P.
+//
+// Sharding is not free: every shard keeps its own client cache, so it opens its own connections to every proxy, and
+// shard latencies reach the global histogram only every statsFlushInterval. It only pays off once the shared counters
+// and histogram lock are contended. A request updates about ten counters and records one latency; uncontended, that is
+// roughly 100ns in total (see BenchmarkStatsCollectorAdd and BenchmarkHistogramRecord), but once the cache lines bounce
+// between cores every update costs several times that. With requests taking around a millisecond, 5000 threads send
+// a few million requests per second, which is where the single slot's updates start to take a noticeable share of a
+// core. Re-run the benchmarks with -cpu set to the target machine's cores to check the cutoff.
+func shardCount() int {
+	if numOfThreads >= shardingThreshold {
+		return runtime.GOMAXPROCS(0)
+	}
+	return 1
+}
+
+// setupShards creates one shard per slot of the given stats collector.
+func setupShards(collector *StatsCollector) {
+	shards = make([]*shard, len(collector.shards))
+	for i := range shards {
+		shards[i] = newShard(i, collector)
+	}
+}
+
+// shardKey is the context key of the shard a request is sent by
+type shardKey struct{}
+
+// withShard returns a copy of ctx that carries the shard, so the client hooks of a request count into the shard's slot.
+func withShard(ctx context.Context, sh *shard) context.Context {
+	return context.WithValue(ctx, shardKey{}, sh)
+}
+
+// countInContext adds one to a counter of the shard carried by ctx.
+// Requests sent outside a shard, such as proxy tests, are not counted.
+func countInContext(ctx context.Context, counter Counter) {
+	if sh, ok := ctx.Value(shardKey{}).(*shard); ok {
+		sh.count(counter)
+	}
+}
+
+// shardFor returns the shard of the thread with the given index.
+func shardFor(threadIndex int) *shard {
+	return shards[threadIndex%len(shards)]
+}
+
+// count adds one to a counter in the shard's slot of the stats collector.
+func (s *shard) count(counter Counter) {
+	s.stats.Add(s.id, counter, 1)
+}
+
+// countBytes adds the size of a response body to the shard's slot of the stats collector.
+func (s *shard) countBytes(n int) {
+	s.stats.Add(s.id, CounterBytesIn, int64(n))
+}
+
+// countWireBytes adds the size of a response body as received on the wire to the shard's slot of the stats collector.
+func (s *shard) countWireBytes(n int64) {
+	s.stats.Add(s.id, CounterWireBytes, n)
+}
+
+// countConnection counts the connection a request got as new or reused in the shard's slot of the stats collector,
+// and records the setup time of a new one.
+func (s *shard) countConnection(reused bool, setup time.Duration) {
+	if reused {
+		s.stats.Add(s.id, CounterReusedConnections, 1)
+		return
+	}
+	s.stats.Add(s.id, CounterNewConnections, 1)
+	connectionSetupTimes.Record(setup)
+}
+
+// countFailure counts a failed request and its error class in the shard's slot of the stats collector.
+func (s *shard) countFailure(class ErrorClass) {
+	s.stats.Add(s.id, CounterFailures, 1)
+	s.stats.AddError(s.id, class)
+}
+
+// countStatus counts a response status code in the shard's slot of the stats collector.
+func (s *shard) countStatus(code int) {
+	s.stats.AddStatus(s.id, code)
+}
+
+// countBatch counts the requests of a finished batch against the request budget.
+// It returns the number of requests counted against the budget by all shards.
+func (s *shard) countBatch(requests int) int64 {
+	s.stats.Add(s.id, CounterBudgetUsed, int64(requests))
+	return s.stats.Get(CounterBudgetUsed)
+}
+
+// complete records a finished request that advances the progress bar.
+func (s *shard) complete() {
+	atomic.AddInt64(&s.counters.completed, 1)
+}
+
+// client returns the shard's HTTP client for a proxy, creating it if needed.
+func (s *shard) client(proxy string) (*http.Client, error) {
+	s.clientsMu.Lock()
+	defer s.clientsMu.Unlock()
+
+	if client, ok := s.clients[proxy]; ok {
+		return client, nil
+	}
+	client, err := newProxyClient(proxy)
+	if err != nil {
+		return nil, err
+	}
+	s.clients[proxy] = client
+
+	return client, nil
+}
+
+// discardClient removes the shard's HTTP client for a proxy and closes its idle connections.
+func (s *shard) discardClient(proxy string) {
+	s.clientsMu.Lock()
+	client, ok := s.clients[proxy]
+	delete(s.clients, proxy)
+	s.clientsMu.Unlock()
+
+	if ok {
+		client.CloseIdleConnections()
+	}
+}
+
+// flush moves the shard's latencies into the global histogram and its progress into the progress bar.
+// The completed counter is swapped first, so every request counted on the progress bar has its latency flushed too.
+func (s *shard) flush(bar *mpb.Bar) {
+	completed := atomic.SwapInt64(&s.counters.completed, 0)
+
+	s.latencies.DrainInto(latencies)
+
+	if completed > 0 && bar != nil {
+		bar.IncrInt64(completed)
+	}
+}
+
+// flushShards flushes every shard every statsFlushInterval until ctx is cancelled.
+func flushShards(ctx context.Context, bar *mpb.Bar) {
+	ticker := time.NewTicker(statsFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			for _, s := range shards {
+				s.flush(bar)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
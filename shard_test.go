@@ -0,0 +1,56 @@
+package main
+
+import (
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// runSharded runs op under b.RunParallel, every goroutine using the slot it is assigned round-robin out of slots.
+func runSharded(b *testing.B, slots int, op func(slot int)) {
+	var next int64
+	b.RunParallel(func(pb *testing.PB) {
+		slot := int(atomic.AddInt64(&next, 1)-1) % slots
+		for pb.Next() {
+			op(slot)
+		}
+	})
+}
+
+func BenchmarkStatsCollectorAdd(b *testing.B) {
+	for _, bc := range []struct {
+		name  string
+		slots int
+	}{
+		{"unsharded", 1},
+		{"sharded", runtime.GOMAXPROCS(0)},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			c := newStatsCollector(bc.slots)
+			runSharded(b, bc.slots, func(slot int) {
+				c.Add(slot, CounterRequests, 1)
+			})
+		})
+	}
+}
+
+func BenchmarkHistogramRecord(b *testing.B) {
+	for _, bc := range []struct {
+		name  string
+		slots int
+	}{
+		{"unsharded", 1},
+		{"sharded", runtime.GOMAXPROCS(0)},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			histograms := make([]*Histogram, bc.slots)
+			for i := range histograms {
+				histograms[i] = newHistogram(latencyHighestTrackable, latencySignificantFigures)
+			}
+			runSharded(b, bc.slots, func(slot int) {
+				histograms[slot].Record(1500 * time.Microsecond)
+			})
+		})
+	}
+}
@@ -0,0 +1,87 @@
+// sla.go contains the SLA thresholds, pass/fail criteria evaluated at the end of a run,
+// so the binary can gate automated pipelines with a printed verdict and a non-zero exit code.
+
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// The exit codes of a run
+const (
+	exitOK         = 0 // The run passed
+	exitRegression = 1 // The run regressed against the baseline it was compared to
+	exitSLAFailed  = 3 // The run missed one of its SLA thresholds
+	exitAborted    = 4 // The run was aborted by an abort condition
+)
+
+// SLACheck is the evaluation of one SLA threshold against a run.
+type SLACheck struct {
+	Name   string
+	Limit  float64
+	Actual float64
+	Max    bool // Whether Limit is a maximum rather than a minimum
+	Passed bool
+}
+
+// evaluateSLA checks the run against the SLA thresholds that are set; a threshold of 0 is not checked.
+func evaluateSLA(report RunReport, maxP99 time.Duration, maxErrorRate float64, minRPS float64) []SLACheck {
+	var checks []SLACheck
+	if maxP99 > 0 {
+		checks = append(checks, newSLACheck("p99_ms", durationMillis(maxP99), durationMillis(report.Latency.P99), true))
+	}
+	if maxErrorRate > 0 {
+		var errorRate float64
+		if report.Stats.Requests > 0 {
+			errorRate = float64(report.Stats.Failures) / float64(report.Stats.Requests)
+		}
+		checks = append(checks, newSLACheck("error_rate", maxErrorRate, errorRate, true))
+	}
+	if minRPS > 0 {
+		checks = append(checks, newSLACheck("rps", minRPS, report.Throughput, false))
+	}
+	return checks
+}
+
+// newSLACheck evaluates an actual value against a maximum or minimum limit.
+func newSLACheck(name string, limit, actual float64, max bool) SLACheck {
+	passed := actual >= limit
+	if max {
+		passed = actual <= limit
+	}
+	return SLACheck{Name: name, Limit: limit, Actual: actual, Max: max, Passed: passed}
+}
+
+// slaPassed reports whether every check passed.
+func slaPassed(checks []SLACheck) bool {
+	for _, c := range checks {
+		if !c.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+// printSLAVerdict prints every check and the overall verdict.
+func printSLAVerdict(checks []SLACheck) {
+	fmt.Printf("\n--- SLA ---\n")
+	fmt.Printf("%-12s %12s %12s %s\n", "CRITERION", "LIMIT", "ACTUAL", "")
+	for _, c := range checks {
+		limit := fmt.Sprintf(">= %.3f", c.Limit)
+		if c.Max {
+			limit = fmt.Sprintf("<= %.3f", c.Limit)
+		}
+		verdict := "pass"
+		if !c.Passed {
+			verdict = "FAIL"
+		}
+		fmt.Printf("%-12s %12s %12.3f %s\n", c.Name, limit, c.Actual, verdict)
+	}
+	if slaPassed(checks) {
+		fmt.Printf("Verdict: PASS\n")
+	} else {
+		fmt.Printf("Verdict: FAIL\n")
+	}
+	fmt.Printf("-----------\n")
+}
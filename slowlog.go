@@ -0,0 +1,87 @@
+// slowlog.go contains the slow request log. Requests that take longer than -slow-threshold are counted and logged
+// with the time they spent in each phase, taken from httptrace, so tail-latency offenders can be found in the log.
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// RequestPhases holds the times at which a request passed the phases of its connection and exchange.
+// It is safe for concurrent use; the dials of happy eyeballs may run concurrently.
+type RequestPhases struct {
+	mu           sync.Mutex
+	getConn      time.Time
+	dnsStart     time.Time
+	dnsDone      time.Time
+	connectStart time.Time
+	connectDone  time.Time
+	tlsStart     time.Time
+	tlsDone      time.Time
+	gotConn      time.Time
+	wroteRequest time.Time
+	firstByte    time.Time
+}
+
+// withRequestPhases returns a context that records the phases of a request in phases, if slow requests are logged.
+func withRequestPhases(ctx context.Context, phases *RequestPhases) context.Context {
+	if *slowThresholdFlag <= 0 {
+		return ctx
+	}
+	mark := func(t *time.Time) {
+		phases.mu.Lock()
+		*t = time.Now()
+		phases.mu.Unlock()
+	}
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GetConn:              func(string) { mark(&phases.getConn) },
+		DNSStart:             func(httptrace.DNSStartInfo) { mark(&phases.dnsStart) },
+		DNSDone:              func(httptrace.DNSDoneInfo) { mark(&phases.dnsDone) },
+		ConnectStart:         func(string, string) { mark(&phases.connectStart) },
+		ConnectDone:          func(string, string, error) { mark(&phases.connectDone) },
+		TLSHandshakeStart:    func() { mark(&phases.tlsStart) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { mark(&phases.tlsDone) },
+		GotConn:              func(httptrace.GotConnInfo) { mark(&phases.gotConn) },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { mark(&phases.wroteRequest) },
+		GotFirstResponseByte: func() { mark(&phases.firstByte) },
+	})
+}
+
+// phaseMillis returns the milliseconds between two phase times, or 0 if the request did not pass both.
+func phaseMillis(from, to time.Time) float64 {
+	if from.IsZero() || to.IsZero() || to.Before(from) {
+		return 0
+	}
+	return durationMillis(to.Sub(from))
+}
+
+// checkSlowRequest counts and logs a request that took longer than -slow-threshold,
+// with the milliseconds it spent resolving, connecting, in the TLS handshake, waiting for a connection,
+// sending, and waiting for the first response byte.
+func checkSlowRequest(sh *shard, summary RequestSummary) {
+	if *slowThresholdFlag <= 0 || summary.Duration < *slowThresholdFlag {
+		return
+	}
+	sh.count(CounterSlowRequests)
+
+	attrs := []any{"component", componentRequest, "request_id", summary.RequestID, "parameter", summary.Parameter,
+		"proxy", summary.Proxy, "status", summary.StatusCode, "error_class", summary.ErrorClass.String(),
+		"duration_ms", durationMillis(summary.Duration)}
+	if p := summary.Phases; p != nil {
+		p.mu.Lock()
+		attrs = append(attrs,
+			"dns_ms", phaseMillis(p.dnsStart, p.dnsDone),
+			"connect_ms", phaseMillis(p.connectStart, p.connectDone),
+			"tls_ms", phaseMillis(p.tlsStart, p.tlsDone),
+			"get_conn_ms", phaseMillis(p.getConn, p.gotConn),
+			"send_ms", phaseMillis(p.gotConn, p.wroteRequest),
+			"wait_ms", phaseMillis(p.wroteRequest, p.firstByte))
+		p.mu.Unlock()
+	}
+	slog.Warn("Slow request", attrs...)
+}
@@ -0,0 +1,164 @@
+// snapshot.go contains the periodic JSON stats snapshot, which atomically replaces a stats file
+// with the rolling stats every few seconds so external tooling can scrape the state of a run.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// statsSnapshotJSON is the layout of the JSON stats snapshot file.
+type statsSnapshotJSON struct {
+	Timestamp         time.Time        `json:"timestamp"`
+	Requests          int64            `json:"requests"`
+	Successes         int64            `json:"successes"`
+	Failures          int64            `json:"failures"`
+	HeadersOnly       int64            `json:"headers_only"`
+	BytesIn           int64            `json:"bytes_in"`
+	ProxySuccesses    int64            `json:"proxy_successes"`
+	ProxyFailures     int64            `json:"proxy_failures"`
+	UniqueIPs         int              `json:"unique_ips"`
+	RequestsPerMinute int64            `json:"requests_per_minute"`
+	StatusCodes       map[string]int64 `json:"status_codes"`
+	Errors            map[string]int64 `json:"errors"`
+	Latency           latencyJSON      `json:"latency_ms"`
+}
+
+// latencyJSON is the layout of the latency percentiles in the JSON stats snapshot, in milliseconds.
+type latencyJSON struct {
+	Count int64   `json:"count"`
+	Min   float64 `json:"min"`
+	Mean  float64 `json:"mean"`
+	P50   float64 `json:"p50"`
+	P90   float64 `json:"p90"`
+	P95   float64 `json:"p95"`
+	P99   float64 `json:"p99"`
+	Max   float64 `json:"max"`
+}
+
+// writeStatsSnapshots writes the rolling stats to the file at path every statsSnapshotInterval.
+// It does nothing if statsSnapshotInterval is not positive, and stops once ctx is cancelled.
+func writeStatsSnapshots(ctx context.Context, collector *StatsCollector, path string) {
+	if statsSnapshotInterval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(statsSnapshotInterval)
+		defer ticker.Stop()
+
+		minuteTicker := time.NewTicker(1 * time.Minute)
+		defer minuteTicker.Stop()
+
+		// Requests counted at the start of the current minute
+		var minuteStart int64
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := writeStatsSnapshotFile(path, takeStatsSample(collector, minuteStart)); err != nil {
+					slog.Error("Failed to write stats snapshot", "component", componentOutput, "error", err)
+				}
+			case <-minuteTicker.C:
+				minuteStart = collector.Get(CounterRequests)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// writeStatsSnapshotFile writes a sample to the file at path as JSON.
+// The file is written to a temporary file first and renamed over path,
+// so readers never see a partially written snapshot.
+func writeStatsSnapshotFile(path string, sample statsSample) error {
+	data, err := json.MarshalIndent(newStatsSnapshotJSON(sample), "", "  ")
+	if err != nil {
+		slog.Error("Error in writeStatsSnapshotFile", "component", componentOutput, "error", err)
+		return fmt.Errorf("Failed to encode stats snapshot: %w", err)
+	}
+
+	if err := replaceFile(path, data); err != nil {
+		slog.Error("Error in writeStatsSnapshotFile", "component", componentOutput, "error", err)
+		return fmt.Errorf("Failed to replace stats snapshot file: %w", err)
+	}
+
+	return nil
+}
+
+// replaceFile writes data to a temporary file next to path and renames it over path,
+// so readers never see a partially written file.
+func replaceFile(path string, data []byte) error {
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("Failed to create temporary file: %w", err)
+	}
+	// Remove the temporary file if it was not renamed over path
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return fmt.Errorf("Failed to write temporary file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("Failed to close temporary file: %w", err)
+	}
+	if err := os.Rename(file.Name(), path); err != nil {
+		return fmt.Errorf("Failed to rename temporary file: %w", err)
+	}
+
+	return nil
+}
+
+// newStatsSnapshotJSON converts a sample to the layout of the JSON stats snapshot file.
+func newStatsSnapshotJSON(sample statsSample) statsSnapshotJSON {
+	snapshot := statsSnapshotJSON{
+		Timestamp:         time.Now(),
+		Requests:          sample.Requests,
+		Successes:         sample.Successes,
+		Failures:          sample.Failures,
+		HeadersOnly:       sample.HeadersOnly,
+		BytesIn:           sample.BytesIn,
+		ProxySuccesses:    sample.ProxySuccesses,
+		ProxyFailures:     sample.ProxyFailures,
+		UniqueIPs:         sample.UniqueIPs,
+		RequestsPerMinute: sample.RequestsPerMinute,
+		StatusCodes:       make(map[string]int64, len(sample.StatusCodes)),
+		Errors:            make(map[string]int64),
+		Latency: latencyJSON{
+			Count: sample.Latency.Count,
+			Min:   durationMillis(sample.Latency.Min),
+			Mean:  durationMillis(sample.Latency.Mean),
+			P50:   durationMillis(sample.Latency.P50),
+			P90:   durationMillis(sample.Latency.P90),
+			P95:   durationMillis(sample.Latency.P95),
+			P99:   durationMillis(sample.Latency.P99),
+			Max:   durationMillis(sample.Latency.Max),
+		},
+	}
+	for code, count := range sample.StatusCodes {
+		label := fmt.Sprint(code)
+		if code == 0 {
+			label = "other"
+		}
+		snapshot.StatusCodes[label] = count
+	}
+	for class, count := range sample.ErrorClasses {
+		if count > 0 {
+			snapshot.Errors[ErrorClass(class).String()] = count
+		}
+	}
+
+	return snapshot
+}
+
+// durationMillis returns a duration as fractional milliseconds.
+func durationMillis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,39 @@
+// source.go contains the rotation of local source addresses for multi-homed load machines.
+// Direct connections bind to the addresses of sourceAddresses in turn, so a run spreads over several egress IPs.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"sync/atomic"
+)
+
+// sourceTCPAddrs holds the parsed source addresses
+var sourceTCPAddrs []*net.TCPAddr
+
+// sourceAddrCounter is used to rotate through the source addresses
+var sourceAddrCounter uint64
+
+// setupSourceAddresses parses sourceAddresses into sourceTCPAddrs.
+func setupSourceAddresses() error {
+	for _, addr := range sourceAddresses {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return fmt.Errorf("source address %q is not an IP address", addr)
+		}
+		sourceTCPAddrs = append(sourceTCPAddrs, &net.TCPAddr{IP: ip})
+	}
+	return nil
+}
+
+// sourceDialer returns dialer bound to the next source address, or dialer itself if no source addresses are set.
+// The dialer only dials target addresses of the same family as the source address.
+func sourceDialer(dialer *net.Dialer) *net.Dialer {
+	if len(sourceTCPAddrs) == 0 {
+		return dialer
+	}
+	bound := *dialer
+	bound.LocalAddr = sourceTCPAddrs[(atomic.AddUint64(&sourceAddrCounter, 1)-1)%uint64(len(sourceTCPAddrs))]
+	return &bound
+}
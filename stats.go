@@ -3,19 +3,26 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"sync/atomic"
+	"strings"
 	"time"
 )
 
-// requestPerMinute is a counter for the number of requests in the current minute
-var requestPerMinute int32
+// statsSample is a point-in-time copy of the values shown by printStats.
+type statsSample struct {
+	StatsSnapshot
+	UniqueIPs         int
+	RequestsPerMinute int64
+	Latency           LatencySnapshot
+}
 
 // printStats prints statistics about the requests every second.
 // It prints the total number of requests, success count, failure count,
-// successful proxy connections, failed proxy connections, unique IPs, and requests per minute.
-// The function does not take any arguments and does not return anything.
-func printStats() {
+// successful proxy connections, failed proxy connections, unique IPs, requests per minute, and latency percentiles.
+// Depending on statsDisplay, it prints a full block, a compact single-line delta, or updates a block in place.
+// It stops printing once ctx is cancelled.
+func printStats(ctx context.Context, collector *StatsCollector) {
 	go func() {
 		// Create a ticker that ticks every second
 		ticker := time.NewTicker(1 * time.Second)
@@ -25,37 +32,118 @@ func printStats() {
 		minuteTicker := time.NewTicker(1 * time.Minute)
 		defer minuteTicker.Stop()
 
+		var previous statsSample
+		printedLines := 0
+
+		// Requests counted at the start of the current minute
+		var minuteStart int64
+
 		for {
 			select {
 			case <-ticker.C:
 				// Every second, print the statistics
-				// Count the number of unique IPs
-				uniqueIPCount := 0
-				uniqueIPs.Range(func(key, value interface{}) bool {
-					uniqueIPCount++
-					return true
-				})
-
-				// Print the statistics
-				fmt.Printf("\n--- STATS ---\n")
-				fmt.Printf("Total requests: %d\n", atomic.LoadInt32(&totalRequests))
-				fmt.Printf("Success count: %d\n", atomic.LoadInt32(&successCount))
-				fmt.Printf("Failure count: %d\n", atomic.LoadInt32(&failureCount))
-				fmt.Printf("Successful proxy connections: %d\n", atomic.LoadInt32(&successfulProxyConnections))
-				fmt.Printf("Failed proxy connections: %d\n", atomic.LoadInt32(&failedProxyConnections))
-				fmt.Printf("Unique IPs: %d\n", uniqueIPCount)
-				fmt.Printf("Requests per minute: %d\n", atomic.LoadInt32(&requestPerMinute))
-				fmt.Printf("-------------\n")
+				current := takeStatsSample(collector, minuteStart)
+				switch statsDisplay {
+				case "delta":
+					fmt.Println(formatStatsDelta(previous, current))
+				case "inplace":
+					printedLines = printStatsInPlace(current, printedLines)
+				default:
+					fmt.Printf("\n%s\n", strings.Join(formatStatsBlock(current), "\n"))
+				}
+				previous = current
 			case <-minuteTicker.C:
-				// Every minute, reset the requests per minute counter
-				atomic.StoreInt32(&requestPerMinute, 0)
+				// Every minute, restart the requests per minute count
+				minuteStart = collector.Get(CounterRequests)
+			case <-ctx.Done():
+				return
 			}
 		}
 	}()
 }
 
-// When a request is made, increment the total requests and requests per minute counters
-func onRequest() {
-	atomic.AddInt32(&totalRequests, 1)
-	atomic.AddInt32(&requestPerMinute, 1)
+// takeStatsSample reads the current values of all counters of collector.
+// Requests per minute are counted from minuteStart, the request count at the start of the current minute.
+func takeStatsSample(collector *StatsCollector, minuteStart int64) statsSample {
+	snapshot := collector.Snapshot()
+	return statsSample{
+		StatsSnapshot:     snapshot,
+		UniqueIPs:         countUniqueIPs(),
+		RequestsPerMinute: snapshot.Requests - minuteStart,
+		Latency:           latencies.Snapshot(),
+	}
+}
+
+// countUniqueIPs returns the number of unique proxy exit IPs seen so far.
+func countUniqueIPs() int {
+	count := 0
+	uniqueIPs.Range(func(key, value interface{}) bool {
+		count++
+		return true
+	})
+	return count
+}
+
+// formatStatsBlock formats a sample as the multi-line stats block.
+func formatStatsBlock(sample statsSample) []string {
+	lines := []string{
+		"--- STATS ---",
+		fmt.Sprintf("Total requests: %d", sample.Requests),
+		fmt.Sprintf("Success count: %d", sample.Successes),
+		fmt.Sprintf("Failure count: %d", sample.Failures),
+	}
+	if headersOnly {
+		lines = append(lines, fmt.Sprintf("Headers-only responses: %d", sample.HeadersOnly))
+	}
+	if useProxy {
+		lines = append(lines,
+			fmt.Sprintf("Successful proxy connections: %d", sample.ProxySuccesses),
+			fmt.Sprintf("Failed proxy connections: %d", sample.ProxyFailures),
+			fmt.Sprintf("Unique IPs: %d", sample.UniqueIPs),
+		)
+	} else {
+		lines = append(lines, fmt.Sprintf("Direct connections dialed: %d", sample.DirectDials))
+	}
+	lines = append(lines,
+		fmt.Sprintf("Requests per minute: %d", sample.RequestsPerMinute),
+		fmt.Sprintf("Latency: %s", sample.Latency),
+		fmt.Sprintf("Status codes: %s", sample.StatusCodes),
+		fmt.Sprintf("Errors: %s", sample.ErrorClasses),
+		"-------------",
+	)
+	return lines
+}
+
+// formatStatsDelta formats the change between two samples as a single compact line.
+func formatStatsDelta(previous, current statsSample) string {
+	return fmt.Sprintf("requests +%d, ok +%d, errors +%d, proxies +%d/-%d, p95 %s, total %d",
+		current.Requests-previous.Requests,
+		current.Successes-previous.Successes,
+		current.Failures-previous.Failures,
+		current.ProxySuccesses-previous.ProxySuccesses,
+		current.ProxyFailures-previous.ProxyFailures,
+		current.Latency.P95.Round(time.Millisecond),
+		current.Requests,
+	)
+}
+
+// printStatsInPlace prints the stats block, overwriting the previously printed block
+// with terminal cursor control. It returns the number of lines printed.
+func printStatsInPlace(sample statsSample, printedLines int) int {
+	lines := formatStatsBlock(sample)
+
+	var b strings.Builder
+	if printedLines > 0 {
+		// Move the cursor back up to the start of the previous block
+		fmt.Fprintf(&b, "\033[%dA", printedLines)
+	}
+	for _, line := range lines {
+		// Clear the line before writing it
+		b.WriteString("\033[2K")
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+	fmt.Print(b.String())
+
+	return len(lines)
 }
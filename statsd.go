@@ -0,0 +1,136 @@
+// statsd.go contains the StatsD metrics sink, which pushes request timings and counters over UDP
+// in the StatsD format, with DogStatsD tags if configured, to an agent running next to the load generator.
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// statsdMaxPacket is the largest UDP payload sent to the agent, small enough to avoid fragmentation
+const statsdMaxPacket = 1432
+
+// StatsDSink buffers StatsD metrics for every request and sends them in packets of up to statsdMaxPacket bytes.
+// It is safe for concurrent use.
+type StatsDSink struct {
+	mu   sync.Mutex
+	conn net.Conn
+	buf  []byte
+	tags string // Preformatted DogStatsD tags appended to every metric
+	done chan struct{}
+}
+
+// openStatsDSink connects to the StatsD agent at addr.
+// Buffered metrics are sent every statsdFlushInterval, when the buffer is full, and when the sink is closed.
+func openStatsDSink(addr string) (*StatsDSink, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		slog.Error("Error in openStatsDSink", "component", componentOutput, "error", err)
+		return nil, fmt.Errorf("Failed to connect to StatsD agent: %w", err)
+	}
+
+	sink := &StatsDSink{
+		conn: conn,
+		buf:  make([]byte, 0, statsdMaxPacket),
+		tags: strings.Join(statsdTags, ","),
+		done: make(chan struct{}),
+	}
+	go sink.flushPeriodically()
+
+	return sink, nil
+}
+
+// Write buffers the counters and timing of a request.
+func (s *StatsDSink) Write(summary RequestSummary) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if summary.ErrorClass != ErrorClassNone {
+		s.appendMetric("request.failures", "1", "c", "class:"+summary.ErrorClass.String())
+	}
+	if summary.StatusCode != 0 {
+		s.appendMetric("requests", "1", "c", fmt.Sprintf("status:%d", summary.StatusCode))
+		s.appendMetric("request.duration", formatMillis(summary.Duration), "ms", "")
+		s.appendMetric("response.bytes", fmt.Sprint(summary.BytesIn), "c", "")
+	}
+}
+
+// appendMetric adds a metric to the buffer, sending the buffer first if the metric does not fit.
+// The caller must hold the lock.
+func (s *StatsDSink) appendMetric(name, value, kind, tag string) {
+	line := statsdPrefix + name + ":" + value + "|" + kind
+	if tags := joinTags(s.tags, tag); tags != "" {
+		line += "|#" + tags
+	}
+
+	if len(s.buf) > 0 && len(s.buf)+1+len(line) > statsdMaxPacket {
+		s.flushLocked()
+	}
+	if len(s.buf) > 0 {
+		s.buf = append(s.buf, '\n')
+	}
+	s.buf = append(s.buf, line...)
+}
+
+// joinTags joins the non-empty tag lists.
+func joinTags(a, b string) string {
+	switch {
+	case a == "":
+		return b
+	case b == "":
+		return a
+	default:
+		return a + "," + b
+	}
+}
+
+// flushLocked sends the buffered metrics. The caller must hold the lock.
+func (s *StatsDSink) flushLocked() {
+	if len(s.buf) == 0 {
+		return
+	}
+	// UDP is fire and forget; a lost packet only loses some samples
+	if _, err := s.conn.Write(s.buf); err != nil {
+		slog.Error("Failed to send StatsD metrics", "component", componentOutput, "error", err)
+	}
+	s.buf = s.buf[:0]
+}
+
+// flushPeriodically sends the pool gauges and the buffered metrics every statsdFlushInterval until the sink is closed.
+func (s *StatsDSink) flushPeriodically() {
+	ticker := time.NewTicker(statsdFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.mu.Lock()
+			if useProxy && proxiesPool != nil {
+				s.appendMetric("proxy.pool_size", fmt.Sprint(proxiesPool.Len()), "g", "")
+			}
+			s.flushLocked()
+			s.mu.Unlock()
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// Close sends the buffered metrics and closes the connection.
+func (s *StatsDSink) Close() error {
+	close(s.done)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flushLocked()
+	if err := s.conn.Close(); err != nil {
+		slog.Error("Error in Close", "component", componentOutput, "error", err)
+		return fmt.Errorf("Failed to close StatsD connection: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+// stop.go contains the run-wide context, which is cancelled when the run is asked to stop: by requestStop,
+// an interrupt or termination signal, the runDuration deadline, or an abort condition.
+// Threads finish the request they are sending and exit, the background goroutines return,
+// and once the threads have all exited the progress bar is aborted so the run ends with its final report.
+
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/vbauerster/mpb/v7"
+)
+
+// runCtx is the context of the current run; it is cancelled when the run is asked to stop
+var runCtx, cancelRun = context.WithCancel(context.Background())
+
+// threadsRunning tracks the running threads, so a stopped run can wait for them to exit
+var threadsRunning sync.WaitGroup
+
+// setupRunContext creates the context of the run, which is also cancelled by an interrupt or termination signal
+// and, if runDuration is set, once the run has lasted that long. Once it is cancelled, a second signal
+// kills the process, and threads waiting for a proxy or a paused run are woken up so they notice.
+func setupRunContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	ctx, stopSignals := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	cancelDeadline := context.CancelFunc(func() {})
+	if runDuration > 0 {
+		ctx, cancelDeadline = context.WithTimeout(ctx, runDuration)
+	}
+	runCtx, cancelRun = ctx, cancel
+
+	context.AfterFunc(ctx, func() {
+		stopSignals()
+		cancelDeadline()
+		if proxiesPool != nil {
+			proxiesPool.WakeAll()
+		}
+		runControl.wake()
+	})
+
+	return ctx
+}
+
+// requestStop asks the run to stop. It is safe to call more than once and from any goroutine.
+func requestStop() {
+	cancelRun()
+}
+
+// stopping reports whether the run has been asked to stop.
+func stopping() bool {
+	return runCtx.Err() != nil
+}
+
+// abortOnStop waits for the run to be asked to stop and for the threads to exit,
+// then flushes the shards and aborts the progress bar so that waiting for it returns.
+func abortOnStop(ctx context.Context, bar *mpb.Bar) {
+	<-ctx.Done()
+	threadsRunning.Wait()
+
+	for _, s := range shards {
+		s.flush(bar)
+	}
+	bar.Abort(false)
+}
@@ -0,0 +1,30 @@
+// sweep.go contains the content negotiation sweep mode, which rotates the Accept-Language and Accept
+// headers across a configured matrix and reports response size and latency per combination.
+
+package main
+
+import "sync/atomic"
+
+// negotiationStats aggregates the outcome of requests per header combination
+var negotiationStats = newParameterAggregator()
+
+// negotiationCounter is used to rotate through the header combinations
+var negotiationCounter uint64
+
+// nextNegotiationHeaders returns the Accept-Language and Accept values for the next request,
+// cycling through every combination of sweepLanguages and sweepAccepts.
+func nextNegotiationHeaders() (string, string) {
+	n := atomic.AddUint64(&negotiationCounter, 1) - 1
+	combination := n % uint64(len(sweepLanguages)*len(sweepAccepts))
+	return sweepLanguages[combination/uint64(len(sweepAccepts))], sweepAccepts[combination%uint64(len(sweepAccepts))]
+}
+
+// negotiationKey returns the key a request's header combination is aggregated under.
+func negotiationKey(language, accept string) string {
+	return language + " | " + accept
+}
+
+// printNegotiationSummary prints the per-combination table, slowest mean duration first.
+func printNegotiationSummary() {
+	printSummaryTable("NEGOTIATION SWEEP", "LANGUAGE | ACCEPT", negotiationStats.Summaries())
+}
@@ -0,0 +1,174 @@
+// syslog.go contains the syslog output of the logs. When syslogAddr is set, the records of requests.log and
+// proxies.log are sent as RFC 5424 messages to a local or remote syslog endpoint instead of being written to files,
+// so they outlive ephemeral load boxes. Stream connections use octet-counting framing (RFC 6587).
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// The syslog severities of the log records
+const (
+	syslogSeverityError   = 3
+	syslogSeverityWarning = 4
+	syslogSeverityNotice  = 5
+	syslogSeverityInfo    = 6
+	syslogSeverityDebug   = 7
+)
+
+// syslogTimeFormat is the RFC 5424 timestamp, which allows at most microsecond precision
+const syslogTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+// SyslogWriter sends every write as one syslog message with the given MSGID.
+// It reconnects once if a write fails. It is safe for concurrent use.
+type SyslogWriter struct {
+	mu       sync.Mutex
+	network  string
+	addr     string
+	msgID    string
+	severity int // Severity of writes that are not JSON log records
+	hostname string
+	conn     net.Conn
+}
+
+// openSyslogWriter connects to the syslog endpoint at syslogAddr: udp://host:port, tcp://host:port,
+// or unix:///path for a local datagram socket such as /dev/log.
+// Writes that are not JSON log records are sent with the given severity.
+func openSyslogWriter(msgID string, severity int) (*SyslogWriter, error) {
+	u, err := url.Parse(syslogAddr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid syslog address %q: %w", syslogAddr, err)
+	}
+	w := &SyslogWriter{msgID: msgID, severity: severity, hostname: "-"}
+	switch u.Scheme {
+	case "udp", "tcp":
+		w.network, w.addr = u.Scheme, u.Host
+	case "unix":
+		w.network, w.addr = "unixgram", u.Path
+	default:
+		return nil, fmt.Errorf("unknown syslog address scheme %q, expected udp, tcp, or unix", u.Scheme)
+	}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		w.hostname = hostname
+	}
+	if err := w.connect(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// setupSyslogLoggers sets up the main and proxies loggers to send their records to syslog,
+// with the MSGIDs "requests" and "proxies". Severity filtering takes the place of the error log.
+// It returns the main writer, the proxies logger, and an error if the endpoint cannot be reached.
+func setupSyslogLoggers() (io.WriteCloser, *log.Logger, error) {
+	syslogWriter, err := openSyslogWriter("requests", syslogSeverityInfo)
+	if err != nil {
+		slog.Error("Error in setupSyslogLoggers", "component", componentMain, "error", err)
+		return nil, nil, fmt.Errorf("Failed to open syslog for the main log: %w", err)
+	}
+	var requests io.WriteCloser = syslogWriter
+	if logAsync {
+		requests = newAsyncWriter(syslogWriter, false)
+	}
+	setLogOutput(requests)
+
+	proxies, err := openSyslogWriter("proxies", syslogSeverityNotice)
+	if err != nil {
+		requests.Close()
+		slog.Error("Error in setupSyslogLoggers", "component", componentMain, "error", err)
+		return nil, nil, fmt.Errorf("Failed to open syslog for the proxies log: %w", err)
+	}
+
+	return requests, log.New(proxies, "", 0), nil
+}
+
+// connect dials the syslog endpoint. The caller must hold the lock or own w.
+func (w *SyslogWriter) connect() error {
+	conn, err := net.DialTimeout(w.network, w.addr, clientTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to connect to syslog at %s: %w", syslogAddr, err)
+	}
+	w.conn = conn
+	return nil
+}
+
+// Write sends p as one syslog message, with the severity of its level if it is a JSON log record.
+func (w *SyslogWriter) Write(p []byte) (int, error) {
+	msg := w.format(bytes.TrimRight(p, "\n"))
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.conn == nil {
+		if err := w.connect(); err != nil {
+			return 0, err
+		}
+	}
+	if _, err := w.conn.Write(msg); err != nil {
+		// Reconnect once, for a restarted syslog daemon or a dropped TCP connection
+		w.conn.Close()
+		w.conn = nil
+		if err := w.connect(); err != nil {
+			return 0, err
+		}
+		if _, err := w.conn.Write(msg); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// format builds the RFC 5424 message of a record, framed with its length on stream connections.
+func (w *SyslogWriter) format(record []byte) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "<%d>1 %s %s %s %d %s - ", syslogFacility*8+w.recordSeverity(record),
+		time.Now().Format(syslogTimeFormat), w.hostname, syslogAppName, os.Getpid(), w.msgID)
+	b.Write(record)
+	if w.network != "tcp" {
+		return b.Bytes()
+	}
+	return append([]byte(strconv.Itoa(b.Len())+" "), b.Bytes()...)
+}
+
+// recordSeverity returns the syslog severity of the level of a JSON log record,
+// or the writer's severity if the record has no level.
+func (w *SyslogWriter) recordSeverity(record []byte) int {
+	i := bytes.Index(record, []byte(`"level":"`))
+	if i < 0 {
+		return w.severity
+	}
+	level := record[i+len(`"level":"`):]
+	switch {
+	case bytes.HasPrefix(level, []byte("ERROR")):
+		return syslogSeverityError
+	case bytes.HasPrefix(level, []byte("WARN")):
+		return syslogSeverityWarning
+	case bytes.HasPrefix(level, []byte("DEBUG")):
+		return syslogSeverityDebug
+	default:
+		return syslogSeverityInfo
+	}
+}
+
+// Close closes the connection to the syslog endpoint.
+func (w *SyslogWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSyslogRecordSeverity(t *testing.T) {
+	tests := []struct {
+		name   string
+		record string
+		want   int
+	}{
+		{"error", `{"time":"t","level":"ERROR","msg":"m"}`, syslogSeverityError},
+		{"warning", `{"time":"t","level":"WARN","msg":"m"}`, syslogSeverityWarning},
+		{"info", `{"time":"t","level":"INFO","msg":"m"}`, syslogSeverityInfo},
+		{"debug", `{"time":"t","level":"DEBUG","msg":"m"}`, syslogSeverityDebug},
+		{"level with offset", `{"level":"ERROR+2"}`, syslogSeverityError},
+		{"unknown level", `{"level":"TRACE"}`, syslogSeverityInfo},
+		{"no level", "proxy 1.2.3.4:80 failed", syslogSeverityNotice},
+		{"empty", "", syslogSeverityNotice},
+	}
+	w := &SyslogWriter{severity: syslogSeverityNotice}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := w.recordSeverity([]byte(tt.record)); got != tt.want {
+				t.Errorf("recordSeverity(%q) = %d, want %d", tt.record, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSyslogFormat(t *testing.T) {
+	// PRI VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+	message := regexp.MustCompile(`^<(\d+)>1 (\S+) loadbox (\S+) (\d+) (\S+) - (.*)$`)
+	tests := []struct {
+		name     string
+		network  string
+		msgID    string
+		record   string
+		wantPRI  int
+		wantMsg  string
+		wantSize bool // Whether the message is prefixed with its length
+	}{
+		{"udp error", "udp", "requests", `{"level":"ERROR","msg":"m"}`, syslogFacility*8 + syslogSeverityError, `{"level":"ERROR","msg":"m"}`, false},
+		{"unix info", "unixgram", "requests", `{"level":"INFO","msg":"m"}`, syslogFacility*8 + syslogSeverityInfo, `{"level":"INFO","msg":"m"}`, false},
+		{"tcp warning", "tcp", "requests", `{"level":"WARN","msg":"m"}`, syslogFacility*8 + syslogSeverityWarning, `{"level":"WARN","msg":"m"}`, true},
+		{"tcp plain line", "tcp", "proxies", "proxy failed", syslogFacility*8 + syslogSeverityNotice, "proxy failed", true},
+		{"tcp empty", "tcp", "proxies", "", syslogFacility*8 + syslogSeverityNotice, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &SyslogWriter{network: tt.network, msgID: tt.msgID, severity: syslogSeverityNotice, hostname: "loadbox"}
+			got := string(w.format([]byte(tt.record)))
+
+			if tt.wantSize {
+				match := regexp.MustCompile(`^(\d+) `).FindStringSubmatch(got)
+				if match == nil {
+					t.Fatalf("format() = %q, want an octet count prefix", got)
+				}
+				got = got[len(match[0]):]
+				if size, _ := strconv.Atoi(match[1]); size != len(got) {
+					t.Errorf("octet count = %d, want %d", size, len(got))
+				}
+			}
+
+			match := message.FindStringSubmatch(got)
+			if match == nil {
+				t.Fatalf("format() = %q, not an RFC 5424 message", got)
+			}
+			if pri, _ := strconv.Atoi(match[1]); pri != tt.wantPRI {
+				t.Errorf("PRI = %d, want %d", pri, tt.wantPRI)
+			}
+			if _, err := time.Parse(syslogTimeFormat, match[2]); err != nil {
+				t.Errorf("TIMESTAMP %q: %s", match[2], err)
+			}
+			if match[3] != syslogAppName {
+				t.Errorf("APP-NAME = %q, want %q", match[3], syslogAppName)
+			}
+			if match[5] != tt.msgID {
+				t.Errorf("MSGID = %q, want %q", match[5], tt.msgID)
+			}
+			if match[6] != tt.wantMsg {
+				t.Errorf("MSG = %q, want %q", match[6], tt.wantMsg)
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+// template.go contains the request template engine, which expands {{...}} tokens in the URL, headers, and body
+// of every request with a fresh value: {{rng a b}}, {{uuid}}, {{timestamp}}, {{randstr n}}, {{choice a|b|c}},
+// {{data column}} from the row of the data file, and the fake data tokens of fake.go.
+
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// templateToken matches a {{name args}} template token; the name has to start the token,
+// so JSON bodies with nested objects such as {{"a":1}} are left alone
+var templateToken = regexp.MustCompile(`\{\{\s*([a-z][a-z0-9]*)\b([^{}]*)\}\}`)
+
+// randstrAlphabet holds the characters {{randstr n}} draws from
+const randstrAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// templateHeaderNames holds the names of the requestHeaders in sorted order, set by setupTemplates,
+// so the tokens of the headers are expanded in the same order for the same seed
+var templateHeaderNames []string
+
+// setupTemplates checks every template token in the base URL, the request body, and the request headers,
+// so a typo fails the run at startup instead of being sent verbatim with every request.
+func setupTemplates() error {
+	if err := validateTemplate(baseUrl); err != nil {
+		return fmt.Errorf("base URL: %w", err)
+	}
+	if err := validateTemplate(requestBody); err != nil {
+		return fmt.Errorf("request body: %w", err)
+	}
+	templateHeaderNames = templateHeaderNames[:0]
+	for name, value := range requestHeaders {
+		if err := validateTemplate(value); err != nil {
+			return fmt.Errorf("header %s: %w", name, err)
+		}
+		templateHeaderNames = append(templateHeaderNames, name)
+	}
+	sort.Strings(templateHeaderNames)
+	return nil
+}
+
+// validateTemplate returns an error for the first template token in s that cannot be expanded.
+func validateTemplate(s string) error {
+	r := rand.New(rand.NewSource(runSeed))
+	for _, match := range templateToken.FindAllStringSubmatch(s, -1) {
+		// Data tokens have no row to take a value from before the run, so only their column is checked
+		if match[1] == "data" {
+			if err := validateDataColumn(strings.TrimSpace(match[2])); err != nil {
+				return fmt.Errorf("%s: %w", match[0], err)
+			}
+			continue
+		}
+		if _, err := evalTemplateToken(match[1], match[2], r, nil); err != nil {
+			return fmt.Errorf("%s: %w", match[0], err)
+		}
+	}
+	return nil
+}
+
+// expandTemplate replaces every template token in s with a value drawn from r, or taken from row for {{data column}}.
+// Tokens that cannot be expanded are left as they are; setupTemplates reports them before the run.
+// The values are inserted as they are, as fits headers and bodies.
+func expandTemplate(s string, r *rand.Rand, row DataRow) string {
+	return expandTemplateEscaped(s, r, row, nil)
+}
+
+// expandURLTemplate is expandTemplate for a URL: values of tokens in the query or fragment are query-escaped,
+// and values of tokens before them are path-escaped, so a value with spaces, &, # or = stays one value.
+func expandURLTemplate(s string, r *rand.Rand, row DataRow) string {
+	if !strings.Contains(s, "{{") {
+		return s
+	}
+
+	// The query starts at the first ? outside a token, since token arguments may contain one
+	query := len(s)
+	tokens := templateToken.FindAllStringIndex(s, -1)
+	for i, t := 0, 0; i < len(s); i++ {
+		for t < len(tokens) && tokens[t][1] <= i {
+			t++
+		}
+		if t < len(tokens) && tokens[t][0] <= i {
+			i = tokens[t][1] - 1
+			continue
+		}
+		if s[i] == '?' || s[i] == '#' {
+			query = i
+			break
+		}
+	}
+
+	// Expand the path first, so the values are drawn from r in the order the tokens appear
+	path := expandTemplateEscaped(s[:query], r, row, url.PathEscape)
+	return path + expandTemplateEscaped(s[query:], r, row, url.QueryEscape)
+}
+
+// expandTemplateEscaped is expandTemplate with every value passed through escape, unless escape is nil.
+func expandTemplateEscaped(s string, r *rand.Rand, row DataRow, escape func(string) string) string {
+	if !strings.Contains(s, "{{") {
+		return s
+	}
+	return templateToken.ReplaceAllStringFunc(s, func(token string) string {
+		match := templateToken.FindStringSubmatch(token)
+		value, err := evalTemplateToken(match[1], match[2], r, row)
+		if err != nil {
+			return token
+		}
+		if escape != nil {
+			return escape(value)
+		}
+		return value
+	})
+}
+
+// evalTemplateToken returns the value of the template token with the given name and arguments.
+func evalTemplateToken(name, args string, r *rand.Rand, row DataRow) (string, error) {
+	args = strings.TrimSpace(args)
+	switch name {
+	case "data":
+		value, ok := row[args]
+		if !ok {
+			return "", fmt.Errorf("no data column %q", args)
+		}
+		return value, nil
+	case "rng":
+		fields := strings.Fields(args)
+		if len(fields) != 2 {
+			return "", fmt.Errorf("rng takes a minimum and a maximum")
+		}
+		min, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return "", fmt.Errorf("invalid minimum: %w", err)
+		}
+		max, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return "", fmt.Errorf("invalid maximum: %w", err)
+		}
+		if max < min {
+			min, max = max, min
+		}
+		return rng(r, min, max), nil
+	case "uuid":
+		if args != "" {
+			return "", fmt.Errorf("uuid takes no arguments")
+		}
+		return randomUUID(r), nil
+	case "timestamp":
+		if args != "" {
+			return "", fmt.Errorf("timestamp takes no arguments")
+		}
+		return strconv.FormatInt(time.Now().Unix(), 10), nil
+	case "randstr":
+		n, err := strconv.Atoi(args)
+		if err != nil || n < 1 {
+			return "", fmt.Errorf("randstr takes a positive length")
+		}
+		return randomString(r, n), nil
+	case "choice":
+		if args == "" {
+			return "", fmt.Errorf("choice takes options separated by |")
+		}
+		options := strings.Split(args, "|")
+		return strings.TrimSpace(options[r.Intn(len(options))]), nil
+	default:
+		value, ok, err := evalFakeToken(name, args, r)
+		if !ok {
+			return "", fmt.Errorf("unknown template token %q", name)
+		}
+		return value, err
+	}
+}
+
+// randomUUID returns a version 4 UUID drawn from r, so a seeded run sends the same UUIDs again.
+func randomUUID(r *rand.Rand) string {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], r.Uint64())
+	binary.BigEndian.PutUint64(b[8:], r.Uint64())
+	b[6] = b[6]&0x0f | 0x40 // Version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+
+	s := hex.EncodeToString(b[:])
+	return s[0:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:32]
+}
+
+// randomString returns n characters drawn from randstrAlphabet with r.
+func randomString(r *rand.Rand, n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = randstrAlphabet[r.Intn(len(randstrAlphabet))]
+	}
+	return string(b)
+}
+
+// applyTemplateHeaders sets the requestHeaders on a request, expanding their template tokens with r and row.
+func applyTemplateHeaders(req *http.Request, r *rand.Rand, row DataRow) {
+	for _, name := range templateHeaderNames {
+		req.Header.Set(name, expandTemplate(requestHeaders[name], r, row))
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestExpandTemplate(t *testing.T) {
+	row := DataRow{"user": "John Smith", "query": "a&b=c#d"}
+	tests := []struct {
+		name string
+		s    string
+		want string
+	}{
+		{"no tokens", "plain text", "plain text"},
+		{"data", "{{data user}}", "John Smith"},
+		{"data unescaped", `{"q":"{{data query}}"}`, `{"q":"a&b=c#d"}`},
+		{"choice", "{{choice x y|x y}}", "x y"},
+		{"unknown left as is", "{{nope}}", "{{nope}}"},
+		{"json left as is", `{{"a":1}}`, `{{"a":1}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := expandTemplate(tt.s, rand.New(rand.NewSource(1)), row); got != tt.want {
+				t.Errorf("expandTemplate(%q) = %q, want %q", tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandURLTemplate(t *testing.T) {
+	row := DataRow{"user": "John Smith", "query": "a&b=c#d", "dir": "a/b c"}
+	tests := []struct {
+		name string
+		s    string
+		want string
+	}{
+		{"no tokens", "http://host/path?a=1", "http://host/path?a=1"},
+		{"query space", "http://host/?name={{data user}}", "http://host/?name=John+Smith"},
+		{"query separators", "http://host/?q={{data query}}&x=1", "http://host/?q=a%26b%3Dc%23d&x=1"},
+		{"path", "http://host/users/{{data user}}", "http://host/users/John%20Smith"},
+		{"path slash", "http://host/{{data dir}}/x", "http://host/a%2Fb%20c/x"},
+		{"path and query", "http://host/{{data user}}?u={{data user}}", "http://host/John%20Smith?u=John+Smith"},
+		{"fragment", "http://host/p#{{data user}}", "http://host/p#John+Smith"},
+		{"question mark in token", "http://host/{{choice a?b}}?u={{data user}}", "http://host/a%3Fb?u=John+Smith"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := expandURLTemplate(tt.s, rand.New(rand.NewSource(1)), row); got != tt.want {
+				t.Errorf("expandURLTemplate(%q) = %q, want %q", tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandURLTemplateFakeData(t *testing.T) {
+	for _, token := range []string{"name", "lorem 3"} {
+		t.Run(token, func(t *testing.T) {
+			r := rand.New(rand.NewSource(1))
+			want := expandTemplate("{{"+token+"}}", rand.New(rand.NewSource(1)), nil)
+			u, err := url.Parse(expandURLTemplate("http://host/?v={{"+token+"}}&x=1", r, nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := u.Query().Get("v"); got != want || u.Query().Get("x") != "1" {
+				t.Errorf("query v = %q x = %q, want %q and 1", got, u.Query().Get("x"), want)
+			}
+		})
+	}
+}
+
+func TestBuildRequestEscapesParameter(t *testing.T) {
+	var gotName string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotName = r.URL.Query().Get("name")
+	}))
+	defer srv.Close()
+
+	saved := parameters
+	defer func() {
+		parameters = saved
+		requestTarget = ""
+		parameterGenerators = make(map[string]*ParameterGenerator)
+	}()
+	tests := []struct {
+		name  string
+		line  string
+		value string
+	}{
+		{"space", "name=John Smith", "John Smith"},
+		{"separators", "name=a&b=c#d", "a&b=c#d"},
+		{"choice", "name=choice(x y)", "x y"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parameters = []string{tt.line}
+			requestTarget = srv.URL + "/"
+			if err := setupParameterGenerators(); err != nil {
+				t.Fatal(err)
+			}
+			if err := setupParameterOrder(); err != nil {
+				t.Fatal(err)
+			}
+			req, _, err := buildRequest(context.Background(), rand.New(rand.NewSource(1)), nil, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("status %d", resp.StatusCode)
+			}
+			if gotName != tt.value {
+				t.Errorf("server got name %q, want %q", gotName, tt.value)
+			}
+		})
+	}
+}
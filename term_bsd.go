@@ -0,0 +1,13 @@
+// term_bsd.go contains the terminal ioctl requests for macOS and the BSDs.
+
+//go:build darwin || freebsd || netbsd || openbsd
+
+package main
+
+import "syscall"
+
+// The ioctl requests that read and write the terminal attributes
+const (
+	ioctlGetTermios = syscall.TIOCGETA
+	ioctlSetTermios = syscall.TIOCSETA
+)
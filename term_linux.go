@@ -0,0 +1,13 @@
+// term_linux.go contains the terminal ioctl requests for Linux.
+
+//go:build linux
+
+package main
+
+import "syscall"
+
+// The ioctl requests that read and write the terminal attributes
+const (
+	ioctlGetTermios = syscall.TCGETS
+	ioctlSetTermios = syscall.TCSETS
+)
@@ -0,0 +1,26 @@
+// term_other.go contains the terminal queries for systems without Unix terminal ioctls.
+
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+
+package main
+
+import "os"
+
+// terminalSize returns the number of columns and rows of the terminal attached to f.
+// Without terminal ioctls, a terminal is assumed if f is a character device, with a default size.
+func terminalSize(f *os.File) (int, int, bool) {
+	info, err := f.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return 0, 0, false
+	}
+	return 100, 30, true
+}
+
+// enableKeyInput reports whether keys can be read from f. Without terminal ioctls the terminal mode
+// is left alone, so keys are only read once Enter is pressed. The returned function does nothing.
+func enableKeyInput(f *os.File) (func(), bool) {
+	if _, _, ok := terminalSize(f); !ok {
+		return nil, false
+	}
+	return func() {}, true
+}
@@ -0,0 +1,46 @@
+// term_unix.go contains the terminal queries for Unix systems.
+
+//go:build linux || darwin || freebsd || netbsd || openbsd
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// terminalSize returns the number of columns and rows of the terminal attached to f.
+// It returns false if f is not a terminal.
+func terminalSize(f *os.File) (int, int, bool) {
+	var ws struct {
+		Row, Col, Xpixel, Ypixel uint16
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), uintptr(syscall.TIOCGWINSZ), uintptr(unsafe.Pointer(&ws)))
+	if errno != 0 || ws.Col == 0 || ws.Row == 0 {
+		return 0, 0, false
+	}
+	return int(ws.Col), int(ws.Row), true
+}
+
+// enableKeyInput switches the terminal attached to f to reading single keys without echoing them,
+// keeping signal keys such as Ctrl-C working. It returns a function that restores the previous mode,
+// and false if f is not a terminal.
+func enableKeyInput(f *os.File) (func(), bool) {
+	var previous syscall.Termios
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), ioctlGetTermios, uintptr(unsafe.Pointer(&previous))); errno != 0 {
+		return nil, false
+	}
+
+	keys := previous
+	keys.Lflag &^= syscall.ICANON | syscall.ECHO
+	keys.Cc[syscall.VMIN] = 1
+	keys.Cc[syscall.VTIME] = 0
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), ioctlSetTermios, uintptr(unsafe.Pointer(&keys))); errno != 0 {
+		return nil, false
+	}
+
+	return func() {
+		syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), ioctlSetTermios, uintptr(unsafe.Pointer(&previous)))
+	}, true
+}
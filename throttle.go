@@ -0,0 +1,117 @@
+// throttle.go contains the client-side download throttling, which emulates slow clients:
+// the connections of the clients read from the network no faster than a per-connection and a global byte rate,
+// so the target sees many slow readers holding their connections open.
+
+package main
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// globalDownloadBucket limits the bytes read by all connections together when downloadRateGlobal is set
+var globalDownloadBucket = newTokenBucket(downloadRateGlobal)
+
+// tokenBucket hands out tokens at a fixed rate, up to a burst. A nil tokenBucket does not limit.
+// It is safe for concurrent use.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64 // Tokens added per second
+	burst  float64 // Most tokens the bucket holds
+	tokens float64 // Tokens available; negative while taken tokens are still owed
+	last   time.Time
+}
+
+// newTokenBucket creates a bucket of rate tokens per second with a burst of a tenth of a second's worth,
+// or returns nil if rate is not positive.
+func newTokenBucket(rate int64) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+	burst := float64(rate) / 10
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{rate: float64(rate), burst: burst, tokens: burst, last: time.Now()}
+}
+
+// Take takes n tokens and returns how long to wait until they are paid for.
+// Tokens are handed out in order, so concurrent takers share the rate.
+func (b *tokenBucket) Take(n int) time.Duration {
+	if b == nil || n <= 0 {
+		return 0
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// throttledConn is a connection whose reads are limited by its own token bucket and the global one.
+type throttledConn struct {
+	net.Conn
+	bucket    *tokenBucket
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// throttleConn wraps conn so its reads are throttled, or returns conn itself if no download rate is set.
+func throttleConn(conn net.Conn) net.Conn {
+	if downloadRatePerConn <= 0 && downloadRateGlobal <= 0 {
+		return conn
+	}
+	return &throttledConn{Conn: conn, bucket: newTokenBucket(downloadRatePerConn), closed: make(chan struct{})}
+}
+
+// Read reads at most a burst of bytes, then waits until both buckets have paid for them.
+// Waiting instead of reading lets the socket's receive buffer fill, so the target is slowed down by TCP flow control.
+func (c *throttledConn) Read(p []byte) (int, error) {
+	if c.bucket != nil && len(p) > int(c.bucket.burst) {
+		p = p[:int(c.bucket.burst)]
+	}
+	if globalDownloadBucket != nil && len(p) > int(globalDownloadBucket.burst) {
+		p = p[:int(globalDownloadBucket.burst)]
+	}
+	n, err := c.Conn.Read(p)
+
+	wait := c.bucket.Take(n)
+	if global := globalDownloadBucket.Take(n); global > wait {
+		wait = global
+	}
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-c.closed:
+		}
+	}
+
+	return n, err
+}
+
+// Close closes the connection and ends a throttling wait in progress.
+func (c *throttledConn) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return c.Conn.Close()
+}
+
+// formatDownloadRate formats a download rate in bytes per second, or "unlimited" if it is not positive.
+func formatDownloadRate(rate int64) string {
+	if rate <= 0 {
+		return "unlimited"
+	}
+	return formatBytes(rate) + "/s"
+}
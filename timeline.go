@@ -0,0 +1,130 @@
+// timeline.go contains the run timeline, which samples the request counters at a fixed interval
+// so throughput over time can be charted after the run.
+
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// timeline holds the samples of the current run
+var timeline = &Timeline{}
+
+// TimelinePoint is the throughput during one timeline interval.
+type TimelinePoint struct {
+	Elapsed   time.Duration // Time since the start of the run at the end of the interval
+	Requests  float64       // Requests started per second
+	Failures  float64       // Requests failed per second
+	Successes float64       // Requests succeeded per second
+
+	span int // Number of timeline intervals merged into the sample; 0 means 1
+}
+
+// Timeline is a series of throughput samples.
+// It is safe for concurrent use.
+type Timeline struct {
+	mu     sync.Mutex
+	points []TimelinePoint
+}
+
+// recordTimeline samples the request counters every timelineInterval until ctx is cancelled.
+func recordTimeline(ctx context.Context, collector *StatsCollector, start time.Time) {
+	go func() {
+		ticker := time.NewTicker(timelineInterval)
+		defer ticker.Stop()
+
+		var previous StatsSnapshot
+		for {
+			var now time.Time
+			select {
+			case now = <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+			current := collector.Snapshot()
+			seconds := timelineInterval.Seconds()
+			timeline.add(TimelinePoint{
+				Elapsed:   now.Sub(start),
+				Requests:  float64(current.Requests-previous.Requests) / seconds,
+				Failures:  float64(current.Failures-previous.Failures) / seconds,
+				Successes: float64(current.Successes-previous.Successes) / seconds,
+			})
+			previous = current
+		}
+	}()
+}
+
+// add appends a sample to the timeline. Once the timeline holds more than timelineMaxPoints samples,
+// consecutive pairs are merged, so memory stays bounded however long the run is.
+func (t *Timeline) add(point TimelinePoint) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.points = append(t.points, point)
+
+	if len(t.points) <= timelineMaxPoints {
+		return
+	}
+	merged := t.points[:0]
+	for i := 0; i+1 < len(t.points); i += 2 {
+		merged = append(merged, mergeTimelinePoints(t.points[i:i+2]))
+	}
+	if len(t.points)%2 == 1 {
+		merged = append(merged, t.points[len(t.points)-1])
+	}
+	t.points = merged
+}
+
+// mergeTimelinePoints merges consecutive samples into one, weighting each by the intervals it spans.
+func mergeTimelinePoints(points []TimelinePoint) TimelinePoint {
+	var merged TimelinePoint
+	for _, point := range points {
+		span := point.span
+		if span == 0 {
+			span = 1
+		}
+		merged.Requests += point.Requests * float64(span)
+		merged.Failures += point.Failures * float64(span)
+		merged.Successes += point.Successes * float64(span)
+		merged.span += span
+	}
+	n := float64(merged.span)
+	merged.Elapsed = points[len(points)-1].Elapsed
+	merged.Requests /= n
+	merged.Failures /= n
+	merged.Successes /= n
+	return merged
+}
+
+// Last returns the most recent sample, or a zero sample if there is none yet.
+func (t *Timeline) Last() TimelinePoint {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.points) == 0 {
+		return TimelinePoint{}
+	}
+	return t.points[len(t.points)-1]
+}
+
+// Points returns the timeline, averaged down to at most maxPoints samples.
+func (t *Timeline) Points(maxPoints int) []TimelinePoint {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if maxPoints <= 0 || len(t.points) <= maxPoints {
+		return append([]TimelinePoint(nil), t.points...)
+	}
+
+	// Average consecutive samples so the timeline fits into maxPoints
+	per := (len(t.points) + maxPoints - 1) / maxPoints
+	points := make([]TimelinePoint, 0, maxPoints)
+	for i := 0; i < len(t.points); i += per {
+		end := i + per
+		if end > len(t.points) {
+			end = len(t.points)
+		}
+		points = append(points, mergeTimelinePoints(t.points[i:end]))
+	}
+	return points
+}
@@ -0,0 +1,150 @@
+// tlsconfig.go contains the TLS options of the HTTP clients, for testing staging targets with self-signed certificates:
+// certificate verification can be skipped, a custom root CA bundle can be trusted,
+// and the target's certificate can be pinned to a SHA-256 fingerprint.
+// The TLS versions and cipher suites the clients offer can be restricted, to see how the target handles older clients,
+// and the server name sent can be overridden along with the Host header, to test an origin server behind a CDN.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+)
+
+// clientTLSConfig is the TLS configuration of the HTTP clients, or nil to use the defaults
+var clientTLSConfig *tls.Config
+
+// setupTLS builds clientTLSConfig from the -insecure, -ca-file, and -pin-cert flags, the TLS version
+// and cipher suite settings, hostOverride, and the -protocol flag. It does nothing if none of them is set.
+func setupTLS() error {
+	if !*tlsInsecure && *tlsCAFile == "" && *tlsPinnedCert == "" && *protocolFlag != protocolHTTP2 &&
+		tlsMinVersion == "" && tlsMaxVersion == "" && len(tlsCipherSuites) == 0 && hostOverride == "" {
+		return nil
+	}
+
+	// Send the overridden host as the server name of every connection, and verify the certificate against it
+	serverName := hostOverride
+	if host, _, err := net.SplitHostPort(hostOverride); err == nil {
+		serverName = host
+	}
+	config := &tls.Config{InsecureSkipVerify: *tlsInsecure, ServerName: serverName}
+
+	// Restrict the versions and cipher suites offered in the handshake
+	var err error
+	if config.MinVersion, err = parseTLSVersion(tlsMinVersion); err != nil {
+		return err
+	}
+	if config.MaxVersion, err = parseTLSVersion(tlsMaxVersion); err != nil {
+		return err
+	}
+	if config.MinVersion != 0 && config.MaxVersion != 0 && config.MinVersion > config.MaxVersion {
+		return fmt.Errorf("TLS min version %s is above max version %s", tlsMinVersion, tlsMaxVersion)
+	}
+	if config.CipherSuites, err = parseCipherSuites(tlsCipherSuites); err != nil {
+		return err
+	}
+
+	// Trust the certificates of the CA bundle instead of the system roots
+	if *tlsCAFile != "" {
+		pem, err := os.ReadFile(*tlsCAFile)
+		if err != nil {
+			slog.Error("Error in setupTLS", "component", componentMain, "error", err)
+			return fmt.Errorf("Failed to read CA bundle: %w", err)
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in CA bundle %s", *tlsCAFile)
+		}
+		config.RootCAs = roots
+	}
+
+	// Check the fingerprint of the certificate the target presents, after the usual verification if it is enabled
+	if *tlsPinnedCert != "" {
+		pin, err := hex.DecodeString(strings.ReplaceAll(*tlsPinnedCert, ":", ""))
+		if err != nil || len(pin) != sha256.Size {
+			return fmt.Errorf("certificate pin %q is not a hex SHA-256 fingerprint", *tlsPinnedCert)
+		}
+		config.VerifyConnection = pinnedCertVerifier(pin)
+	}
+
+	// Reject connections that fall back to HTTP/1.1 when HTTP/2 is required
+	if *protocolFlag == protocolHTTP2 {
+		pinned := config.VerifyConnection
+		config.VerifyConnection = func(state tls.ConnectionState) error {
+			if pinned != nil {
+				if err := pinned(state); err != nil {
+					return err
+				}
+			}
+			return requireHTTP2(state)
+		}
+	}
+
+	clientTLSConfig = config
+
+	return nil
+}
+
+// parseTLSVersion returns the TLS version with the given number, e.g. "1.2", or 0 for the empty string.
+func parseTLSVersion(version string) (uint16, error) {
+	switch version {
+	case "":
+		return 0, nil
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("unknown TLS version %q", version)
+}
+
+// parseCipherSuites returns the IDs of the named cipher suites, including the insecure ones Go still implements,
+// or nil if no names are given.
+func parseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	known := make(map[string]uint16)
+	for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		known[suite.Name] = suite.ID
+	}
+
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// pinnedCertVerifier returns a VerifyConnection function that rejects connections
+// whose leaf certificate does not have the given SHA-256 fingerprint.
+// Every TLS connection of the clients is pinned, so an https proxy test URL fails validation while a pin is set.
+func pinnedCertVerifier(pin []byte) func(tls.ConnectionState) error {
+	return func(state tls.ConnectionState) error {
+		if len(state.PeerCertificates) == 0 {
+			return errors.New("tls: server presented no certificate to check against the pin")
+		}
+		fingerprint := sha256.Sum256(state.PeerCertificates[0].Raw)
+		if !bytes.Equal(fingerprint[:], pin) {
+			return fmt.Errorf("tls: certificate fingerprint %x does not match the pin", fingerprint)
+		}
+		return nil
+	}
+}
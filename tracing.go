@@ -0,0 +1,172 @@
+// tracing.go contains the tracing of generated requests, which attaches W3C traceparent headers to a sampled
+// fraction of requests and exports a client span for each of them to an OTLP collector, so generated load
+// can be correlated with server-side traces.
+
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// spans holds the finished client spans waiting to be exported, or is nil if no span exporter is running
+var spans *SpanExporter
+
+// The OTLP JSON encoding of spans, limited to the fields the exporter uses
+type (
+	otlpTraceRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpSpan struct {
+		TraceID           string         `json:"traceId"`
+		SpanID            string         `json:"spanId"`
+		Name              string         `json:"name"`
+		Kind              int            `json:"kind"`
+		StartTimeUnixNano string         `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+		Attributes        []otlpKeyValue `json:"attributes"`
+		Status            otlpStatus     `json:"status"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code"`
+		Message string `json:"message,omitempty"`
+	}
+)
+
+// The OTLP span kind and status codes used by the client spans
+const (
+	otlpSpanKindClient = 3
+	otlpStatusUnset    = 0
+	otlpStatusError    = 2
+)
+
+// SpanExporter batches client spans and exports them to an OTLP collector.
+// It is safe for concurrent use.
+type SpanExporter struct {
+	mu     sync.Mutex
+	config otlpConfig
+	spans  []otlpSpan
+}
+
+// startSpanExporter starts exporting client spans every OTEL_BSP_SCHEDULE_DELAY if request tracing is enabled
+// and an OTLP endpoint is configured. Without an endpoint, traceparent headers are still attached.
+// It returns a function that exports the remaining spans, or nil if no exporter is running.
+func startSpanExporter() func() {
+	if traceSampleFraction <= 0 {
+		return nil
+	}
+	config, ok := otlpConfigFromEnv("traces", 5*time.Second)
+	if !ok {
+		slog.Warn("No OTLP endpoint configured, attaching traceparent headers without exporting spans", "component", componentOutput)
+		return nil
+	}
+	if ms, err := strconv.Atoi(os.Getenv("OTEL_BSP_SCHEDULE_DELAY")); err == nil && ms > 0 {
+		config.Interval = time.Duration(ms) * time.Millisecond
+	}
+
+	spans = &SpanExporter{config: config}
+	go func() {
+		ticker := time.NewTicker(config.Interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			spans.Export()
+		}
+	}()
+
+	return spans.Export
+}
+
+// traceRequest attaches a traceparent header with a new trace and span ID drawn from r
+// to a sampled fraction of requests.
+func traceRequest(req *http.Request, r *rand.Rand) {
+	if traceSampleFraction <= 0 || r.Float64() >= traceSampleFraction {
+		return
+	}
+
+	var traceID [16]byte
+	var spanID [8]byte
+	binary.BigEndian.PutUint64(traceID[:8], r.Uint64())
+	binary.BigEndian.PutUint64(traceID[8:], r.Uint64())
+	binary.BigEndian.PutUint64(spanID[:], r.Uint64()|1) // An all-zero span ID is invalid
+
+	req.Header.Set("traceparent", "00-"+hex.EncodeToString(traceID[:])+"-"+hex.EncodeToString(spanID[:])+"-01")
+}
+
+// recordSpan adds the client span of a traced request to the exporter.
+// Requests without a traceparent header were not sampled and are ignored.
+func recordSpan(req *http.Request, summary RequestSummary) {
+	if spans == nil {
+		return
+	}
+	parts := strings.Split(req.Header.Get("traceparent"), "-")
+	if len(parts) != 4 {
+		return
+	}
+
+	span := otlpSpan{
+		TraceID:           parts[1],
+		SpanID:            parts[2],
+		Name:              req.Method,
+		Kind:              otlpSpanKindClient,
+		StartTimeUnixNano: strconv.FormatInt(summary.Timestamp.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(summary.Timestamp.Add(summary.Duration).UnixNano(), 10),
+		Attributes: []otlpKeyValue{
+			otlpString("http.request.method", req.Method),
+			otlpString("url.full", req.URL.String()),
+			otlpString("jeet.parameter", summary.Parameter),
+			otlpString("jeet.request_id", summary.RequestID),
+		},
+		Status: otlpStatus{Code: otlpStatusUnset},
+	}
+	if summary.StatusCode != 0 {
+		span.Attributes = append(span.Attributes, otlpInt("http.response.status_code", int64(summary.StatusCode)))
+	}
+	if summary.Proxy != "" {
+		span.Attributes = append(span.Attributes, otlpString("jeet.proxy", summary.Proxy))
+	}
+	if summary.ErrorClass != ErrorClassNone {
+		span.Attributes = append(span.Attributes, otlpString("error.type", summary.ErrorClass.String()))
+		span.Status = otlpStatus{Code: otlpStatusError, Message: summary.ErrorClass.String()}
+	} else if summary.StatusCode >= 500 {
+		span.Status = otlpStatus{Code: otlpStatusError}
+	}
+
+	spans.mu.Lock()
+	spans.spans = append(spans.spans, span)
+	spans.mu.Unlock()
+}
+
+// Export sends the batched spans to the collector.
+func (e *SpanExporter) Export() {
+	e.mu.Lock()
+	batch := e.spans
+	e.spans = nil
+	e.mu.Unlock()
+
+	if len(batch) == 0 {
+		return
+	}
+	request := otlpTraceRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: e.config.Attributes},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "jeet"}, Spans: batch}},
+	}}}
+	if err := postOTLP(e.config, request); err != nil {
+		slog.Error("Failed to export spans", "component", componentOutput, "spans", len(batch), "error", err)
+	}
+}
@@ -0,0 +1,160 @@
+// transport.go contains the construction of the HTTP transports and dialers of the clients, and the timeouts of requests.
+// Their tuning is settable per run with flags whose defaults are the constants in config.go,
+// and the effective settings are printed at startup.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// newTransport creates an HTTP transport that dials with dial and keeps up to maxIdle idle connections,
+// maxIdlePerHost of them per host, tuned by the transport flags.
+func newTransport(dial func(ctx context.Context, network, addr string) (net.Conn, error), maxIdle, maxIdlePerHost int) *http.Transport {
+	httpTransport := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := dial(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			return throttleConn(conn), nil
+		},
+		MaxIdleConns:          maxIdle,
+		MaxIdleConnsPerHost:   maxIdlePerHost,
+		MaxConnsPerHost:       *maxConnsPerHostFlag,
+		IdleConnTimeout:       *idleConnTimeoutFlag,
+		TLSHandshakeTimeout:   *tlsHandshakeTimeoutFlag,
+		ExpectContinueTimeout: *expectContinueTimeoutFlag,
+		ResponseHeaderTimeout: *responseHeaderTimeoutFlag,
+		DisableKeepAlives:     *disableKeepAlivesFlag || freshConnections(),
+		WriteBufferSize:       *writeBufferSizeFlag,
+		ReadBufferSize:        *readBufferSizeFlag,
+		DisableCompression:    true, // Bodies are decompressed by decodeBody, so wire bytes can be counted
+		TLSClientConfig:       clientTLSConfig,
+	}
+
+	configureProtocol(httpTransport)
+
+	return httpTransport
+}
+
+// newDialer creates a dialer with the dial timeout and keep-alive interval of the run, resolving with clientResolver.
+func newDialer() *net.Dialer {
+	return &net.Dialer{
+		Timeout:   *dialTimeoutFlag,
+		KeepAlive: *dialKeepAliveFlag,
+		Resolver:  clientResolver,
+	}
+}
+
+// withRequestTimeout returns a context that is canceled at the overall deadline of a request, if -timeout sets one.
+func withRequestTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if *requestTimeoutFlag > 0 {
+		return context.WithTimeout(ctx, *requestTimeoutFlag)
+	}
+	return context.WithCancel(ctx)
+}
+
+// requestDeadline returns the overall deadline of a request started at start, or the zero time if -timeout sets none.
+func requestDeadline(start time.Time) time.Time {
+	if *requestTimeoutFlag > 0 {
+		return start.Add(*requestTimeoutFlag)
+	}
+	return time.Time{}
+}
+
+// errBodyReadTimeout is returned by bodies whose next bytes took longer than the read timeout.
+var errBodyReadTimeout = &readTimeoutError{}
+
+// readTimeoutError is the timeout error of a body read.
+type readTimeoutError struct{}
+
+func (e *readTimeoutError) Error() string   { return "timed out waiting for the response body" }
+func (e *readTimeoutError) Timeout() bool   { return true }
+func (e *readTimeoutError) Temporary() bool { return true }
+
+// readTimeoutReader cancels its request if a read does not return within the read timeout.
+type readTimeoutReader struct {
+	r        io.Reader
+	timer    *time.Timer
+	timedOut atomic.Bool
+}
+
+// withReadTimeout returns a reader of body that calls cancel if the next bytes take longer than -read-timeout,
+// and a function that stops the timer once the body is read. Without a read timeout it returns body itself.
+func withReadTimeout(body io.Reader, cancel context.CancelFunc) (io.Reader, func()) {
+	if *bodyReadTimeoutFlag <= 0 {
+		return body, func() {}
+	}
+	t := &readTimeoutReader{r: body}
+	t.timer = time.AfterFunc(*bodyReadTimeoutFlag, func() {
+		t.timedOut.Store(true)
+		cancel()
+	})
+	return t, func() { t.timer.Stop() }
+}
+
+// Read reads from the body and restarts the read timeout. It returns errBodyReadTimeout if the read timed out.
+func (t *readTimeoutReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	if err != nil && t.timedOut.Load() {
+		return n, errBodyReadTimeout
+	}
+	t.timer.Reset(*bodyReadTimeoutFlag)
+	return n, err
+}
+
+// directIdleConnsPerHost returns the idle connections per host kept by the direct client's transport:
+// the -max-idle-conns-per-host flag if it is set, and one per thread otherwise.
+func directIdleConnsPerHost() int {
+	if *maxIdleConnsPerHostFlag > 0 {
+		return *maxIdleConnsPerHostFlag
+	}
+	return numOfThreads
+}
+
+// printTransportConfig prints the effective settings of the transports and dialers.
+func printTransportConfig() {
+	fmt.Printf("Transport: protocol %s, connection mode %s, keep-alives %s, max idle conns %d (per host %d direct, %s proxied), max conns per host %s\n",
+		*protocolFlag, *connectionModeFlag, onOff(!*disableKeepAlivesFlag && !freshConnections()), *maxIdleConnsFlag, directIdleConnsPerHost(),
+		orDefault(*maxIdleConnsPerHostFlag, "2"), orDefault(*maxConnsPerHostFlag, "unlimited"))
+	fmt.Printf("Timeouts: overall %s, dial %s, TLS handshake %s, response header %s, body read %s, idle conn %s, expect-continue %s\n",
+		durationOrNone(*requestTimeoutFlag), durationOrNone(*dialTimeoutFlag), *tlsHandshakeTimeoutFlag,
+		durationOrNone(*responseHeaderTimeoutFlag), durationOrNone(*bodyReadTimeoutFlag), *idleConnTimeoutFlag, *expectContinueTimeoutFlag)
+	fmt.Printf("Buffers: write %s, read %s; Accept-Encoding: %q\n",
+		orDefault(*writeBufferSizeFlag, "4096"), orDefault(*readBufferSizeFlag, "4096"), requestAcceptEncoding())
+	if downloadRatePerConn > 0 || downloadRateGlobal > 0 {
+		fmt.Printf("Download throttle: %s per connection, %s overall\n",
+			formatDownloadRate(downloadRatePerConn), formatDownloadRate(downloadRateGlobal))
+	}
+}
+
+// onOff formats a setting that is either on or off.
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
+
+// orDefault formats a numeric setting, or the description of its default if it is 0.
+func orDefault(v int, def string) string {
+	if v == 0 {
+		return def
+	}
+	return fmt.Sprint(v)
+}
+
+// durationOrNone formats a timeout, or "none" if it is 0.
+func durationOrNone(d time.Duration) string {
+	if d > 0 {
+		return d.String()
+	}
+	return "none"
+}
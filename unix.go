@@ -0,0 +1,39 @@
+// unix.go contains the support for targets exposed only over a Unix domain socket, such as sidecars and test fixtures.
+// A base URL of the form unix:///path/to/app.sock:/request/path?query sends every request over the socket.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// unixSocketPath is the socket the direct client dials for every connection, or empty for network targets
+var unixSocketPath string
+
+// setupUnixTarget splits a unix:// request target into the socket path and an http:// URL of the request path,
+// which the requests are built from. Proxies cannot reach a local socket, so it returns an error if they are used.
+func setupUnixTarget() error {
+	if !strings.HasPrefix(requestTarget, "unix://") {
+		return nil
+	}
+	if useProxy {
+		return fmt.Errorf("unix socket target %s cannot be reached through proxies, disable useProxy", requestTarget)
+	}
+
+	socket, path, found := strings.Cut(strings.TrimPrefix(requestTarget, "unix://"), ":")
+	if socket == "" {
+		return fmt.Errorf("unix socket target %s has no socket path", requestTarget)
+	}
+	if !found || path == "" {
+		path = "/"
+	}
+	if !strings.HasPrefix(path, "/") {
+		return fmt.Errorf("request path %q of unix socket target %s does not start with /", path, requestTarget)
+	}
+
+	unixSocketPath = socket
+	requestTarget = "http://localhost" + path
+
+	return nil
+}
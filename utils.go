@@ -3,29 +3,36 @@
 package main
 
 import (
+	"context"
 	"io"
 	"log"
 	"net/http"
 )
 
 // testProxy tests a proxy by sending a request to the test URL.
-func testProxy(client *http.Client, proxiesLogger *log.Logger) bool {
-	resp, err := client.Get(testUrl)
+// The request is abandoned if ctx is cancelled.
+func testProxy(ctx context.Context, client *http.Client, proxy string, proxiesLogger *log.Logger) bool {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, testUrl, nil)
 	if err != nil {
-		proxiesLogger.Printf("Failed to connect to test URL with proxy: %s\n", err)
+		logProxyError(proxiesLogger, proxy, "Failed to create test request: %s", err)
+		return false
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		logProxyError(proxiesLogger, proxy, "Failed to connect to test URL with proxy %s: %s", proxy, err)
 		return false
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		proxiesLogger.Printf("Received non-200 response code: %d\n", resp.StatusCode)
+		logProxyError(proxiesLogger, proxy, "Received non-200 response code from proxy %s: %d", proxy, resp.StatusCode)
 		return false
 	}
 
 	// Read the response body
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		proxiesLogger.Printf("Failed to read response body: %s\n", err)
+		logProxyError(proxiesLogger, proxy, "Failed to read response body through proxy %s: %s", proxy, err)
 		return false
 	}
 
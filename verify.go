@@ -0,0 +1,223 @@
+// verify.go contains the verification run mode, which sends a tiny fraction of the configured load
+// with full request/response dumps and every client hook traced, so templates, auth, and proxies
+// can be checked before launching the real run at scale.
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"net/http/httptrace"
+	"net/http/httputil"
+	"net/textproto"
+	"os"
+	"time"
+)
+
+// verificationRequestCount returns the number of requests to send during a verification run.
+// It is verificationFraction of the configured load, but always at least one request.
+func verificationRequestCount() int {
+	count := int(float64(totalRequestBudget()) * verificationFraction)
+	if count < 1 {
+		count = 1
+	}
+	return count
+}
+
+// runVerification sends verificationRequestCount requests one after another.
+// Every request and response is dumped in full and every httptrace hook is logged,
+// both to stdout and to the plain-text dump file at dumpPath, so the JSON log stays machine-readable.
+// It returns an error if none of the requests succeeded.
+func runVerification(dumpPath string) error {
+	dumpFile, err := os.Create(dumpPath)
+	if err != nil {
+		slog.Error("Error in runVerification", "component", componentMain, "error", err)
+		return fmt.Errorf("Failed to create verification dump file: %w", err)
+	}
+	// Ensure the dump file is closed after the function returns
+	defer func() {
+		if cerr := dumpFile.Close(); cerr != nil {
+			slog.Error("Failed to close verification dump file", "component", componentMain, "error", cerr)
+		}
+	}()
+	verboseLogger := log.New(io.MultiWriter(os.Stdout, dumpFile), "[verify] ", log.LstdFlags|log.Lmicroseconds)
+
+	count := verificationRequestCount()
+	r := newLockedRand(runRand.Int63())
+	verboseLogger.Printf("Starting verification run with %d request(s)\n", count)
+
+	succeeded := 0
+	for i := 0; i < count; i++ {
+		var proxy string
+		client := directClient
+		if useProxy {
+			proxy = proxies[i%len(proxies)]
+
+			var err error
+			client, err = createProxyClient(proxy)
+			if err != nil {
+				verboseLogger.Printf("Failed to create client with proxy %s: %s\n", proxy, err)
+				continue
+			}
+			if !testProxy(context.Background(), client, proxy, verboseLogger) {
+				verboseLogger.Printf("Proxy %s failed the proxy test\n", proxy)
+				continue
+			}
+		}
+
+		if err := verifyRequest(client, proxy, r, verboseLogger); err != nil {
+			verboseLogger.Printf("Request %d/%d failed: %s\n", i+1, count, err)
+			continue
+		}
+		succeeded++
+	}
+
+	verboseLogger.Printf("Verification run finished: %d/%d request(s) succeeded\n", succeeded, count)
+	if succeeded == 0 {
+		return fmt.Errorf("none of the %d verification request(s) succeeded", count)
+	}
+
+	return nil
+}
+
+// verifyRequest sends a single traced request and dumps the request and response in full.
+// The response goes through the same status, header, body, and GraphQL checks and the same capture as in a real run,
+// and the request fails if any check does.
+func verifyRequest(client *http.Client, proxy string, r *rand.Rand, verboseLogger *log.Logger) error {
+	ctx, cancel := withRequestTimeout(context.Background())
+	defer cancel()
+
+	req, param, err := buildRequest(httptrace.WithClientTrace(ctx, newVerboseTrace(verboseLogger)), r, headerProfileFor(proxy), 0)
+	if err != nil {
+		return fmt.Errorf("failed to create request with parameter %s: %w", param, err)
+	}
+	id := tagRequest(req)
+	verboseLogger.Printf("Sending request %s with parameter %s through proxy %q\n", id, param, proxy)
+
+	// Dump the outgoing request
+	dump, err := httputil.DumpRequestOut(req, true)
+	if err != nil {
+		return fmt.Errorf("failed to dump request: %w", err)
+	}
+	verboseLogger.Printf("Request dump:\n%s\n", dump)
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request with parameter %s failed after %s: %w", param, time.Since(start), err)
+	}
+	defer resp.Body.Close()
+
+	// Dump the response including its body
+	dump, err = httputil.DumpResponse(resp, true)
+	if err != nil {
+		return fmt.Errorf("failed to dump response: %w", err)
+	}
+	verboseLogger.Printf("Response dump (%s):\n%s\n", time.Since(start), dump)
+
+	return checkVerifiedResponse(resp, RequestSummary{
+		Timestamp:  start,
+		RequestID:  id,
+		Parameter:  param,
+		Proxy:      proxy,
+		StatusCode: resp.StatusCode,
+		Protocol:   resp.Proto,
+	})
+}
+
+// checkVerifiedResponse captures the body of a response whose body was already dumped if it is due for capture,
+// and runs the checks of a real run on it. It returns an error describing the first failed check.
+func checkVerifiedResponse(resp *http.Response, summary RequestSummary) error {
+	// DumpResponse left a copy of the body in resp.Body; read it the way sendRequest does
+	bodyReader, err := decodeBody(resp.Body, resp.Header.Get("Content-Encoding"))
+	if err != nil {
+		return fmt.Errorf("failed to decode response body: %w", err)
+	}
+	if maxBodySize > 0 {
+		bodyReader = io.LimitReader(bodyReader, maxBodySize)
+	}
+	body, err := io.ReadAll(bodyReader)
+	if err != nil {
+		return fmt.Errorf("failed to read response body: %w", err)
+	}
+	if captureDirPath != "" {
+		captureBody(summary, body)
+	}
+
+	if !isSuccessStatus(resp.StatusCode) {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	if failure := checkHeaderAssertions(resp.Header); failure != "" {
+		return fmt.Errorf("header assertion failed: %s", failure)
+	}
+	if failure := checkAssertions(body, len(body)); failure != "" {
+		return fmt.Errorf("assertion failed: %s", failure)
+	}
+	if graphqlMode {
+		if failure := checkGraphQLErrors(body); failure != "" {
+			return fmt.Errorf("GraphQL errors: %s", failure)
+		}
+	}
+	return nil
+}
+
+// newVerboseTrace returns a ClientTrace that logs every hook to the given logger.
+func newVerboseTrace(verboseLogger *log.Logger) *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GetConn: func(hostPort string) {
+			verboseLogger.Printf("GetConn: %s\n", hostPort)
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			verboseLogger.Printf("GotConn: reused=%t wasIdle=%t idleTime=%s\n", info.Reused, info.WasIdle, info.IdleTime)
+		},
+		PutIdleConn: func(err error) {
+			verboseLogger.Printf("PutIdleConn: err=%v\n", err)
+		},
+		GotFirstResponseByte: func() {
+			verboseLogger.Printf("GotFirstResponseByte\n")
+		},
+		Got100Continue: func() {
+			verboseLogger.Printf("Got100Continue\n")
+		},
+		Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+			verboseLogger.Printf("Got1xxResponse: %d %v\n", code, header)
+			return nil
+		},
+		DNSStart: func(info httptrace.DNSStartInfo) {
+			verboseLogger.Printf("DNSStart: %s\n", info.Host)
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			verboseLogger.Printf("DNSDone: addrs=%v err=%v\n", info.Addrs, info.Err)
+		},
+		ConnectStart: func(network, addr string) {
+			verboseLogger.Printf("ConnectStart: %s %s\n", network, addr)
+		},
+		ConnectDone: func(network, addr string, err error) {
+			verboseLogger.Printf("ConnectDone: %s %s err=%v\n", network, addr, err)
+		},
+		TLSHandshakeStart: func() {
+			verboseLogger.Printf("TLSHandshakeStart\n")
+		},
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			verboseLogger.Printf("TLSHandshakeDone: version=%x cipher=%x protocol=%q err=%v\n", state.Version, state.CipherSuite, state.NegotiatedProtocol, err)
+		},
+		WroteHeaderField: func(key string, value []string) {
+			verboseLogger.Printf("WroteHeaderField: %s: %v\n", key, value)
+		},
+		WroteHeaders: func() {
+			verboseLogger.Printf("WroteHeaders\n")
+		},
+		Wait100Continue: func() {
+			verboseLogger.Printf("Wait100Continue\n")
+		},
+		WroteRequest: func(info httptrace.WroteRequestInfo) {
+			verboseLogger.Printf("WroteRequest: err=%v\n", info.Err)
+		},
+	}
+}
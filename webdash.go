@@ -0,0 +1,131 @@
+// webdash.go contains the web dashboard, which serves an embedded page with live throughput and latency charts
+// fed over a websocket, the state of the proxy pool, and a button to stop the run, for runs on headless machines.
+
+package main
+
+import (
+	_ "embed"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// webDashboardPage is the page served by the web dashboard
+//
+//go:embed dashboard.html
+var webDashboardPage []byte
+
+// webDashboardFrame is the JSON message pushed to the web dashboard every second.
+type webDashboardFrame struct {
+	Elapsed        float64          `json:"elapsed"`
+	Requests       int64            `json:"requests"`
+	Successes      int64            `json:"successes"`
+	Failures       int64            `json:"failures"`
+	RequestsPerSec float64          `json:"rps"`
+	P50Ms          float64          `json:"p50_ms"`
+	P95Ms          float64          `json:"p95_ms"`
+	P99Ms          float64          `json:"p99_ms"`
+	StatusCodes    map[string]int64 `json:"status_codes"`
+	Errors         map[string]int64 `json:"errors"`
+	UseProxy       bool             `json:"use_proxy"`
+	HealthyProxies int              `json:"healthy_proxies"`
+	ProxyTarget    int              `json:"proxy_target"`
+	ProxyValidated int64            `json:"proxy_validated"`
+	ProxyFailed    int64            `json:"proxy_failed"`
+	UniqueIPs      int              `json:"unique_ips"`
+	Stopping       bool             `json:"stopping"`
+}
+
+// startWebDashboard serves the web dashboard on webDashboardAddr for the lifetime of the run.
+func startWebDashboard(collector *StatsCollector, start time.Time) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(webDashboardPage)
+	})
+	mux.Handle("/ws", websocket.Handler(func(ws *websocket.Conn) {
+		defer ws.Close()
+		ticker := time.NewTicker(1 * time.Second)
+		defer ticker.Stop()
+		for {
+			if err := websocket.JSON.Send(ws, newWebDashboardFrame(collector, start)); err != nil {
+				return
+			}
+			<-ticker.C
+		}
+	}))
+	mux.HandleFunc("/stop", handleWebDashboardStop)
+
+	go func() {
+		if err := http.ListenAndServe(webDashboardAddr, mux); err != nil {
+			slog.Error("Web dashboard failed", "component", componentControl, "error", err)
+		}
+	}()
+}
+
+// handleWebDashboardStop stops the run when the dashboard's stop button is pressed.
+// Requests from pages of other origins are rejected, so a page open in the same browser cannot stop the run.
+func handleWebDashboardStop(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !sameOrigin(r) {
+		slog.Warn("Rejected a stop request from another origin", "component", componentControl, "remote_addr", r.RemoteAddr, "origin", r.Header.Get("Origin"))
+		http.Error(w, "cross-origin request", http.StatusForbidden)
+		return
+	}
+	slog.Info("Stop requested from the web dashboard", "component", componentControl, "remote_addr", r.RemoteAddr)
+	requestStop()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// sameOrigin reports whether a request comes from a page served by the dashboard itself: its Origin header names
+// the host the request was sent to. Requests without an Origin header do not come from a browser page, and pass.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+// newWebDashboardFrame collects the current state of the run for the web dashboard.
+func newWebDashboardFrame(collector *StatsCollector, start time.Time) webDashboardFrame {
+	sample := newStatsSnapshotJSON(takeStatsSample(collector, 0))
+	frame := webDashboardFrame{
+		Elapsed:        time.Since(start).Seconds(),
+		Requests:       sample.Requests,
+		Successes:      sample.Successes,
+		Failures:       sample.Failures,
+		RequestsPerSec: timeline.Last().Requests,
+		P50Ms:          sample.Latency.P50,
+		P95Ms:          sample.Latency.P95,
+		P99Ms:          sample.Latency.P99,
+		StatusCodes:    sample.StatusCodes,
+		Errors:         sample.Errors,
+		UseProxy:       useProxy,
+		Stopping:       stopping(),
+	}
+	if useProxy {
+		frame.HealthyProxies = proxiesPool.Len()
+		frame.ProxyTarget = proxyPoolTarget
+		frame.ProxyValidated = sample.ProxySuccesses
+		frame.ProxyFailed = sample.ProxyFailures
+		frame.UniqueIPs = sample.UniqueIPs
+	}
+	return frame
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWebDashboardStop(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		host     string
+		origin   string
+		want     int
+		wantStop bool
+	}{
+		{"dashboard page", http.MethodPost, "127.0.0.1:8080", "http://127.0.0.1:8080", http.StatusAccepted, true},
+		{"dashboard page by name", http.MethodPost, "loadbox:8080", "http://LOADBOX:8080", http.StatusAccepted, true},
+		{"https dashboard page", http.MethodPost, "loadbox:8443", "https://loadbox:8443", http.StatusAccepted, true},
+		{"no origin", http.MethodPost, "127.0.0.1:8080", "", http.StatusAccepted, true},
+		{"other site", http.MethodPost, "127.0.0.1:8080", "https://evil.example", http.StatusForbidden, false},
+		{"other port", http.MethodPost, "127.0.0.1:8080", "http://127.0.0.1:9090", http.StatusForbidden, false},
+		{"other host with the same port", http.MethodPost, "127.0.0.1:8080", "http://localhost:8080", http.StatusForbidden, false},
+		{"opaque origin", http.MethodPost, "127.0.0.1:8080", "null", http.StatusForbidden, false},
+		{"file origin", http.MethodPost, "127.0.0.1:8080", "file://127.0.0.1:8080", http.StatusForbidden, false},
+		{"get", http.MethodGet, "127.0.0.1:8080", "", http.StatusMethodNotAllowed, false},
+	}
+	savedCtx, savedCancel := runCtx, cancelRun
+	defer func() { runCtx, cancelRun = savedCtx, savedCancel }()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runCtx, cancelRun = context.WithCancel(context.Background())
+			defer cancelRun()
+
+			r := httptest.NewRequest(tt.method, "http://"+tt.host+"/stop", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			w := httptest.NewRecorder()
+			handleWebDashboardStop(w, r)
+
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+			if stopping() != tt.wantStop {
+				t.Errorf("stopping() = %t, want %t", stopping(), tt.wantStop)
+			}
+		})
+	}
+}
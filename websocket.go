@@ -0,0 +1,270 @@
+// websocket.go contains the websocket mode, which load-tests a websocket endpoint instead of sending HTTP requests.
+// Every thread holds one connection, through a SOCKS proxy or directly, and sends templated messages over it
+// at a fixed rate. The time to connect, the round trip time of every message, and the disconnects are tracked.
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"log/slog"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// websocketConnectTimes holds the time it took to open every websocket connection, including the handshake
+var websocketConnectTimes = newHistogram(latencyHighestTrackable, latencySignificantFigures)
+
+// startWebSocketThreads starts the proxy pool maintainer, if proxies are used, and the websocket threads.
+func startWebSocketThreads(ctx context.Context, collector *StatsCollector, proxiesLogger *log.Logger) {
+	if useProxy {
+		go maintainProxyPool(ctx, collector, proxiesLogger)
+	}
+	runControl.start(numOfThreads, func(id int) {
+		websocketThread(ctx, shardFor(id), id, proxiesLogger)
+	})
+}
+
+// websocketThread is a goroutine that opens websocket connections and sends messages over them.
+// It sends numOfRequests messages per connection, and then reconnects, through another proxy if proxies are used.
+// Unless runIndefinitely is set, it keeps going until the total number of requests has been sent.
+// It stops when the run controller lets it exit.
+func websocketThread(ctx context.Context, sh *shard, id int, proxiesLogger *log.Logger) {
+	pace := newPacer(websocketMessageRate)
+	for runControl.admit(ctx, id) {
+		// Get a proxy from the proxies pool if proxies are used
+		proxy := ""
+		if useProxy {
+			var ok bool
+			if proxy, ok = proxiesPool.Acquire(ctx, sh.rng); !ok {
+				return
+			}
+		}
+
+		requestCount, received, admitted := websocketSession(ctx, sh, id, pace, proxy)
+
+		if useProxy {
+			releaseProxy(proxy, received > 0, proxiesLogger)
+		}
+
+		if !runIndefinitely && sh.countBatch(requestCount) >= totalRequestBudget() || !admitted {
+			return
+		}
+	}
+}
+
+// websocketSession opens a websocket connection through proxy, or directly if proxy is empty,
+// and sends up to numOfRequests messages over it. A connection that cannot be opened counts as one failed request.
+// It returns the number of requests counted, the number of replies received,
+// and false if the run controller or rate limits did not admit the next message.
+func websocketSession(ctx context.Context, sh *shard, id int, pace *pacer, proxy string) (int, int, bool) {
+	start := time.Now()
+	ws, err := dialWebSocket(ctx, proxy, sh)
+	if err != nil {
+		class := classifyError(err)
+		slog.Error("Failed to open websocket", "component", componentRequest, "proxy", proxy, "error_class", class.String(), "error", err)
+		noteError("%s: websocket connect (%s)", class, err)
+		sh.count(CounterRequests)
+		sh.countFailure(class)
+		recordWebSocketSummary(RequestSummary{Timestamp: start, Parameter: "connect", Proxy: proxy, Duration: time.Since(start), ErrorCount: 1, ErrorClass: class})
+		sh.complete() // Advance the progress bar
+		return 1, 0, true
+	}
+	defer ws.Close()
+	websocketConnectTimes.Record(time.Since(start))
+	sh.count(CounterWebSocketConnects)
+
+	requestCount := 0
+	received := 0
+	for requestCount < numOfRequests {
+		if !runControl.admit(ctx, id) || !waitForRateLimits(ctx, pace, proxy) {
+			return requestCount, received, false
+		}
+		requestCount++
+		if !sendWebSocketMessage(sh, ws, proxy) {
+			// The connection is unusable after a failed message, so count it as a disconnect and reconnect
+			sh.count(CounterWebSocketDisconnects)
+			break
+		}
+		received++
+	}
+
+	return requestCount, received, true
+}
+
+// sendWebSocketMessage sends one templated message and waits for the next message from the server,
+// recording the time between the two as the message's round trip time.
+// It returns false if the message could not be sent or no reply arrived within the request timeout.
+func sendWebSocketMessage(sh *shard, ws *websocket.Conn, proxy string) bool {
+	sh.count(CounterRequests)
+
+	message := expandPlaceholders(websocketMessage, sh.rng)
+	start := time.Now()
+	summary := RequestSummary{
+		Timestamp: start,
+		Parameter: "message",
+		Proxy:     proxy,
+	}
+
+	var reply []byte
+	err := ws.SetDeadline(requestDeadline(start))
+	if err == nil {
+		err = websocket.Message.Send(ws, message)
+	}
+	if err == nil {
+		err = websocket.Message.Receive(ws, &reply)
+	}
+	summary.Duration = time.Since(start)
+	if err != nil {
+		summary.ErrorClass = classifyError(err)
+		summary.ErrorCount++
+		slog.Error("Failed on websocket message", "component", componentRequest, "proxy", proxy,
+			"error_class", summary.ErrorClass.String(), "duration_ms", durationMillis(summary.Duration), "error", err)
+		noteError("%s: websocket message (%s)", summary.ErrorClass, err)
+		sh.countFailure(summary.ErrorClass)
+		recordWebSocketSummary(summary)
+		sh.complete() // Advance the progress bar
+		return false
+	}
+
+	summary.BytesIn = len(reply)
+	summary.WireBytes = len(reply)
+	sh.countBytes(len(reply))
+	sh.countWireBytes(int64(len(reply)))
+	sh.latencies.Record(summary.Duration)
+	sh.count(CounterSuccesses)
+	recordWebSocketSummary(summary)
+	sh.complete() // Advance the progress bar
+
+	return true
+}
+
+// dialWebSocket opens a websocket connection to the websocket URL through proxy, or directly if proxy is empty.
+// It dials like the HTTP clients do, and the dial and the handshake have to finish within the request timeout.
+func dialWebSocket(ctx context.Context, proxy string, sh *shard) (*websocket.Conn, error) {
+	config, err := websocket.NewConfig(expandURLPlaceholders(websocketTarget(), sh.rng, nil), websocketOrigin)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create websocket config: %w", err)
+	}
+	if profile := headerProfileFor(proxy); profile != nil {
+		for _, header := range profile.Headers {
+			if header[0] == "User-Agent" || header[0] == "Accept-Language" {
+				config.Header.Set(header[0], header[1])
+			}
+		}
+	}
+
+	// Dial the endpoint's address
+	host := config.Location.Hostname()
+	port := config.Location.Port()
+	if port == "" {
+		port = "80"
+		if config.Location.Scheme == "wss" {
+			port = "443"
+		}
+	}
+	addr := net.JoinHostPort(host, port)
+	ctx, cancel := withRequestTimeout(withShard(ctx, sh))
+	defer cancel()
+	var conn net.Conn
+	if proxy == "" {
+		conn, err = dialDirect(ctx, newDialer(), addr)
+	} else {
+		dialer, dialerErr := newProxyDialer(proxy)
+		if dialerErr != nil {
+			return nil, dialerErr
+		}
+		conn, err = dialProxy(ctx, dialer, dialNetwork(), dialTarget(addr))
+	}
+	if err != nil {
+		return nil, err
+	}
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// Secure the connection for wss endpoints, with the same TLS settings as the HTTP clients
+	if config.Location.Scheme == "wss" {
+		tlsConfig := &tls.Config{}
+		if clientTLSConfig != nil {
+			tlsConfig = clientTLSConfig.Clone()
+		}
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName = host
+		}
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	ws, err := websocket.NewClient(config, conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		ws.Close()
+		return nil, err
+	}
+
+	return ws, nil
+}
+
+// websocketTarget returns the URL of the websocket endpoint: websocketURL if it is set,
+// and otherwise the request target with its http scheme switched to ws.
+func websocketTarget() string {
+	if websocketURL != "" {
+		return websocketURL
+	}
+	if strings.HasPrefix(requestTarget, "https://") {
+		return "wss://" + strings.TrimPrefix(requestTarget, "https://")
+	}
+	return "ws://" + strings.TrimPrefix(requestTarget, "http://")
+}
+
+// recordWebSocketSummary writes the summary of a websocket message or connection attempt to the result sinks,
+// and counts it towards the consecutive failures.
+func recordWebSocketSummary(summary RequestSummary) {
+	for _, sink := range resultSinks {
+		sink.Write(summary)
+	}
+	countConsecutiveFailure(summary.ErrorClass != ErrorClassNone)
+}
+
+// printWebSocketSummary prints the connections opened, the time it took to open them, and the disconnects.
+func printWebSocketSummary(snapshot StatsSnapshot) {
+	connect := websocketConnectTimes.Snapshot()
+	fmt.Printf("\n--- WEBSOCKET ---\n")
+	fmt.Printf("Target: %s\n", websocketTarget())
+	fmt.Printf("Connections opened: %d, disconnects: %d\n", snapshot.WebSocketConnects, snapshot.WebSocketDisconnects)
+	if connect.Count > 0 {
+		fmt.Printf("Connect time: mean %s, p50 %s, p95 %s, p99 %s, max %s\n",
+			connect.Mean.Round(time.Millisecond), connect.P50.Round(time.Millisecond), connect.P95.Round(time.Millisecond),
+			connect.P99.Round(time.Millisecond), connect.Max.Round(time.Millisecond))
+	}
+	fmt.Printf("Message round trip times are the request latencies above\n")
+	fmt.Printf("-----------------\n")
+}
+
+// validateWebSocketTarget returns an error if the websocket URL is not a ws or wss URL.
+func validateWebSocketTarget() error {
+	u, err := url.Parse(websocketTarget())
+	if err != nil {
+		return fmt.Errorf("Failed to parse websocket URL: %w", err)
+	}
+	if u.Scheme != "ws" && u.Scheme != "wss" {
+		return fmt.Errorf("websocket URL %s is not a ws:// or wss:// URL", websocketTarget())
+	}
+	return nil
+}
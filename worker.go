@@ -0,0 +1,167 @@
+// worker.go contains the worker subcommand, which waits for a coordinator to assign it a share of the parameters
+// and proxies and a start time, runs the load with them, and hands its mergeable results back to the coordinator.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// currentAssignment holds the assignment of a worker run; it is nil when not running as a worker
+var currentAssignment *WorkerAssignment
+
+// WorkerAssignment is the share of a distributed run assigned to one worker.
+type WorkerAssignment struct {
+	Parameters []string  `json:"parameters"`
+	Proxies    []string  `json:"proxies"`
+	StartAt    time.Time `json:"start_at"` // Time all workers start sending requests
+}
+
+// WorkerResult is the outcome of a worker run, in a form the coordinator can merge with other workers.
+type WorkerResult struct {
+	Config         RunConfig         `json:"config"`
+	StartTime      time.Time         `json:"start_time"`
+	EndTime        time.Time         `json:"end_time"`
+	Stats          StatsSnapshot     `json:"stats"`
+	Latency        []HistogramBucket `json:"latency"`
+	HealthyProxies int               `json:"healthy_proxies"`
+	ProxiesLoaded  int               `json:"proxies_loaded"`
+	UniqueIPs      []string          `json:"unique_ips"`
+}
+
+// workerState holds the result of a worker run once it is ready.
+// It is safe for concurrent use.
+type workerState struct {
+	mu       sync.Mutex
+	assigned chan *WorkerAssignment
+	result   *WorkerResult
+	fetched  chan struct{}
+}
+
+// worker holds the state of the current worker
+var worker = &workerState{
+	assigned: make(chan *WorkerAssignment, 1),
+	fetched:  make(chan struct{}),
+}
+
+// runWorker runs the worker subcommand with the given arguments and returns the exit code.
+func runWorker(args []string) int {
+	flags := flag.NewFlagSet("worker", flag.ContinueOnError)
+	listen := flags.String("listen", workerListenAddr, "address to accept the coordinator's assignment on")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	// Workers run unattended, so they never take over the terminal
+	*dashboardFlag = false
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/assign", handleWorkerAssign)
+	mux.HandleFunc("/result", handleWorkerResult)
+	go func() {
+		if err := http.ListenAndServe(*listen, mux); err != nil {
+			fmt.Fprintf(os.Stderr, "Worker server failed: %s\n", err)
+			os.Exit(1)
+		}
+	}()
+
+	fmt.Printf("Waiting for an assignment on %s\n", *listen)
+	currentAssignment = <-worker.assigned
+	fmt.Printf("Assigned %d parameters and %d proxies, starting at %s\n",
+		len(currentAssignment.Parameters), len(currentAssignment.Proxies), currentAssignment.StartAt.Format(time.RFC3339Nano))
+
+	code := run()
+
+	// Keep serving until the coordinator has fetched the result
+	select {
+	case <-worker.fetched:
+	case <-time.After(workerResultTimeout):
+		fmt.Printf("The coordinator did not fetch the result within %s\n", workerResultTimeout)
+	}
+
+	return code
+}
+
+// handleWorkerAssign accepts the assignment of the worker. Only the first assignment is accepted.
+func handleWorkerAssign(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var assignment WorkerAssignment
+	if err := json.NewDecoder(r.Body).Decode(&assignment); err != nil {
+		http.Error(w, fmt.Sprintf("malformed assignment: %s", err), http.StatusBadRequest)
+		return
+	}
+	if len(assignment.Parameters) == 0 || (useProxy && len(assignment.Proxies) == 0) {
+		http.Error(w, "assignment without parameters or proxies", http.StatusBadRequest)
+		return
+	}
+
+	select {
+	case worker.assigned <- &assignment:
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		http.Error(w, "already assigned", http.StatusConflict)
+	}
+}
+
+// handleWorkerResult responds with the result of the worker run, or 404 while the run is in progress.
+func handleWorkerResult(w http.ResponseWriter, r *http.Request) {
+	worker.mu.Lock()
+	result := worker.result
+	worker.mu.Unlock()
+
+	if result == nil {
+		http.Error(w, "run in progress", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		slog.Error("Failed to write worker result", "component", componentControl, "error", err)
+		return
+	}
+
+	select {
+	case <-worker.fetched:
+	default:
+		close(worker.fetched)
+	}
+}
+
+// waitForAssignedStart sleeps until the start time of the worker's assignment.
+func waitForAssignedStart() {
+	if wait := time.Until(currentAssignment.StartAt); wait > 0 {
+		time.Sleep(wait)
+	}
+}
+
+// publishWorkerResult makes the result of the worker run available to the coordinator.
+func publishWorkerResult(report RunReport) {
+	result := &WorkerResult{
+		Config:         report.Config,
+		StartTime:      report.StartTime,
+		EndTime:        report.EndTime,
+		Stats:          report.Stats,
+		Latency:        latencies.Buckets(),
+		HealthyProxies: report.HealthyProxies,
+		ProxiesLoaded:  report.ProxiesLoaded,
+	}
+	uniqueIPs.Range(func(key, value interface{}) bool {
+		result.UniqueIPs = append(result.UniqueIPs, key.(string))
+		return true
+	})
+
+	worker.mu.Lock()
+	worker.result = result
+	worker.mu.Unlock()
+}